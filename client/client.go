@@ -0,0 +1,211 @@
+// Paquete client ofrece una API de alto nivel sobre FileSystemService: subidas y descargas por
+// partes desde archivos y io.Writer, reintentos con espera exponencial ante errores transitorios,
+// un conjunto de conexiones reutilizables y errores tipados.
+//
+//	c, err := client.New("localhost:50051", client.Options{Token: os.Getenv("FILEDEPOT_TOKEN")})
+//	if err != nil { ... }
+//	defer c.Close()
+//	resp, err := c.Upload(ctx, "informe.pdf", "documentos")
+//	if errors.Is(err, client.ErrUnauthenticated) { ... }
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Valores por defecto de Options
+const (
+	DefaultPoolSize       = 4
+	DefaultMaxRetries     = 4
+	DefaultInitialBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultTimeout        = 60 * time.Second
+	DefaultPartSize       = 1024 * 1024
+	DefaultMaxMessageSize = 32 * 1024 * 1024
+)
+
+type Options struct {
+	// Token Bearer; vacío si el servidor no exige autenticación
+	Token string
+	// Identidad que el cliente declara (x-caller-id). El servidor la registra en la auditoría solo
+	// como dato sin verificar: la auditoría y los límites identifican al cliente por su token.
+	CallerID string
+	// Configuración TLS; nil para conectarse sin TLS
+	TLS *tls.Config
+	// Conexiones que se abren y se usan por turnos
+	PoolSize int
+	// Reintentos ante errores transitorios; un valor negativo los desactiva
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Tiempo máximo de cada llamada unaria (cada parte, en las subidas) si el contexto no tiene
+	// un plazo propio; un valor negativo no pone límite
+	Timeout time.Duration
+	// Tamaño de cada parte de las subidas
+	PartSize int
+	// Tamaño máximo de los mensajes recibidos
+	MaxMessageSize int
+}
+
+func (o *Options) setDefaults() {
+	if o.PoolSize <= 0 {
+		o.PoolSize = DefaultPoolSize
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = DefaultMaxRetries
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = DefaultInitialBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = DefaultPartSize
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = DefaultMaxMessageSize
+	}
+}
+
+// Cliente de un nodo. Se puede usar desde varias goroutines a la vez.
+type Client struct {
+	opts  Options
+	conns []*grpc.ClientConn
+	next  atomic.Uint64
+}
+
+// Agrega el token y la identidad del cliente a cada llamada
+type callCredentials struct {
+	token    string
+	callerID string
+	secure   bool
+}
+
+func (c callCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := map[string]string{}
+	if c.token != "" {
+		md["authorization"] = "Bearer " + c.token
+	}
+	if c.callerID != "" {
+		md["x-caller-id"] = c.callerID
+	}
+	return md, nil
+}
+
+func (c callCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+// Crea un cliente del nodo en address (host:puerto). Las conexiones se establecen con la primera llamada.
+func New(address string, opts Options) (*Client, error) {
+	opts.setDefaults()
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		creds = credentials.NewTLS(opts.TLS)
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithPerRPCCredentials(callCredentials{token: opts.Token, callerID: opts.CallerID, secure: opts.TLS != nil}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(opts.MaxMessageSize)),
+	}
+
+	c := &Client{opts: opts}
+	for range opts.PoolSize {
+		conn, err := grpc.NewClient(address, dialOpts...)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.conns = append(c.conns, conn)
+	}
+	return c, nil
+}
+
+// Cierra todas las conexiones
+func (c *Client) Close() error {
+	var errs []error
+	for _, conn := range c.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Siguiente conexión del conjunto
+func (c *Client) conn() *grpc.ClientConn {
+	return c.conns[c.next.Add(1)%uint64(len(c.conns))]
+}
+
+// Cliente generado sobre la siguiente conexión, para las RPC que este paquete no envuelve
+func (c *Client) Service() pb.FileSystemServiceClient {
+	return pb.NewFileSystemServiceClient(c.conn())
+}
+
+// Cliente del servicio de administración del nodo
+func (c *Client) Admin() pb.AdminServiceClient {
+	return pb.NewAdminServiceClient(c.conn())
+}
+
+// Indica si vale la pena reintentar. Las operaciones que no se pueden repetir sin efectos solo
+// se reintentan cuando el servidor seguro no las ejecutó.
+func retryable(err error, idempotent bool) bool {
+	switch status.Code(err) {
+	case codes.ResourceExhausted, codes.Unavailable:
+		return true
+	case codes.Aborted, codes.DeadlineExceeded:
+		return idempotent
+	}
+	return false
+}
+
+// Espera exponencial con variación aleatoria, o la que pidió el servidor si es mayor
+func (c *Client) backoff(attempt int, err error) time.Duration {
+	limit := min(c.opts.InitialBackoff<<attempt, c.opts.MaxBackoff)
+	if limit <= 0 {
+		limit = c.opts.MaxBackoff
+	}
+	wait := limit/2 + rand.N(limit/2+1)
+	var e *Error
+	if errors.As(wrapError("", "", err), &e) && e.RetryAfter > wait {
+		wait = e.RetryAfter
+	}
+	return wait
+}
+
+// Ejecuta una llamada unaria con el plazo de Options.Timeout, reintentándola ante errores transitorios
+func retry[T any](ctx context.Context, c *Client, idempotent bool, call func(context.Context) (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if _, ok := ctx.Deadline(); !ok && c.opts.Timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		}
+		resp, err := call(callCtx)
+		cancel()
+		if err == nil || attempt >= c.opts.MaxRetries || !retryable(err, idempotent) || ctx.Err() != nil {
+			return resp, err
+		}
+		timer := time.NewTimer(c.backoff(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Nodo falso en memoria: registra cada llamada y guarda el árbol como entradas de Inventory
+type fakeNode struct {
+	pb.UnimplementedFileSystemServiceServer
+
+	mu      sync.Mutex
+	entries map[string]*pb.InventoryEntry
+	// Métodos llamados, en orden
+	calls []string
+	// Cambios aplicados, como "mkdir a", "delete a" o "upload a/b.txt"
+	ops []string
+	// Errores que devuelven las próximas llamadas a cada método, en orden
+	failures map[string][]error
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		entries:  map[string]*pb.InventoryEntry{"": {IsDir: true}},
+		failures: make(map[string][]error),
+	}
+}
+
+// Registra la llamada y devuelve el error que le toca, si hay alguno
+func (n *fakeNode) call(method string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls = append(n.calls, method)
+	if errs := n.failures[method]; len(errs) > 0 {
+		n.failures[method] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+func (n *fakeNode) fail(method string, errs ...error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures[method] = append(n.failures[method], errs...)
+}
+
+func (n *fakeNode) callCount(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count := 0
+	for _, call := range n.calls {
+		if call == method {
+			count++
+		}
+	}
+	return count
+}
+
+// Agrega un archivo con el contenido y la fecha de modificación indicados
+func (n *fakeNode) putFile(p, content string, modTime time.Time) {
+	sum := sha256.Sum256([]byte(content))
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.entries[p] = &pb.InventoryEntry{Path: p, Size: int64(len(content)), ModTime: modTime.UnixNano(), ChecksumSha256: hex.EncodeToString(sum[:])}
+}
+
+func (n *fakeNode) putDir(p string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.entries[p] = &pb.InventoryEntry{Path: p, IsDir: true}
+}
+
+func (n *fakeNode) Inventory(req *pb.InventoryRequest, stream pb.FileSystemService_InventoryServer) error {
+	if err := n.call("Inventory"); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	var entries []*pb.InventoryEntry
+	for p, entry := range n.entries {
+		if p == req.Path || req.Path == "" || strings.HasPrefix(p, req.Path+"/") {
+			entries = append(entries, entry)
+		}
+	}
+	n.mu.Unlock()
+	if len(entries) == 0 {
+		return status.Errorf(codes.NotFound, "El archivo/directorio no existe")
+	}
+	for _, entry := range entries {
+		if err := stream.Send(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *fakeNode) CreateDirectory(ctx context.Context, req *pb.DirectoryRequest) (*pb.Response, error) {
+	if err := n.call("CreateDirectory"); err != nil {
+		return nil, err
+	}
+	n.putDir(req.Path)
+	n.mu.Lock()
+	n.ops = append(n.ops, "mkdir "+req.Path)
+	n.mu.Unlock()
+	return &pb.Response{Message: "Directorio creado correctamente"}, nil
+}
+
+func (n *fakeNode) DeleteFile(ctx context.Context, req *pb.DeleteRequest) (*pb.Response, error) {
+	if err := n.call("DeleteFile"); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.entries[req.Path]; !ok {
+		return nil, status.Errorf(codes.NotFound, "El archivo/directorio no existe")
+	}
+	for p := range n.entries {
+		if p == req.Path || strings.HasPrefix(p, req.Path+"/") {
+			delete(n.entries, p)
+		}
+	}
+	n.ops = append(n.ops, "delete "+req.Path)
+	return &pb.Response{Message: "Archivo eliminado correctamente"}, nil
+}
+
+// Sin subidas por partes: el cliente sube todo con UploadFile
+func (n *fakeNode) InitiateUpload(ctx context.Context, req *pb.InitiateUploadRequest) (*pb.UploadStatus, error) {
+	if err := n.call("InitiateUpload"); err != nil {
+		return nil, err
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method InitiateUpload not implemented")
+}
+
+func (n *fakeNode) UploadFile(ctx context.Context, req *pb.UploadRequest) (*pb.Response, error) {
+	if err := n.call("UploadFile"); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(req.ContentBase64)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Contenido inválido")
+	}
+	p := path.Join(req.Directory, req.Filename)
+	n.putFile(p, string(data), time.Now())
+	n.mu.Lock()
+	n.ops = append(n.ops, "upload "+p)
+	n.mu.Unlock()
+	return &pb.Response{Message: "Archivo subido correctamente"}, nil
+}
+
+// Árbol del nodo, en orden
+func (n *fakeNode) paths() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var paths []string
+	for p := range n.entries {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Cliente de n servido en un puerto libre de 127.0.0.1, con esperas cortas entre reintentos
+func newTestClient(t *testing.T, n *fakeNode, configure func(*Options)) *Client {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	pb.RegisterFileSystemServiceServer(gs, n)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	opts := Options{PoolSize: 1, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	if configure != nil {
+		configure(&opts)
+	}
+	c, err := New(lis.Addr().String(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRetry(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "no disponible")
+	tests := []struct {
+		name       string
+		maxRetries int
+		method     string
+		failures   []error
+		call       func(*Client) error
+		wantCalls  int
+		wantCode   codes.Code
+	}{
+		{"transitorio", 0, "CreateDirectory", []error{unavailable, status.Error(codes.ResourceExhausted, "límite")},
+			func(c *Client) error { return c.Mkdir(context.Background(), "a") }, 3, codes.OK},
+		{"agota los reintentos", 2, "CreateDirectory", []error{unavailable, unavailable, unavailable, unavailable},
+			func(c *Client) error { return c.Mkdir(context.Background(), "a") }, 3, codes.Unavailable},
+		{"desactivados", -1, "CreateDirectory", []error{unavailable},
+			func(c *Client) error { return c.Mkdir(context.Background(), "a") }, 1, codes.Unavailable},
+		{"no transitorio", 0, "CreateDirectory", []error{status.Error(codes.PermissionDenied, "prohibido")},
+			func(c *Client) error { return c.Mkdir(context.Background(), "a") }, 1, codes.PermissionDenied},
+		// Una subida entera no se repite si el servidor pudo haberla aplicado
+		{"aborted no idempotente", 0, "UploadFile", []error{status.Error(codes.Aborted, "conflicto")},
+			func(c *Client) error {
+				_, err := c.UploadReader(context.Background(), strings.NewReader("hola"), 4, "a.txt", "")
+				return err
+			}, 1, codes.Aborted},
+		{"unavailable no idempotente", 0, "UploadFile", []error{unavailable},
+			func(c *Client) error {
+				_, err := c.UploadReader(context.Background(), strings.NewReader("hola"), 4, "a.txt", "")
+				return err
+			}, 2, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newFakeNode()
+			n.fail(tt.method, tt.failures...)
+			c := newTestClient(t, n, func(o *Options) { o.MaxRetries = tt.maxRetries })
+			err := tt.call(c)
+			if calls := n.callCount(tt.method); calls != tt.wantCalls {
+				t.Fatalf("%d llamadas a %s, se esperaban %d", calls, tt.method, tt.wantCalls)
+			}
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("se esperaba %s, se obtuvo %v", tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{opts: Options{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}}
+	unavailable := status.Error(codes.Unavailable, "no disponible")
+	for attempt, limit := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for range 20 {
+			if wait := c.backoff(attempt, unavailable); wait < limit/2 || wait > limit {
+				t.Fatalf("intento %d: espera %s fuera de [%s, %s]", attempt, wait, limit/2, limit)
+			}
+		}
+	}
+	// Con muchos intentos el desplazamiento desborda y se usa el máximo
+	if wait := c.backoff(70, unavailable); wait < 500*time.Millisecond || wait > time.Second {
+		t.Fatalf("espera %s tras desbordar", wait)
+	}
+
+	// La espera que pide el servidor se respeta si es mayor
+	st, err := status.New(codes.ResourceExhausted, "límite").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(5 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait := c.backoff(0, st.Err()); wait != 5*time.Second {
+		t.Fatalf("espera %s, el servidor pidió 5s", wait)
+	}
+
+	// Cancelar el contexto corta la espera
+	n := newFakeNode()
+	n.fail("CreateDirectory", st.Err())
+	slow := newTestClient(t, n, func(o *Options) { o.InitialBackoff, o.MaxBackoff = time.Hour, time.Hour })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := slow.Mkdir(ctx, "a"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("se esperaba ErrRateLimited, se obtuvo %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("la espera siguió %s después de cancelar el contexto", elapsed)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	for code, want := range map[codes.Code]error{
+		codes.NotFound:           ErrNotFound,
+		codes.AlreadyExists:      ErrAlreadyExists,
+		codes.InvalidArgument:    ErrInvalidArgument,
+		codes.OutOfRange:         ErrInvalidArgument,
+		codes.Unauthenticated:    ErrUnauthenticated,
+		codes.PermissionDenied:   ErrPermissionDenied,
+		codes.ResourceExhausted:  ErrRateLimited,
+		codes.Unavailable:        ErrUnavailable,
+		codes.FailedPrecondition: ErrFailedPrecondition,
+		codes.DataLoss:           ErrChecksumMismatch,
+	} {
+		err := wrapError("op", "a.txt", status.Error(code, "mensaje"))
+		if !errors.Is(err, want) {
+			t.Fatalf("%s: %v no es %v", code, err, want)
+		}
+		if status.Code(err) != code {
+			t.Fatalf("%s: status.Code devolvió %s", code, status.Code(err))
+		}
+	}
+	if err := wrapError("op", "", status.Error(codes.Internal, "mensaje")); errors.Unwrap(err) != nil {
+		t.Fatalf("Internal no debe corresponder a ningún error: %v", errors.Unwrap(err))
+	}
+
+	// Una escritura aplicada sin quórum trae la respuesta en los detalles
+	applied := &pb.Response{Message: "Archivo subido correctamente"}
+	st, err := status.New(codes.FailedPrecondition, "quórum no alcanzado").WithDetails(applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrapError("upload", "a.txt", st.Err())
+	var e *Error
+	if !errors.Is(err, ErrQuorumNotReached) || !errors.As(err, &e) || e.Response.GetMessage() != applied.Message {
+		t.Fatalf("quórum: %v", err)
+	}
+	if details := status.Convert(err).Details(); len(details) != 1 {
+		t.Fatalf("GRPCStatus perdió los detalles: %v", details)
+	}
+
+	// Errores de las llamadas, con la operación y la ruta
+	n := newFakeNode()
+	c := newTestClient(t, n, nil)
+	err = c.Delete(context.Background(), "nada")
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &e) || e.Op != "delete" || e.Path != "nada" {
+		t.Fatalf("borrar una ruta inexistente: %v", err)
+	}
+	if err := c.Delete(context.Background(), ""); !errors.Is(err, ErrInvalidArgument) || n.callCount("DeleteFile") != 1 {
+		t.Fatalf("borrar la raíz: %v", err)
+	}
+	n.putFile("a.txt", "hola", time.Now())
+	if err := c.Delete(context.Background(), "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+
+	"filesystem/delta"
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Operaciones de delta por mensaje, además del límite de Options.PartSize bytes literales
+const maxDeltaOps = 4096
+
+// Resultado de UploadDelta
+type DeltaResult struct {
+	Response *pb.Response
+	// Bytes enviados tal cual y bytes que el nodo copió de su versión del archivo
+	LiteralBytes int64
+	CopiedBytes  int64
+	// Se subió el archivo completo porque no existía en el nodo, el nodo no admite deltas o su
+	// versión tiene demasiados bloques para firmarla
+	Full bool
+}
+
+// Actualiza remotePath con el archivo local localPath enviando solo los bloques que cambiaron,
+// como rsync: el nodo devuelve las firmas de los bloques de su versión y el cliente envía
+// instrucciones para copiarlos junto con los datos nuevos. El nodo verifica el checksum del
+// resultado antes de reemplazar el archivo. Si remotePath no existe se sube completo.
+func (c *Client) UploadDelta(ctx context.Context, localPath, remotePath string) (*DeltaResult, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, newError("delta", localPath, codes.InvalidArgument, "no es un archivo regular")
+	}
+
+	sig, err := retry(ctx, c, true, func(ctx context.Context) (*pb.FileSignatureResponse, error) {
+		return c.Service().FileSignature(ctx, &pb.FileSignatureRequest{Path: remotePath})
+	})
+	if code := status.Code(err); code == codes.NotFound || code == codes.Unimplemented || code == codes.OutOfRange {
+		dir := path.Dir(remotePath)
+		if dir == "." {
+			dir = ""
+		}
+		resp, err := c.UploadReader(ctx, f, info.Size(), path.Base(remotePath), dir)
+		if err != nil {
+			return nil, err
+		}
+		return &DeltaResult{Response: resp, LiteralBytes: info.Size(), Full: true}, nil
+	}
+	if err != nil {
+		return nil, wrapError("delta", remotePath, err)
+	}
+
+	checksum, err := fileSHA256(localPath)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.sendDelta(ctx, f, sig, &pb.DeltaHeader{
+		Path:               remotePath,
+		BaseChecksumSha256: sig.ChecksumSha256,
+		BlockSize:          sig.BlockSize,
+		Size:               info.Size(),
+		ChecksumSha256:     checksum,
+	})
+	return result, wrapError("delta", remotePath, err)
+}
+
+func (c *Client) sendDelta(ctx context.Context, r io.Reader, sig *pb.FileSignatureResponse, header *pb.DeltaHeader) (*DeltaResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.Service().ApplyDelta(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]delta.Block, len(sig.Blocks))
+	for i, b := range sig.Blocks {
+		blocks[i] = delta.Block{Weak: b.Weak, Strong: b.Strong}
+	}
+	idx := delta.NewIndex(blocks, int(sig.BlockSize), sig.Size)
+
+	result := &DeltaResult{}
+	chunk := &pb.DeltaChunk{Header: header}
+	var chunkBytes int
+	send := func() error {
+		err := stream.Send(chunk)
+		chunk, chunkBytes = &pb.DeltaChunk{}, 0
+		return err
+	}
+	err = delta.Diff(r, idx, c.opts.PartSize, func(op delta.Op) error {
+		if len(chunk.Ops) >= maxDeltaOps || (chunkBytes > 0 && chunkBytes+len(op.Data) > c.opts.PartSize) {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		if op.Count > 0 {
+			chunk.Ops = append(chunk.Ops, &pb.DeltaOp{Op: &pb.DeltaOp_Copy{Copy: &pb.BlockRange{Index: op.Index, Count: op.Count}}})
+			result.CopiedBytes += min(sig.Size, (op.Index+op.Count)*int64(sig.BlockSize)) - op.Index*int64(sig.BlockSize)
+			return nil
+		}
+		chunk.Ops = append(chunk.Ops, &pb.DeltaOp{Op: &pb.DeltaOp_Data{Data: op.Data}})
+		chunkBytes += len(op.Data)
+		result.LiteralBytes += int64(len(op.Data))
+		return nil
+	})
+	if err == nil && (chunk.Header != nil || len(chunk.Ops) > 0) {
+		err = send()
+	}
+	// io.EOF significa que el nodo ya respondió; el motivo llega con CloseAndRecv
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if result.Response, err = stream.CloseAndRecv(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
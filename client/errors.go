@@ -0,0 +1,115 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errores con los que se puede comparar con errors.Is
+var (
+	ErrNotFound           = errors.New("no existe")
+	ErrAlreadyExists      = errors.New("ya existe")
+	ErrInvalidArgument    = errors.New("argumento inválido")
+	ErrUnauthenticated    = errors.New("no autenticado")
+	ErrPermissionDenied   = errors.New("permiso denegado")
+	ErrRateLimited        = errors.New("límite de peticiones excedido")
+	ErrUnavailable        = errors.New("servidor no disponible")
+	ErrFailedPrecondition = errors.New("condición previa no cumplida")
+	ErrChecksumMismatch   = errors.New("el checksum no coincide")
+	ErrQuorumNotReached   = errors.New("quórum de escritura no alcanzado")
+)
+
+// Error de una operación del servidor
+type Error struct {
+	Op   string
+	Path string
+	Code codes.Code
+	// Mensaje del servidor
+	Message string
+	// Tiempo que pidió esperar el servidor antes de reintentar, si lo indicó
+	RetryAfter time.Duration
+	// Respuesta de una escritura que se aplicó aunque la operación falló, por ejemplo
+	// cuando no se alcanzó el quórum de réplicas
+	Response *pb.Response
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", e.Op, e.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Op, e.Path, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	if e.Code == codes.FailedPrecondition && e.Response != nil {
+		return ErrQuorumNotReached
+	}
+	switch e.Code {
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.AlreadyExists:
+		return ErrAlreadyExists
+	case codes.InvalidArgument, codes.OutOfRange:
+		return ErrInvalidArgument
+	case codes.Unauthenticated:
+		return ErrUnauthenticated
+	case codes.PermissionDenied:
+		return ErrPermissionDenied
+	case codes.ResourceExhausted:
+		return ErrRateLimited
+	case codes.Unavailable:
+		return ErrUnavailable
+	case codes.FailedPrecondition:
+		return ErrFailedPrecondition
+	case codes.DataLoss:
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// Permite obtener el estado original con status.FromError
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Code, e.Message)
+	if e.Response != nil {
+		if detailed, err := st.WithDetails(e.Response); err == nil {
+			return detailed
+		}
+	}
+	return st
+}
+
+// Convierte el error de una RPC en un *Error; los demás errores se devuelven sin cambios
+func wrapError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	wrapped := &Error{Op: op, Path: path, Code: st.Code(), Message: st.Message()}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.RetryInfo:
+			wrapped.RetryAfter = detail.GetRetryDelay().AsDuration()
+		case *pb.Response:
+			wrapped.Response = detail
+		}
+	}
+	return wrapped
+}
+
+func newError(op, path string, code codes.Code, message string) error {
+	return &Error{Op: op, Path: path, Code: code, Message: message}
+}
@@ -0,0 +1,374 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tiempo para cancelar una sesión de subida fallida aunque el contexto ya se haya cancelado
+const abortTimeout = 10 * time.Second
+
+// Sube el archivo local localPath al directorio remoteDir ("" para la raíz), por partes y
+// verificando el checksum. Cada parte se reintenta por separado. Con servidores que no tienen
+// subidas por partes se envía en una sola llamada.
+func (c *Client) Upload(ctx context.Context, localPath, remoteDir string) (*pb.Response, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, newError("upload", localPath, codes.InvalidArgument, "no es un archivo regular")
+	}
+	return c.UploadReader(ctx, f, info.Size(), filepath.Base(localPath), remoteDir)
+}
+
+// Sube size bytes de r como remoteDir/name. Si r es un io.ReaderAt (un archivo, por ejemplo),
+// el checksum se calcula antes de subir y el servidor lo verifica desde el principio.
+func (c *Client) UploadReader(ctx context.Context, r io.Reader, size int64, name, remoteDir string) (*pb.Response, error) {
+	remotePath := strings.TrimPrefix(remoteDir+"/"+name, "/")
+	svc := c.Service()
+
+	var checksum string
+	readerAt, seekable := r.(io.ReaderAt)
+	if seekable {
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, io.NewSectionReader(readerAt, 0, size)); err != nil {
+			return nil, err
+		}
+		checksum = hex.EncodeToString(hasher.Sum(nil))
+		r = io.NewSectionReader(readerAt, 0, size)
+	}
+
+	session, err := retry(ctx, c, true, func(ctx context.Context) (*pb.UploadStatus, error) {
+		return svc.InitiateUpload(ctx, &pb.InitiateUploadRequest{Filename: name, Directory: remoteDir, TotalSize: size, ChecksumSha256: checksum})
+	})
+	if status.Code(err) == codes.Unimplemented {
+		return c.uploadWhole(ctx, r, name, remoteDir)
+	}
+	if err != nil {
+		return nil, wrapError("upload", remotePath, err)
+	}
+
+	resp, err := c.uploadParts(ctx, svc, session.SessionId, r, size)
+	if err != nil {
+		// La sesión expiraría sola, pero así no ocupa espacio en el servidor
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+		svc.AbortUpload(abortCtx, &pb.UploadSessionRequest{SessionId: session.SessionId})
+		cancel()
+		return nil, wrapError("upload", remotePath, err)
+	}
+	return resp, nil
+}
+
+func (c *Client) uploadParts(ctx context.Context, svc pb.FileSystemServiceClient, sessionID string, r io.Reader, size int64) (*pb.Response, error) {
+	hasher := sha256.New()
+	buf := make([]byte, c.opts.PartSize)
+	var offset int64
+	for offset < size {
+		n, err := io.ReadFull(r, buf[:min(int64(len(buf)), size-offset)])
+		if err != nil {
+			return nil, err
+		}
+		hasher.Write(buf[:n])
+		// Repetir una parte no tiene efectos adicionales
+		_, err = retry(ctx, c, true, func(ctx context.Context) (*pb.UploadStatus, error) {
+			return svc.UploadPart(ctx, &pb.UploadPartRequest{SessionId: sessionID, Offset: offset, Content: buf[:n]})
+		})
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(n)
+	}
+	return retry(ctx, c, false, func(ctx context.Context) (*pb.Response, error) {
+		return svc.CompleteUpload(ctx, &pb.CompleteUploadRequest{SessionId: sessionID, ChecksumSha256: hex.EncodeToString(hasher.Sum(nil))})
+	})
+}
+
+// Subida en una sola llamada, para servidores sin subidas por partes
+func (c *Client) uploadWhole(ctx context.Context, r io.Reader, name, remoteDir string) (*pb.Response, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	req := &pb.UploadRequest{Filename: name, Directory: remoteDir, ContentBase64: base64.StdEncoding.EncodeToString(data)}
+	resp, err := retry(ctx, c, false, func(ctx context.Context) (*pb.Response, error) {
+		return c.Service().UploadFile(ctx, req)
+	})
+	return resp, wrapError("upload", strings.TrimPrefix(remoteDir+"/"+name, "/"), err)
+}
+
+// Cuenta lo escrito, para saber si una descarga se puede reintentar
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Descarga remotePath en w y devuelve los bytes escritos. El contenido llega por partes y se
+// verifica con su checksum; si el servidor no lo permite, se descarga en una sola llamada.
+// Solo se reintenta mientras no se haya escrito nada en w.
+func (c *Client) Download(ctx context.Context, remotePath string, w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	for attempt := 0; ; attempt++ {
+		err := c.pull(ctx, remotePath, cw)
+		if status.Code(err) == codes.Unimplemented && cw.n == 0 {
+			err = c.downloadWhole(ctx, remotePath, cw)
+		}
+		if err == nil || cw.n > 0 || attempt >= c.opts.MaxRetries || !retryable(err, true) || ctx.Err() != nil {
+			return cw.n, wrapError("download", remotePath, err)
+		}
+		timer := time.NewTimer(c.backoff(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return cw.n, wrapError("download", remotePath, err)
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) pull(ctx context.Context, remotePath string, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.Service().PullFile(ctx, &pb.PullFileRequest{Path: remotePath})
+	if err != nil {
+		return err
+	}
+	var meta *pb.ReplicaMetadata
+	hasher := sha256.New()
+	var received int64
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if meta == nil {
+			if meta = chunk.Metadata; meta == nil {
+				return status.Errorf(codes.Internal, "la respuesta no tiene metadatos")
+			}
+		}
+		received += int64(len(chunk.Data))
+		if received > meta.Size {
+			return status.Errorf(codes.DataLoss, "se recibieron más de %d bytes", meta.Size)
+		}
+		hasher.Write(chunk.Data)
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+	if meta == nil {
+		return status.Errorf(codes.Internal, "la respuesta está vacía")
+	}
+	if received != meta.Size || !strings.EqualFold(hex.EncodeToString(hasher.Sum(nil)), meta.ChecksumSha256) {
+		return status.Errorf(codes.DataLoss, "el contenido recibido no coincide con el checksum")
+	}
+	return nil
+}
+
+// Descarga hasta length bytes de remotePath a partir de offset (length 0: hasta el final) y
+// devuelve también el tamaño total del archivo. Los rangos no se verifican con el checksum.
+func (c *Client) DownloadRange(ctx context.Context, remotePath string, offset, length int64) ([]byte, int64, error) {
+	type result struct {
+		data []byte
+		size int64
+	}
+	res, err := retry(ctx, c, true, func(ctx context.Context) (result, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, err := c.Service().PullFile(ctx, &pb.PullFileRequest{Path: remotePath, Offset: offset, Length: length})
+		if err != nil {
+			return result{}, err
+		}
+		var res result
+		want := int64(-1)
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return result{}, err
+			}
+			if want < 0 {
+				if chunk.Metadata == nil {
+					return result{}, status.Errorf(codes.Internal, "la respuesta no tiene metadatos")
+				}
+				res.size = chunk.Metadata.Size
+				want = res.size - offset
+				if length > 0 {
+					want = min(want, length)
+				}
+				res.data = make([]byte, 0, max(want, 0))
+			}
+			res.data = append(res.data, chunk.Data...)
+			if int64(len(res.data)) > want {
+				return result{}, status.Errorf(codes.DataLoss, "se recibieron más de %d bytes", want)
+			}
+		}
+		if int64(len(res.data)) != want {
+			return result{}, status.Errorf(codes.DataLoss, "se recibieron %d bytes de %d", len(res.data), want)
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, 0, wrapError("download", remotePath, err)
+	}
+	return res.data, res.size, nil
+}
+
+func (c *Client) downloadWhole(ctx context.Context, remotePath string, w io.Writer) error {
+	resp, err := retry(ctx, c, true, func(ctx context.Context) (*pb.DownloadResponse, error) {
+		return c.Service().DownloadFile(ctx, &pb.DownloadRequest{Path: remotePath})
+	})
+	if err != nil {
+		return err
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.ContentBase64)
+	if err != nil {
+		return status.Errorf(codes.Internal, "contenido inválido: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Contenido de un directorio
+type Listing struct {
+	Files       []string
+	Directories []string
+}
+
+// Lista el directorio remoteDir ("" para la raíz)
+func (c *Client) List(ctx context.Context, remoteDir string) (*Listing, error) {
+	resp, err := retry(ctx, c, true, func(ctx context.Context) (*pb.ListAllResponse, error) {
+		return c.Service().ListAll(ctx, &pb.DirectoryRequest{Path: remoteDir})
+	})
+	if err != nil {
+		return nil, wrapError("list", remoteDir, err)
+	}
+	return &Listing{Files: resp.Files, Directories: resp.Directories}, nil
+}
+
+// Metadatos de un archivo o directorio
+func (c *Client) Stat(ctx context.Context, remotePath string) (*pb.StatResponse, error) {
+	resp, err := retry(ctx, c, true, func(ctx context.Context) (*pb.StatResponse, error) {
+		return c.Service().StatFile(ctx, &pb.StatRequest{Path: remotePath})
+	})
+	return resp, wrapError("stat", remotePath, err)
+}
+
+// Mueve un archivo o directorio
+func (c *Client) Move(ctx context.Context, source, destination string) error {
+	_, err := retry(ctx, c, false, func(ctx context.Context) (*pb.Response, error) {
+		return c.Service().MoveFile(ctx, &pb.MoveRequest{SourcePath: source, DestinationPath: destination})
+	})
+	return wrapError("move", source, err)
+}
+
+// Cambia el nombre de un archivo o directorio; las dos rutas son completas
+func (c *Client) Rename(ctx context.Context, oldPath, newPath string) error {
+	_, err := retry(ctx, c, false, func(ctx context.Context) (*pb.Response, error) {
+		return c.Service().RenameFile(ctx, &pb.RenameRequest{OldName: oldPath, NewName: newPath})
+	})
+	return wrapError("rename", oldPath, err)
+}
+
+// Elimina un archivo o un directorio con todo su contenido
+func (c *Client) Delete(ctx context.Context, remotePath string) error {
+	if remotePath == "" {
+		return newError("delete", remotePath, codes.InvalidArgument, "la ruta no puede estar vacía")
+	}
+	_, err := retry(ctx, c, true, func(ctx context.Context) (*pb.Response, error) {
+		return c.Service().DeleteFile(ctx, &pb.DeleteRequest{Path: remotePath})
+	})
+	return wrapError("delete", remotePath, err)
+}
+
+// Crea un directorio y los que falten en su ruta
+func (c *Client) Mkdir(ctx context.Context, remotePath string) error {
+	if remotePath == "" {
+		return newError("mkdir", remotePath, codes.InvalidArgument, "la ruta no puede estar vacía")
+	}
+	_, err := retry(ctx, c, true, func(ctx context.Context) (*pb.Response, error) {
+		return c.Service().CreateDirectory(ctx, &pb.DirectoryRequest{Path: remotePath})
+	})
+	return wrapError("mkdir", remotePath, err)
+}
+
+// Qué se empaqueta con DownloadArchive
+type ArchiveOptions struct {
+	// Archivos o directorios del nodo; vacío para todo el almacenamiento
+	Paths []string
+	// "zip" (por defecto) o "tar.gz"
+	Format string
+	// Globs sobre la ruta de cada archivo; un patrón sin "/" se compara también con el nombre
+	Include []string
+	Exclude []string
+	// Máximo de bytes de contenido; 0 para el límite del nodo
+	MaxSize int64
+}
+
+// Descarga en w los archivos pedidos empaquetados en zip o tar.gz. Como Download, solo se
+// reintenta mientras no se haya escrito nada en w.
+func (c *Client) DownloadArchive(ctx context.Context, w io.Writer, opts ArchiveOptions) (int64, error) {
+	cw := &countingWriter{w: w}
+	req := &pb.ArchiveRequest{Paths: opts.Paths, Format: opts.Format, Include: opts.Include, Exclude: opts.Exclude, MaxSize: opts.MaxSize}
+	for attempt := 0; ; attempt++ {
+		err := c.downloadArchive(ctx, req, cw)
+		if err == nil || cw.n > 0 || attempt >= c.opts.MaxRetries || !retryable(err, true) || ctx.Err() != nil {
+			return cw.n, wrapError("archive", strings.Join(opts.Paths, ","), err)
+		}
+		timer := time.NewTimer(c.backoff(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return cw.n, wrapError("archive", strings.Join(opts.Paths, ","), err)
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) downloadArchive(ctx context.Context, req *pb.ArchiveRequest, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.Service().DownloadArchive(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+
+	pb "filesystem/proto/filesystem"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Estado del nodo según el servicio de salud estándar de gRPC (SERVING, NOT_SERVING...)
+func (c *Client) Health(ctx context.Context) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	resp, err := retry(ctx, c, true, func(ctx context.Context) (*healthpb.HealthCheckResponse, error) {
+		return healthpb.NewHealthClient(c.conn()).Check(ctx, &healthpb.HealthCheckRequest{})
+	})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, wrapError("health", "", err)
+	}
+	return resp.Status, nil
+}
+
+// Estadísticas del almacenamiento del nodo
+func (c *Client) StorageStats(ctx context.Context) (*pb.StorageStatsResponse, error) {
+	resp, err := retry(ctx, c, true, func(ctx context.Context) (*pb.StorageStatsResponse, error) {
+		return c.Service().StorageStats(ctx, &pb.StorageStatsRequest{})
+	})
+	return resp, wrapError("stats", "", err)
+}
+
+// Estado de la verificación de integridad del nodo
+func (c *Client) ScrubStatus(ctx context.Context) (*pb.ScrubStatusResponse, error) {
+	resp, err := retry(ctx, c, true, func(ctx context.Context) (*pb.ScrubStatusResponse, error) {
+		return c.Admin().ScrubStatus(ctx, &pb.ScrubStatusRequest{})
+	})
+	return resp, wrapError("scrub", "", err)
+}
@@ -0,0 +1,302 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Opciones de Sync
+type SyncOptions struct {
+	// Borrar del nodo los archivos y directorios que no están en la carpeta local
+	Delete bool
+	// Calcular las acciones sin ejecutarlas
+	DryRun bool
+	// Comparar siempre el contenido, aunque el archivo local no sea más reciente que el del nodo.
+	// Conviene si el reloj de la máquina local no está sincronizado con el del nodo.
+	Checksum bool
+	// Se llama antes de ejecutar cada acción (o en lugar de ejecutarla, con DryRun)
+	OnAction func(SyncAction)
+}
+
+// Operaciones de una sincronización
+const (
+	SyncUpload = "upload"
+	SyncMkdir  = "mkdir"
+	SyncDelete = "delete"
+)
+
+// Motivos de una subida
+const (
+	SyncReasonNew     = "nuevo"
+	SyncReasonSize    = "tamaño"
+	SyncReasonContent = "contenido"
+)
+
+// Cambio que hace una sincronización en el nodo
+type SyncAction struct {
+	Op string `json:"op"`
+	// Ruta en el nodo
+	Path string `json:"path"`
+	// Archivo local, en las subidas
+	LocalPath string `json:"local_path,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Resultado de una sincronización
+type SyncResult struct {
+	Actions       []SyncAction `json:"actions"`
+	Unchanged     int          `json:"unchanged"`
+	BytesUploaded int64        `json:"bytes_uploaded"`
+}
+
+// Archivo o directorio de la carpeta local
+type localEntry struct {
+	path    string
+	isDir   bool
+	size    int64
+	modTime int64
+}
+
+// Deja remoteDir igual que la carpeta local localDir: sube los archivos nuevos o modificados,
+// crea los directorios vacíos y, con Delete, borra lo que sobra. Un archivo se considera igual
+// al del nodo si tiene el mismo tamaño y no se modificó después de subirlo; si se modificó, se
+// compara su checksum antes de volver a subirlo. Los enlaces simbólicos y demás archivos
+// especiales se ignoran.
+func (c *Client) Sync(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncResult, error) {
+	remoteDir = strings.Trim(remoteDir, "/")
+	local, err := walkLocal(localDir)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := c.inventory(ctx, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	if root, ok := remote[remoteDir]; ok && !root.IsDir {
+		return nil, newError("sync", remoteDir, codes.FailedPrecondition, "en el nodo es un archivo, no un directorio")
+	}
+
+	result := &SyncResult{}
+	if _, ok := remote[remoteDir]; !ok && remoteDir != "" {
+		if err := c.syncApply(ctx, SyncAction{Op: SyncMkdir, Path: remoteDir}, opts, result); err != nil {
+			return result, err
+		}
+	}
+	// El orden de la carpeta local hace que los directorios se creen antes que su contenido
+	for _, entry := range local {
+		remotePath := path.Join(remoteDir, entry.path)
+		existing, exists := remote[remotePath]
+		if exists && existing.IsDir != entry.isDir {
+			// Un archivo que pasó a ser directorio, o al revés, hay que borrarlo primero
+			if !opts.Delete {
+				kind := "un archivo"
+				if existing.IsDir {
+					kind = "un directorio"
+				}
+				return result, newError("sync", remotePath, codes.FailedPrecondition, "en el nodo es "+kind+"; se necesita Delete para reemplazarlo")
+			}
+			if err := c.syncDelete(ctx, remotePath, remote, opts, result); err != nil {
+				return result, err
+			}
+			exists = false
+		}
+
+		if entry.isDir {
+			if !exists {
+				action := SyncAction{Op: SyncMkdir, Path: remotePath}
+				if err := c.syncApply(ctx, action, opts, result); err != nil {
+					return result, err
+				}
+			}
+			continue
+		}
+
+		localPath := filepath.Join(localDir, filepath.FromSlash(entry.path))
+		reason, err := uploadReason(entry, localPath, existing, exists, opts.Checksum)
+		if err != nil {
+			return result, err
+		}
+		if reason == "" {
+			result.Unchanged++
+			continue
+		}
+		action := SyncAction{Op: SyncUpload, Path: remotePath, LocalPath: localPath, Size: entry.size, Reason: reason}
+		if err := c.syncApply(ctx, action, opts, result); err != nil {
+			return result, err
+		}
+	}
+
+	if opts.Delete {
+		wanted := make(map[string]bool, len(local))
+		for _, entry := range local {
+			wanted[path.Join(remoteDir, entry.path)] = true
+		}
+		var extra []string
+		for remotePath := range remote {
+			if remotePath != remoteDir && !wanted[remotePath] {
+				extra = append(extra, remotePath)
+			}
+		}
+		sort.Strings(extra)
+		for _, remotePath := range extra {
+			// Ya se borró junto con un directorio anterior
+			if _, ok := remote[remotePath]; !ok {
+				continue
+			}
+			if err := c.syncDelete(ctx, remotePath, remote, opts, result); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// Motivo para subir un archivo, o "" si el del nodo ya es igual
+func uploadReason(entry localEntry, localPath string, existing *pb.InventoryEntry, exists, checksum bool) (string, error) {
+	switch {
+	case !exists:
+		return SyncReasonNew, nil
+	case existing.Size != entry.size:
+		return SyncReasonSize, nil
+	case !checksum && entry.modTime <= existing.ModTime:
+		return "", nil
+	}
+	sum, err := fileSHA256(localPath)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(sum, existing.ChecksumSha256) {
+		return SyncReasonContent, nil
+	}
+	return "", nil
+}
+
+// Borra remotePath y olvida todo lo que había debajo
+func (c *Client) syncDelete(ctx context.Context, remotePath string, remote map[string]*pb.InventoryEntry, opts SyncOptions, result *SyncResult) error {
+	if err := c.syncApply(ctx, SyncAction{Op: SyncDelete, Path: remotePath}, opts, result); err != nil {
+		return err
+	}
+	for p := range remote {
+		if p == remotePath || strings.HasPrefix(p, remotePath+"/") {
+			delete(remote, p)
+		}
+	}
+	return nil
+}
+
+func (c *Client) syncApply(ctx context.Context, action SyncAction, opts SyncOptions, result *SyncResult) error {
+	if opts.OnAction != nil {
+		opts.OnAction(action)
+	}
+	result.Actions = append(result.Actions, action)
+	if opts.DryRun {
+		return nil
+	}
+	switch action.Op {
+	case SyncMkdir:
+		return c.Mkdir(ctx, action.Path)
+	case SyncDelete:
+		return c.Delete(ctx, action.Path)
+	}
+	dir := path.Dir(action.Path)
+	if dir == "." {
+		dir = ""
+	}
+	f, err := os.Open(action.LocalPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := c.UploadReader(ctx, f, action.Size, path.Base(action.Path), dir); err != nil {
+		return err
+	}
+	result.BytesUploaded += action.Size
+	return nil
+}
+
+// Contenido de la carpeta local con rutas relativas separadas por "/", en orden
+func walkLocal(root string) ([]localEntry, error) {
+	var entries []localEntry
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			if !d.IsDir() {
+				return newError("sync", root, codes.InvalidArgument, "no es un directorio")
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, localEntry{
+			path:    filepath.ToSlash(rel),
+			isDir:   d.IsDir(),
+			size:    info.Size(),
+			modTime: info.ModTime().UnixNano(),
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// Archivos y directorios del nodo bajo remoteDir, por ruta; vacío si remoteDir no existe
+func (c *Client) inventory(ctx context.Context, remoteDir string) (map[string]*pb.InventoryEntry, error) {
+	entries := make(map[string]*pb.InventoryEntry)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.Service().Inventory(ctx, &pb.InventoryRequest{Path: remoteDir, IncludeDirectories: true})
+	if err != nil {
+		return nil, wrapError("inventory", remoteDir, err)
+	}
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			return entries, nil
+		}
+		err = wrapError("inventory", remoteDir, err)
+		if errors.Is(err, ErrNotFound) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries[entry.Path] = entry
+	}
+}
+
+func fileSHA256(localPath string) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Escribe los archivos en root con la fecha de modificación indicada; un nombre terminado en
+// "/" es un directorio vacío
+func writeLocal(t *testing.T, root string, modTime time.Time, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		localPath := filepath.Join(root, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(localPath, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(localPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertOps(t *testing.T, n *fakeNode, want ...string) {
+	t.Helper()
+	n.mu.Lock()
+	got := slices.Clone(n.ops)
+	n.mu.Unlock()
+	if !slices.Equal(got, want) {
+		t.Fatalf("cambios en el nodo: %q, se esperaba %q", got, want)
+	}
+}
+
+// Nodo con un archivo de cada caso de decisión y la carpeta local que lo sincroniza
+func newSyncFixture(t *testing.T) (*fakeNode, string) {
+	uploaded := time.Now().Add(-time.Hour)
+	n := newFakeNode()
+	n.putDir("destino")
+	n.putFile("destino/tamaño.txt", "corto", uploaded)
+	n.putFile("destino/contenido.txt", "versión 1", uploaded)
+	n.putFile("destino/igual.txt", "sin cambios", uploaded)
+	n.putFile("destino/tocado.txt", "mismo texto", uploaded)
+	n.putFile("destino/viejo.txt", "versión 1", uploaded)
+
+	local := t.TempDir()
+	writeLocal(t, local, uploaded.Add(time.Minute), map[string]string{
+		"nuevo.txt":     "recién creado",
+		"tamaño.txt":    "bastante más largo",
+		"contenido.txt": "versión 2",
+		"tocado.txt":    "mismo texto",
+		"vacío/":        "",
+	})
+	// Sin modificar desde la subida: no se compara el contenido
+	writeLocal(t, local, uploaded.Add(-time.Minute), map[string]string{
+		"igual.txt": "sin cambios",
+		"viejo.txt": "versión 2",
+	})
+	return n, local
+}
+
+func TestSyncDecisions(t *testing.T) {
+	n, local := newSyncFixture(t)
+	c := newTestClient(t, n, nil)
+	result, err := c.Sync(context.Background(), local, "destino", SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SyncAction{
+		{Op: SyncUpload, Path: "destino/contenido.txt", Reason: SyncReasonContent, Size: 10},
+		{Op: SyncUpload, Path: "destino/nuevo.txt", Reason: SyncReasonNew, Size: 14},
+		{Op: SyncUpload, Path: "destino/tamaño.txt", Reason: SyncReasonSize, Size: 19},
+		{Op: SyncMkdir, Path: "destino/vacío"},
+	}
+	if len(result.Actions) != len(want) {
+		t.Fatalf("acciones: %+v", result.Actions)
+	}
+	var bytes int64
+	for i, action := range result.Actions {
+		action.LocalPath = ""
+		if action != want[i] {
+			t.Fatalf("acción %d: %+v, se esperaba %+v", i, action, want[i])
+		}
+		bytes += action.Size
+	}
+	// igual.txt y viejo.txt no cambiaron desde la subida; tocado.txt sí, pero tiene el mismo contenido
+	if result.Unchanged != 3 || result.BytesUploaded != bytes {
+		t.Fatalf("%d sin cambios y %d bytes subidos", result.Unchanged, result.BytesUploaded)
+	}
+	assertOps(t, n, "upload destino/contenido.txt", "upload destino/nuevo.txt", "upload destino/tamaño.txt", "mkdir destino/vacío")
+
+	// Con Checksum se compara también lo que no se modificó después de subirlo
+	n.ops = nil
+	result, err = c.Sync(context.Background(), local, "destino", SyncOptions{Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Path != "destino/viejo.txt" || result.Actions[0].Reason != SyncReasonContent {
+		t.Fatalf("acciones con Checksum: %+v", result.Actions)
+	}
+	assertOps(t, n, "upload destino/viejo.txt")
+}
+
+func TestSyncCreatesRemoteDir(t *testing.T) {
+	n := newFakeNode()
+	local := t.TempDir()
+	writeLocal(t, local, time.Now(), map[string]string{"a.txt": "hola"})
+	c := newTestClient(t, n, nil)
+	if _, err := c.Sync(context.Background(), local, "/nuevo/", SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assertOps(t, n, "mkdir nuevo", "upload nuevo/a.txt")
+}
+
+func TestSyncReplaceKind(t *testing.T) {
+	newFixture := func() (*fakeNode, string) {
+		n := newFakeNode()
+		n.putDir("destino")
+		// a pasó de archivo a directorio y b de directorio a archivo
+		n.putFile("destino/a", "era un archivo", time.Now())
+		n.putDir("destino/b")
+		n.putFile("destino/b/dentro.txt", "se borra con su directorio", time.Now())
+		n.putFile("destino/sobra.txt", "no está en la carpeta local", time.Now())
+		local := t.TempDir()
+		writeLocal(t, local, time.Now(), map[string]string{
+			"a/x.txt": "ahora es un directorio",
+			"b":       "ahora es un archivo",
+		})
+		return n, local
+	}
+
+	t.Run("sin delete", func(t *testing.T) {
+		n, local := newFixture()
+		c := newTestClient(t, n, nil)
+		_, err := c.Sync(context.Background(), local, "destino", SyncOptions{})
+		if !errors.Is(err, ErrFailedPrecondition) {
+			t.Fatalf("se esperaba ErrFailedPrecondition, se obtuvo %v", err)
+		}
+		assertOps(t, n)
+	})
+
+	t.Run("con delete", func(t *testing.T) {
+		n, local := newFixture()
+		c := newTestClient(t, n, nil)
+		if _, err := c.Sync(context.Background(), local, "destino", SyncOptions{Delete: true}); err != nil {
+			t.Fatal(err)
+		}
+		// El contenido de b se borra junto con el directorio, no por separado
+		assertOps(t, n,
+			"delete destino/a", "mkdir destino/a", "upload destino/a/x.txt",
+			"delete destino/b", "upload destino/b",
+			"delete destino/sobra.txt",
+		)
+		if got := n.paths(); !slices.Equal(got, []string{"destino", "destino/a", "destino/a/x.txt", "destino/b"}) {
+			t.Fatalf("árbol del nodo: %q", got)
+		}
+		if n.entries["destino/b"].IsDir {
+			t.Fatal("destino/b sigue siendo un directorio")
+		}
+	})
+}
+
+func TestSyncDryRun(t *testing.T) {
+	n, local := newSyncFixture(t)
+	n.putFile("destino/sobra.txt", "no está en la carpeta local", time.Now())
+	before := n.paths()
+	c := newTestClient(t, n, nil)
+
+	var reported []SyncAction
+	result, err := c.Sync(context.Background(), local, "destino", SyncOptions{
+		Delete:   true,
+		DryRun:   true,
+		OnAction: func(action SyncAction) { reported = append(reported, action) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Actions) != 5 || !slices.Equal(reported, result.Actions) {
+		t.Fatalf("acciones %+v, informadas %+v", result.Actions, reported)
+	}
+	if result.BytesUploaded != 0 {
+		t.Fatalf("se informaron %d bytes subidos", result.BytesUploaded)
+	}
+	// Solo se leyó el inventario
+	n.mu.Lock()
+	calls := slices.Clone(n.calls)
+	n.mu.Unlock()
+	if !slices.Equal(calls, []string{"Inventory"}) {
+		t.Fatalf("llamadas al nodo: %q", calls)
+	}
+	if after := n.paths(); !slices.Equal(after, before) {
+		t.Fatalf("el árbol cambió: %q, antes %q", after, before)
+	}
+}
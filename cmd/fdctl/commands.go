@@ -0,0 +1,537 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"filesystem/client"
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// FlagSet de un subcomando; los errores de las opciones se informan como errores de uso
+func subcommandFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("fdctl "+name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return usageError{err.Error()}
+	}
+	return nil
+}
+
+// Entrada de un listado; los metadatos solo se completan con ls -l
+type listEntry struct {
+	Path         string `json:"path"`
+	Name         string `json:"name"`
+	IsDir        bool   `json:"is_dir"`
+	Size         *int64 `json:"size,omitempty"`
+	PhysicalSize *int64 `json:"physical_size,omitempty"`
+	ModTime      string `json:"mod_time,omitempty"`
+	FileType     string `json:"file_type,omitempty"`
+}
+
+func runLs(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("ls")
+	long := fs.Bool("l", false, "")
+	recursive := fs.Bool("R", false, "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return usagef("se esperaba una sola ruta")
+	}
+	root := remotePath(fs.Arg(0))
+
+	// ls de un archivo lo muestra solo a él
+	if root != "" {
+		stat, err := a.client.Stat(ctx, root)
+		if err != nil {
+			return err
+		}
+		if !stat.IsDir {
+			entry := statEntry(stat)
+			return a.printEntries(map[string][]listEntry{"": {entry}}, []string{""}, *long, false)
+		}
+	}
+
+	groups := map[string][]listEntry{}
+	var order []string
+	pending := []string{root}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		listing, err := a.client.List(ctx, dir)
+		if err != nil {
+			return err
+		}
+		var entries []listEntry
+		var subdirs []string
+		for _, name := range listing.Directories {
+			p := path.Join(dir, name)
+			entries = append(entries, listEntry{Path: p, Name: name, IsDir: true})
+			subdirs = append(subdirs, p)
+		}
+		for _, name := range listing.Files {
+			entries = append(entries, listEntry{Path: path.Join(dir, name), Name: name})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		if *long {
+			for i := range entries {
+				stat, err := a.client.Stat(ctx, entries[i].Path)
+				// Se pudo borrar entre el listado y la consulta
+				if errors.Is(err, client.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				entries[i] = statEntry(stat)
+			}
+		}
+		groups[dir] = entries
+		order = append(order, dir)
+		if *recursive {
+			sort.Strings(subdirs)
+			pending = append(subdirs, pending...)
+		}
+	}
+	return a.printEntries(groups, order, *long, *recursive)
+}
+
+func statEntry(stat *pb.StatResponse) listEntry {
+	return listEntry{
+		Path:         stat.Path,
+		Name:         stat.Name,
+		IsDir:        stat.IsDir,
+		Size:         &stat.Size,
+		PhysicalSize: &stat.PhysicalSize,
+		ModTime:      time.Unix(stat.ModTime, 0).Format(time.RFC3339),
+		FileType:     stat.FileType,
+	}
+}
+
+// Muestra los listados en orden; con titles cada uno lleva su directorio como título, como ls -R
+func (a *app) printEntries(groups map[string][]listEntry, order []string, long, titles bool) error {
+	if a.json {
+		var all []listEntry
+		for _, dir := range order {
+			all = append(all, groups[dir]...)
+		}
+		if all == nil {
+			all = []listEntry{}
+		}
+		return a.printJSON(all)
+	}
+	for i, dir := range order {
+		if titles {
+			if i > 0 {
+				fmt.Fprintln(a.stdout)
+			}
+			title := dir
+			if title == "" {
+				title = "."
+			}
+			fmt.Fprintf(a.stdout, "%s:\n", title)
+		}
+		// Los tamaños se alinean a la derecha, como en ls -l
+		sizeWidth := 0
+		for _, entry := range groups[dir] {
+			if long {
+				sizeWidth = max(sizeWidth, len(fmt.Sprint(*entry.Size)))
+			}
+		}
+		for _, entry := range groups[dir] {
+			name := entry.Name
+			if entry.IsDir {
+				name += "/"
+			}
+			if !long {
+				fmt.Fprintln(a.stdout, name)
+				continue
+			}
+			kind := "-"
+			if entry.IsDir {
+				kind = "d"
+			}
+			modTime, _ := time.Parse(time.RFC3339, entry.ModTime)
+			fmt.Fprintf(a.stdout, "%s %*d %s %s\n", kind, sizeWidth, *entry.Size, modTime.Local().Format("2006-01-02 15:04"), name)
+		}
+	}
+	return nil
+}
+
+// Resultado de una transferencia en modo JSON
+type transferResult struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Size        int64  `json:"size"`
+	// Con put -delta, bytes enviados tal cual; el resto se copió del archivo que ya tenía el nodo
+	SentBytes *int64 `json:"sent_bytes,omitempty"`
+}
+
+func runPut(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("put")
+	useDelta := fs.Bool("delta", false, "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		return usagef("falta el archivo a subir")
+	}
+	remoteDir := ""
+	if len(files) > 1 {
+		remoteDir = remotePath(files[len(files)-1])
+		files = files[:len(files)-1]
+	}
+
+	var results []transferResult
+	for _, local := range files {
+		result := transferResult{Source: local, Destination: path.Join(remoteDir, filepath.Base(local))}
+		if *useDelta {
+			res, err := a.client.UploadDelta(ctx, local, result.Destination)
+			if err != nil {
+				return err
+			}
+			result.Size = res.Response.GetFileSize()
+			result.SentBytes = &res.LiteralBytes
+			if !a.json {
+				fmt.Fprintf(a.stdout, "%s: enviados %s de %s\n", result.Destination, formatBytes(res.LiteralBytes), formatBytes(result.Size))
+			}
+		} else {
+			size, err := a.upload(ctx, local, remoteDir)
+			if err != nil {
+				return err
+			}
+			result.Size = size
+		}
+		results = append(results, result)
+	}
+	if a.json {
+		return a.printJSON(results)
+	}
+	return nil
+}
+
+func (a *app) upload(ctx context.Context, local, remoteDir string) (int64, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s no es un archivo regular", local)
+	}
+
+	name := filepath.Base(local)
+	bar := a.newProgress(name, info.Size())
+	// Sin io.ReaderAt el cliente calcula el checksum mientras sube y el servidor lo verifica al completar
+	_, err = a.client.UploadReader(ctx, bar.reader(f), info.Size(), name, remoteDir)
+	bar.done(err)
+	return info.Size(), err
+}
+
+func runGet(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("get")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return usagef("se esperaba la ruta remota y, opcionalmente, el destino")
+	}
+	remote := remotePath(fs.Arg(0))
+	stat, err := a.client.Stat(ctx, remote)
+	if err != nil {
+		return err
+	}
+	if stat.IsDir {
+		return fmt.Errorf("%s es un directorio", remote)
+	}
+
+	local := fs.Arg(1)
+	if local == "-" {
+		// La barra no se mezcla con el contenido porque va a la salida de errores
+		bar := a.newProgress(stat.Name, stat.Size)
+		_, err := a.client.Download(ctx, remote, bar.writer(a.stdout))
+		bar.done(err)
+		return err
+	}
+	if local == "" {
+		local = stat.Name
+	} else if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, stat.Name)
+	}
+
+	// Se descarga a un temporal para no dejar un archivo a medias con el nombre final
+	tmp, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".fdctl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	bar := a.newProgress(stat.Name, stat.Size)
+	size, err := a.client.Download(ctx, remote, bar.writer(tmp))
+	bar.done(err)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// CreateTemp deja el archivo solo para su dueño
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), local); err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(transferResult{Source: remote, Destination: local, Size: size})
+	}
+	return nil
+}
+
+func runPack(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("pack")
+	var opts client.ArchiveOptions
+	fs.StringVar(&opts.Format, "format", "", "")
+	fs.Int64Var(&opts.MaxSize, "max-size", 0, "")
+	fs.Func("include", "", func(v string) error { opts.Include = append(opts.Include, v); return nil })
+	fs.Func("exclude", "", func(v string) error { opts.Exclude = append(opts.Exclude, v); return nil })
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return usagef("se esperaba el destino y, opcionalmente, las rutas remotas")
+	}
+	local := fs.Arg(0)
+	for _, p := range fs.Args()[1:] {
+		opts.Paths = append(opts.Paths, remotePath(p))
+	}
+	if opts.Format == "" && (strings.HasSuffix(local, ".tar.gz") || strings.HasSuffix(local, ".tgz")) {
+		opts.Format = "tar.gz"
+	}
+	if local == "-" {
+		_, err := a.client.DownloadArchive(ctx, a.stdout, opts)
+		return err
+	}
+
+	// Como en get, se descarga a un temporal para no dejar un paquete a medias
+	tmp, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".fdctl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := a.client.DownloadArchive(ctx, tmp, opts)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), local); err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(transferResult{Source: strings.Join(opts.Paths, ","), Destination: local, Size: size})
+	}
+	return nil
+}
+
+func runMv(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("mv")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return usagef("se esperaban el origen y el destino")
+	}
+	return a.client.Move(ctx, remotePath(fs.Arg(0)), remotePath(fs.Arg(1)))
+}
+
+func runRm(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("rm")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("falta la ruta a borrar")
+	}
+	for _, p := range fs.Args() {
+		if err := a.client.Delete(ctx, remotePath(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runMkdir(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("mkdir")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("falta el directorio a crear")
+	}
+	for _, p := range fs.Args() {
+		if err := a.client.Mkdir(ctx, remotePath(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runStat(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("stat")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("falta la ruta")
+	}
+	var stats []proto.Message
+	for _, p := range fs.Args() {
+		stat, err := a.client.Stat(ctx, remotePath(p))
+		if err != nil {
+			return err
+		}
+		stats = append(stats, stat)
+	}
+	if a.json {
+		return a.printJSON(stats)
+	}
+	for i, m := range stats {
+		stat := m.(*pb.StatResponse)
+		if i > 0 {
+			fmt.Fprintln(a.stdout)
+		}
+		kind := "archivo"
+		if stat.IsDir {
+			kind = "directorio"
+		}
+		tw := tabwriter.NewWriter(a.stdout, 0, 0, 1, ' ', 0)
+		fmt.Fprintf(tw, "Ruta:\t%s\n", stat.Path)
+		fmt.Fprintf(tw, "Tipo:\t%s\n", kind)
+		if !stat.IsDir {
+			fmt.Fprintf(tw, "Tamaño:\t%d (%s)\n", stat.Size, formatBytes(stat.Size))
+			fmt.Fprintf(tw, "En disco:\t%d (%s)\n", stat.PhysicalSize, formatBytes(stat.PhysicalSize))
+			fmt.Fprintf(tw, "Contenido:\t%s\n", stat.FileType)
+			fmt.Fprintf(tw, "Compresión:\t%s\n", orNone(stat.Compression))
+			fmt.Fprintf(tw, "Cifrado:\t%s\n", orNone(stat.Encryption))
+			fmt.Fprintf(tw, "Deduplicado:\t%s\n", yesNo(stat.Deduplicated))
+		}
+		fmt.Fprintf(tw, "Modificado:\t%s\n", time.Unix(stat.ModTime, 0).Local().Format(time.RFC3339))
+		tw.Flush()
+	}
+	return nil
+}
+
+// Entrada de du en modo JSON
+type usageEntry struct {
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir"`
+	Size  int64  `json:"size"`
+}
+
+func runDu(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("du")
+	summary := fs.Bool("s", false, "")
+	all := fs.Bool("a", false, "")
+	human := fs.Bool("h", false, "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return usagef("se esperaba una sola ruta")
+	}
+	root := remotePath(fs.Arg(0))
+
+	// El inventario emite cada directorio después de su contenido, con el tamaño ya sumado,
+	// y el de la ruta pedida al final
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := a.client.Service().Inventory(ctx, &pb.InventoryRequest{Path: root, IncludeDirectories: true})
+	if err != nil {
+		return err
+	}
+	var entries []usageEntry
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		entries = append(entries, usageEntry{Path: entry.Path, IsDir: entry.IsDir, Size: entry.Size})
+	}
+	if len(entries) == 0 {
+		return status.Errorf(codes.Internal, "el inventario está vacío")
+	}
+	if *summary {
+		entries = entries[len(entries)-1:]
+	} else if !*all {
+		last := len(entries) - 1
+		kept := entries[:0]
+		for i, entry := range entries {
+			// La ruta pedida se muestra siempre, aunque sea un archivo
+			if entry.IsDir || i == last {
+				kept = append(kept, entry)
+			}
+		}
+		entries = kept
+	}
+
+	if a.json {
+		return a.printJSON(entries)
+	}
+	for _, entry := range entries {
+		size := fmt.Sprint(entry.Size)
+		if *human {
+			size = formatBytes(entry.Size)
+		}
+		p := entry.Path
+		if p == "" {
+			p = "."
+		}
+		fmt.Fprintf(a.stdout, "%s\t%s\n", size, p)
+	}
+	return nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "ninguno"
+	}
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "sí"
+	}
+	return "no"
+}
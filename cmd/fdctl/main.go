@@ -0,0 +1,209 @@
+// fdctl opera un nodo desde la línea de comandos: lista, sube, descarga, mueve y borra archivos,
+// y consulta el estado del nodo. La conexión se configura como se describe en cliconfig.
+//
+//	fdctl -addr nodo1:50051 ls -l documentos
+//	FDCTL_TOKEN=secreto fdctl put informe.pdf documentos
+//	fdctl -json stat documentos/informe.pdf
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"filesystem/client"
+	"filesystem/cmd/internal/cliconfig"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Subcomando: recibe sus argumentos sin las opciones globales
+type command struct {
+	usage       string
+	description string
+	run         func(ctx context.Context, app *app, args []string) error
+}
+
+var commands = map[string]command{
+	"ls":     {"ls [-l] [-R] [ruta]", "Lista un directorio", runLs},
+	"put":    {"put [-delta] <archivo>... [directorio]", "Sube archivos locales a un directorio remoto; -delta envía solo los bloques que cambiaron", runPut},
+	"get":    {"get <ruta> [destino]", "Descarga un archivo; destino - escribe en la salida estándar", runGet},
+	"pack":   {"pack [-format zip|tar.gz] [-include glob]... [-exclude glob]... [-max-size bytes] <destino> [ruta]...", "Descarga directorios o archivos empaquetados en zip o tar.gz; destino - escribe en la salida estándar", runPack},
+	"mv":     {"mv <origen> <destino>", "Mueve un archivo o directorio", runMv},
+	"rm":     {"rm <ruta>...", "Borra archivos o directorios con todo su contenido", runRm},
+	"mkdir":  {"mkdir <ruta>...", "Crea directorios y los que falten en su ruta", runMkdir},
+	"stat":   {"stat <ruta>...", "Muestra los metadatos de archivos o directorios", runStat},
+	"du":     {"du [-s] [-a] [-h] [ruta]", "Muestra el espacio que ocupa cada directorio", runDu},
+	"sync":   {"sync [-delete] [-n] [-checksum] <carpeta> [directorio]", "Sube solo lo que cambió en una carpeta local; -delete borra lo que sobra en el nodo", runSync},
+	"status": {"status", "Muestra el estado, el almacenamiento y la verificación del nodo", runStatus},
+	"health": {"health", "Consulta el servicio de salud del nodo; termina con error si no está disponible", runHealth},
+}
+
+// Estado compartido por los subcomandos
+type app struct {
+	cfg      cliconfig.Config
+	client   *client.Client
+	json     bool
+	progress bool
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("fdctl", flag.ContinueOnError)
+	loader := cliconfig.Register(fs)
+	jsonOutput := fs.Bool("json", false, "Mostrar los resultados y los errores en JSON")
+	quiet := fs.Bool("quiet", false, "No mostrar el progreso de las transferencias")
+	fs.Usage = func() { printUsage(fs) }
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		printUsage(fs)
+		return 2
+	}
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "fdctl: comando desconocido %q\n", name)
+		printUsage(fs)
+		return 2
+	}
+
+	a := &app{json: *jsonOutput, stdout: os.Stdout, stderr: os.Stderr}
+	a.progress = !*quiet && !a.json && isTerminal(os.Stderr)
+
+	cfg, err := loader.Load()
+	if err != nil {
+		return a.fail(err)
+	}
+	a.cfg = cfg
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		return a.fail(err)
+	}
+	if a.client, err = client.New(cfg.Address, opts); err != nil {
+		return a.fail(err)
+	}
+	defer a.client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := cmd.run(ctx, a, fs.Args()[1:]); err != nil {
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintf(os.Stderr, "fdctl %s: %v\nUso: fdctl %s\n", name, err, cmd.usage)
+			return 2
+		}
+		return a.fail(err)
+	}
+	return 0
+}
+
+func printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Uso: fdctl [opciones] <comando> [argumentos]\n\nComandos:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-30s %s\n", commands[name].usage, commands[name].description)
+	}
+	fmt.Fprintf(out, "\nOpciones:\n")
+	fs.PrintDefaults()
+}
+
+// Error en los argumentos de un subcomando
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// Muestra el error y devuelve el código de salida
+func (a *app) fail(err error) int {
+	if a.json {
+		out := map[string]string{"error": err.Error()}
+		if st, ok := status.FromError(err); ok {
+			out["code"] = st.Code().String()
+		}
+		json.NewEncoder(a.stderr).Encode(out)
+	} else {
+		fmt.Fprintf(a.stderr, "fdctl: %v\n", err)
+	}
+	return 1
+}
+
+// Escribe v en JSON; los mensajes protobuf usan sus nombres de campo
+func (a *app) printJSON(v any) error {
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(toJSON(v))
+}
+
+func toJSON(v any) any {
+	switch v := v.(type) {
+	case proto.Message:
+		data, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(v)
+		if err != nil {
+			return map[string]string{"error": err.Error()}
+		}
+		return json.RawMessage(data)
+	case []proto.Message:
+		out := make([]any, len(v))
+		for i, m := range v {
+			out[i] = toJSON(m)
+		}
+		return out
+	}
+	return v
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Tamaño legible, en unidades binarias
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Ruta remota limpia, sin barras al principio ni al final
+func remotePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Las transferencias menores no muestran barra, terminan antes de que se vea
+const progressMinSize = 1024 * 1024
+
+const progressInterval = 100 * time.Millisecond
+
+// Barra de progreso de una transferencia en la salida de errores. Con el progreso desactivado
+// todos sus métodos son no-ops.
+type progress struct {
+	out     io.Writer
+	name    string
+	total   int64
+	started time.Time
+
+	mu      sync.Mutex
+	current int64
+	drawn   time.Time
+}
+
+func (a *app) newProgress(name string, total int64) *progress {
+	if !a.progress || total < progressMinSize {
+		return nil
+	}
+	return &progress{out: a.stderr, name: name, total: total, started: time.Now()}
+}
+
+func (p *progress) add(n int) {
+	if p == nil || n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current += int64(n)
+	if time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+// Dibuja la barra sobre la línea actual; requiere mu
+func (p *progress) draw() {
+	p.drawn = time.Now()
+	current := min(p.current, p.total)
+	const width = 30
+	filled := int(current * width / p.total)
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+	rate := ""
+	if elapsed := time.Since(p.started).Seconds(); elapsed > 0 {
+		rate = formatBytes(int64(float64(current)/elapsed)) + "/s"
+	}
+	fmt.Fprintf(p.out, "\r%s [%s] %3d%% %s/%s %s\x1b[K", p.name, bar, current*100/p.total,
+		formatBytes(current), formatBytes(p.total), rate)
+}
+
+// Termina la barra: la deja completa si la transferencia salió bien y pasa a la línea siguiente
+func (p *progress) done(err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.current = p.total
+	}
+	p.draw()
+	fmt.Fprintln(p.out)
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (pr progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.add(n)
+	return n, err
+}
+
+// Envuelve r para contar lo leído. El resultado solo es un io.Reader.
+func (p *progress) reader(r io.Reader) io.Reader {
+	return progressReader{r, p}
+}
+
+type progressWriter struct {
+	w io.Writer
+	p *progress
+}
+
+func (pw progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.add(n)
+	return n, err
+}
+
+// Envuelve w para contar lo escrito
+func (p *progress) writer(w io.Writer) io.Writer {
+	return progressWriter{w, p}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"filesystem/client"
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func runHealth(ctx context.Context, a *app, args []string) error {
+	if len(args) > 0 {
+		return usagef("no lleva argumentos")
+	}
+	state, err := a.client.Health(ctx)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		if err := a.printJSON(map[string]string{"address": a.cfg.Address, "status": state.String()}); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(a.stdout, state)
+	}
+	if state != healthpb.HealthCheckResponse_SERVING {
+		return status.Errorf(codes.Unavailable, "el nodo no está atendiendo llamadas (%s)", state)
+	}
+	return nil
+}
+
+// Estado del nodo en modo JSON. La verificación falta si el nodo no la expone o el token no
+// tiene acceso a la administración.
+type nodeStatus struct {
+	Address string          `json:"address"`
+	Health  string          `json:"health"`
+	Storage json.RawMessage `json:"storage"`
+	Scrub   json.RawMessage `json:"scrub,omitempty"`
+}
+
+func runStatus(ctx context.Context, a *app, args []string) error {
+	if len(args) > 0 {
+		return usagef("no lleva argumentos")
+	}
+	// Un nodo anterior al servicio de salud sigue respondiendo al resto
+	health := "UNIMPLEMENTED"
+	state, err := a.client.Health(ctx)
+	if err == nil {
+		health = state.String()
+	} else if status.Code(err) != codes.Unimplemented {
+		return err
+	}
+	stats, err := a.client.StorageStats(ctx)
+	if err != nil {
+		return err
+	}
+	scrub, err := a.client.ScrubStatus(ctx)
+	if err != nil && !errors.Is(err, client.ErrPermissionDenied) && status.Code(err) != codes.Unimplemented {
+		return err
+	}
+
+	if a.json {
+		out := nodeStatus{Address: a.cfg.Address, Health: health, Storage: toJSON(stats).(json.RawMessage)}
+		if scrub != nil {
+			out.Scrub = toJSON(scrub).(json.RawMessage)
+		}
+		return a.printJSON(out)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "Nodo:\t%s\n", a.cfg.Address)
+	fmt.Fprintf(tw, "Salud:\t%s\n", health)
+	fmt.Fprintf(tw, "Almacenamiento:\t%s, compresión %s\n", stats.StorageMode, orNone(stats.Compression))
+	fmt.Fprintf(tw, "Archivos:\t%d (%d comprimidos, %d cifrados)\n", stats.FileCount, stats.CompressedFileCount, stats.EncryptedFileCount)
+	fmt.Fprintf(tw, "Tamaño lógico:\t%s\n", formatBytes(stats.LogicalBytes))
+	fmt.Fprintf(tw, "En disco:\t%s\n", formatBytes(stats.PhysicalBytes))
+	if stats.StorageMode == "dedup" {
+		fmt.Fprintf(tw, "Blobs:\t%d, %s recuperables, deduplicación %.2fx\n", stats.BlobCount, formatBytes(stats.ReclaimableBytes), stats.DedupRatio)
+	}
+	printScrub(tw, scrub)
+	return tw.Flush()
+}
+
+func printScrub(tw *tabwriter.Writer, scrub *pb.ScrubStatusResponse) {
+	switch {
+	case scrub == nil:
+		fmt.Fprintf(tw, "Verificación:\tno disponible\n")
+		return
+	case !scrub.Enabled:
+		fmt.Fprintf(tw, "Verificación:\tdesactivada\n")
+		return
+	}
+	state := "en espera"
+	if scrub.Running {
+		state = "en curso"
+	}
+	fmt.Fprintf(tw, "Verificación:\t%s, %d pasadas completas, acción %s\n", state, scrub.PassesCompleted, scrub.Action)
+	if scrub.LastPassCompleted > 0 {
+		fmt.Fprintf(tw, "Última pasada:\t%s\n", time.Unix(scrub.LastPassCompleted, 0).Local().Format(time.RFC3339))
+	}
+	fmt.Fprintf(tw, "Corruptos:\t%d\n", scrub.CorruptFiles)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"filesystem/client"
+)
+
+func runSync(ctx context.Context, a *app, args []string) error {
+	fs := subcommandFlags("sync")
+	deleteExtra := fs.Bool("delete", false, "")
+	dryRun := fs.Bool("n", false, "")
+	checksum := fs.Bool("checksum", false, "")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return usagef("se esperaba la carpeta local y, opcionalmente, el directorio remoto")
+	}
+
+	opts := client.SyncOptions{Delete: *deleteExtra, DryRun: *dryRun, Checksum: *checksum}
+	if !a.json {
+		opts.OnAction = func(action client.SyncAction) {
+			switch action.Op {
+			case client.SyncUpload:
+				fmt.Fprintf(a.stdout, "subir  %s (%s, %s)\n", action.Path, action.Reason, formatBytes(action.Size))
+			case client.SyncMkdir:
+				fmt.Fprintf(a.stdout, "crear  %s/\n", action.Path)
+			case client.SyncDelete:
+				fmt.Fprintf(a.stdout, "borrar %s\n", action.Path)
+			}
+		}
+	}
+	result, err := a.client.Sync(ctx, fs.Arg(0), remotePath(fs.Arg(1)), opts)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		if result.Actions == nil {
+			result.Actions = []client.SyncAction{}
+		}
+		return a.printJSON(result)
+	}
+
+	var uploads, deletes int
+	var bytes int64
+	for _, action := range result.Actions {
+		switch action.Op {
+		case client.SyncUpload:
+			uploads++
+			bytes += action.Size
+		case client.SyncDelete:
+			deletes++
+		}
+	}
+	if *dryRun {
+		fmt.Fprintf(a.stdout, "Simulación: se subirían %d archivos (%s) y se borrarían %d; %d sin cambios\n", uploads, formatBytes(bytes), deletes, result.Unchanged)
+	} else {
+		fmt.Fprintf(a.stdout, "%d archivos subidos (%s), %d borrados, %d sin cambios\n", uploads, formatBytes(result.BytesUploaded), deletes, result.Unchanged)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+)
+
+// Metadatos de las rutas consultadas, incluidas las que no existen (stat nil)
+type attrCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]attrEntry
+}
+
+type attrEntry struct {
+	stat    *pb.StatResponse
+	expires time.Time
+}
+
+func newAttrCache(ttl time.Duration) *attrCache {
+	return &attrCache{ttl: ttl, entries: make(map[string]attrEntry)}
+}
+
+func (c *attrCache) get(p string) (stat *pb.StatResponse, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[p]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.entries, p)
+		return nil, false
+	}
+	return entry.stat, true
+}
+
+func (c *attrCache) put(p string, stat *pb.StatResponse) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[p] = attrEntry{stat: stat, expires: time.Now().Add(c.ttl)}
+}
+
+// Olvida p y todo lo que está debajo
+func (c *attrCache) invalidate(p string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if under(key, p) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Bloques de contenido leídos del nodo. Cada bloque recuerda la versión del archivo (tamaño y
+// fecha de modificación) de la que salió, así que un cambio en el nodo se nota en cuanto
+// caducan los metadatos aunque el bloque no haya caducado todavía.
+type dataCache struct {
+	ttl      time.Duration
+	maxBytes int64
+
+	mu     sync.Mutex
+	blocks map[blockKey]*list.Element
+	lru    *list.List
+	bytes  int64
+}
+
+type blockKey struct {
+	path  string
+	index int64
+}
+
+type block struct {
+	key     blockKey
+	version fileVersion
+	data    []byte
+	expires time.Time
+}
+
+type fileVersion struct {
+	size    int64
+	modTime int64
+}
+
+func versionOf(stat *pb.StatResponse) fileVersion {
+	return fileVersion{size: stat.Size, modTime: stat.ModTime}
+}
+
+func newDataCache(ttl time.Duration, maxBytes int64) *dataCache {
+	return &dataCache{ttl: ttl, maxBytes: maxBytes, blocks: make(map[blockKey]*list.Element), lru: list.New()}
+}
+
+func (c *dataCache) get(key blockKey, version fileVersion) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.blocks[key]
+	if !ok {
+		return nil, false
+	}
+	b := elem.Value.(*block)
+	if b.version != version || time.Now().After(b.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return b.data, true
+}
+
+func (c *dataCache) put(key blockKey, version fileVersion, data []byte) {
+	if c.ttl <= 0 || int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.blocks[key]; ok {
+		c.remove(elem)
+	}
+	c.blocks[key] = c.lru.PushFront(&block{key: key, version: version, data: data, expires: time.Now().Add(c.ttl)})
+	c.bytes += int64(len(data))
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Olvida los bloques de p y de todo lo que está debajo
+func (c *dataCache) invalidate(p string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, elem := range c.blocks {
+		if under(key.path, p) {
+			c.remove(elem)
+		}
+	}
+}
+
+// Requiere mu
+func (c *dataCache) remove(elem *list.Element) {
+	b := c.lru.Remove(elem).(*block)
+	delete(c.blocks, b.key)
+	c.bytes -= int64(len(b.data))
+}
+
+// Indica si p es dir o está dentro de dir ("" es la raíz)
+func under(p, dir string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"syscall"
+	"time"
+
+	"filesystem/client"
+	pb "filesystem/proto/filesystem"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Estado compartido por todos los nodos del montaje
+type mountFS struct {
+	client    *client.Client
+	attrs     *attrCache
+	data      *dataCache
+	attrTTL   time.Duration
+	blockSize int64
+	// Directorio de las copias locales de los archivos abiertos para escritura
+	tempDir  string
+	uid, gid uint32
+}
+
+// Archivo o directorio del nodo. La ruta se obtiene del árbol de inodos en cada llamada,
+// así que sigue siendo correcta después de un rename.
+type node struct {
+	fs.Inode
+	mfs *mountFS
+}
+
+var (
+	_ fs.NodeLookuper  = (*node)(nil)
+	_ fs.NodeGetattrer = (*node)(nil)
+	_ fs.NodeSetattrer = (*node)(nil)
+	_ fs.NodeReaddirer = (*node)(nil)
+	_ fs.NodeMkdirer   = (*node)(nil)
+	_ fs.NodeCreater   = (*node)(nil)
+	_ fs.NodeOpener    = (*node)(nil)
+	_ fs.NodeReader    = (*node)(nil)
+	_ fs.NodeUnlinker  = (*node)(nil)
+	_ fs.NodeRmdirer   = (*node)(nil)
+	_ fs.NodeRenamer   = (*node)(nil)
+)
+
+func (n *node) path() string {
+	return n.Path(n.Root())
+}
+
+func (n *node) child(name string) string {
+	return path.Join(n.path(), name)
+}
+
+// Metadatos de p, de la caché si no caducaron
+func (m *mountFS) stat(ctx context.Context, p string) (*pb.StatResponse, syscall.Errno) {
+	if stat, ok := m.attrs.get(p); ok {
+		if stat == nil {
+			return nil, syscall.ENOENT
+		}
+		return stat, 0
+	}
+	stat, err := m.client.Stat(ctx, p)
+	if errors.Is(err, client.ErrNotFound) {
+		m.attrs.put(p, nil)
+		return nil, syscall.ENOENT
+	}
+	if err != nil {
+		return nil, toErrno("stat", p, err)
+	}
+	m.attrs.put(p, stat)
+	return stat, 0
+}
+
+// Olvida lo que se sabe de p tras modificarlo
+func (m *mountFS) invalidate(p string) {
+	m.attrs.invalidate(p)
+	m.data.invalidate(p)
+}
+
+func (m *mountFS) fillAttr(stat *pb.StatResponse, out *fuse.Attr) {
+	out.Nlink = 1
+	if stat.IsDir {
+		out.Mode = fuse.S_IFDIR | 0755
+	} else {
+		out.Mode = fuse.S_IFREG | 0644
+		out.Size = uint64(stat.Size)
+		out.Blocks = (out.Size + 511) / 512
+	}
+	modTime := time.Unix(stat.ModTime, 0)
+	out.SetTimes(nil, &modTime, &modTime)
+	out.Owner = fuse.Owner{Uid: m.uid, Gid: m.gid}
+}
+
+func (m *mountFS) stableAttr(stat *pb.StatResponse) fs.StableAttr {
+	if stat.IsDir {
+		return fs.StableAttr{Mode: fuse.S_IFDIR}
+	}
+	return fs.StableAttr{Mode: fuse.S_IFREG}
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	p := n.child(name)
+	stat, errno := n.mfs.stat(ctx, p)
+	if errno != 0 {
+		return nil, errno
+	}
+	n.mfs.fillAttr(stat, &out.Attr)
+	out.SetEntryTimeout(n.mfs.attrTTL)
+	out.SetAttrTimeout(n.mfs.attrTTL)
+	return n.NewInode(ctx, &node{mfs: n.mfs}, n.mfs.stableAttr(stat)), 0
+}
+
+func (n *node) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	// Lo escrito y todavía no subido manda sobre lo que dice el nodo
+	if h, ok := f.(*handle); ok {
+		if size, ok := h.localSize(); ok {
+			out.Mode = fuse.S_IFREG | 0644
+			out.Nlink = 1
+			out.Size = uint64(size)
+			out.Blocks = (out.Size + 511) / 512
+			now := time.Now()
+			out.SetTimes(nil, &now, &now)
+			out.Owner = fuse.Owner{Uid: n.mfs.uid, Gid: n.mfs.gid}
+			return 0
+		}
+	}
+	p := n.path()
+	if p == "" {
+		out.Mode = fuse.S_IFDIR | 0755
+		out.Owner = fuse.Owner{Uid: n.mfs.uid, Gid: n.mfs.gid}
+		return 0
+	}
+	stat, errno := n.mfs.stat(ctx, p)
+	if errno != 0 {
+		return errno
+	}
+	n.mfs.fillAttr(stat, &out.Attr)
+	out.SetTimeout(n.mfs.attrTTL)
+	return 0
+}
+
+// Solo se admite cambiar el tamaño; los permisos, dueños y fechas los decide el nodo
+func (n *node) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if size, ok := in.GetSize(); ok {
+		h, ok := f.(*handle)
+		if !ok {
+			// truncate(2) sin el archivo abierto
+			h = newHandle(n)
+			defer h.Release(ctx)
+		}
+		if errno := h.truncate(ctx, int64(size)); errno != 0 {
+			return errno
+		}
+		if !ok {
+			if errno := h.Flush(ctx); errno != 0 {
+				return errno
+			}
+		}
+	}
+	return n.Getattr(ctx, f, out)
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	p := n.path()
+	listing, err := n.mfs.client.List(ctx, p)
+	if err != nil {
+		return nil, toErrno("list", p, err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(listing.Directories)+len(listing.Files))
+	for _, name := range listing.Directories {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR})
+	}
+	for _, name := range listing.Files {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFREG})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	p := n.child(name)
+	if _, errno := n.mfs.stat(ctx, p); errno == 0 {
+		return nil, syscall.EEXIST
+	}
+	if err := n.mfs.client.Mkdir(ctx, p); err != nil {
+		return nil, toErrno("mkdir", p, err)
+	}
+	n.mfs.invalidate(p)
+	return n.Lookup(ctx, name, out)
+}
+
+// Crea el archivo vacío en el nodo enseguida, para que exista aunque nunca se escriba en él
+func (n *node) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	p := n.child(name)
+	if _, err := n.mfs.client.UploadReader(ctx, bytes.NewReader(nil), 0, name, n.path()); err != nil {
+		return nil, nil, 0, toErrno("create", p, err)
+	}
+	n.mfs.invalidate(p)
+	inode, errno := n.Lookup(ctx, name, out)
+	if errno != 0 {
+		return nil, nil, 0, errno
+	}
+	h := newHandle(inode.Operations().(*node))
+	if errno := h.truncate(ctx, 0); errno != 0 {
+		return nil, nil, 0, errno
+	}
+	return inode, h, 0, 0
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	h := newHandle(n)
+	if flags&syscall.O_TRUNC != 0 && flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		if errno := h.truncate(ctx, 0); errno != 0 {
+			return nil, 0, errno
+		}
+	}
+	// El contenido cambia por fuera del kernel, así que no debe conservar su caché entre aperturas
+	return h, 0, 0
+}
+
+// Lectura por rangos a través de la caché de bloques
+func (n *node) Read(ctx context.Context, f fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if h, ok := f.(*handle); ok {
+		if result, ok, errno := h.readLocal(dest, off); ok || errno != 0 {
+			return result, errno
+		}
+	}
+	p := n.path()
+	stat, errno := n.mfs.stat(ctx, p)
+	if errno != 0 {
+		return nil, errno
+	}
+	if off >= stat.Size {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := min(off+int64(len(dest)), stat.Size)
+	version := versionOf(stat)
+	buf := dest[:0]
+	for blockIndex := off / n.mfs.blockSize; blockIndex*n.mfs.blockSize < end; blockIndex++ {
+		data, errno := n.mfs.readBlock(ctx, p, blockIndex, version)
+		if errno != 0 {
+			return nil, errno
+		}
+		blockStart := blockIndex * n.mfs.blockSize
+		from := max(off-blockStart, 0)
+		to := min(end-blockStart, int64(len(data)))
+		if from >= to {
+			break
+		}
+		buf = append(buf, data[from:to]...)
+	}
+	return fuse.ReadResultData(buf), 0
+}
+
+func (m *mountFS) readBlock(ctx context.Context, p string, index int64, version fileVersion) ([]byte, syscall.Errno) {
+	key := blockKey{path: p, index: index}
+	if data, ok := m.data.get(key, version); ok {
+		return data, 0
+	}
+	data, size, err := m.client.DownloadRange(ctx, p, index*m.blockSize, m.blockSize)
+	if err != nil {
+		return nil, toErrno("read", p, err)
+	}
+	// Si el archivo cambió desde el último stat, el bloque no se guarda con la versión vieja
+	if size == version.size {
+		m.data.put(key, version, data)
+	} else {
+		m.attrs.invalidate(p)
+	}
+	return data, 0
+}
+
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	return n.remove(ctx, name)
+}
+
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	p := n.child(name)
+	listing, err := n.mfs.client.List(ctx, p)
+	if err != nil {
+		return toErrno("rmdir", p, err)
+	}
+	if len(listing.Files)+len(listing.Directories) > 0 {
+		return syscall.ENOTEMPTY
+	}
+	return n.remove(ctx, name)
+}
+
+func (n *node) remove(ctx context.Context, name string) syscall.Errno {
+	p := n.child(name)
+	err := n.mfs.client.Delete(ctx, p)
+	n.mfs.invalidate(p)
+	if err != nil {
+		return toErrno("delete", p, err)
+	}
+	return 0
+}
+
+// Flag RENAME_NOREPLACE de renameat2; go-fuse solo define RENAME_EXCHANGE
+const renameNoReplace = 0x1
+
+// Dentro del mismo directorio es un RenameFile; entre directorios, un MoveFile
+func (n *node) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	oldPath := n.child(name)
+	newDir := newParent.EmbeddedInode().Path(n.Root())
+	newPath := path.Join(newDir, newName)
+	switch flags {
+	case 0:
+	case renameNoReplace:
+		if _, errno := n.mfs.stat(ctx, newPath); errno == 0 {
+			return syscall.EEXIST
+		}
+	default:
+		return syscall.ENOTSUP
+	}
+
+	var err error
+	if newDir == n.path() {
+		err = n.mfs.client.Rename(ctx, oldPath, newPath)
+	} else {
+		err = n.mfs.client.Move(ctx, oldPath, newPath)
+	}
+	n.mfs.invalidate(oldPath)
+	n.mfs.invalidate(newPath)
+	if err != nil {
+		return toErrno("rename", oldPath, err)
+	}
+	return 0
+}
+
+// Traduce el error de una operación del nodo al código que ve la aplicación
+func toErrno(op, p string, err error) syscall.Errno {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+	switch status.Code(err) {
+	case codes.NotFound:
+		return syscall.ENOENT
+	case codes.AlreadyExists:
+		return syscall.EEXIST
+	case codes.InvalidArgument, codes.OutOfRange:
+		return syscall.EINVAL
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return syscall.EACCES
+	case codes.ResourceExhausted:
+		return syscall.EAGAIN
+	case codes.Canceled:
+		return syscall.EINTR
+	case codes.Unimplemented:
+		return syscall.ENOTSUP
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return syscall.ENOENT
+	}
+	slog.Warn("Error en una operación del nodo", "op", op, "path", p, "error", err)
+	return syscall.EIO
+}
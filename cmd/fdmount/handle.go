@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Archivo abierto. Mientras solo se lee no guarda nada; la primera escritura o truncado
+// trae el contenido a una copia local, que se sube entera al cerrar (flush) o con fsync.
+type handle struct {
+	n *node
+
+	mu    sync.Mutex
+	local *os.File
+	dirty bool
+}
+
+var (
+	_ fs.FileWriter   = (*handle)(nil)
+	_ fs.FileFlusher  = (*handle)(nil)
+	_ fs.FileFsyncer  = (*handle)(nil)
+	_ fs.FileReleaser = (*handle)(nil)
+)
+
+func newHandle(n *node) *handle {
+	return &handle{n: n}
+}
+
+// Crea la copia local; con download trae primero el contenido actual. Requiere mu.
+func (h *handle) ensureLocal(ctx context.Context, download bool) syscall.Errno {
+	if h.local != nil {
+		return 0
+	}
+	f, err := os.CreateTemp(h.n.mfs.tempDir, "fdmount-*")
+	if err != nil {
+		return toErrno("open", h.n.path(), err)
+	}
+	if download {
+		p := h.n.path()
+		if _, err := h.n.mfs.client.Download(ctx, p, f); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return toErrno("open", p, err)
+		}
+	}
+	h.local = f
+	return 0
+}
+
+// Tamaño de la copia local, si la hay
+func (h *handle) localSize() (int64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.local == nil {
+		return 0, false
+	}
+	info, err := h.local.Stat()
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// Lee de la copia local; ok es false si no la hay y hay que leer del nodo
+func (h *handle) readLocal(dest []byte, off int64) (result fuse.ReadResult, ok bool, errno syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.local == nil {
+		return nil, false, 0
+	}
+	n, err := h.local.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, true, toErrno("read", h.n.path(), err)
+	}
+	return fuse.ReadResultData(dest[:n]), true, 0
+}
+
+func (h *handle) truncate(ctx context.Context, size int64) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Truncar a cero no necesita el contenido anterior
+	if errno := h.ensureLocal(ctx, size > 0); errno != 0 {
+		return errno
+	}
+	if err := h.local.Truncate(size); err != nil {
+		return toErrno("truncate", h.n.path(), err)
+	}
+	h.dirty = true
+	return 0
+}
+
+func (h *handle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if errno := h.ensureLocal(ctx, true); errno != 0 {
+		return 0, errno
+	}
+	n, err := h.local.WriteAt(data, off)
+	if n > 0 {
+		h.dirty = true
+	}
+	if err != nil {
+		return uint32(n), toErrno("write", h.n.path(), err)
+	}
+	return uint32(n), 0
+}
+
+// Sube la copia local si cambió. Se llama en cada close del descriptor, así que las
+// siguientes no suben nada si no hubo más escrituras.
+func (h *handle) Flush(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.dirty {
+		return 0
+	}
+	info, err := h.local.Stat()
+	if err != nil {
+		return toErrno("upload", h.n.path(), err)
+	}
+	p := h.n.path()
+	dir := path.Dir(p)
+	if dir == "." {
+		dir = ""
+	}
+	_, err = h.n.mfs.client.UploadReader(ctx, h.local, info.Size(), path.Base(p), dir)
+	h.n.mfs.invalidate(p)
+	if err != nil {
+		return toErrno("upload", p, err)
+	}
+	h.dirty = false
+	return 0
+}
+
+func (h *handle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	return h.Flush(ctx)
+}
+
+func (h *handle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.local != nil {
+		h.local.Close()
+		os.Remove(h.local.Name())
+		h.local = nil
+	}
+	return 0
+}
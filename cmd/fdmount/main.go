@@ -0,0 +1,120 @@
+// fdmount monta el almacenamiento de un nodo como un directorio local con FUSE. Los listados,
+// lecturas por rangos, subidas al cerrar, renombrados, borrados y directorios nuevos se
+// traducen a llamadas de FileSystemService. La conexión se configura como en fdctl (cliconfig).
+//
+//	fdmount -addr nodo1:50051 -attr-ttl 5s ~/nodo1
+//	fusermount -u ~/nodo1
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"filesystem/client"
+	"filesystem/cmd/internal/cliconfig"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func main() {
+	fset := flag.NewFlagSet("fdmount", flag.ContinueOnError)
+	loader := cliconfig.Register(fset)
+	attrTTL := fset.Duration("attr-ttl", time.Second, "Tiempo que se conservan los metadatos (0: sin caché)")
+	dataTTL := fset.Duration("data-ttl", 30*time.Second, "Tiempo que se conservan los bloques leídos (0: sin caché)")
+	cacheSize := fset.Int64("cache-size", 64<<20, "Bytes máximos de la caché de bloques")
+	blockSize := fset.Int64("block-size", 1<<20, "Tamaño de las lecturas por rangos")
+	tempDir := fset.String("temp-dir", os.TempDir(), "Directorio de las copias locales de los archivos abiertos para escritura")
+	allowOther := fset.Bool("allow-other", false, "Permitir el acceso a otros usuarios (requiere user_allow_other en /etc/fuse.conf)")
+	debug := fset.Bool("debug", false, "Registrar cada operación FUSE")
+	fset.Usage = func() {
+		fmt.Fprintf(fset.Output(), "Uso: fdmount [opciones] <punto de montaje>\n\nOpciones:\n")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		os.Exit(2)
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		os.Exit(2)
+	}
+	if *blockSize <= 0 || *cacheSize < 0 {
+		fatal("block-size debe ser mayor que 0 y cache-size no puede ser negativo")
+	}
+	mountpoint := fset.Arg(0)
+
+	cfg, err := loader.Load()
+	if err != nil {
+		fatal("Configuración inválida", "error", err)
+	}
+	opts, err := cfg.ClientOptions()
+	if err != nil {
+		fatal("Configuración inválida", "error", err)
+	}
+	c, err := client.New(cfg.Address, opts)
+	if err != nil {
+		fatal("No se pudo crear el cliente", "error", err)
+	}
+	defer c.Close()
+
+	mfs := &mountFS{
+		client:    c,
+		attrs:     newAttrCache(*attrTTL),
+		data:      newDataCache(*dataTTL, *cacheSize),
+		attrTTL:   *attrTTL,
+		blockSize: *blockSize,
+		tempDir:   *tempDir,
+		uid:       uint32(os.Getuid()),
+		gid:       uint32(os.Getgid()),
+	}
+	server, err := fs.Mount(mountpoint, &node{mfs: mfs}, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:     cfg.Address,
+			Name:       "filedepot",
+			AllowOther: *allowOther,
+			Debug:      *debug,
+			// Como root no hace falta fusermount
+			DirectMount: true,
+			// Las subidas van por partes, así que las escrituras grandes ahorran llamadas al kernel
+			MaxWrite: fuse.MAX_KERNEL_WRITE,
+		},
+		EntryTimeout:    attrTTL,
+		AttrTimeout:     attrTTL,
+		NegativeTimeout: attrTTL,
+		UID:             mfs.uid,
+		GID:             mfs.gid,
+	})
+	if err != nil {
+		fatal("No se pudo montar", "mountpoint", mountpoint, "error", err)
+	}
+	slog.Info("Nodo montado", "address", cfg.Address, "mountpoint", mountpoint)
+
+	// Desmontar con una señal equivale a fusermount -u
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range stop {
+			if err := server.Unmount(); err != nil {
+				slog.Warn("No se pudo desmontar; ¿hay archivos abiertos?", "error", err)
+				continue
+			}
+			return
+		}
+	}()
+	server.Wait()
+	slog.Info("Nodo desmontado", "mountpoint", mountpoint)
+}
+
+// Registra un error de arranque y termina el proceso
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,178 @@
+// Paquete cliconfig carga la conexión con el nodo que comparten las herramientas de línea de
+// comandos. Cada valor se toma, de menor a mayor prioridad, del archivo YAML (-config,
+// FDCTL_CONFIG o ~/.config/fdctl/config.yaml), de las variables FDCTL_* y de las opciones.
+package cliconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"filesystem/client"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Conexión con el nodo
+type Config struct {
+	Address               string        `yaml:"address"`
+	Token                 string        `yaml:"token"`
+	CallerID              string        `yaml:"caller_id"`
+	TLS                   bool          `yaml:"tls"`
+	TLSCAFile             string        `yaml:"tls_ca_file"`
+	TLSServerName         string        `yaml:"tls_server_name"`
+	TLSInsecureSkipVerify bool          `yaml:"tls_insecure_skip_verify"`
+	Timeout               time.Duration `yaml:"timeout"`
+}
+
+// Opción de configuración que también se puede indicar con una variable de entorno
+type option struct {
+	name   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(cfg *Config, text string) error
+}
+
+var options = []option{
+	{name: "addr", env: "FDCTL_ADDRESS", usage: "Dirección del nodo (host:puerto)", set: func(cfg *Config, text string) error {
+		cfg.Address = text
+		return nil
+	}},
+	{name: "token", env: "FDCTL_TOKEN", usage: "Token Bearer del nodo; mejor por variable de entorno, para que no aparezca en la lista de procesos", set: func(cfg *Config, text string) error {
+		cfg.Token = text
+		return nil
+	}},
+	{name: "caller", env: "FDCTL_CALLER_ID", usage: "Identidad del cliente en la auditoría y en los límites del nodo", set: func(cfg *Config, text string) error {
+		cfg.CallerID = text
+		return nil
+	}},
+	{name: "tls", env: "FDCTL_TLS", usage: "Conectarse con TLS", isBool: true, set: func(cfg *Config, text string) (err error) {
+		cfg.TLS, err = strconv.ParseBool(text)
+		return err
+	}},
+	{name: "tls-ca", env: "FDCTL_TLS_CA_FILE", usage: "CA con la que se verifica el nodo; vacío para usar las del sistema", set: func(cfg *Config, text string) error {
+		cfg.TLSCAFile = text
+		return nil
+	}},
+	{name: "tls-server-name", env: "FDCTL_TLS_SERVER_NAME", usage: "Nombre esperado en el certificado del nodo", set: func(cfg *Config, text string) error {
+		cfg.TLSServerName = text
+		return nil
+	}},
+	{name: "tls-insecure", env: "FDCTL_TLS_INSECURE_SKIP_VERIFY", usage: "No verificar el certificado del nodo (solo para pruebas)", isBool: true, set: func(cfg *Config, text string) (err error) {
+		cfg.TLSInsecureSkipVerify, err = strconv.ParseBool(text)
+		return err
+	}},
+	{name: "timeout", env: "FDCTL_TIMEOUT", usage: "Tiempo máximo de cada llamada", set: func(cfg *Config, text string) (err error) {
+		cfg.Timeout, err = time.ParseDuration(text)
+		return err
+	}},
+}
+
+// Opciones registradas en un FlagSet, para cargar la configuración después de Parse
+type Loader struct {
+	configFile *string
+	overrides  []func(*Config) error
+}
+
+// Registra -config y las opciones de la conexión en fs
+func Register(fs *flag.FlagSet) *Loader {
+	l := &Loader{configFile: fs.String("config", os.Getenv("FDCTL_CONFIG"), "Archivo de configuración YAML (FDCTL_CONFIG)")}
+	for _, opt := range options {
+		record := func(text string) error {
+			// Se valida ahora para que el error aparezca junto a la opción
+			if err := opt.set(&Config{}, text); err != nil {
+				return err
+			}
+			l.overrides = append(l.overrides, func(cfg *Config) error { return opt.set(cfg, text) })
+			return nil
+		}
+		usage := fmt.Sprintf("%s (%s)", opt.usage, opt.env)
+		if opt.isBool {
+			fs.BoolFunc(opt.name, usage, record)
+		} else {
+			fs.Func(opt.name, usage, record)
+		}
+	}
+	return l
+}
+
+// Valores por defecto, archivo, entorno y opciones, en ese orden
+func (l *Loader) Load() (Config, error) {
+	cfg := Config{Address: "localhost:50051"}
+	path := *l.configFile
+
+	explicit := path != ""
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "fdctl", "config.yaml")
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := yaml.Unmarshal(data, &cfg); err != nil {
+				return cfg, fmt.Errorf("archivo de configuración %s inválido: %w", path, err)
+			}
+		// El archivo por defecto es opcional
+		case explicit || !os.IsNotExist(err):
+			return cfg, fmt.Errorf("no se pudo leer el archivo de configuración: %w", err)
+		}
+	}
+
+	for _, opt := range options {
+		if text, ok := os.LookupEnv(opt.env); ok && text != "" {
+			if err := opt.set(&cfg, text); err != nil {
+				return cfg, fmt.Errorf("%s inválido: %s", opt.env, text)
+			}
+		}
+	}
+	for _, override := range l.overrides {
+		if err := override(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Address == "" {
+		return cfg, errors.New("falta la dirección del nodo (-addr o FDCTL_ADDRESS)")
+	}
+	return cfg, nil
+}
+
+// Configuración TLS del cliente; nil si no se usa TLS. Indicar una CA o un nombre implica TLS.
+func (cfg Config) tlsConfig() (*tls.Config, error) {
+	if !cfg.TLS && cfg.TLSCAFile == "" && cfg.TLSServerName == "" && !cfg.TLSInsecureSkipVerify {
+		return nil, nil
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("no se pudo leer la CA: %w", err)
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s no contiene certificados válidos", cfg.TLSCAFile)
+		}
+	}
+	return tlsCfg, nil
+}
+
+// Opciones del cliente con esta conexión
+func (cfg Config) ClientOptions() (client.Options, error) {
+	tlsCfg, err := cfg.tlsConfig()
+	if err != nil {
+		return client.Options{}, err
+	}
+	return client.Options{Token: cfg.Token, CallerID: cfg.CallerID, TLS: tlsCfg, Timeout: cfg.Timeout}, nil
+}
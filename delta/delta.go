@@ -0,0 +1,341 @@
+// Paquete delta implementa el algoritmo de rsync para actualizar un archivo enviando solo lo que
+// cambió. El nodo calcula las firmas de los bloques del archivo que ya tiene (Signatures); el
+// cliente recorre la versión nueva con una suma rodante (Diff) y, donde encuentra un bloque
+// conocido, envía una instrucción de copia en lugar de sus bytes. El nodo reconstruye el archivo
+// con Apply.
+package delta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Límites del tamaño de bloque
+const (
+	MinBlockSize = 2 << 10
+	MaxBlockSize = 4 << 20
+	// Con más bloques la respuesta de firmas no cabría en un mensaje gRPC
+	MaxBlocks = 1 << 16
+)
+
+// Bytes de la suma fuerte de cada bloque (el principio de su SHA-256)
+const StrongSize = 16
+
+// Firma de un bloque del archivo base
+type Block struct {
+	Weak   uint32
+	Strong []byte
+}
+
+// Tamaño de bloque para un archivo de size bytes: la raíz cuadrada del tamaño, como rsync,
+// redondeada a potencia de dos y sin pasar de MaxBlocks bloques mientras MaxBlockSize lo permita
+func BlockSize(size int64) int {
+	bs := MinBlockSize
+	for bs < MaxBlockSize && (int64(bs)*int64(bs) < size || size/int64(bs) >= MaxBlocks) {
+		bs *= 2
+	}
+	return bs
+}
+
+// Verifica un tamaño de bloque pedido por un cliente
+func ValidBlockSize(blockSize int) bool {
+	return blockSize >= MinBlockSize && blockSize <= MaxBlockSize
+}
+
+// Número de bloques de un archivo de size bytes; el último puede ser más corto
+func NumBlocks(size int64, blockSize int) int64 {
+	return (size + int64(blockSize) - 1) / int64(blockSize)
+}
+
+// Calcula las firmas de los bloques del contenido de r, leyéndolo de bloque en bloque
+func Signatures(r io.Reader, blockSize int) ([]Block, error) {
+	var blocks []Block
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			block := buf[:n]
+			blocks = append(blocks, Block{Weak: newRolling(block).sum(), Strong: StrongSum(block)})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func StrongSum(block []byte) []byte {
+	sum := sha256.Sum256(block)
+	return sum[:StrongSize]
+}
+
+// Suma débil de rsync: a es la suma de los bytes y b la suma de las sumas parciales, ambas
+// módulo 2^16. Se puede desplazar un byte en tiempo constante.
+type rolling struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRolling(block []byte) rolling {
+	r := rolling{n: uint32(len(block))}
+	for i, c := range block {
+		r.a += uint32(c)
+		r.b += uint32(len(block)-i) * uint32(c)
+	}
+	return r
+}
+
+// Quita out del principio de la ventana y añade in al final
+func (r *rolling) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+func (r rolling) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+// Operación de un delta: copiar Count bloques del archivo base desde Index o, con Count 0,
+// añadir Data
+type Op struct {
+	Index int64
+	Count int64
+	Data  []byte
+}
+
+// Firmas del archivo base indexadas por su suma débil
+type Index struct {
+	blockSize int
+	blocks    []Block
+	// Longitud del último bloque, que puede ser más corto que los demás
+	lastLen int
+	weak    map[uint32][]int64
+}
+
+// Índice de las firmas de un archivo base de size bytes
+func NewIndex(blocks []Block, blockSize int, size int64) *Index {
+	idx := &Index{blockSize: blockSize, blocks: blocks, weak: make(map[uint32][]int64, len(blocks))}
+	if len(blocks) > 0 {
+		idx.lastLen = int(size - int64(len(blocks)-1)*int64(blockSize))
+	}
+	for i, b := range blocks {
+		idx.weak[b.Weak] = append(idx.weak[b.Weak], int64(i))
+	}
+	return idx
+}
+
+// Busca un bloque completo con el contenido de window; si hay varios se prefiere prefer, para
+// que las copias de bloques consecutivos se junten en una sola operación
+func (idx *Index) find(weak uint32, window []byte, prefer int64) (int64, bool) {
+	candidates, ok := idx.weak[weak]
+	if !ok {
+		return 0, false
+	}
+	strong := StrongSum(window)
+	found := int64(-1)
+	for _, i := range candidates {
+		if idx.blockLen(i) != len(window) || !bytes.Equal(idx.blocks[i].Strong, strong) {
+			continue
+		}
+		if i == prefer {
+			return i, true
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	return found, found >= 0
+}
+
+func (idx *Index) blockLen(i int64) int {
+	if i == int64(len(idx.blocks))-1 {
+		return idx.lastLen
+	}
+	return idx.blockSize
+}
+
+// Recorre r y llama a emit con las operaciones que transforman el archivo base en el contenido
+// de r. Los datos literales se entregan en trozos de hasta maxLiteral bytes.
+func Diff(r io.Reader, idx *Index, maxLiteral int, emit func(Op) error) error {
+	bs := idx.blockSize
+	maxLiteral = max(maxLiteral, bs)
+	d := differ{emit: emit}
+	buf := make([]byte, 0, maxLiteral+2*bs)
+	// buf[lit:pos] es el literal pendiente y buf[pos:pos+bs] la ventana
+	lit, pos := 0, 0
+	eof := false
+	var sum rolling
+	valid := false
+	for {
+		if !eof && len(buf)-pos <= bs {
+			// El literal pendiente nunca llega a maxLiteral, así que siempre cabe un bloque más
+			n := copy(buf, buf[lit:])
+			buf, pos, lit = buf[:n], pos-lit, 0
+			read, err := io.ReadFull(r, buf[n:cap(buf)])
+			buf = buf[:n+read]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if len(buf)-pos < bs {
+			// Cola más corta que un bloque: solo puede coincidir con el último bloque del base
+			return d.tail(idx, buf[lit:])
+		}
+		window := buf[pos : pos+bs]
+		if !valid {
+			sum, valid = newRolling(window), true
+		}
+		if i, ok := idx.find(sum.sum(), window, d.next()); ok {
+			if err := d.literal(buf[lit:pos]); err != nil {
+				return err
+			}
+			if err := d.copy(i); err != nil {
+				return err
+			}
+			pos += bs
+			lit, valid = pos, false
+			continue
+		}
+		if pos+bs < len(buf) {
+			sum.roll(buf[pos], buf[pos+bs])
+		} else {
+			valid = false
+		}
+		pos++
+		if pos-lit >= maxLiteral {
+			if err := d.literal(buf[lit:pos]); err != nil {
+				return err
+			}
+			lit = pos
+		}
+	}
+}
+
+// Junta las copias de bloques consecutivos antes de emitirlas
+type differ struct {
+	emit    func(Op) error
+	pending *Op
+}
+
+// Bloque que continuaría la copia pendiente
+func (d *differ) next() int64 {
+	if d.pending == nil {
+		return -1
+	}
+	return d.pending.Index + d.pending.Count
+}
+
+func (d *differ) copy(i int64) error {
+	if d.pending != nil && i == d.next() {
+		d.pending.Count++
+		return nil
+	}
+	if err := d.flush(); err != nil {
+		return err
+	}
+	d.pending = &Op{Index: i, Count: 1}
+	return nil
+}
+
+func (d *differ) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := d.flush(); err != nil {
+		return err
+	}
+	// buf se reutiliza, así que emit recibe una copia
+	return d.emit(Op{Data: bytes.Clone(data)})
+}
+
+func (d *differ) flush() error {
+	if d.pending == nil {
+		return nil
+	}
+	op := *d.pending
+	d.pending = nil
+	return d.emit(op)
+}
+
+// Emite lo que queda: el último bloque del base si coincide con el final, y el resto literal
+func (d *differ) tail(idx *Index, rest []byte) error {
+	if last := int64(len(idx.blocks)) - 1; last >= 0 && idx.lastLen < idx.blockSize && len(rest) >= idx.lastLen {
+		block := rest[len(rest)-idx.lastLen:]
+		if _, ok := idx.find(newRolling(block).sum(), block, last); ok {
+			if err := d.literal(rest[:len(rest)-len(block)]); err != nil {
+				return err
+			}
+			if err := d.copy(last); err != nil {
+				return err
+			}
+			return d.flush()
+		}
+	}
+	if err := d.literal(rest); err != nil {
+		return err
+	}
+	return d.flush()
+}
+
+// Errores de Apply
+var (
+	ErrBlockRange = errors.New("copia fuera del archivo base")
+	ErrTooLarge   = errors.New("el resultado supera el tamaño anunciado")
+)
+
+// Reconstruye el archivo aplicando operaciones sobre el base y escribe el resultado en out a
+// medida que avanza, sin cargar ninguno de los dos en memoria. El resultado se limita a size
+// bytes, que es lo que el cliente anuncia antes de enviar el delta.
+type Builder struct {
+	base      io.ReaderAt
+	baseSize  int64
+	blockSize int
+	out       io.Writer
+	size      int64
+	written   int64
+}
+
+// base tiene baseSize bytes
+func NewBuilder(base io.ReaderAt, baseSize int64, blockSize int, out io.Writer, size int64) *Builder {
+	return &Builder{base: base, baseSize: baseSize, blockSize: blockSize, out: out, size: size}
+}
+
+func (b *Builder) Apply(op Op) error {
+	length := int64(len(op.Data))
+	var start int64
+	if op.Count != 0 {
+		blocks := NumBlocks(b.baseSize, b.blockSize)
+		if op.Index < 0 || op.Count < 0 || op.Index > blocks-op.Count {
+			return fmt.Errorf("%w: bloques [%d, +%d) de %d", ErrBlockRange, op.Index, op.Count, blocks)
+		}
+		start = op.Index * int64(b.blockSize)
+		length = min(b.baseSize, (op.Index+op.Count)*int64(b.blockSize)) - start
+	}
+	if length > b.size-b.written {
+		return fmt.Errorf("%w (%d bytes)", ErrTooLarge, b.size)
+	}
+	var err error
+	if op.Count != 0 {
+		_, err = io.CopyN(b.out, io.NewSectionReader(b.base, start, length), length)
+	} else {
+		_, err = b.out.Write(op.Data)
+	}
+	if err != nil {
+		return err
+	}
+	b.written += length
+	return nil
+}
+
+// Bytes escritos hasta ahora
+func (b *Builder) Written() int64 {
+	return b.written
+}
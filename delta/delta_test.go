@@ -0,0 +1,110 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func testData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// Aplica sobre base el delta que lleva a target y devuelve el resultado junto con los bytes literales
+func roundTrip(t *testing.T, base, target []byte, blockSize int) ([]byte, int64) {
+	t.Helper()
+	blocks, err := Signatures(bytes.NewReader(base), blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := NumBlocks(int64(len(base)), blockSize); int64(len(blocks)) != want {
+		t.Fatalf("%d firmas, se esperaban %d", len(blocks), want)
+	}
+	var out bytes.Buffer
+	b := NewBuilder(bytes.NewReader(base), int64(len(base)), blockSize, &out, int64(len(target)))
+	var literal int64
+	idx := NewIndex(blocks, blockSize, int64(len(base)))
+	err = Diff(bytes.NewReader(target), idx, 3*blockSize, func(op Op) error {
+		literal += int64(len(op.Data))
+		return b.Apply(op)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Written() != int64(out.Len()) {
+		t.Fatalf("Written() = %d, se escribieron %d bytes", b.Written(), out.Len())
+	}
+	return out.Bytes(), literal
+}
+
+func TestDiffApplyRoundTrip(t *testing.T) {
+	const bs = MinBlockSize
+	base := testData(1, 10*bs+123)
+	insert := bytes.Clone(base[:5*bs+7])
+	insert = append(insert, "bytes insertados"...)
+	insert = append(insert, base[5*bs+7:]...)
+
+	tests := map[string]struct {
+		base, target []byte
+		// Máximo de bytes literales que debería enviar el delta. El último bloque del base, más
+		// corto, solo se reconoce al final del archivo nuevo.
+		maxLiteral int64
+	}{
+		"igual":                   {base, base, 0},
+		"vacío":                   {base, nil, 0},
+		"base vacío":              {nil, base, int64(len(base))},
+		"inserción":               {base, insert, 2 * bs},
+		"bloque cambiado":         {base, append(append(bytes.Clone(base[:3*bs]), testData(2, bs)...), base[4*bs:]...), bs},
+		"recortado":               {base, base[:7*bs+5], bs},
+		"añadido al final":        {base, append(bytes.Clone(base), testData(3, 50)...), 123 + 50},
+		"bloques reordenados":     {base, append(bytes.Clone(base[6*bs:]), base[:6*bs]...), 123},
+		"más corto que un bloque": {base[:100], base[:100], 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, literal := roundTrip(t, tt.base, tt.target, bs)
+			if !bytes.Equal(got, tt.target) {
+				t.Fatal("el resultado no coincide con el archivo nuevo")
+			}
+			if literal > tt.maxLiteral {
+				t.Fatalf("%d bytes literales, se esperaban como mucho %d", literal, tt.maxLiteral)
+			}
+		})
+	}
+}
+
+func TestBuilderLimits(t *testing.T) {
+	const bs = MinBlockSize
+	base := testData(4, 3*bs+10)
+	tests := []struct {
+		op   Op
+		size int64
+		want error
+	}{
+		{Op{Index: 3, Count: 1}, 100, nil},
+		{Op{Index: 0, Count: 4}, int64(len(base)), nil},
+		{Op{Index: 0, Count: 5}, 10 * bs, ErrBlockRange},
+		{Op{Index: 4, Count: 1}, 10 * bs, ErrBlockRange},
+		{Op{Index: -1, Count: 1}, 10 * bs, ErrBlockRange},
+		{Op{Index: 1, Count: -1}, 10 * bs, ErrBlockRange},
+		{Op{Index: 0, Count: 1}, bs - 1, ErrTooLarge},
+		{Op{Data: []byte("abc")}, 2, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%+v/%d", tt.op, tt.size), func(t *testing.T) {
+			var out bytes.Buffer
+			b := NewBuilder(bytes.NewReader(base), int64(len(base)), bs, &out, tt.size)
+			err := b.Apply(tt.op)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("se obtuvo %v, se esperaba %v", err, tt.want)
+			}
+			if err != nil && (out.Len() != 0 || b.Written() != 0) {
+				t.Fatal("una operación rechazada escribió datos")
+			}
+		})
+	}
+}
@@ -4,123 +4,182 @@ import (
 	"context"
 	pb "filesystem/proto/filesystem"
 	"filesystem/server"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
-	"sync"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func main() {
-	err := godotenv.Load()
+	// Las variables del archivo .env se suman a las del entorno
+	envErr := godotenv.Load()
+
+	cfg, printConfig, err := server.LoadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
 	if err != nil {
-		log.Println("No se pudo cargar el archivo .env, usando valores por defecto.")
+		fmt.Fprintf(os.Stderr, "Configuración inválida:\n%v\n", err)
+		os.Exit(2)
 	}
-
-	ip := os.Getenv("IP_ADDRESS")
-	if ip == "" {
-		ip = "127.0.0.1"
-		log.Println("IP_ADDRESS no definido, usando 127.0.0.1 por defecto.")
+	if printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("Error mostrando la configuración", "error", err)
+		}
+		return
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "50051"
-		log.Println("PORT no definido, usando 50051 por defecto.")
+	if err := server.SetupLogging(cfg.Logging); err != nil {
+		fatal("Configuración de logs inválida", "error", err)
 	}
-
-	nodeID := os.Getenv("NODE_ID")
-	if nodeID == "" {
-		nodeID = "1"
-		log.Println("NODE_ID no definido, usando 1 por defecto.")
+	if envErr != nil {
+		slog.Debug("No se pudo cargar el archivo .env", "error", envErr)
 	}
 
-	log.Printf("Nodo %s iniciando en %s:%s\n", nodeID, ip, port)
+	slog.Info("Nodo iniciando", "node_id", cfg.Node.ID, "ip", cfg.Node.IP, "port", cfg.Node.Port)
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	var wg sync.WaitGroup
-	workChan := make(chan func(), 100)
+	shutdownTracing, err := server.SetupTracing(context.Background(), cfg)
+	if err != nil {
+		fatal("Configuración de trazas inválida", "error", err)
+	}
 
-	for i := 0; i < 4; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			log.Printf("Worker %d iniciado\n", workerID)
-			for work := range workChan {
-				work()
-			}
-			log.Printf("Worker %d detenido\n", workerID)
-		}(i + 1)
+	fileSystemServer := server.NewServer(cfg)
+
+	// La traza y el identificador de petición van primero para que aparezcan en la auditoría y en los logs;
+	// la auditoría va antes de la autenticación para registrar también los rechazos, y antes
+	// del pool para que la duración incluya la espera por un worker. La recuperación de pánicos va
+	// al final para ejecutarse en la misma goroutine que el handler
+	unaryInterceptors := []grpc.UnaryServerInterceptor{server.TracingUnaryInterceptor(), server.RequestIDUnaryInterceptor(),
+		fileSystemServer.AuditUnaryInterceptor(), fileSystemServer.AuthUnaryInterceptor(),
+		fileSystemServer.RateLimitUnaryInterceptor(), fileSystemServer.WorkerPoolInterceptor(), server.RecoveryUnaryInterceptor()}
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(server.TracingStreamInterceptor(), server.RequestIDStreamInterceptor(),
+			fileSystemServer.AuditStreamInterceptor(), fileSystemServer.AuthStreamInterceptor(),
+			fileSystemServer.RateLimitStreamInterceptor(), server.RecoveryStreamInterceptor()),
+		grpc.MaxRecvMsgSize(cfg.Node.MaxMessageSize),
+		grpc.MaxSendMsgSize(cfg.Node.MaxMessageSize),
 	}
+	if creds := fileSystemServer.TransportCredentials(); creds != nil {
+		options = append(options, grpc.Creds(creds))
+	}
+	grpcServer := grpc.NewServer(options...)
 
-	unaryInterceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		var result interface{}
-		var err error
-		done := make(chan struct{})
+	pb.RegisterFileSystemServiceServer(grpcServer, fileSystemServer)
+	pb.RegisterAdminServiceServer(grpcServer, fileSystemServer)
 
-		workChan <- func() {
-			result, err = handler(ctx, req)
-			close(done)
-		}
+	// Estado estándar de gRPC para balanceadores y para fdctl health
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
 
-		<-done
-		return result, err
+	address := net.JoinHostPort(cfg.Node.IP, strconv.Itoa(cfg.Node.Port))
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		fatal("Error al escuchar", "address", address, "error", err)
 	}
 
-	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(unaryInterceptor),
-		grpc.MaxRecvMsgSize(20*1024*1024),
-		grpc.MaxSendMsgSize(20*1024*1024),
-	)
+	slog.Info("Servidor gRPC corriendo", "address", address)
 
-	fileSystemServer := server.NewServer()
-	pb.RegisterFileSystemServiceServer(grpcServer, fileSystemServer)
+	// Latido con el estado del nodo hacia el servidor central
+	fileSystemServer.StartHeartbeat(address)
 
-	address := ip + ":" + port
-	lis, err := net.Listen("tcp", address)
-	if err != nil {
-		log.Fatalf("Error al escuchar en %s: %v", address, err)
+	// SIGHUP vuelve a leer la configuración y aplica lo que se puede cambiar sin reiniciar
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			fileSystemServer.Reload()
+		}
+	}()
+
+	// Gateway HTTP/REST, WebDAV y API S3, con las mismas reglas que las llamadas gRPC
+	var httpServers []*http.Server
+	if httpAddress := cfg.Node.HTTPAddress; httpAddress != "" {
+		httpServers = append(httpServers, fileSystemServer.ServeGateway(httpAddress, unaryInterceptors...))
+	}
+	if webdavAddress := cfg.Node.WebDAVAddress; webdavAddress != "" {
+		httpServers = append(httpServers, fileSystemServer.ServeWebDAV(webdavAddress, unaryInterceptors...))
+	}
+	if s3Address := cfg.S3.Address; s3Address != "" {
+		httpServers = append(httpServers, fileSystemServer.ServeS3(s3Address, unaryInterceptors...))
 	}
 
-	log.Printf("Servidor gRPC corriendo en %s\n", address)
+	// Métricas (incluida la verificación de integridad) en /debug/vars
+	if metricsAddress := cfg.Node.MetricsAddress; metricsAddress != "" {
+		go func() {
+			slog.Info("Métricas disponibles", "url", "http://"+metricsAddress+"/debug/vars")
+			if err := http.ListenAndServe(metricsAddress, nil); err != nil {
+				slog.Error("Error en el servidor de métricas", "error", err)
+			}
+		}()
+	}
 
 	go func() {
 		for {
 			conn, err := lis.Accept()
 			if err != nil {
-				log.Printf("Error aceptando conexión: %v", err)
+				slog.Warn("Error aceptando conexión", "error", err)
 				continue
 			}
-			log.Printf("Nueva conexión desde: %s", conn.RemoteAddr().String())
+			slog.Debug("Nueva conexión", "remote", conn.RemoteAddr().String())
 			conn.Close()
 		}
 	}()
 
 	go func() {
 		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatalf("Error al iniciar el servidor gRPC: %v", err)
+			fatal("Error al iniciar el servidor gRPC", "error", err)
 		}
 	}()
 
-	waitForShutdown(grpcServer, workChan, &wg)
+	waitForShutdown(grpcServer, healthServer, httpServers, fileSystemServer)
+
+	// Envía las trazas pendientes antes de salir
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("No se pudieron enviar las trazas pendientes", "error", err)
+	}
 }
 
-func waitForShutdown(grpcServer *grpc.Server, workChan chan func(), wg *sync.WaitGroup) {
+func waitForShutdown(grpcServer *grpc.Server, healthServer *health.Server, httpServers []*http.Server, fileSystemServer *server.Server) {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
-	log.Println("Señal de apagado recibida, cerrando servidor...")
-
-	close(workChan)
-	wg.Wait()
+	slog.Info("Señal de apagado recibida, cerrando servidor")
+	// Los balanceadores dejan de enviar llamadas nuevas mientras terminan las actuales
+	healthServer.Shutdown()
 
+	// Las llamadas en curso terminan antes de detener los workers que las atienden
+	for _, httpServer := range httpServers {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := httpServer.Shutdown(ctx); err != nil {
+			slog.Warn("Un servidor HTTP no terminó a tiempo", "address", httpServer.Addr, "error", err)
+		}
+		cancel()
+	}
 	grpcServer.GracefulStop()
-	log.Println("Servidor detenido correctamente")
+	fileSystemServer.StopWorkers()
+	slog.Info("Servidor detenido correctamente")
+}
+
+// Registra un error de arranque y termina el proceso
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -28,6 +28,25 @@ const (
 	FileSystemService_MoveFile_FullMethodName           = "/filesystem.FileSystemService/MoveFile"
 	FileSystemService_ListAll_FullMethodName            = "/filesystem.FileSystemService/ListAll"
 	FileSystemService_DownloadFile_FullMethodName       = "/filesystem.FileSystemService/DownloadFile"
+	FileSystemService_SearchContent_FullMethodName      = "/filesystem.FileSystemService/SearchContent"
+	FileSystemService_StorageStats_FullMethodName       = "/filesystem.FileSystemService/StorageStats"
+	FileSystemService_StatFile_FullMethodName           = "/filesystem.FileSystemService/StatFile"
+	FileSystemService_InitiateUpload_FullMethodName     = "/filesystem.FileSystemService/InitiateUpload"
+	FileSystemService_UploadPart_FullMethodName         = "/filesystem.FileSystemService/UploadPart"
+	FileSystemService_GetUploadStatus_FullMethodName    = "/filesystem.FileSystemService/GetUploadStatus"
+	FileSystemService_CompleteUpload_FullMethodName     = "/filesystem.FileSystemService/CompleteUpload"
+	FileSystemService_AbortUpload_FullMethodName        = "/filesystem.FileSystemService/AbortUpload"
+	FileSystemService_FileSignature_FullMethodName      = "/filesystem.FileSystemService/FileSignature"
+	FileSystemService_ApplyDelta_FullMethodName         = "/filesystem.FileSystemService/ApplyDelta"
+	FileSystemService_DownloadArchive_FullMethodName    = "/filesystem.FileSystemService/DownloadArchive"
+	FileSystemService_ReplicateFile_FullMethodName      = "/filesystem.FileSystemService/ReplicateFile"
+	FileSystemService_PullFile_FullMethodName           = "/filesystem.FileSystemService/PullFile"
+	FileSystemService_ReplicateToPeer_FullMethodName    = "/filesystem.FileSystemService/ReplicateToPeer"
+	FileSystemService_PullFromPeer_FullMethodName       = "/filesystem.FileSystemService/PullFromPeer"
+	FileSystemService_Inventory_FullMethodName          = "/filesystem.FileSystemService/Inventory"
+	FileSystemService_DirectoryDigest_FullMethodName    = "/filesystem.FileSystemService/DirectoryDigest"
+	FileSystemService_WatchPath_FullMethodName          = "/filesystem.FileSystemService/WatchPath"
+	FileSystemService_CreateSignedURL_FullMethodName    = "/filesystem.FileSystemService/CreateSignedURL"
 )
 
 // FileSystemServiceClient is the client API for FileSystemService service.
@@ -45,6 +64,32 @@ type FileSystemServiceClient interface {
 	MoveFile(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*Response, error)
 	ListAll(ctx context.Context, in *DirectoryRequest, opts ...grpc.CallOption) (*ListAllResponse, error)
 	DownloadFile(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*DownloadResponse, error)
+	SearchContent(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	StorageStats(ctx context.Context, in *StorageStatsRequest, opts ...grpc.CallOption) (*StorageStatsResponse, error)
+	StatFile(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error)
+	// Subidas reanudables por partes
+	InitiateUpload(ctx context.Context, in *InitiateUploadRequest, opts ...grpc.CallOption) (*UploadStatus, error)
+	UploadPart(ctx context.Context, in *UploadPartRequest, opts ...grpc.CallOption) (*UploadStatus, error)
+	GetUploadStatus(ctx context.Context, in *UploadSessionRequest, opts ...grpc.CallOption) (*UploadStatus, error)
+	CompleteUpload(ctx context.Context, in *CompleteUploadRequest, opts ...grpc.CallOption) (*Response, error)
+	AbortUpload(ctx context.Context, in *UploadSessionRequest, opts ...grpc.CallOption) (*Response, error)
+	// Actualización de un archivo enviando solo los bloques que cambiaron
+	FileSignature(ctx context.Context, in *FileSignatureRequest, opts ...grpc.CallOption) (*FileSignatureResponse, error)
+	ApplyDelta(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DeltaChunk, Response], error)
+	// Descarga de un directorio o una lista de rutas empaquetada en zip o tar.gz
+	DownloadArchive(ctx context.Context, in *ArchiveRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ArchiveChunk], error)
+	// Réplicas entre nodos
+	ReplicateFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ReplicaChunk, ReplicateResponse], error)
+	PullFile(ctx context.Context, in *PullFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReplicaChunk], error)
+	ReplicateToPeer(ctx context.Context, in *PeerReplicaRequest, opts ...grpc.CallOption) (*ReplicateResponse, error)
+	PullFromPeer(ctx context.Context, in *PeerReplicaRequest, opts ...grpc.CallOption) (*ReplicateResponse, error)
+	// Reconciliación con el catálogo del servidor central
+	Inventory(ctx context.Context, in *InventoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[InventoryEntry], error)
+	DirectoryDigest(ctx context.Context, in *DirectoryDigestRequest, opts ...grpc.CallOption) (*DirectoryDigestResponse, error)
+	// Eventos de cambios en el almacenamiento
+	WatchPath(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+	// URL firmada del gateway HTTP para descargar o subir un archivo sin otras credenciales
+	CreateSignedURL(ctx context.Context, in *CreateSignedURLRequest, opts ...grpc.CallOption) (*CreateSignedURLResponse, error)
 }
 
 type fileSystemServiceClient struct {
@@ -145,6 +190,238 @@ func (c *fileSystemServiceClient) DownloadFile(ctx context.Context, in *Download
 	return out, nil
 }
 
+func (c *fileSystemServiceClient) SearchContent(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, FileSystemService_SearchContent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) StorageStats(ctx context.Context, in *StorageStatsRequest, opts ...grpc.CallOption) (*StorageStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StorageStatsResponse)
+	err := c.cc.Invoke(ctx, FileSystemService_StorageStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) StatFile(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatResponse)
+	err := c.cc.Invoke(ctx, FileSystemService_StatFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) InitiateUpload(ctx context.Context, in *InitiateUploadRequest, opts ...grpc.CallOption) (*UploadStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadStatus)
+	err := c.cc.Invoke(ctx, FileSystemService_InitiateUpload_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) UploadPart(ctx context.Context, in *UploadPartRequest, opts ...grpc.CallOption) (*UploadStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadStatus)
+	err := c.cc.Invoke(ctx, FileSystemService_UploadPart_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) GetUploadStatus(ctx context.Context, in *UploadSessionRequest, opts ...grpc.CallOption) (*UploadStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadStatus)
+	err := c.cc.Invoke(ctx, FileSystemService_GetUploadStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) CompleteUpload(ctx context.Context, in *CompleteUploadRequest, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, FileSystemService_CompleteUpload_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) AbortUpload(ctx context.Context, in *UploadSessionRequest, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, FileSystemService_AbortUpload_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) FileSignature(ctx context.Context, in *FileSignatureRequest, opts ...grpc.CallOption) (*FileSignatureResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FileSignatureResponse)
+	err := c.cc.Invoke(ctx, FileSystemService_FileSignature_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) ApplyDelta(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DeltaChunk, Response], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileSystemService_ServiceDesc.Streams[0], FileSystemService_ApplyDelta_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DeltaChunk, Response]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_ApplyDeltaClient = grpc.ClientStreamingClient[DeltaChunk, Response]
+
+func (c *fileSystemServiceClient) DownloadArchive(ctx context.Context, in *ArchiveRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ArchiveChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileSystemService_ServiceDesc.Streams[1], FileSystemService_DownloadArchive_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ArchiveRequest, ArchiveChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_DownloadArchiveClient = grpc.ServerStreamingClient[ArchiveChunk]
+
+func (c *fileSystemServiceClient) ReplicateFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ReplicaChunk, ReplicateResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileSystemService_ServiceDesc.Streams[2], FileSystemService_ReplicateFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReplicaChunk, ReplicateResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_ReplicateFileClient = grpc.ClientStreamingClient[ReplicaChunk, ReplicateResponse]
+
+func (c *fileSystemServiceClient) PullFile(ctx context.Context, in *PullFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReplicaChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileSystemService_ServiceDesc.Streams[3], FileSystemService_PullFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PullFileRequest, ReplicaChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_PullFileClient = grpc.ServerStreamingClient[ReplicaChunk]
+
+func (c *fileSystemServiceClient) ReplicateToPeer(ctx context.Context, in *PeerReplicaRequest, opts ...grpc.CallOption) (*ReplicateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReplicateResponse)
+	err := c.cc.Invoke(ctx, FileSystemService_ReplicateToPeer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) PullFromPeer(ctx context.Context, in *PeerReplicaRequest, opts ...grpc.CallOption) (*ReplicateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReplicateResponse)
+	err := c.cc.Invoke(ctx, FileSystemService_PullFromPeer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) Inventory(ctx context.Context, in *InventoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[InventoryEntry], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileSystemService_ServiceDesc.Streams[4], FileSystemService_Inventory_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[InventoryRequest, InventoryEntry]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_InventoryClient = grpc.ServerStreamingClient[InventoryEntry]
+
+func (c *fileSystemServiceClient) DirectoryDigest(ctx context.Context, in *DirectoryDigestRequest, opts ...grpc.CallOption) (*DirectoryDigestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DirectoryDigestResponse)
+	err := c.cc.Invoke(ctx, FileSystemService_DirectoryDigest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemServiceClient) WatchPath(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileSystemService_ServiceDesc.Streams[5], FileSystemService_WatchPath_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_WatchPathClient = grpc.ServerStreamingClient[WatchEvent]
+
+func (c *fileSystemServiceClient) CreateSignedURL(ctx context.Context, in *CreateSignedURLRequest, opts ...grpc.CallOption) (*CreateSignedURLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateSignedURLResponse)
+	err := c.cc.Invoke(ctx, FileSystemService_CreateSignedURL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FileSystemServiceServer is the server API for FileSystemService service.
 // All implementations must embed UnimplementedFileSystemServiceServer
 // for forward compatibility.
@@ -160,6 +437,32 @@ type FileSystemServiceServer interface {
 	MoveFile(context.Context, *MoveRequest) (*Response, error)
 	ListAll(context.Context, *DirectoryRequest) (*ListAllResponse, error)
 	DownloadFile(context.Context, *DownloadRequest) (*DownloadResponse, error)
+	SearchContent(context.Context, *SearchRequest) (*SearchResponse, error)
+	StorageStats(context.Context, *StorageStatsRequest) (*StorageStatsResponse, error)
+	StatFile(context.Context, *StatRequest) (*StatResponse, error)
+	// Subidas reanudables por partes
+	InitiateUpload(context.Context, *InitiateUploadRequest) (*UploadStatus, error)
+	UploadPart(context.Context, *UploadPartRequest) (*UploadStatus, error)
+	GetUploadStatus(context.Context, *UploadSessionRequest) (*UploadStatus, error)
+	CompleteUpload(context.Context, *CompleteUploadRequest) (*Response, error)
+	AbortUpload(context.Context, *UploadSessionRequest) (*Response, error)
+	// Actualización de un archivo enviando solo los bloques que cambiaron
+	FileSignature(context.Context, *FileSignatureRequest) (*FileSignatureResponse, error)
+	ApplyDelta(grpc.ClientStreamingServer[DeltaChunk, Response]) error
+	// Descarga de un directorio o una lista de rutas empaquetada en zip o tar.gz
+	DownloadArchive(*ArchiveRequest, grpc.ServerStreamingServer[ArchiveChunk]) error
+	// Réplicas entre nodos
+	ReplicateFile(grpc.ClientStreamingServer[ReplicaChunk, ReplicateResponse]) error
+	PullFile(*PullFileRequest, grpc.ServerStreamingServer[ReplicaChunk]) error
+	ReplicateToPeer(context.Context, *PeerReplicaRequest) (*ReplicateResponse, error)
+	PullFromPeer(context.Context, *PeerReplicaRequest) (*ReplicateResponse, error)
+	// Reconciliación con el catálogo del servidor central
+	Inventory(*InventoryRequest, grpc.ServerStreamingServer[InventoryEntry]) error
+	DirectoryDigest(context.Context, *DirectoryDigestRequest) (*DirectoryDigestResponse, error)
+	// Eventos de cambios en el almacenamiento
+	WatchPath(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	// URL firmada del gateway HTTP para descargar o subir un archivo sin otras credenciales
+	CreateSignedURL(context.Context, *CreateSignedURLRequest) (*CreateSignedURLResponse, error)
 	mustEmbedUnimplementedFileSystemServiceServer()
 }
 
@@ -197,6 +500,63 @@ func (UnimplementedFileSystemServiceServer) ListAll(context.Context, *DirectoryR
 func (UnimplementedFileSystemServiceServer) DownloadFile(context.Context, *DownloadRequest) (*DownloadResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
 }
+func (UnimplementedFileSystemServiceServer) SearchContent(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchContent not implemented")
+}
+func (UnimplementedFileSystemServiceServer) StorageStats(context.Context, *StorageStatsRequest) (*StorageStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StorageStats not implemented")
+}
+func (UnimplementedFileSystemServiceServer) StatFile(context.Context, *StatRequest) (*StatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StatFile not implemented")
+}
+func (UnimplementedFileSystemServiceServer) InitiateUpload(context.Context, *InitiateUploadRequest) (*UploadStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InitiateUpload not implemented")
+}
+func (UnimplementedFileSystemServiceServer) UploadPart(context.Context, *UploadPartRequest) (*UploadStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UploadPart not implemented")
+}
+func (UnimplementedFileSystemServiceServer) GetUploadStatus(context.Context, *UploadSessionRequest) (*UploadStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUploadStatus not implemented")
+}
+func (UnimplementedFileSystemServiceServer) CompleteUpload(context.Context, *CompleteUploadRequest) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompleteUpload not implemented")
+}
+func (UnimplementedFileSystemServiceServer) AbortUpload(context.Context, *UploadSessionRequest) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AbortUpload not implemented")
+}
+func (UnimplementedFileSystemServiceServer) FileSignature(context.Context, *FileSignatureRequest) (*FileSignatureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FileSignature not implemented")
+}
+func (UnimplementedFileSystemServiceServer) ApplyDelta(grpc.ClientStreamingServer[DeltaChunk, Response]) error {
+	return status.Errorf(codes.Unimplemented, "method ApplyDelta not implemented")
+}
+func (UnimplementedFileSystemServiceServer) DownloadArchive(*ArchiveRequest, grpc.ServerStreamingServer[ArchiveChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadArchive not implemented")
+}
+func (UnimplementedFileSystemServiceServer) ReplicateFile(grpc.ClientStreamingServer[ReplicaChunk, ReplicateResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ReplicateFile not implemented")
+}
+func (UnimplementedFileSystemServiceServer) PullFile(*PullFileRequest, grpc.ServerStreamingServer[ReplicaChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method PullFile not implemented")
+}
+func (UnimplementedFileSystemServiceServer) ReplicateToPeer(context.Context, *PeerReplicaRequest) (*ReplicateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplicateToPeer not implemented")
+}
+func (UnimplementedFileSystemServiceServer) PullFromPeer(context.Context, *PeerReplicaRequest) (*ReplicateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PullFromPeer not implemented")
+}
+func (UnimplementedFileSystemServiceServer) Inventory(*InventoryRequest, grpc.ServerStreamingServer[InventoryEntry]) error {
+	return status.Errorf(codes.Unimplemented, "method Inventory not implemented")
+}
+func (UnimplementedFileSystemServiceServer) DirectoryDigest(context.Context, *DirectoryDigestRequest) (*DirectoryDigestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DirectoryDigest not implemented")
+}
+func (UnimplementedFileSystemServiceServer) WatchPath(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchPath not implemented")
+}
+func (UnimplementedFileSystemServiceServer) CreateSignedURL(context.Context, *CreateSignedURLRequest) (*CreateSignedURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSignedURL not implemented")
+}
 func (UnimplementedFileSystemServiceServer) mustEmbedUnimplementedFileSystemServiceServer() {}
 func (UnimplementedFileSystemServiceServer) testEmbeddedByValue()                           {}
 
@@ -380,48 +740,683 @@ func _FileSystemService_DownloadFile_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
-// FileSystemService_ServiceDesc is the grpc.ServiceDesc for FileSystemService service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var FileSystemService_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "filesystem.FileSystemService",
-	HandlerType: (*FileSystemServiceServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "UploadFile",
-			Handler:    _FileSystemService_UploadFile_Handler,
-		},
-		{
-			MethodName: "CreateDirectory",
-			Handler:    _FileSystemService_CreateDirectory_Handler,
-		},
-		{
-			MethodName: "CreateSubdirectory",
-			Handler:    _FileSystemService_CreateSubdirectory_Handler,
-		},
-		{
-			MethodName: "RenameFile",
-			Handler:    _FileSystemService_RenameFile_Handler,
-		},
-		{
-			MethodName: "DeleteFile",
-			Handler:    _FileSystemService_DeleteFile_Handler,
-		},
-		{
-			MethodName: "ListFiles",
-			Handler:    _FileSystemService_ListFiles_Handler,
-		},
-		{
-			MethodName: "MoveFile",
-			Handler:    _FileSystemService_MoveFile_Handler,
-		},
-		{
-			MethodName: "ListAll",
-			Handler:    _FileSystemService_ListAll_Handler,
-		},
-		{
-			MethodName: "DownloadFile",
-			Handler:    _FileSystemService_DownloadFile_Handler,
+func _FileSystemService_SearchContent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).SearchContent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_SearchContent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).SearchContent(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_StorageStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StorageStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).StorageStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_StorageStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).StorageStats(ctx, req.(*StorageStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_StatFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).StatFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_StatFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).StatFile(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_InitiateUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InitiateUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).InitiateUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_InitiateUpload_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).InitiateUpload(ctx, req.(*InitiateUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_UploadPart_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadPartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).UploadPart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_UploadPart_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).UploadPart(ctx, req.(*UploadPartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_GetUploadStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).GetUploadStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_GetUploadStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).GetUploadStatus(ctx, req.(*UploadSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_CompleteUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompleteUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).CompleteUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_CompleteUpload_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).CompleteUpload(ctx, req.(*CompleteUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_AbortUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).AbortUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_AbortUpload_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).AbortUpload(ctx, req.(*UploadSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_FileSignature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FileSignatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).FileSignature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_FileSignature_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).FileSignature(ctx, req.(*FileSignatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_ApplyDelta_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileSystemServiceServer).ApplyDelta(&grpc.GenericServerStream[DeltaChunk, Response]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_ApplyDeltaServer = grpc.ClientStreamingServer[DeltaChunk, Response]
+
+func _FileSystemService_DownloadArchive_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ArchiveRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileSystemServiceServer).DownloadArchive(m, &grpc.GenericServerStream[ArchiveRequest, ArchiveChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_DownloadArchiveServer = grpc.ServerStreamingServer[ArchiveChunk]
+
+func _FileSystemService_ReplicateFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileSystemServiceServer).ReplicateFile(&grpc.GenericServerStream[ReplicaChunk, ReplicateResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_ReplicateFileServer = grpc.ClientStreamingServer[ReplicaChunk, ReplicateResponse]
+
+func _FileSystemService_PullFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PullFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileSystemServiceServer).PullFile(m, &grpc.GenericServerStream[PullFileRequest, ReplicaChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_PullFileServer = grpc.ServerStreamingServer[ReplicaChunk]
+
+func _FileSystemService_ReplicateToPeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerReplicaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).ReplicateToPeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_ReplicateToPeer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).ReplicateToPeer(ctx, req.(*PeerReplicaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_PullFromPeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerReplicaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).PullFromPeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_PullFromPeer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).PullFromPeer(ctx, req.(*PeerReplicaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_Inventory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(InventoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileSystemServiceServer).Inventory(m, &grpc.GenericServerStream[InventoryRequest, InventoryEntry]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_InventoryServer = grpc.ServerStreamingServer[InventoryEntry]
+
+func _FileSystemService_DirectoryDigest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DirectoryDigestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).DirectoryDigest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_DirectoryDigest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).DirectoryDigest(ctx, req.(*DirectoryDigestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemService_WatchPath_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileSystemServiceServer).WatchPath(m, &grpc.GenericServerStream[WatchRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSystemService_WatchPathServer = grpc.ServerStreamingServer[WatchEvent]
+
+func _FileSystemService_CreateSignedURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSignedURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServiceServer).CreateSignedURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystemService_CreateSignedURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServiceServer).CreateSignedURL(ctx, req.(*CreateSignedURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FileSystemService_ServiceDesc is the grpc.ServiceDesc for FileSystemService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FileSystemService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "filesystem.FileSystemService",
+	HandlerType: (*FileSystemServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "UploadFile",
+			Handler:    _FileSystemService_UploadFile_Handler,
+		},
+		{
+			MethodName: "CreateDirectory",
+			Handler:    _FileSystemService_CreateDirectory_Handler,
+		},
+		{
+			MethodName: "CreateSubdirectory",
+			Handler:    _FileSystemService_CreateSubdirectory_Handler,
+		},
+		{
+			MethodName: "RenameFile",
+			Handler:    _FileSystemService_RenameFile_Handler,
+		},
+		{
+			MethodName: "DeleteFile",
+			Handler:    _FileSystemService_DeleteFile_Handler,
+		},
+		{
+			MethodName: "ListFiles",
+			Handler:    _FileSystemService_ListFiles_Handler,
+		},
+		{
+			MethodName: "MoveFile",
+			Handler:    _FileSystemService_MoveFile_Handler,
+		},
+		{
+			MethodName: "ListAll",
+			Handler:    _FileSystemService_ListAll_Handler,
+		},
+		{
+			MethodName: "DownloadFile",
+			Handler:    _FileSystemService_DownloadFile_Handler,
+		},
+		{
+			MethodName: "SearchContent",
+			Handler:    _FileSystemService_SearchContent_Handler,
+		},
+		{
+			MethodName: "StorageStats",
+			Handler:    _FileSystemService_StorageStats_Handler,
+		},
+		{
+			MethodName: "StatFile",
+			Handler:    _FileSystemService_StatFile_Handler,
+		},
+		{
+			MethodName: "InitiateUpload",
+			Handler:    _FileSystemService_InitiateUpload_Handler,
+		},
+		{
+			MethodName: "UploadPart",
+			Handler:    _FileSystemService_UploadPart_Handler,
+		},
+		{
+			MethodName: "GetUploadStatus",
+			Handler:    _FileSystemService_GetUploadStatus_Handler,
+		},
+		{
+			MethodName: "CompleteUpload",
+			Handler:    _FileSystemService_CompleteUpload_Handler,
+		},
+		{
+			MethodName: "AbortUpload",
+			Handler:    _FileSystemService_AbortUpload_Handler,
+		},
+		{
+			MethodName: "FileSignature",
+			Handler:    _FileSystemService_FileSignature_Handler,
+		},
+		{
+			MethodName: "ReplicateToPeer",
+			Handler:    _FileSystemService_ReplicateToPeer_Handler,
+		},
+		{
+			MethodName: "PullFromPeer",
+			Handler:    _FileSystemService_PullFromPeer_Handler,
+		},
+		{
+			MethodName: "DirectoryDigest",
+			Handler:    _FileSystemService_DirectoryDigest_Handler,
+		},
+		{
+			MethodName: "CreateSignedURL",
+			Handler:    _FileSystemService_CreateSignedURL_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ApplyDelta",
+			Handler:       _FileSystemService_ApplyDelta_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadArchive",
+			Handler:       _FileSystemService_DownloadArchive_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReplicateFile",
+			Handler:       _FileSystemService_ReplicateFile_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "PullFile",
+			Handler:       _FileSystemService_PullFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Inventory",
+			Handler:       _FileSystemService_Inventory_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchPath",
+			Handler:       _FileSystemService_WatchPath_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/filesystem.proto",
+}
+
+const (
+	AdminService_RotateMasterKey_FullMethodName = "/filesystem.AdminService/RotateMasterKey"
+	AdminService_ScrubStatus_FullMethodName     = "/filesystem.AdminService/ScrubStatus"
+	AdminService_ScrubPath_FullMethodName       = "/filesystem.AdminService/ScrubPath"
+	AdminService_QueryAudit_FullMethodName      = "/filesystem.AdminService/QueryAudit"
+	AdminService_ReloadConfig_FullMethodName    = "/filesystem.AdminService/ReloadConfig"
+)
+
+// AdminServiceClient is the client API for AdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Operaciones de administración del nodo
+type AdminServiceClient interface {
+	RotateMasterKey(ctx context.Context, in *RotateMasterKeyRequest, opts ...grpc.CallOption) (*RotateMasterKeyResponse, error)
+	ScrubStatus(ctx context.Context, in *ScrubStatusRequest, opts ...grpc.CallOption) (*ScrubStatusResponse, error)
+	ScrubPath(ctx context.Context, in *ScrubPathRequest, opts ...grpc.CallOption) (*ScrubPathResponse, error)
+	QueryAudit(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditResponse, error)
+	// Vuelve a leer la configuración y aplica los cambios que no requieren reiniciar
+	ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error)
+}
+
+type adminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminServiceClient(cc grpc.ClientConnInterface) AdminServiceClient {
+	return &adminServiceClient{cc}
+}
+
+func (c *adminServiceClient) RotateMasterKey(ctx context.Context, in *RotateMasterKeyRequest, opts ...grpc.CallOption) (*RotateMasterKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RotateMasterKeyResponse)
+	err := c.cc.Invoke(ctx, AdminService_RotateMasterKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) ScrubStatus(ctx context.Context, in *ScrubStatusRequest, opts ...grpc.CallOption) (*ScrubStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ScrubStatusResponse)
+	err := c.cc.Invoke(ctx, AdminService_ScrubStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) ScrubPath(ctx context.Context, in *ScrubPathRequest, opts ...grpc.CallOption) (*ScrubPathResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ScrubPathResponse)
+	err := c.cc.Invoke(ctx, AdminService_ScrubPath_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) QueryAudit(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryAuditResponse)
+	err := c.cc.Invoke(ctx, AdminService_QueryAudit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReloadConfigResponse)
+	err := c.cc.Invoke(ctx, AdminService_ReloadConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServiceServer is the server API for AdminService service.
+// All implementations must embed UnimplementedAdminServiceServer
+// for forward compatibility.
+//
+// Operaciones de administración del nodo
+type AdminServiceServer interface {
+	RotateMasterKey(context.Context, *RotateMasterKeyRequest) (*RotateMasterKeyResponse, error)
+	ScrubStatus(context.Context, *ScrubStatusRequest) (*ScrubStatusResponse, error)
+	ScrubPath(context.Context, *ScrubPathRequest) (*ScrubPathResponse, error)
+	QueryAudit(context.Context, *QueryAuditRequest) (*QueryAuditResponse, error)
+	// Vuelve a leer la configuración y aplica los cambios que no requieren reiniciar
+	ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error)
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+// UnimplementedAdminServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAdminServiceServer struct{}
+
+func (UnimplementedAdminServiceServer) RotateMasterKey(context.Context, *RotateMasterKeyRequest) (*RotateMasterKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateMasterKey not implemented")
+}
+func (UnimplementedAdminServiceServer) ScrubStatus(context.Context, *ScrubStatusRequest) (*ScrubStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScrubStatus not implemented")
+}
+func (UnimplementedAdminServiceServer) ScrubPath(context.Context, *ScrubPathRequest) (*ScrubPathResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScrubPath not implemented")
+}
+func (UnimplementedAdminServiceServer) QueryAudit(context.Context, *QueryAuditRequest) (*QueryAuditResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryAudit not implemented")
+}
+func (UnimplementedAdminServiceServer) ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadConfig not implemented")
+}
+func (UnimplementedAdminServiceServer) mustEmbedUnimplementedAdminServiceServer() {}
+func (UnimplementedAdminServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServiceServer will
+// result in compilation errors.
+type UnsafeAdminServiceServer interface {
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+func RegisterAdminServiceServer(s grpc.ServiceRegistrar, srv AdminServiceServer) {
+	// If the following call pancis, it indicates UnimplementedAdminServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AdminService_ServiceDesc, srv)
+}
+
+func _AdminService_RotateMasterKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RotateMasterKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).RotateMasterKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_RotateMasterKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).RotateMasterKey(ctx, req.(*RotateMasterKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_ScrubStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScrubStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).ScrubStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_ScrubStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).ScrubStatus(ctx, req.(*ScrubStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_ScrubPath_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScrubPathRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).ScrubPath(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_ScrubPath_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).ScrubPath(ctx, req.(*ScrubPathRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_QueryAudit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).QueryAudit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_QueryAudit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).QueryAudit(ctx, req.(*QueryAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_ReloadConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).ReloadConfig(ctx, req.(*ReloadConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AdminService_ServiceDesc is the grpc.ServiceDesc for AdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "filesystem.AdminService",
+	HandlerType: (*AdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RotateMasterKey",
+			Handler:    _AdminService_RotateMasterKey_Handler,
+		},
+		{
+			MethodName: "ScrubStatus",
+			Handler:    _AdminService_ScrubStatus_Handler,
+		},
+		{
+			MethodName: "ScrubPath",
+			Handler:    _AdminService_ScrubPath_Handler,
+		},
+		{
+			MethodName: "QueryAudit",
+			Handler:    _AdminService_QueryAudit_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _AdminService_ReloadConfig_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	archiveFormatZip   = "zip"
+	archiveFormatTarGz = "tar.gz"
+	// Bytes de cada mensaje de DownloadArchive
+	archiveChunkSize      = 256 * 1024
+	defaultMaxArchiveSize = 10 << 30
+)
+
+// Archivo que va en el paquete, con su nombre dentro de él
+type archiveEntry struct {
+	filePath string
+	name     string
+	size     int64
+	modTime  time.Time
+}
+
+// Empaqueta en zip o tar.gz los archivos pedidos y lo envía a medida que se genera, sin
+// escribirlo en disco. Antes de enviar nada se comprueba que el contenido no supere el límite.
+func (s *Server) DownloadArchive(req *pb.ArchiveRequest, stream pb.FileSystemService_DownloadArchiveServer) error {
+	ctx := stream.Context()
+	format := strings.ToLower(req.Format)
+	if format == "" {
+		format = archiveFormatZip
+	}
+	if format != archiveFormatZip && format != archiveFormatTarGz {
+		return status.Errorf(codes.InvalidArgument, "Formato inválido: %s (valores posibles: %s, %s)", req.Format, archiveFormatZip, archiveFormatTarGz)
+	}
+	for _, pattern := range append(append([]string(nil), req.Include...), req.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return status.Errorf(codes.InvalidArgument, "Patrón inválido: %s", pattern)
+		}
+	}
+	if req.MaxSize < 0 {
+		return status.Errorf(codes.InvalidArgument, "El tamaño máximo no puede ser negativo")
+	}
+	maxSize := s.maxArchiveSize
+	if req.MaxSize > 0 {
+		maxSize = min(maxSize, req.MaxSize)
+	}
+
+	entries, total, err := s.archiveEntries(req)
+	if err != nil {
+		return err
+	}
+	if total > maxSize {
+		return status.Errorf(codes.OutOfRange, "El contenido ocupa %d bytes y el máximo es %d", total, maxSize)
+	}
+
+	_, span := startSpan(ctx, "archive.write", attribute.String("format", format), attribute.Int("files", len(entries)), attribute.Int64("size", total))
+	w := &archiveStreamWriter{send: stream.Send}
+	if format == archiveFormatZip {
+		err = s.writeZip(w, entries)
+	} else {
+		err = s.writeTarGz(w, entries)
+	}
+	if err == nil {
+		err = w.flush()
+	}
+	endSpan(span, err)
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Internal, "Error generando el paquete: %v", err)
+	}
+	return nil
+}
+
+// Recorre las rutas pedidas y devuelve los archivos que pasan los filtros y la suma de sus tamaños
+func (s *Server) archiveEntries(req *pb.ArchiveRequest) ([]archiveEntry, int64, error) {
+	paths := req.Paths
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	var entries []archiveEntry
+	var total int64
+	seen := make(map[string]bool)
+	for _, relPath := range paths {
+		fullPath, err := resolveStoragePath(relPath)
+		if err != nil {
+			return nil, 0, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+		}
+		if _, err := os.Stat(fullPath); err != nil {
+			if os.IsNotExist(err) {
+				return nil, 0, status.Errorf(codes.NotFound, "El archivo/directorio no existe: %s", relPath)
+			}
+			return nil, 0, status.Errorf(codes.Internal, "Error al obtener información de la ruta: %v", err)
+		}
+		err = filepath.WalkDir(fullPath, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Se borró mientras se recorría el directorio
+				if os.IsNotExist(err) && filePath != fullPath {
+					return nil
+				}
+				return err
+			}
+			rel, err := filepath.Rel(rootDirectory, filePath)
+			if err != nil {
+				return err
+			}
+			name := indexKey(rel)
+			if d.IsDir() {
+				if name != "" && filePath != fullPath && matchesAny(req.Exclude, name) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// Los temporales de escrituras en curso no son de nadie
+			if !d.Type().IsRegular() || isStagingName(d.Name()) || seen[name] {
+				return nil
+			}
+			if matchesAny(req.Exclude, name) || (len(req.Include) > 0 && !matchesAny(req.Include, name)) {
+				return nil
+			}
+			stored, err := s.statStoredFile(filePath)
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			seen[name] = true
+			entries = append(entries, archiveEntry{filePath: filePath, name: name, size: stored.size, modTime: info.ModTime()})
+			total += stored.size
+			return nil
+		})
+		if err != nil {
+			return nil, 0, status.Errorf(codes.Internal, "Error recorriendo el almacenamiento: %v", err)
+		}
+	}
+	return entries, total, nil
+}
+
+// Indica si name coincide con algún glob. Un patrón sin "/" se compara también con el último
+// elemento de la ruta, de modo que "*.log" omite los .log de cualquier directorio.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Server) writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		err := s.writeArchiveEntry(e, func(size int64) (io.Writer, error) {
+			return zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.modTime})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (s *Server) writeTarGz(w io.Writer, entries []archiveEntry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		err := s.writeArchiveEntry(e, func(size int64) (io.Writer, error) {
+			err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0644, Size: size, ModTime: e.modTime, Typeflag: tar.TypeReg, Format: tar.FormatPAX})
+			return tw, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Copia el contenido original de un archivo en la entrada que crea create con su tamaño
+func (s *Server) writeArchiveEntry(e archiveEntry, create func(size int64) (io.Writer, error)) error {
+	content, err := s.openStoredFile(e.filePath)
+	if os.IsNotExist(err) {
+		// Se borró después de recorrer el directorio
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	// Si el archivo creció desde el recorrido, el límite ya comprobado dejaría de valer
+	if content.size > e.size {
+		return status.Errorf(codes.Aborted, "%s cambió mientras se generaba el paquete", e.name)
+	}
+	out, err := create(content.size)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, content.reader())
+	return err
+}
+
+// Agrupa lo que escriben zip y tar en mensajes de archiveChunkSize bytes
+type archiveStreamWriter struct {
+	send func(*pb.ArchiveChunk) error
+	buf  []byte
+}
+
+func (w *archiveStreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.buf == nil {
+			w.buf = make([]byte, 0, archiveChunkSize)
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *archiveStreamWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	// Cada mensaje lleva su propio buffer: gRPC puede seguir usándolo después de Send
+	err := w.send(&pb.ArchiveChunk{Data: w.buf})
+	w.buf = nil
+	return err
+}
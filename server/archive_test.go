@@ -0,0 +1,200 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Junta lo que DownloadArchive envía
+type archiveRecorder struct {
+	grpc.ServerStream
+	buf      bytes.Buffer
+	messages int
+}
+
+func (r *archiveRecorder) Context() context.Context {
+	return context.Background()
+}
+
+func (r *archiveRecorder) Send(chunk *pb.ArchiveChunk) error {
+	if len(chunk.Data) > archiveChunkSize {
+		return status.Errorf(codes.Internal, "mensaje de %d bytes", len(chunk.Data))
+	}
+	r.buf.Write(chunk.Data)
+	r.messages++
+	return nil
+}
+
+// Contenido de cada archivo del paquete
+func unpackArchive(t *testing.T, format string, data []byte) map[string][]byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	if format == archiveFormatTarGz {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return files
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if files[h.Name], err = io.ReadAll(tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files[f.Name], err = io.ReadAll(rc); err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+	}
+	return files
+}
+
+func TestDownloadArchive(t *testing.T) {
+	s := newTestServer(t, storageVariants["dedup-encrypted-gz"])
+	stored := map[string][]byte{
+		"docs/a.txt":         textBytes(3*defaultSegmentSize + 5),
+		"docs/b.log":         []byte("registro"),
+		"docs/sub/c.txt":     randomBytes(t, 1000),
+		"docs/tmp/d.txt":     []byte("temporal"),
+		"docs/vacío.txt":     {},
+		"otros/e.txt":        []byte("fuera del directorio"),
+		"otros/f.bin":        randomBytes(t, 10),
+		"docs/sub/g.log":     []byte("otro registro"),
+		"docs/sub/deep/h.md": []byte("# h"),
+	}
+	for name, data := range stored {
+		if err := os.MkdirAll(filepath.Join(rootDirectory, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.writeStoredFile(filepath.Join(rootDirectory, name), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Temporal de una escritura en curso
+	if err := os.WriteFile(filepath.Join(rootDirectory, "docs", ".a.txt-123"), []byte("a medias"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.ArchiveRequest
+		want []string
+	}{
+		{"directorio", &pb.ArchiveRequest{Paths: []string{"docs"}},
+			[]string{"docs/a.txt", "docs/b.log", "docs/sub/c.txt", "docs/sub/deep/h.md", "docs/sub/g.log", "docs/tmp/d.txt", "docs/vacío.txt"}},
+		{"lista", &pb.ArchiveRequest{Paths: []string{"otros/e.txt", "docs/sub", "docs/sub/c.txt"}, Format: archiveFormatTarGz},
+			[]string{"otros/e.txt", "docs/sub/c.txt", "docs/sub/deep/h.md", "docs/sub/g.log"}},
+		{"excluir", &pb.ArchiveRequest{Paths: []string{"docs"}, Exclude: []string{"*.log", "docs/tmp"}},
+			[]string{"docs/a.txt", "docs/sub/c.txt", "docs/sub/deep/h.md", "docs/vacío.txt"}},
+		{"incluir", &pb.ArchiveRequest{Include: []string{"*.txt"}, Exclude: []string{"docs/sub/*"}, Format: archiveFormatTarGz},
+			[]string{"docs/a.txt", "docs/tmp/d.txt", "docs/vacío.txt", "otros/e.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &archiveRecorder{}
+			if err := s.DownloadArchive(tt.req, rec); err != nil {
+				t.Fatal(err)
+			}
+			files := unpackArchive(t, tt.req.Format, rec.buf.Bytes())
+			var names []string
+			for name, data := range files {
+				names = append(names, name)
+				if !bytes.Equal(data, stored[name]) {
+					t.Fatalf("%s: el contenido no coincide", name)
+				}
+			}
+			if len(files) != len(tt.want) {
+				t.Fatalf("se empaquetaron %v, se esperaban %v", names, tt.want)
+			}
+			for _, name := range tt.want {
+				if _, ok := files[name]; !ok {
+					t.Fatalf("falta %s en el paquete (%v)", name, names)
+				}
+			}
+		})
+	}
+
+	// El orden de los archivos sigue el de las rutas pedidas
+	rec := &archiveRecorder{}
+	if err := s.DownloadArchive(&pb.ArchiveRequest{Paths: []string{"otros", "docs/sub/deep"}}, rec); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.buf.Bytes()), int64(rec.buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, f := range zr.File {
+		order = append(order, f.Name)
+	}
+	if want := []string{"otros/e.txt", "otros/f.bin", "docs/sub/deep/h.md"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("orden %v, se esperaba %v", order, want)
+	}
+}
+
+func TestDownloadArchiveRejects(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.Storage.MaxArchiveSize = 100 })
+	if err := os.MkdirAll(filepath.Join(rootDirectory, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"a.txt": 60, "b.txt": 50} {
+		if err := s.writeStoredFile(filepath.Join(rootDirectory, "dir", name), textBytes(size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		req  *pb.ArchiveRequest
+		code codes.Code
+	}{
+		{"límite del nodo", &pb.ArchiveRequest{Paths: []string{"dir"}}, codes.OutOfRange},
+		{"límite pedido", &pb.ArchiveRequest{Paths: []string{"dir/a.txt"}, MaxSize: 59}, codes.OutOfRange},
+		{"no supera el límite del nodo", &pb.ArchiveRequest{Paths: []string{"dir/a.txt"}, MaxSize: 1000}, codes.OK},
+		{"formato", &pb.ArchiveRequest{Paths: []string{"dir"}, Format: "rar"}, codes.InvalidArgument},
+		{"patrón", &pb.ArchiveRequest{Paths: []string{"dir"}, Include: []string{"[a-"}}, codes.InvalidArgument},
+		{"no existe", &pb.ArchiveRequest{Paths: []string{"nada"}}, codes.NotFound},
+		{"fuera de la raíz", &pb.ArchiveRequest{Paths: []string{"../x"}}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &archiveRecorder{}
+			err := s.DownloadArchive(tt.req, rec)
+			if status.Code(err) != tt.code {
+				t.Fatalf("se esperaba %v, se obtuvo %v", tt.code, err)
+			}
+			if err != nil && rec.messages > 0 {
+				t.Fatal("se envió parte del paquete antes de rechazarlo")
+			}
+		})
+	}
+}
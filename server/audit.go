@@ -0,0 +1,420 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultAuditFile     = "audit.log"
+	defaultAuditMaxSize  = 50 * 1024 * 1024
+	defaultAuditMaxFiles = 10
+	defaultAuditLimit    = 100
+	maxAuditLimit        = 1000
+)
+
+// Metadatos en los que quien llama declara su identidad, en orden de preferencia
+var claimedIdentityKeys = []string{"x-caller-id", "x-user-id"}
+
+// Registro de una llamada a la API
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Peer       string    `json:"peer"`
+	Identity   string    `json:"identity,omitempty"`         // Principal autenticado, ver callerPrincipal
+	Claimed    string    `json:"claimed_identity,omitempty"` // Identidad que declaró el cliente, sin verificar
+	RequestID  string    `json:"request_id,omitempty"`
+	RPC        string    `json:"rpc"`
+	Paths      []string  `json:"paths,omitempty"`
+	Bytes      int64     `json:"bytes,omitempty"`
+	Code       string    `json:"code"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+func (e *auditEntry) addPath(p string) {
+	if p == "" {
+		return
+	}
+	p = indexKey(p)
+	for _, existing := range e.Paths {
+		if existing == p {
+			return
+		}
+	}
+	e.Paths = append(e.Paths, p)
+}
+
+// Agrega las rutas y los bytes que trae un mensaje de petición o de respuesta
+func (e *auditEntry) addMessage(msg any) {
+	switch m := msg.(type) {
+	case *pb.UploadRequest:
+		// El tamaño se toma de la respuesta
+		e.addPath(path.Join(m.Directory, m.Filename))
+	case *pb.DirectoryRequest:
+		e.addPath(m.Path)
+	case *pb.SubdirectoryRequest:
+		e.addPath(path.Join(m.ParentDirectory, m.SubdirectoryName))
+	case *pb.RenameRequest:
+		e.addPath(m.OldName)
+		e.addPath(m.NewName)
+	case *pb.DeleteRequest:
+		e.addPath(m.Path)
+	case *pb.MoveRequest:
+		e.addPath(m.SourcePath)
+		e.addPath(m.DestinationPath)
+	case *pb.DownloadRequest:
+		e.addPath(m.Path)
+	case *pb.DownloadResponse:
+		e.Bytes += m.Filesize
+	case *pb.SearchRequest:
+		e.addPath(m.Path)
+	case *pb.StatRequest:
+		e.addPath(m.Path)
+	case *pb.InitiateUploadRequest:
+		e.addPath(path.Join(m.Directory, m.Filename))
+	case *pb.UploadPartRequest:
+		e.Bytes += int64(len(m.Content))
+	case *pb.UploadStatus:
+		e.addPath(path.Join(m.Directory, m.Filename))
+	case *pb.Response:
+		// FilePath incluye el directorio raíz
+		if rel, err := filepath.Rel(rootDirectory, m.FilePath); m.FilePath != "" && err == nil {
+			e.addPath(rel)
+		}
+		e.Bytes += m.FileSize
+	case *pb.FileSignatureRequest:
+		e.addPath(m.Path)
+	case *pb.DeltaChunk:
+		// El tamaño se toma de la respuesta
+		if m.Header != nil {
+			e.addPath(m.Header.Path)
+		}
+	case *pb.ReplicaChunk:
+		if m.Metadata != nil {
+			e.addPath(m.Metadata.Path)
+		}
+		e.Bytes += int64(len(m.Data))
+	case *pb.PullFileRequest:
+		e.addPath(m.Path)
+	case *pb.PeerReplicaRequest:
+		e.addPath(m.Path)
+	case *pb.ReplicateResponse:
+		e.Bytes += m.BytesTransferred
+	case *pb.ArchiveRequest:
+		for _, p := range m.Paths {
+			e.addPath(p)
+		}
+	case *pb.ArchiveChunk:
+		e.Bytes += int64(len(m.Data))
+	case *pb.InventoryRequest:
+		e.addPath(m.Path)
+	case *pb.DirectoryDigestRequest:
+		e.addPath(m.Path)
+	case *pb.WatchRequest:
+		e.addPath(m.Path)
+	case *pb.ScrubPathRequest:
+		e.addPath(m.Path)
+	case *pb.CreateSignedURLRequest:
+		e.addPath(m.Path)
+	}
+}
+
+// Identidad que declara quien llama en los metadatos. Cualquiera puede enviar cualquier valor,
+// así que solo se registra como dato aparte de la identidad autenticada.
+func claimedIdentity(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, key := range claimedIdentityKeys {
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func (s *Server) newAuditEntry(ctx context.Context, fullMethod string) *auditEntry {
+	entry := &auditEntry{
+		Time:      time.Now(),
+		Identity:  s.callerPrincipal(ctx),
+		Claimed:   claimedIdentity(ctx),
+		RequestID: RequestID(ctx),
+		RPC:       path.Base(fullMethod),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		entry.Peer = p.Addr.String()
+	}
+	return entry
+}
+
+func (e *auditEntry) finish(err error) {
+	e.DurationMs = float64(time.Since(e.Time).Microseconds()) / 1000
+	st := status.Convert(err)
+	e.Code = st.Code().String()
+	if err != nil {
+		e.Error = st.Message()
+	}
+}
+
+// Registro de auditoría en líneas JSON. Solo se agrega al final y rota por tamaño.
+type auditLog struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newAuditLog(path string, maxSize int64, maxFiles int) (*auditLog, error) {
+	a := &auditLog{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *auditLog) open() error {
+	if dir := filepath.Dir(a.path); dir != "." {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+func (a *auditLog) write(entry *auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("Error serializando el registro de auditoría", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			slog.Error("Error rotando el registro de auditoría", "error", err)
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		slog.Error("Error escribiendo el registro de auditoría", "error", err)
+	}
+}
+
+// Renombra el archivo actual con la fecha y borra los más antiguos. Debe llamarse con a.mu tomado.
+func (a *auditLog) rotate() error {
+	a.file.Close()
+	rotated := a.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(a.path, rotated); err != nil {
+		// Se sigue escribiendo en el mismo archivo
+		return a.open()
+	}
+	if err := a.open(); err != nil {
+		return err
+	}
+
+	files := a.rotatedFiles()
+	for len(files) > a.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Archivos rotados, del más antiguo al más reciente
+func (a *auditLog) rotatedFiles() []string {
+	matches, _ := filepath.Glob(a.path + ".*")
+	sort.Strings(matches)
+	return matches
+}
+
+// Recorre los registros en orden cronológico, desde los archivos rotados hasta el actual
+func (a *auditLog) scan(fn func(*auditEntry)) error {
+	a.mu.Lock()
+	files := append(a.rotatedFiles(), a.path)
+	a.mu.Unlock()
+
+	for _, name := range files {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			// Se borró al rotar mientras se consultaba
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var entry auditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			fn(&entry)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Interceptor que registra cada llamada unaria en la auditoría
+func (s *Server) AuditUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		entry := s.newAuditEntry(ctx, info.FullMethod)
+		entry.addMessage(req)
+		resp, err := handler(ctx, req)
+		if err == nil {
+			entry.addMessage(resp)
+		}
+		entry.finish(err)
+		s.audit.write(entry)
+		return resp, err
+	}
+}
+
+// Stream que va juntando las rutas y los bytes de los mensajes para la auditoría
+type auditedStream struct {
+	grpc.ServerStream
+	entry *auditEntry
+}
+
+func (as *auditedStream) RecvMsg(m any) error {
+	err := as.ServerStream.RecvMsg(m)
+	if err == nil {
+		as.entry.addMessage(m)
+	}
+	return err
+}
+
+func (as *auditedStream) SendMsg(m any) error {
+	err := as.ServerStream.SendMsg(m)
+	if err == nil {
+		as.entry.addMessage(m)
+	}
+	return err
+}
+
+// Interceptor que registra cada llamada con streaming al terminar
+func (s *Server) AuditStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		entry := s.newAuditEntry(ss.Context(), info.FullMethod)
+		err := handler(srv, &auditedStream{ServerStream: ss, entry: entry})
+		entry.finish(err)
+		s.audit.write(entry)
+		return err
+	}
+}
+
+func auditEntryToProto(e *auditEntry) *pb.AuditRecord {
+	return &pb.AuditRecord{
+		Timestamp:       e.Time.UnixNano(),
+		Peer:            e.Peer,
+		Identity:        e.Identity,
+		ClaimedIdentity: e.Claimed,
+		Rpc:             e.RPC,
+		Paths:           e.Paths,
+		Bytes:           e.Bytes,
+		Code:            e.Code,
+		Error:           e.Error,
+		DurationMs:      e.DurationMs,
+		RequestId:       e.RequestID,
+	}
+}
+
+// Consulta la auditoría por rango de fechas, ruta, RPC e identidad. Devuelve primero los más recientes.
+func (s *Server) QueryAudit(ctx context.Context, req *pb.QueryAuditRequest) (*pb.QueryAuditResponse, error) {
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	limit = min(limit, maxAuditLimit)
+	prefix := ""
+	if req.Path != "" {
+		prefix = indexKey(req.Path)
+	}
+
+	// Se guardan solo los últimos limit registros que cumplen los filtros
+	var matches []*auditEntry
+	err := s.audit.scan(func(e *auditEntry) {
+		if req.Since != 0 && e.Time.Unix() < req.Since {
+			return
+		}
+		if req.Until != 0 && e.Time.Unix() > req.Until {
+			return
+		}
+		if req.Rpc != "" && !strings.EqualFold(req.Rpc, e.RPC) {
+			return
+		}
+		if req.Identity != "" && req.Identity != e.Identity {
+			return
+		}
+		if prefix != "" {
+			found := false
+			for _, p := range e.Paths {
+				if isUnderPath(p, prefix) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return
+			}
+		}
+		matches = append(matches, e)
+		if len(matches) > 2*limit {
+			matches = append([]*auditEntry(nil), matches[len(matches)-limit:]...)
+		}
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error leyendo el registro de auditoría: %v", err)
+	}
+	if len(matches) > limit {
+		matches = matches[len(matches)-limit:]
+	}
+
+	resp := &pb.QueryAuditResponse{}
+	for i := len(matches) - 1; i >= 0; i-- {
+		resp.Records = append(resp.Records, auditEntryToProto(matches[i]))
+	}
+	return resp, nil
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+)
+
+func TestAuditIdentity(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.Security.AuthTokens = []string{testToken} })
+	interceptor := s.AuditUnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: pb.FileSystemService_StatFile_FullMethodName}
+	handler := func(ctx context.Context, req any) (any, error) { return &pb.StatResponse{}, nil }
+
+	calls := []context.Context{
+		callContext(authorizationKey, bearerPrefix+testToken, "x-caller-id", "admin"),
+		callContext("x-user-id", "admin"),
+		withPrincipal(withPreauthorized(callContext()), "s3:AKID"),
+	}
+	for _, ctx := range calls {
+		if _, err := interceptor(ctx, &pb.StatRequest{Path: "a.txt"}, info, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := s.QueryAudit(context.Background(), &pb.QueryAuditRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Los más recientes primero
+	want := []struct{ identity, claimed string }{
+		{"s3:AKID", ""},
+		{"", "admin"},
+		{tokenPrincipal(testToken), "admin"},
+	}
+	if len(resp.Records) != len(want) {
+		t.Fatalf("%d registros, se esperaban %d", len(resp.Records), len(want))
+	}
+	for i, w := range want {
+		r := resp.Records[i]
+		if r.Identity != w.identity || r.ClaimedIdentity != w.claimed {
+			t.Fatalf("registro %d: identidad %q y declarada %q, se esperaba %q y %q", i, r.Identity, r.ClaimedIdentity, w.identity, w.claimed)
+		}
+	}
+
+	// El filtro por identidad solo compara con el principal autenticado
+	resp, err = s.QueryAudit(context.Background(), &pb.QueryAuditRequest{Identity: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Records) != 0 {
+		t.Fatalf("la identidad declarada coincidió con %d registros", len(resp.Records))
+	}
+}
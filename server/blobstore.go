@@ -0,0 +1,214 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultBlobGCInterval = 10 * time.Minute
+
+// Almacén de blobs direccionado por contenido (SHA-256) con conteo de referencias.
+// Las referencias viven en memoria y se reconstruyen al arrancar recorriendo el
+// directorio raíz, que es la fuente de verdad.
+type blobStore struct {
+	dir  string
+	mu   sync.Mutex
+	refs map[string]int64
+}
+
+func newBlobStore(dir string) (*blobStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &blobStore{dir: dir, refs: make(map[string]int64)}, nil
+}
+
+func isValidBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+func (b *blobStore) path(hash string) string {
+	return filepath.Join(b.dir, hash[:2], hash)
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Suma una referencia al blob si ya existe
+func (b *blobStore) ref(hash string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := os.Stat(b.path(hash)); err != nil {
+		return false
+	}
+	b.refs[hash]++
+	return true
+}
+
+// Guarda el blob con el contenido (ya codificado) que escribe write si no existe todavía
+// y suma una referencia
+func (b *blobStore) put(hash string, write func(*os.File) error) error {
+	blobPath := b.path(hash)
+
+	// La escritura se hace fuera del candado en un temporal y luego se publica con rename
+	tmp, err := os.CreateTemp(filepath.Join(b.dir, "tmp"), hash+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := os.Stat(blobPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(blobPath), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), blobPath); err != nil {
+			return err
+		}
+	}
+	b.refs[hash]++
+	return nil
+}
+
+// Resta una referencia. El blob se elimina en la siguiente recolección de basura.
+func (b *blobStore) release(hash string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.refs[hash] <= 1 {
+		delete(b.refs, hash)
+		return
+	}
+	b.refs[hash]--
+}
+
+// Recalcula las referencias a partir de los archivos del directorio raíz
+func (b *blobStore) rebuildRefs(root string) error {
+	refs := make(map[string]int64)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		header, err := readEnvelopeHeader(path)
+		if err != nil {
+			slog.Warn("No se pudo leer la cabecera", "path", path, "error", err)
+			return nil
+		}
+		if header != nil && header.Blob != "" {
+			refs[header.Blob]++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	b.mu.Lock()
+	b.refs = refs
+	b.mu.Unlock()
+	return nil
+}
+
+// Elimina los blobs sin referencias y devuelve cuántos se borraron y cuánto espacio se liberó
+func (b *blobStore) collectGarbage() (int, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	removed := 0
+	var freed int64
+	err := filepath.WalkDir(b.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == "tmp" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		hash := d.Name()
+		if !isValidBlobHash(hash) || b.refs[hash] > 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Warn("No se pudo eliminar el blob", "blob", hash, "error", err)
+			return nil
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	return removed, freed, err
+}
+
+// Ejecuta la recolección de basura periódicamente
+func (b *blobStore) runGC(interval time.Duration) {
+	for {
+		removed, freed, err := b.collectGarbage()
+		if err != nil {
+			slog.Error("Error en la recolección de blobs", "error", err)
+		} else if removed > 0 {
+			slog.Info("Recolección de blobs terminada", "removed", removed, "freed_bytes", freed)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Devuelve el espacio ocupado por los blobs y el que se puede recuperar
+func (b *blobStore) usage() (count int64, physical int64, reclaimable int64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err = filepath.WalkDir(b.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == "tmp" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isValidBlobHash(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		count++
+		physical += info.Size()
+		if b.refs[d.Name()] == 0 {
+			reclaimable += info.Size()
+		}
+		return nil
+	})
+	return count, physical, reclaimable, err
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultChecksumFile = "checksums.log"
+
+// Operaciones del diario del catálogo de checksums
+const (
+	checksumOpSet    = "set"
+	checksumOpRemove = "remove"
+	checksumOpRename = "rename"
+	checksumOpFlag   = "flag"
+	checksumOpClear  = "clear"
+)
+
+// Checksum del contenido original de un archivo, registrado al escribirlo
+type checksumRecord struct {
+	Checksum string `json:"sha256"`
+	Size     int64  `json:"size"`
+	// Fecha de modificación en disco al registrarlo, en nanosegundos
+	ModTime int64 `json:"mod_time"`
+}
+
+// Archivo que no pasó la verificación de integridad
+type scrubIssue struct {
+	Path     string    `json:"path"`
+	Reason   string    `json:"reason"`
+	Expected string    `json:"expected,omitempty"`
+	Actual   string    `json:"actual,omitempty"`
+	Detected time.Time `json:"detected"`
+	// Ruta a la que se movió el archivo si se puso en cuarentena
+	Quarantine string `json:"quarantine,omitempty"`
+}
+
+type checksumEntry struct {
+	Op      string          `json:"op"`
+	Path    string          `json:"path"`
+	NewPath string          `json:"new_path,omitempty"`
+	Record  *checksumRecord `json:"record,omitempty"`
+	Issue   *scrubIssue     `json:"issue,omitempty"`
+}
+
+// Catálogo de checksums de los archivos guardados. Se persiste como un diario de
+// líneas JSON al que solo se agrega, y se compacta al arrancar y cuando crece demasiado.
+type checksumCatalog struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	records map[string]checksumRecord
+	issues  map[string]scrubIssue
+	// Líneas escritas en el diario desde la última compactación
+	entries int
+}
+
+func newChecksumCatalog(path string) (*checksumCatalog, error) {
+	c := &checksumCatalog{
+		path:    path,
+		records: make(map[string]checksumRecord),
+		issues:  make(map[string]scrubIssue),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	if err := c.compact(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *checksumCatalog) load() error {
+	f, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry checksumEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Una caída puede dejar la última línea a medias
+			slog.Warn("Línea inválida en el catálogo de checksums ignorada", "file", c.path, "error", err)
+			continue
+		}
+		c.apply(entry)
+	}
+	return scanner.Err()
+}
+
+func (c *checksumCatalog) apply(entry checksumEntry) {
+	switch entry.Op {
+	case checksumOpSet:
+		if entry.Record != nil {
+			c.records[entry.Path] = *entry.Record
+			delete(c.issues, entry.Path)
+		}
+	case checksumOpRemove:
+		for key := range c.records {
+			if isUnderPath(key, entry.Path) {
+				delete(c.records, key)
+			}
+		}
+		for key := range c.issues {
+			if isUnderPath(key, entry.Path) {
+				delete(c.issues, key)
+			}
+		}
+	case checksumOpRename:
+		for key, record := range c.records {
+			if isUnderPath(key, entry.Path) {
+				delete(c.records, key)
+				c.records[entry.NewPath+strings.TrimPrefix(key, entry.Path)] = record
+			}
+		}
+		for key, issue := range c.issues {
+			if isUnderPath(key, entry.Path) {
+				delete(c.issues, key)
+				issue.Path = entry.NewPath + strings.TrimPrefix(key, entry.Path)
+				c.issues[issue.Path] = issue
+			}
+		}
+	case checksumOpFlag:
+		if entry.Issue != nil {
+			c.issues[entry.Path] = *entry.Issue
+		}
+	case checksumOpClear:
+		delete(c.issues, entry.Path)
+	}
+}
+
+// Aplica un cambio y lo agrega al diario. Debe llamarse con c.mu tomado.
+func (c *checksumCatalog) append(entry checksumEntry) {
+	c.apply(entry)
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = c.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		slog.Error("Error escribiendo el catálogo de checksums", "file", c.path, "error", err)
+		return
+	}
+	c.entries++
+	if c.entries > 2*(len(c.records)+len(c.issues))+1000 {
+		if err := c.compact(); err != nil {
+			slog.Error("Error compactando el catálogo de checksums", "file", c.path, "error", err)
+		}
+	}
+}
+
+// Reescribe el diario con el estado actual. Debe llamarse con c.mu tomado o antes de usar el catálogo.
+func (c *checksumCatalog) compact() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for key, record := range c.records {
+		if err := enc.Encode(checksumEntry{Op: checksumOpSet, Path: key, Record: &record}); err != nil {
+			return err
+		}
+	}
+	for key, issue := range c.issues {
+		if err := enc.Encode(checksumEntry{Op: checksumOpFlag, Path: key, Issue: &issue}); err != nil {
+			return err
+		}
+	}
+	if dir := filepath.Dir(c.path); dir != "." {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(c.path, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	if c.file != nil {
+		c.file.Close()
+	}
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	c.file = f
+	c.entries = len(c.records) + len(c.issues)
+	return nil
+}
+
+func (c *checksumCatalog) record(key string, record checksumRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.append(checksumEntry{Op: checksumOpSet, Path: key, Record: &record})
+}
+
+func (c *checksumCatalog) get(key string) (checksumRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	record, ok := c.records[key]
+	return record, ok
+}
+
+// Olvida los checksums y problemas de un archivo o de todo un directorio
+func (c *checksumCatalog) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.append(checksumEntry{Op: checksumOpRemove, Path: key})
+}
+
+func (c *checksumCatalog) rename(oldKey, newKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.append(checksumEntry{Op: checksumOpRename, Path: oldKey, NewPath: newKey})
+}
+
+func (c *checksumCatalog) flag(issue scrubIssue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.append(checksumEntry{Op: checksumOpFlag, Path: issue.Path, Issue: &issue})
+}
+
+// Quita la marca de un archivo que vuelve a estar sano
+func (c *checksumCatalog) clear(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.issues[key]; ok {
+		c.append(checksumEntry{Op: checksumOpClear, Path: key})
+	}
+}
+
+// Rutas con checksum registrado bajo un directorio
+func (c *checksumCatalog) keysUnder(dir string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for key := range c.records {
+		if isUnderPath(key, dir) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Archivos marcados como corruptos, ordenados por ruta
+func (c *checksumCatalog) issueList() []scrubIssue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	issues := make([]scrubIssue, 0, len(c.issues))
+	for _, issue := range c.issues {
+		issues = append(issues, issue)
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues
+}
+
+func (c *checksumCatalog) issueCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.issues)
+}
+
+// Registra el checksum del contenido de un archivo recién escrito junto con su fecha de modificación
+func (s *Server) recordChecksum(filePath, checksum string, size int64) {
+	relPath, err := filepath.Rel(rootDirectory, filePath)
+	if err != nil {
+		return
+	}
+	record := checksumRecord{Checksum: checksum, Size: size}
+	if info, err := os.Stat(filePath); err == nil {
+		record.ModTime = info.ModTime().UnixNano()
+	}
+	s.checksums.record(indexKey(relPath), record)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Algoritmos de compresión en reposo
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+)
+
+// Tipos MIME que ya vienen comprimidos y no vale la pena volver a comprimir
+var incompressibleMimeTypes = map[string]bool{
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/zstd":             true,
+	"application/x-zstd":           true,
+	"application/x-compress":       true,
+	"application/java-archive":     true,
+	"application/epub+zip":         true,
+	"application/pdf":              true,
+	"application/wasm":             true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+}
+
+func isCompressibleMimeType(mimeType string) bool {
+	base := strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	if strings.HasPrefix(base, "image/") && base != "image/svg+xml" && base != "image/bmp" {
+		return false
+	}
+	if strings.HasPrefix(base, "video/") || strings.HasPrefix(base, "audio/") {
+		return false
+	}
+	// Formatos de Office y OpenDocument son zip por dentro
+	if strings.HasPrefix(base, "application/vnd.openxmlformats-") || strings.HasPrefix(base, "application/vnd.oasis.opendocument.") {
+		return false
+	}
+	return !incompressibleMimeTypes[base]
+}
+
+// Indica si un archivo debe comprimirse según la configuración global o por directorio
+func (s *Server) shouldCompress(relPath string, mimeType string) bool {
+	if s.compression == compressionNone || !isCompressibleMimeType(mimeType) {
+		return false
+	}
+	if len(s.compressionDirs) == 0 {
+		return true
+	}
+	key := indexKey(relPath)
+	for _, dir := range s.compressionDirs {
+		if isUnderPath(key, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Comprime los segmentos de un archivo uno tras otro reutilizando el mismo compresor
+type segmentCompressor struct {
+	buf bytes.Buffer
+	gz  *gzip.Writer
+}
+
+func newSegmentCompressor(algorithm string) (*segmentCompressor, error) {
+	if algorithm != compressionGzip {
+		return nil, fmt.Errorf("algoritmo de compresión no soportado: %s", algorithm)
+	}
+	c := &segmentCompressor{}
+	c.gz = gzip.NewWriter(&c.buf)
+	return c, nil
+}
+
+// El resultado solo es válido hasta la siguiente llamada
+func (c *segmentCompressor) compress(data []byte) ([]byte, error) {
+	c.buf.Reset()
+	c.gz.Reset(&c.buf)
+	if _, err := c.gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := c.gz.Close(); err != nil {
+		return nil, err
+	}
+	return c.buf.Bytes(), nil
+}
+
+// Descomprime segmentos reutilizando el mismo descompresor
+type segmentDecompressor struct {
+	src bytes.Reader
+	gz  *gzip.Reader
+}
+
+// Descomprime payload en dst, que debe quedar exactamente lleno
+func (d *segmentDecompressor) decompress(algorithm string, dst, payload []byte) error {
+	if algorithm != compressionGzip {
+		return fmt.Errorf("algoritmo de compresión no soportado: %s", algorithm)
+	}
+	d.src.Reset(payload)
+	if d.gz == nil {
+		gz, err := gzip.NewReader(&d.src)
+		if err != nil {
+			return err
+		}
+		d.gz = gz
+	} else if err := d.gz.Reset(&d.src); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(d.gz, dst); err != nil {
+		return err
+	}
+	// Leer hasta el final verifica además el CRC
+	var extra [1]byte
+	if _, err := io.ReadFull(d.gz, extra[:]); err != io.EOF {
+		if err == nil {
+			return errors.New("el segmento descomprimido es más largo de lo esperado")
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,480 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuración completa del nodo. Cada valor se toma, de menor a mayor prioridad,
+// de los valores por defecto, del archivo YAML (-config o CONFIG_FILE), de las
+// variables de entorno y de las opciones de la línea de comandos (-seccion.campo).
+// Los campos marcados con reload se pueden cambiar sin reiniciar el nodo.
+type Config struct {
+	Node        NodeConfig        `yaml:"node"`
+	Security    SecurityConfig    `yaml:"security"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	S3          S3Config          `yaml:"s3"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Encryption  EncryptionConfig  `yaml:"encryption"`
+	Replication ReplicationConfig `yaml:"replication"`
+	Scrub       ScrubConfig       `yaml:"scrub"`
+	Audit       AuditConfig       `yaml:"audit"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+
+	// Argumentos con los que se cargó, para volver a cargarla igual al recargar
+	args []string
+}
+
+type NodeConfig struct {
+	ID                string        `yaml:"id" env:"NODE_ID" usage:"Identificador del nodo"`
+	IP                string        `yaml:"ip" env:"IP_ADDRESS" usage:"Dirección IP en la que escucha el servidor gRPC"`
+	Port              int           `yaml:"port" env:"PORT" usage:"Puerto del servidor gRPC"`
+	Workers           int           `yaml:"workers" env:"WORKERS" reload:"true" usage:"Workers que atienden las llamadas unarias"`
+	QueueSize         int           `yaml:"queue_size" env:"QUEUE_SIZE" reload:"true" usage:"Llamadas que pueden esperar un worker antes de bloquear"`
+	MaxMessageSize    int           `yaml:"max_message_size" env:"MAX_MESSAGE_SIZE" usage:"Tamaño máximo de los mensajes gRPC, en bytes"`
+	CentralAddress    string        `yaml:"central_address" env:"CENTRAL_SERVER_ADDRESS" reload:"true" usage:"Servidor central al que se envían los latidos"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" env:"HEARTBEAT_INTERVAL" reload:"true" usage:"Intervalo entre latidos"`
+	MetricsAddress    string        `yaml:"metrics_address" env:"METRICS_ADDRESS" usage:"Dirección HTTP para /debug/vars, vacía para no exponer métricas"`
+	HTTPAddress       string        `yaml:"http_address" env:"HTTP_ADDRESS" usage:"Dirección del gateway HTTP/REST, vacía para no exponerlo"`
+	HTTPPublicURL     string        `yaml:"http_public_url" env:"HTTP_PUBLIC_URL" reload:"true" usage:"URL base del gateway en las URLs firmadas; vacía para usar http_address"`
+	WebDAVAddress     string        `yaml:"webdav_address" env:"WEBDAV_ADDRESS" usage:"Dirección del servidor WebDAV, vacía para no exponerlo"`
+}
+
+type SecurityConfig struct {
+	// Sin tokens no se exige autenticación
+	AuthTokens  []string `yaml:"auth_tokens" env:"AUTH_TOKENS" reload:"true" usage:"Tokens aceptados en el metadato authorization (Bearer), separados por comas"`
+	TLSCertFile string   `yaml:"tls_cert_file" env:"TLS_CERT_FILE" reload:"true" usage:"Certificado TLS del servidor; vacío para no usar TLS"`
+	TLSKeyFile  string   `yaml:"tls_key_file" env:"TLS_KEY_FILE" reload:"true" usage:"Clave privada del certificado TLS"`
+	TLSCAFile   string   `yaml:"tls_ca_file" env:"TLS_CA_FILE" usage:"CA con la que se verifican los demás nodos; vacío para usar las del sistema"`
+	// Sin clave no se pueden crear URLs firmadas
+	URLSigningKey string `yaml:"url_signing_key" env:"URL_SIGNING_KEY" reload:"true" usage:"Clave con la que se firman las URLs del gateway HTTP"`
+}
+
+type S3Config struct {
+	Address string `yaml:"address" env:"S3_ADDRESS" usage:"Dirección de la API compatible con S3, vacía para no exponerla"`
+	// Sin claves las peticiones S3 no firmadas se autentican como las demás, con token
+	AccessKeys         []string `yaml:"access_keys" env:"S3_ACCESS_KEYS" reload:"true" usage:"Claves de acceso S3 (access_key:secret_key), separadas por comas"`
+	MultipartDirectory string   `yaml:"multipart_directory" env:"S3_MULTIPART_DIRECTORY" usage:"Directorio de las subidas multipart S3 en curso"`
+}
+
+// Límites por cliente; 0 significa sin límite
+type RateLimits struct {
+	RequestsPerSecond      float64 `yaml:"requests_per_second"`
+	UploadBytesPerSecond   int64   `yaml:"upload_bytes_per_second"`
+	DownloadBytesPerSecond int64   `yaml:"download_bytes_per_second"`
+}
+
+type RateLimitConfig struct {
+	RequestsPerSecond      float64 `yaml:"requests_per_second" env:"RATE_LIMIT_REQUESTS_PER_SECOND" reload:"true" usage:"Llamadas por segundo de cada cliente (0: sin límite)"`
+	UploadBytesPerSecond   int64   `yaml:"upload_bytes_per_second" env:"RATE_LIMIT_UPLOAD_BYTES_PER_SECOND" reload:"true" usage:"Bytes subidos por segundo de cada cliente (0: sin límite)"`
+	DownloadBytesPerSecond int64   `yaml:"download_bytes_per_second" env:"RATE_LIMIT_DOWNLOAD_BYTES_PER_SECOND" reload:"true" usage:"Bytes descargados por segundo de cada cliente (0: sin límite)"`
+	// Límites propios de algunos clientes, por principal ("token:" y los 12 primeros dígitos hex del
+	// SHA-256 del token, o "s3:" y la access key) o dirección IP. Solo en el archivo de configuración.
+	Callers map[string]RateLimits `yaml:"callers" reload:"true"`
+}
+
+// Límites de los clientes que no tienen límites propios
+func (c RateLimitConfig) defaults() RateLimits {
+	return RateLimits{
+		RequestsPerSecond:      c.RequestsPerSecond,
+		UploadBytesPerSecond:   c.UploadBytesPerSecond,
+		DownloadBytesPerSecond: c.DownloadBytesPerSecond,
+	}
+}
+
+// Límites que se aplican a un cliente
+func (c RateLimitConfig) forCaller(key string) RateLimits {
+	if limits, ok := c.Callers[key]; ok {
+		return limits
+	}
+	return c.defaults()
+}
+
+type StorageConfig struct {
+	Root                   string        `yaml:"root" env:"STORAGE_ROOT" usage:"Directorio raíz de los archivos"`
+	Mode                   string        `yaml:"mode" env:"STORAGE_MODE" usage:"Modo de almacenamiento: plain o dedup"`
+	BlobDirectory          string        `yaml:"blob_directory" env:"BLOB_DIRECTORY" usage:"Directorio del almacén de blobs"`
+	BlobGCInterval         time.Duration `yaml:"blob_gc_interval" env:"BLOB_GC_INTERVAL" usage:"Intervalo de la recolección de blobs sin referencias"`
+	Compression            string        `yaml:"compression" env:"COMPRESSION" usage:"Compresión en reposo: none o gzip"`
+	CompressionDirectories []string      `yaml:"compression_directories" env:"COMPRESSION_DIRECTORIES" usage:"Directorios en los que se comprime, separados por comas (vacío: todos)"`
+	UploadDirectory        string        `yaml:"upload_directory" env:"UPLOAD_DIRECTORY" usage:"Directorio de las sesiones de subida"`
+	StagingDirectory       string        `yaml:"staging_directory" env:"STAGING_DIRECTORY" usage:"Directorio de los temporales de las escrituras; debe estar en el mismo sistema de archivos que root"`
+	UploadSessionTTL       time.Duration `yaml:"upload_session_ttl" env:"UPLOAD_SESSION_TTL" usage:"Tiempo sin actividad tras el que expira una sesión de subida"`
+	MaxUploadSize          int64         `yaml:"max_upload_size" env:"MAX_UPLOAD_SIZE" usage:"Tamaño máximo de una subida por partes, en bytes"`
+	MaxArchiveSize         int64         `yaml:"max_archive_size" env:"MAX_ARCHIVE_SIZE" usage:"Máximo de bytes de contenido de una descarga empaquetada con DownloadArchive"`
+	ChecksumFile           string        `yaml:"checksum_file" env:"CHECKSUM_FILE" usage:"Diario del catálogo de checksums"`
+	SearchIndex            bool          `yaml:"search_index" env:"SEARCH_INDEX" usage:"Indexar el contenido de los archivos para SearchContent"`
+	WatchInotify           bool          `yaml:"watch_inotify" env:"WATCH_INOTIFY" usage:"Detectar con inotify los cambios hechos por fuera del servidor"`
+	WatchHistory           int           `yaml:"watch_history" env:"WATCH_HISTORY" usage:"Eventos de cambios que se guardan para reanudar WatchPath"`
+}
+
+type EncryptionConfig struct {
+	MasterKey             string `yaml:"master_key" env:"MASTER_KEY" usage:"Clave maestra del cifrado en reposo (hex o Base64)"`
+	MasterKeyFile         string `yaml:"master_key_file" env:"MASTER_KEY_FILE" usage:"Archivo con la clave maestra"`
+	MasterKeyPreviousFile string `yaml:"master_key_previous_file" env:"MASTER_KEY_PREVIOUS_FILE" usage:"Archivo con la clave maestra anterior"`
+	KeyDirectory          string `yaml:"key_directory" env:"KEY_DIRECTORY" usage:"Directorio de las claves de datos"`
+}
+
+type ReplicationConfig struct {
+	Peers       []string `yaml:"peers" env:"REPLICATION_PEERS" usage:"Nodos a los que se replican las subidas, separados por comas"`
+	Directories []string `yaml:"directories" env:"REPLICATION_DIRECTORIES" usage:"Directorios que se replican, separados por comas (vacío: todos)"`
+	// nil significa todos los pares
+	WriteQuorum *int          `yaml:"write_quorum" env:"REPLICATION_WRITE_QUORUM" usage:"Réplicas que deben confirmar una subida (por defecto, todos los pares)"`
+	Timeout     time.Duration `yaml:"timeout" env:"REPLICATION_TIMEOUT" usage:"Tiempo máximo de cada réplica"`
+}
+
+type ScrubConfig struct {
+	Enabled             bool          `yaml:"enabled" env:"SCRUB_ENABLED" usage:"Verificar periódicamente la integridad de los archivos"`
+	Interval            time.Duration `yaml:"interval" env:"SCRUB_INTERVAL" usage:"Intervalo entre verificaciones"`
+	BytesPerSecond      int64         `yaml:"bytes_per_second" env:"SCRUB_BYTES_PER_SECOND" usage:"Presupuesto de lectura de la verificación"`
+	Action              string        `yaml:"action" env:"SCRUB_ACTION" usage:"Qué hacer con los archivos corruptos: flag o quarantine"`
+	QuarantineDirectory string        `yaml:"quarantine_directory" env:"QUARANTINE_DIRECTORY" usage:"Directorio de cuarentena"`
+}
+
+type AuditConfig struct {
+	File     string `yaml:"file" env:"AUDIT_LOG_FILE" usage:"Archivo del registro de auditoría"`
+	MaxSize  int64  `yaml:"max_size" env:"AUDIT_MAX_SIZE" usage:"Tamaño a partir del cual se rota la auditoría, en bytes"`
+	MaxFiles int    `yaml:"max_files" env:"AUDIT_MAX_FILES" usage:"Archivos rotados de auditoría que se conservan"`
+}
+
+type LoggingConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" reload:"true" usage:"Nivel de los logs: debug, info, warn o error"`
+	Format string `yaml:"format" env:"LOG_FORMAT" reload:"true" usage:"Formato de los logs: text o json"`
+}
+
+type TracingConfig struct {
+	// El destino del exportador OTLP se configura con las variables estándar OTEL_EXPORTER_OTLP_*
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER" usage:"Exportador de trazas: none u otlp"`
+}
+
+// Valores por defecto de todas las opciones
+func DefaultConfig() Config {
+	return Config{
+		Node: NodeConfig{
+			ID:                "1",
+			IP:                "127.0.0.1",
+			Port:              50051,
+			Workers:           4,
+			QueueSize:         100,
+			MaxMessageSize:    20 * 1024 * 1024,
+			HeartbeatInterval: defaultHeartbeatInterval,
+		},
+		S3: S3Config{
+			MultipartDirectory: defaultS3MultipartDirectory,
+		},
+		Storage: StorageConfig{
+			Root:             defaultRootDirectory,
+			Mode:             storageModePlain,
+			BlobDirectory:    defaultBlobDirectory,
+			BlobGCInterval:   defaultBlobGCInterval,
+			Compression:      compressionNone,
+			UploadDirectory:  defaultUploadDirectory,
+			StagingDirectory: defaultStagingDirectory,
+			UploadSessionTTL: defaultUploadSessionTTL,
+			MaxUploadSize:    defaultMaxUploadSize,
+			MaxArchiveSize:   defaultMaxArchiveSize,
+			ChecksumFile:     defaultChecksumFile,
+			WatchHistory:     defaultWatchHistory,
+		},
+		Encryption: EncryptionConfig{
+			KeyDirectory: defaultKeyDirectory,
+		},
+		Replication: ReplicationConfig{
+			Timeout: defaultReplicationTimeout,
+		},
+		Scrub: ScrubConfig{
+			Interval:            defaultScrubInterval,
+			BytesPerSecond:      defaultScrubBytesPerSecond,
+			Action:              scrubActionFlag,
+			QuarantineDirectory: defaultQuarantineDirectory,
+		},
+		Audit: AuditConfig{
+			File:     defaultAuditFile,
+			MaxSize:  defaultAuditMaxSize,
+			MaxFiles: defaultAuditMaxFiles,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: TracingConfig{
+			Exporter: "none",
+		},
+	}
+}
+
+// Opción de la configuración con su nombre en la línea de comandos y su variable de entorno
+type configField struct {
+	name   string
+	env    string
+	usage  string
+	reload bool
+	value  reflect.Value
+}
+
+func (c *Config) fields() []configField {
+	var fields []configField
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		if !sections.Type().Field(i).IsExported() {
+			continue
+		}
+		sectionName := sections.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			fields = append(fields, configField{
+				name:   sectionName + "." + field.Tag.Get("yaml"),
+				env:    field.Tag.Get("env"),
+				usage:  field.Tag.Get("usage"),
+				reload: field.Tag.Get("reload") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Asigna un valor escrito como texto (variable de entorno u opción) según el tipo del campo
+func setConfigValue(v reflect.Value, text string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		v.Set(reflect.ValueOf(splitList(text)))
+	case reflect.Pointer:
+		// Un valor vacío vuelve al valor por defecto
+		if text == "" {
+			v.SetZero()
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := setConfigValue(elem.Elem(), text); err != nil {
+			return err
+		}
+		v.Set(elem)
+	default:
+		return fmt.Errorf("tipo no soportado: %s", v.Type())
+	}
+	return nil
+}
+
+// Carga la configuración a partir de los argumentos de la línea de comandos (sin el nombre del programa).
+// printConfig indica si se pidió -print-config.
+func LoadConfig(args []string) (cfg Config, printConfig bool, err error) {
+	cfg = DefaultConfig()
+	cfg.args = args
+	fields := cfg.fields()
+
+	// Las opciones se guardan y se aplican al final, porque el archivo y el entorno tienen menos prioridad
+	type flagValue struct {
+		field configField
+		text  string
+	}
+	var flagValues []flagValue
+	fs := flag.NewFlagSet("filesystem", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "Archivo de configuración YAML")
+	fs.BoolVar(&printConfig, "print-config", false, "Mostrar la configuración resultante y salir")
+	for _, field := range fields {
+		// Las opciones sin variable de entorno solo se pueden indicar en el archivo
+		if field.env == "" {
+			continue
+		}
+		record := func(text string) error {
+			if err := setConfigValue(reflect.New(field.value.Type()).Elem(), text); err != nil {
+				return err
+			}
+			flagValues = append(flagValues, flagValue{field, text})
+			return nil
+		}
+		usage := fmt.Sprintf("%s (%s)", field.usage, field.env)
+		if field.value.Kind() == reflect.Bool {
+			fs.BoolFunc(field.name, usage, record)
+		} else {
+			fs.Func(field.name, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, false, fmt.Errorf("argumentos inesperados: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if *configFile != "" {
+		f, err := os.Open(*configFile)
+		if err != nil {
+			return cfg, false, fmt.Errorf("no se pudo leer el archivo de configuración: %w", err)
+		}
+		defer f.Close()
+		// Un campo desconocido casi siempre es un error de tipeo
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+			return cfg, false, fmt.Errorf("archivo de configuración %s inválido: %w", *configFile, err)
+		}
+	}
+
+	for _, field := range fields {
+		if field.env == "" {
+			continue
+		}
+		if text, ok := os.LookupEnv(field.env); ok && text != "" {
+			if err := setConfigValue(field.value, text); err != nil {
+				return cfg, false, fmt.Errorf("%s inválido: %s", field.env, text)
+			}
+		}
+	}
+	for _, fv := range flagValues {
+		setConfigValue(fv.field.value, fv.text)
+	}
+
+	return cfg, printConfig, cfg.Validate()
+}
+
+// Verifica que todos los valores sean válidos y devuelve todos los errores juntos
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(value string, allowed ...string) bool {
+		for _, a := range allowed {
+			if value == a {
+				return true
+			}
+		}
+		return false
+	}
+
+	check(c.Node.ID != "", "node.id no puede estar vacío")
+	check(c.Node.Port > 0 && c.Node.Port <= 65535, "node.port inválido: %d", c.Node.Port)
+	check(c.Node.Workers > 0, "node.workers debe ser mayor que 0")
+	check(c.Node.QueueSize > 0, "node.queue_size debe ser mayor que 0")
+	check(c.Node.MaxMessageSize > 0, "node.max_message_size debe ser mayor que 0")
+	check(c.Node.HeartbeatInterval > 0, "node.heartbeat_interval debe ser mayor que 0")
+
+	check((c.Security.TLSCertFile == "") == (c.Security.TLSKeyFile == ""), "security.tls_cert_file y security.tls_key_file se deben indicar juntos")
+	shortToken := false
+	for _, token := range c.Security.AuthTokens {
+		shortToken = shortToken || len(token) < minAuthTokenLength
+	}
+	check(!shortToken, "security.auth_tokens: los tokens deben tener al menos %d caracteres", minAuthTokenLength)
+	check(c.Security.URLSigningKey == "" || len(c.Security.URLSigningKey) >= minURLSigningKeyLength,
+		"security.url_signing_key debe tener al menos %d caracteres", minURLSigningKeyLength)
+
+	for i, pair := range c.S3.AccessKeys {
+		accessKey, secret, ok := strings.Cut(pair, ":")
+		check(ok && accessKey != "" && secret != "", "s3.access_keys: la clave %d no tiene el formato access_key:secret_key", i+1)
+	}
+	check(c.S3.MultipartDirectory != "", "s3.multipart_directory no puede estar vacío")
+
+	validLimits := func(name string, l RateLimits) {
+		check(l.RequestsPerSecond >= 0 && l.UploadBytesPerSecond >= 0 && l.DownloadBytesPerSecond >= 0,
+			"%s: los límites no pueden ser negativos", name)
+	}
+	validLimits("rate_limit", c.RateLimit.defaults())
+	for caller, limits := range c.RateLimit.Callers {
+		validLimits("rate_limit.callers."+caller, limits)
+	}
+
+	check(c.Storage.Root != "", "storage.root no puede estar vacío")
+	check(oneOf(c.Storage.Mode, storageModePlain, storageModeDedup), "storage.mode inválido: %s (valores posibles: plain, dedup)", c.Storage.Mode)
+	check(c.Storage.BlobGCInterval > 0, "storage.blob_gc_interval debe ser mayor que 0")
+	check(oneOf(c.Storage.Compression, compressionNone, compressionGzip), "storage.compression inválido: %s (valores posibles: none, gzip)", c.Storage.Compression)
+	check(c.Storage.StagingDirectory != "" && !isInsideDirectory(c.Storage.StagingDirectory, c.Storage.Root),
+		"storage.staging_directory no puede estar vacío ni dentro de storage.root")
+	check(c.Storage.UploadSessionTTL > 0, "storage.upload_session_ttl debe ser mayor que 0")
+	check(c.Storage.MaxUploadSize > 0, "storage.max_upload_size debe ser mayor que 0")
+	check(c.Storage.MaxArchiveSize > 0, "storage.max_archive_size debe ser mayor que 0")
+	check(c.Storage.WatchHistory > 0, "storage.watch_history debe ser mayor que 0")
+
+	if q := c.Replication.WriteQuorum; q != nil {
+		check(*q >= 0 && *q <= len(c.Replication.Peers), "replication.write_quorum inválido: %d (debe estar entre 0 y %d)", *q, len(c.Replication.Peers))
+	}
+	check(c.Replication.Timeout > 0, "replication.timeout debe ser mayor que 0")
+
+	check(c.Scrub.Interval > 0, "scrub.interval debe ser mayor que 0")
+	check(c.Scrub.BytesPerSecond > 0, "scrub.bytes_per_second debe ser mayor que 0")
+	check(oneOf(c.Scrub.Action, scrubActionFlag, scrubActionQuarantine), "scrub.action inválido: %s (valores posibles: flag, quarantine)", c.Scrub.Action)
+
+	check(c.Audit.File != "", "audit.file no puede estar vacío")
+	check(c.Audit.MaxSize > 0, "audit.max_size debe ser mayor que 0")
+	check(c.Audit.MaxFiles >= 0, "audit.max_files no puede ser negativo")
+
+	var lvl slog.Level
+	check(lvl.UnmarshalText([]byte(c.Logging.Level)) == nil, "logging.level inválido: %s (valores posibles: debug, info, warn, error)", c.Logging.Level)
+	check(oneOf(strings.ToLower(c.Logging.Format), "text", "json"), "logging.format inválido: %s (valores posibles: text, json)", c.Logging.Format)
+	check(oneOf(strings.ToLower(c.Tracing.Exporter), "none", "otlp"), "tracing.exporter inválido: %s (valores posibles: none, otlp)", c.Tracing.Exporter)
+
+	return errors.Join(errs...)
+}
+
+// Escribe la configuración en YAML, ocultando los secretos
+func (c Config) Print(w io.Writer) error {
+	if c.Encryption.MasterKey != "" {
+		c.Encryption.MasterKey = "***"
+	}
+	if len(c.Security.AuthTokens) > 0 {
+		c.Security.AuthTokens = []string{"***"}
+	}
+	if c.Security.URLSigningKey != "" {
+		c.Security.URLSigningKey = "***"
+	}
+	// Las access keys se muestran para poder identificarlas
+	if len(c.S3.AccessKeys) > 0 {
+		masked := make([]string, len(c.S3.AccessKeys))
+		for i, pair := range c.S3.AccessKeys {
+			accessKey, _, _ := strings.Cut(pair, ":")
+			masked[i] = accessKey + ":***"
+		}
+		c.S3.AccessKeys = masked
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Escribe un archivo de configuración YAML en un temporal del test
+func writeConfigFile(t *testing.T, text string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeConfigFile(t, `
+node:
+  id: archivo
+  port: 6000
+  workers: 3
+  heartbeat_interval: 1m
+security:
+  auth_tokens: [token-del-archivo-0123]
+`)
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("NODE_ID", "entorno")
+	t.Setenv("PORT", "7000")
+	// Una variable vacía no cuenta
+	t.Setenv("WORKERS", "")
+	t.Setenv("AUTH_TOKENS", "token-del-entorno-012, otro-token-del-entorno")
+
+	cfg, _, err := LoadConfig([]string{"-node.id=opcion", "-storage.search_index"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := DefaultConfig()
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"opción sobre entorno y archivo", cfg.Node.ID, "opcion"},
+		{"entorno sobre archivo", cfg.Node.Port, 7000},
+		{"archivo sobre defecto", cfg.Node.Workers, 3},
+		{"archivo sobre defecto (duración)", cfg.Node.HeartbeatInterval, time.Minute},
+		{"lista del entorno", cfg.Security.AuthTokens, []string{"token-del-entorno-012", "otro-token-del-entorno"}},
+		{"opción booleana", cfg.Storage.SearchIndex, true},
+		{"sin indicar", cfg.Node.QueueSize, defaults.Node.QueueSize},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: %v, se esperaba %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	// -config tiene prioridad sobre CONFIG_FILE
+	other := writeConfigFile(t, "node:\n  workers: 5\n")
+	if cfg, _, err = LoadConfig([]string{"-config", other}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Node.Workers != 5 || cfg.Node.ID != "entorno" {
+		t.Fatalf("con -config: workers %d, id %q", cfg.Node.Workers, cfg.Node.ID)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	tests := []struct {
+		name string
+		env  map[string]string
+		file string
+		args []string
+		want string
+	}{
+		{"campo desconocido", nil, "node:\n  puerto: 1\n", nil, "puerto"},
+		{"variable inválida", map[string]string{"PORT": "muchos"}, "", nil, "PORT inválido"},
+		{"opción inválida", nil, "", []string{"-node.port=muchos"}, "node.port"},
+		// Cada fuente se lee bien, pero el resultado no es válido
+		{"valor final inválido", nil, "node:\n  workers: 0\n", nil, "node.workers"},
+		{"argumento suelto", nil, "", []string{"sobra"}, "argumentos inesperados"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, tt.file)}, args...)
+			}
+			_, _, err := LoadConfig(args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("se esperaba un error con %q, se obtuvo %v", tt.want, err)
+			}
+		})
+	}
+}
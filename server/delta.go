@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"filesystem/delta"
+	pb "filesystem/proto/filesystem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Firmas de los bloques de un archivo, para que el cliente calcule el delta de su versión nueva
+func (s *Server) FileSignature(ctx context.Context, req *pb.FileSignatureRequest) (*pb.FileSignatureResponse, error) {
+	meta, content, err := s.replicaSource(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	blockSize := int(req.BlockSize)
+	if blockSize == 0 {
+		blockSize = delta.BlockSize(meta.Size)
+	} else if !delta.ValidBlockSize(blockSize) {
+		return nil, status.Errorf(codes.InvalidArgument, "El tamaño de bloque debe estar entre %d y %d bytes", delta.MinBlockSize, delta.MaxBlockSize)
+	}
+	if delta.NumBlocks(meta.Size, blockSize) > delta.MaxBlocks {
+		return nil, status.Errorf(codes.OutOfRange, "Con bloques de %d bytes el archivo tiene más de %d bloques", blockSize, delta.MaxBlocks)
+	}
+
+	_, span := startSpan(ctx, "delta.signatures", attribute.String("path", meta.Path), attribute.Int64("size", meta.Size))
+	blocks, err := delta.Signatures(content.reader(), blockSize)
+	endSpan(span, err)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+	}
+	resp := &pb.FileSignatureResponse{
+		Path:           meta.Path,
+		Size:           meta.Size,
+		BlockSize:      int32(blockSize),
+		ChecksumSha256: meta.ChecksumSha256,
+		Blocks:         make([]*pb.BlockSignature, len(blocks)),
+	}
+	for i, b := range blocks {
+		resp.Blocks[i] = &pb.BlockSignature{Weak: b.Weak, Strong: b.Strong}
+	}
+	return resp, nil
+}
+
+// Reconstruye un archivo a partir de su versión actual y un delta. Las copias se leen por partes
+// del archivo base y el resultado se escribe en un temporal mientras se calcula su checksum; el
+// archivo solo se reemplaza si el checksum coincide y el base no cambió mientras tanto.
+func (s *Server) ApplyDelta(stream pb.FileSystemService_ApplyDeltaServer) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := first.Header
+	if header == nil {
+		return status.Errorf(codes.InvalidArgument, "El primer mensaje del delta debe traer la cabecera")
+	}
+	checksum := strings.ToLower(header.ChecksumSha256)
+	if header.Path == "" || header.Size < 0 || !isValidBlobHash(checksum) {
+		return status.Errorf(codes.InvalidArgument, "Cabecera de delta inválida")
+	}
+	if !delta.ValidBlockSize(int(header.BlockSize)) {
+		return status.Errorf(codes.InvalidArgument, "El tamaño de bloque debe estar entre %d y %d bytes", delta.MinBlockSize, delta.MaxBlockSize)
+	}
+	if header.Size > s.uploads.maxSize {
+		return status.Errorf(codes.OutOfRange, "El archivo supera el tamaño máximo de subida (%d bytes)", s.uploads.maxSize)
+	}
+
+	meta, base, err := s.replicaSource(header.Path)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+	if !strings.EqualFold(meta.ChecksumSha256, header.BaseChecksumSha256) {
+		return status.Errorf(codes.FailedPrecondition, "El archivo cambió después de calcular el delta")
+	}
+
+	staged, err := s.newStagedFile(".delta-*")
+	if err != nil {
+		return status.Errorf(codes.Internal, "Error preparando el archivo: %v", err)
+	}
+	defer staged.remove()
+	builder := delta.NewBuilder(base, base.size, int(header.BlockSize), staged, header.Size)
+	var literal int64
+	for chunk := first; ; {
+		for _, op := range chunk.Ops {
+			var next delta.Op
+			switch o := op.Op.(type) {
+			case *pb.DeltaOp_Copy:
+				if o.Copy.Count <= 0 {
+					return status.Errorf(codes.InvalidArgument, "Una copia debe tener al menos un bloque")
+				}
+				next = delta.Op{Index: o.Copy.Index, Count: o.Copy.Count}
+			case *pb.DeltaOp_Data:
+				next = delta.Op{Data: o.Data}
+				literal += int64(len(o.Data))
+			default:
+				return status.Errorf(codes.InvalidArgument, "Operación de delta vacía")
+			}
+			if err := builder.Apply(next); err != nil {
+				if errors.Is(err, delta.ErrBlockRange) || errors.Is(err, delta.ErrTooLarge) {
+					return status.Errorf(codes.InvalidArgument, "Delta inválido: %v", err)
+				}
+				return status.Errorf(codes.Internal, "Error aplicando el delta: %v", err)
+			}
+		}
+		if chunk, err = stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	sum, err := staged.flush()
+	if err != nil {
+		return status.Errorf(codes.Internal, "Error preparando el archivo: %v", err)
+	}
+	if builder.Written() != header.Size || sum != checksum {
+		return status.Errorf(codes.DataLoss, "El archivo reconstruido no coincide con el checksum")
+	}
+
+	filePath, _ := resolveStoragePath(meta.Path)
+	// El base se vuelve a comprobar con la ruta bloqueada: otra escritura pudo reemplazarlo
+	// mientras llegaba el delta, y publicar el resultado la perdería
+	unchanged := func() error {
+		current, err := s.fileChecksum(filePath, meta.Path)
+		if err != nil || current.Checksum != meta.ChecksumSha256 {
+			return errBaseChanged
+		}
+		return nil
+	}
+	_, span := startSpan(ctx, "storage.write", attribute.String("path", filePath), attribute.Int64("size", header.Size))
+	err = s.writeStoredContentIf(filePath, staged.content, header.Size, checksum, unchanged)
+	endSpan(span, err)
+	if errors.Is(err, errBaseChanged) {
+		return status.Errorf(codes.FailedPrecondition, "El archivo cambió mientras se aplicaba el delta")
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "Error escribiendo archivo: %v", err)
+	}
+
+	head := make([]byte, min(header.Size, mimeSniffLength))
+	if err := readFullAt(staged.content, head, 0); err != nil {
+		return status.Errorf(codes.Internal, "Error leyendo el archivo reconstruido: %v", err)
+	}
+	mimeType := detectMimeType(filePath, head)
+	if s.index != nil {
+		s.index.updateFrom(meta.Path, staged.content, mimeType)
+	}
+	slog.InfoContext(ctx, "Delta aplicado", "path", meta.Path, "size", header.Size, "literal_bytes", literal)
+	s.publishWrite(meta.Path, true, header.Size)
+
+	resp := &pb.Response{
+		Message:  "Archivo actualizado correctamente",
+		FilePath: filePath,
+		FileName: filepath.Base(filePath),
+		FileSize: header.Size,
+		FileType: mimeType,
+		NodeId:   s.nodeID,
+	}
+
+	// Como en CompleteUpload, las réplicas reciben el archivo completo
+	peers, quorum, _ := s.replicationTargets(meta.Path, nil, 0)
+	replicaIDs, ok := s.replicateWrite(ctx, filePath, staged.content, checksum, mimeType, peers, quorum)
+	resp.ReplicaNodeIds = replicaIDs
+	if !ok {
+		return quorumError(resp, quorum)
+	}
+	return stream.SendAndClose(resp)
+}
+
+var errBaseChanged = errors.New("el archivo base cambió")
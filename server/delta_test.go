@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filesystem/delta"
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Stream de ApplyDelta que entrega mensajes ya preparados. beforeRecv, si existe, se llama
+// antes de entregar cada mensaje con su posición.
+type deltaStream struct {
+	grpc.ServerStream
+	chunks     []*pb.DeltaChunk
+	next       int
+	beforeRecv func(int)
+	resp       *pb.Response
+}
+
+func (d *deltaStream) Context() context.Context {
+	return context.Background()
+}
+
+func (d *deltaStream) Recv() (*pb.DeltaChunk, error) {
+	if d.beforeRecv != nil {
+		d.beforeRecv(d.next)
+	}
+	if d.next == len(d.chunks) {
+		return nil, io.EOF
+	}
+	d.next++
+	return d.chunks[d.next-1], nil
+}
+
+func (d *deltaStream) SendAndClose(resp *pb.Response) error {
+	d.resp = resp
+	return nil
+}
+
+// Delta que transforma la versión almacenada de relPath en target, con un mensaje por operación
+func buildDelta(t *testing.T, s *Server, relPath string, target []byte) *deltaStream {
+	t.Helper()
+	sig, err := s.FileSignature(context.Background(), &pb.FileSignatureRequest{Path: relPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := make([]delta.Block, len(sig.Blocks))
+	for i, b := range sig.Blocks {
+		blocks[i] = delta.Block{Weak: b.Weak, Strong: b.Strong}
+	}
+	stream := &deltaStream{chunks: []*pb.DeltaChunk{{Header: &pb.DeltaHeader{
+		Path:               relPath,
+		BaseChecksumSha256: sig.ChecksumSha256,
+		BlockSize:          sig.BlockSize,
+		Size:               int64(len(target)),
+		ChecksumSha256:     contentHash(target),
+	}}}}
+	idx := delta.NewIndex(blocks, int(sig.BlockSize), sig.Size)
+	err = delta.Diff(bytes.NewReader(target), idx, int(sig.BlockSize), func(op delta.Op) error {
+		if op.Count > 0 {
+			stream.chunks = append(stream.chunks, &pb.DeltaChunk{Ops: []*pb.DeltaOp{{Op: &pb.DeltaOp_Copy{Copy: &pb.BlockRange{Index: op.Index, Count: op.Count}}}}})
+		} else {
+			stream.chunks = append(stream.chunks, &pb.DeltaChunk{Ops: []*pb.DeltaOp{{Op: &pb.DeltaOp_Data{Data: op.Data}}}})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func TestApplyDelta(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			base := textBytes(300 * 1024)
+			filePath := filepath.Join(rootDirectory, "doc.txt")
+			if err := s.writeStoredFile(filePath, base); err != nil {
+				t.Fatal(err)
+			}
+			target := append(bytes.Clone(base[:100*1024]), "texto insertado"...)
+			target = append(target, base[100*1024:]...)
+
+			stream := buildDelta(t, s, "doc.txt", target)
+			stream.beforeRecv = func(int) {
+				if s.keys == nil {
+					return
+				}
+				// Con cifrado el resultado a medio construir no está en claro en el disco
+				entries, _ := os.ReadDir(s.stagingDir)
+				for _, e := range entries {
+					raw, err := os.ReadFile(filepath.Join(s.stagingDir, e.Name()))
+					if err == nil && bytes.Contains(raw, []byte("línea 1 del archivo")) {
+						t.Fatalf("el temporal %s contiene el archivo en claro", e.Name())
+					}
+				}
+			}
+			if err := s.ApplyDelta(stream); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.readStoredFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, target) {
+				t.Fatal("el archivo actualizado no coincide")
+			}
+			if stream.resp.FileSize != int64(len(target)) {
+				t.Fatalf("tamaño %d en la respuesta, se esperaba %d", stream.resp.FileSize, len(target))
+			}
+			if entries, _ := os.ReadDir(s.stagingDir); len(entries) != 0 {
+				t.Fatalf("quedaron %d temporales en el directorio de preparación", len(entries))
+			}
+		})
+	}
+}
+
+func TestFileSignatureBlockLimit(t *testing.T) {
+	s := newTestServer(t, nil)
+	// Archivo disperso sin cabecera: con bloques mínimos tendría un bloque más que el límite
+	size := int64(delta.MinBlockSize)*delta.MaxBlocks + 1
+	f, err := os.Create(filepath.Join(rootDirectory, "grande.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	_, err = s.FileSignature(context.Background(), &pb.FileSignatureRequest{Path: "grande.bin", BlockSize: delta.MinBlockSize})
+	if status.Code(err) != codes.OutOfRange {
+		t.Fatalf("se esperaba OutOfRange, se obtuvo %v", err)
+	}
+	// Con el tamaño de bloque por omisión no pasa del límite
+	sig, err := s.FileSignature(context.Background(), &pb.FileSignatureRequest{Path: "grande.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(sig.Blocks)) != delta.NumBlocks(size, int(sig.BlockSize)) || len(sig.Blocks) > delta.MaxBlocks {
+		t.Fatalf("%d bloques de %d bytes", len(sig.Blocks), sig.BlockSize)
+	}
+}
+
+func TestApplyDeltaRejects(t *testing.T) {
+	s := newTestServer(t, nil)
+	base := textBytes(64 * 1024)
+	filePath := filepath.Join(rootDirectory, "doc.txt")
+	if err := s.writeStoredFile(filePath, base); err != nil {
+		t.Fatal(err)
+	}
+	target := append(bytes.Clone(base), "final"...)
+
+	// Checksum equivocado
+	stream := buildDelta(t, s, "doc.txt", target)
+	stream.chunks[0].Header.ChecksumSha256 = contentHash(base)
+	if err := s.ApplyDelta(stream); status.Code(err) != codes.DataLoss {
+		t.Fatalf("se esperaba DataLoss, se obtuvo %v", err)
+	}
+
+	// Más datos que el tamaño anunciado
+	stream = buildDelta(t, s, "doc.txt", target)
+	stream.chunks[0].Header.Size--
+	if err := s.ApplyDelta(stream); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("se esperaba InvalidArgument, se obtuvo %v", err)
+	}
+
+	// Más que el tamaño máximo de subida, aunque sean solo literales
+	stream = buildDelta(t, s, "doc.txt", target)
+	stream.chunks[0].Header.Size = s.uploads.maxSize + 1
+	if err := s.ApplyDelta(stream); status.Code(err) != codes.OutOfRange {
+		t.Fatalf("se esperaba OutOfRange, se obtuvo %v", err)
+	}
+
+	// Copia fuera del base
+	stream = buildDelta(t, s, "doc.txt", target)
+	stream.chunks = append(stream.chunks, &pb.DeltaChunk{Ops: []*pb.DeltaOp{{Op: &pb.DeltaOp_Copy{Copy: &pb.BlockRange{Index: 1000, Count: 1}}}}})
+	if err := s.ApplyDelta(stream); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("se esperaba InvalidArgument, se obtuvo %v", err)
+	}
+
+	got, err := s.readStoredFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, base) {
+		t.Fatal("un delta rechazado modificó el archivo")
+	}
+}
+
+// Una escritura que reemplaza el base mientras llega el delta no se pierde
+func TestApplyDeltaConcurrentWrite(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			base := textBytes(200 * 1024)
+			filePath := filepath.Join(rootDirectory, "doc.txt")
+			if err := s.writeStoredFile(filePath, base); err != nil {
+				t.Fatal(err)
+			}
+			concurrent := []byte("versión escrita por otro cliente")
+			stream := buildDelta(t, s, "doc.txt", append(bytes.Clone(base), "final"...))
+			stream.beforeRecv = func(i int) {
+				if i == 1 {
+					if err := s.writeStoredFile(filePath, concurrent); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := s.ApplyDelta(stream); status.Code(err) != codes.FailedPrecondition {
+				t.Fatalf("se esperaba FailedPrecondition, se obtuvo %v", err)
+			}
+			got, err := s.readStoredFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, concurrent) {
+				t.Fatal("el delta reemplazó la escritura concurrente")
+			}
+		})
+	}
+}
+
+// Las réplicas que terminan después del quórum leen el resultado aunque ApplyDelta ya haya
+// borrado su temporal
+func TestApplyDeltaLateReplica(t *testing.T) {
+	for name, configure := range encryptedVariants {
+		t.Run(name, func(t *testing.T) {
+			s, slow := newLateReplicaServer(t, configure)
+			base := textBytes(3*replicaChunkSize + 10)
+			if err := s.writeStoredFile(filepath.Join(rootDirectory, "doc.txt"), base); err != nil {
+				t.Fatal(err)
+			}
+			target := append(bytes.Clone(base), "final"...)
+			if err := s.ApplyDelta(buildDelta(t, s, "doc.txt", target)); err != nil {
+				t.Fatal(err)
+			}
+			waitLateReplica(t, slow, contentHash(target))
+			if entries, _ := os.ReadDir(s.stagingDir); len(entries) != 0 {
+				t.Fatalf("quedaron %d temporales en el directorio de preparación", len(entries))
+			}
+		})
+	}
+}
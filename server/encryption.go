@@ -0,0 +1,452 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	encryptionAESGCM    = "aes-256-gcm"
+	defaultKeyDirectory = "keys"
+	masterKeySize       = 32
+	dataKeySize         = 32
+	// Las claves de datos sin archivo que las use se conservan este tiempo,
+	// por si pertenecen a una subida que todavía no terminó
+	unusedDataKeyGrace = time.Hour
+)
+
+// Cifrado en sobre: cada archivo (o blob) se cifra con su propia clave de datos AES-GCM,
+// y esa clave se guarda en el directorio de claves envuelta con la clave maestra del nodo.
+// Rotar la clave maestra solo reescribe las claves envueltas, nunca el contenido.
+type keyStore struct {
+	dir        string
+	mu         sync.RWMutex
+	masterKeys map[string][]byte
+	currentID  string
+}
+
+// Clave de datos envuelta tal como se guarda en disco
+type wrappedDataKey struct {
+	MasterKeyID string    `json:"master_key_id"`
+	Nonce       []byte    `json:"nonce"`
+	WrappedKey  []byte    `json:"wrapped_key"`
+	Created     time.Time `json:"created"`
+}
+
+// Interpreta una clave maestra en base64, hexadecimal o 32 bytes en crudo
+func parseMasterKey(value []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(value))
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == masterKeySize {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(text); err == nil && len(key) == masterKeySize {
+		return key, nil
+	}
+	if len(value) == masterKeySize {
+		return value, nil
+	}
+	return nil, fmt.Errorf("la clave maestra debe tener %d bytes (en crudo, base64 o hexadecimal)", masterKeySize)
+}
+
+func loadMasterKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseMasterKey(data)
+}
+
+// Identificador público de una clave maestra, para saber con cuál se envolvió cada clave de datos
+func masterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Crea el almacén de claves. Las claves anteriores solo se usan para desenvolver.
+func newKeyStore(dir string, master []byte, previous ...[]byte) (*keyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	k := &keyStore{dir: dir, masterKeys: make(map[string][]byte)}
+	for _, key := range previous {
+		k.masterKeys[masterKeyID(key)] = key
+	}
+	k.currentID = masterKeyID(master)
+	k.masterKeys[k.currentID] = master
+	return k, nil
+}
+
+func (k *keyStore) path(id string) string {
+	return filepath.Join(k.dir, id+".json")
+}
+
+func sealAESGCM(key, plaintext, additionalData []byte) (nonce, ciphertext []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("nonce inválido")
+	}
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// Genera una clave de datos nueva y la guarda envuelta con la clave maestra actual
+func (k *keyStore) newDataKey() (string, []byte, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+
+	k.mu.RLock()
+	masterID := k.currentID
+	master := k.masterKeys[masterID]
+	k.mu.RUnlock()
+
+	if err := k.writeWrapped(id, key, masterID, master, time.Now()); err != nil {
+		return "", nil, err
+	}
+	return id, key, nil
+}
+
+func (k *keyStore) writeWrapped(id string, key []byte, masterID string, master []byte, created time.Time) error {
+	nonce, wrapped, err := sealAESGCM(master, key, []byte(id))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(wrappedDataKey{MasterKeyID: masterID, Nonce: nonce, WrappedKey: wrapped, Created: created})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(k.path(id), data, 0600)
+}
+
+func (k *keyStore) readWrapped(id string) (*wrappedDataKey, error) {
+	data, err := os.ReadFile(k.path(id))
+	if err != nil {
+		return nil, err
+	}
+	var wrapped wrappedDataKey
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, err
+	}
+	return &wrapped, nil
+}
+
+// Desenvuelve la clave de datos con la clave maestra con la que fue envuelta
+func (k *keyStore) dataKey(id string) ([]byte, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, fmt.Errorf("identificador de clave inválido: %q", id)
+	}
+	wrapped, err := k.readWrapped(id)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer la clave de datos %s: %w", id, err)
+	}
+	k.mu.RLock()
+	master, ok := k.masterKeys[wrapped.MasterKeyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("la clave de datos %s está envuelta con una clave maestra desconocida (%s)", id, wrapped.MasterKeyID)
+	}
+	return openAESGCM(master, wrapped.Nonce, wrapped.WrappedKey, []byte(id))
+}
+
+// Vuelve a envolver todas las claves de datos con una nueva clave maestra y la deja como actual
+func (k *keyStore) rotate(newMaster []byte) (int64, error) {
+	// Las claves nuevas ya se envuelven con la nueva clave; la anterior se conserva
+	// en memoria para poder desenvolver las que todavía no se migraron
+	newID := masterKeyID(newMaster)
+	k.mu.Lock()
+	k.masterKeys[newID] = newMaster
+	k.currentID = newID
+	k.mu.Unlock()
+
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		wrapped, err := k.readWrapped(id)
+		if err != nil {
+			return count, err
+		}
+		if wrapped.MasterKeyID == newID {
+			continue
+		}
+		key, err := k.dataKey(id)
+		if err != nil {
+			return count, err
+		}
+		if err := k.writeWrapped(id, key, newID, newMaster, wrapped.Created); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Borra las claves de datos que ya no usa ningún archivo ni blob
+func (k *keyStore) removeUnused(referenced map[string]bool) (int64, error) {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return 0, err
+	}
+	var removed int64
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() || referenced[id] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < unusedDataKeyGrace {
+			continue
+		}
+		wrapped, err := k.readWrapped(id)
+		if err != nil || time.Since(wrapped.Created) < unusedDataKeyGrace {
+			continue
+		}
+		if err := os.Remove(k.path(id)); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Recorre archivos y blobs para saber qué claves de datos siguen en uso
+func (s *Server) referencedDataKeys() map[string]bool {
+	referenced := make(map[string]bool)
+	collect := func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if header, err := readEnvelopeHeader(path); err == nil && header != nil && header.KeyID != "" {
+			referenced[header.KeyID] = true
+		}
+		return nil
+	}
+	filepath.WalkDir(rootDirectory, collect)
+	if s.blobs != nil {
+		filepath.WalkDir(s.blobs.dir, collect)
+	}
+	if s.uploads != nil {
+		for _, id := range s.uploads.keyIDs() {
+			referenced[id] = true
+		}
+	}
+	return referenced
+}
+
+func (s *Server) removeUnusedDataKeys() {
+	removed, err := s.keys.removeUnused(s.referencedDataKeys())
+	if err != nil {
+		slog.Error("Error limpiando claves de datos", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Info("Claves de datos sin uso eliminadas", "removed", removed)
+	}
+}
+
+// Cifrado AES-GCM de los segmentos de un archivo con su clave de datos. Cada segmento usa el nonce
+// base con su número mezclado en los últimos 8 bytes, y su número y si es el último van como datos
+// adicionales, para que no se puedan reordenar ni quitar segmentos sin que falle la verificación.
+type segmentCipher struct {
+	aead  cipher.AEAD
+	keyID string
+	nonce []byte
+}
+
+func newSegmentCipher(keyID string, key, nonce []byte) (*segmentCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("nonce inválido")
+	}
+	return &segmentCipher{aead: gcm, keyID: keyID, nonce: nonce}, nil
+}
+
+func (c *segmentCipher) params(index int64, last bool) (nonce, additionalData []byte) {
+	nonce = bytes.Clone(c.nonce)
+	counter := nonce[len(nonce)-8:]
+	binary.BigEndian.PutUint64(counter, binary.BigEndian.Uint64(counter)^uint64(index))
+	additionalData = binary.BigEndian.AppendUint64([]byte(c.keyID), uint64(index))
+	if last {
+		return nonce, append(additionalData, 1)
+	}
+	return nonce, append(additionalData, 0)
+}
+
+func (c *segmentCipher) seal(dst, plaintext []byte, index int64, last bool) []byte {
+	nonce, additionalData := c.params(index, last)
+	return c.aead.Seal(dst, nonce, plaintext, additionalData)
+}
+
+func (c *segmentCipher) open(dst, ciphertext []byte, index int64, last bool) ([]byte, error) {
+	nonce, additionalData := c.params(index, last)
+	return c.aead.Open(dst, nonce, ciphertext, additionalData)
+}
+
+// Genera una clave de datos nueva para cifrar los segmentos de un archivo y completa la cabecera
+func (s *Server) newSegmentSealer(header *envelope) (*segmentCipher, error) {
+	keyID, key, err := s.keys.newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header.Encryption = encryptionAESGCM
+	header.KeyID = keyID
+	header.Nonce = nonce
+	return newSegmentCipher(keyID, key, nonce)
+}
+
+// Cifrado con el que se leen los segmentos de un archivo guardado
+func (s *Server) segmentOpener(header *envelope) (*segmentCipher, error) {
+	if header.Encryption != encryptionAESGCM {
+		return nil, fmt.Errorf("algoritmo de cifrado no soportado: %s", header.Encryption)
+	}
+	if s.keys == nil {
+		return nil, errors.New("el archivo está cifrado pero no hay clave maestra configurada")
+	}
+	key, err := s.keys.dataKey(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	return newSegmentCipher(header.KeyID, key, header.Nonce)
+}
+
+// Configura el cifrado en reposo a partir de la clave maestra o del archivo que la contiene
+func (s *Server) initKeyStore(cfg EncryptionConfig) error {
+	var master []byte
+	var err error
+	switch {
+	case cfg.MasterKeyFile != "":
+		master, err = loadMasterKeyFile(cfg.MasterKeyFile)
+	case cfg.MasterKey != "":
+		master, err = parseMasterKey([]byte(cfg.MasterKey))
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Clave anterior opcional, útil si una rotación quedó a medias
+	var previous [][]byte
+	if cfg.MasterKeyPreviousFile != "" {
+		key, err := loadMasterKeyFile(cfg.MasterKeyPreviousFile)
+		if err != nil {
+			return err
+		}
+		previous = append(previous, key)
+	}
+
+	keys, err := newKeyStore(cfg.KeyDirectory, master, previous...)
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	slog.Info("Cifrado en reposo habilitado", "master_key_id", keys.currentID)
+	return nil
+}
+
+// Vuelve a envolver las claves de datos con una nueva clave maestra sin tocar el contenido de los archivos
+func (s *Server) RotateMasterKey(ctx context.Context, req *pb.RotateMasterKeyRequest) (*pb.RotateMasterKeyResponse, error) {
+	if s.keys == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "El cifrado en reposo no está habilitado en este nodo")
+	}
+
+	var newMaster []byte
+	var err error
+	switch {
+	case req.NewKeyFile != "" && len(req.NewKey) > 0:
+		return nil, status.Errorf(codes.InvalidArgument, "Se debe indicar la nueva clave o el archivo que la contiene, no ambos")
+	case req.NewKeyFile != "":
+		newMaster, err = loadMasterKeyFile(req.NewKeyFile)
+	case len(req.NewKey) > 0:
+		newMaster, err = parseMasterKey(req.NewKey)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Falta la nueva clave maestra")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Clave maestra inválida: %v", err)
+	}
+
+	rewrapped, err := s.keys.rotate(newMaster)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error rotando la clave maestra (%d claves ya migradas): %v", rewrapped, err)
+	}
+	removed, err := s.keys.removeUnused(s.referencedDataKeys())
+	if err != nil {
+		slog.Error("Error limpiando claves de datos", "error", err)
+	}
+
+	newID := masterKeyID(newMaster)
+	slog.InfoContext(ctx, "Clave maestra rotada", "master_key_id", newID, "rewrapped_keys", rewrapped)
+	return &pb.RotateMasterKeyResponse{
+		Message:       "Clave maestra rotada. Actualice MASTER_KEY/MASTER_KEY_FILE antes de reiniciar el nodo",
+		MasterKeyId:   newID,
+		RewrappedKeys: rewrapped,
+		RemovedKeys:   removed,
+	}, nil
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "filesystem/proto/filesystem"
+)
+
+const rotatedMasterKey = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+
+// Sin compresión, para que solo el cifrado pueda ocultar el texto en disco
+var encryptedVariants = map[string]func(*Config){
+	"encrypted":       func(c *Config) { c.Encryption.MasterKey = testMasterKey },
+	"dedup-encrypted": func(c *Config) { c.Encryption.MasterKey = testMasterKey; c.Storage.Mode = storageModeDedup },
+}
+
+// Texto fácil de reconocer si llega al disco sin cifrar
+var plaintextMarker = []byte("dato confidencial que no debe quedar en claro\n")
+
+func plaintextData(n int) []byte {
+	return bytes.Repeat(plaintextMarker, n/len(plaintextMarker)+1)[:n]
+}
+
+// Falla si algún archivo bajo dir contiene el texto de prueba
+func assertNoPlaintext(t *testing.T, dir string) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, plaintextMarker) {
+			t.Errorf("%s contiene el contenido en claro", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func uploadBase64(t *testing.T, s *Server, name string, data []byte) {
+	t.Helper()
+	_, err := s.UploadFile(context.Background(), &pb.UploadRequest{Filename: name, ContentBase64: base64.StdEncoding.EncodeToString(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertStored(t *testing.T, s *Server, name string, want []byte) {
+	t.Helper()
+	got, err := s.readStoredFile(filepath.Join(rootDirectory, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s no coincide con lo subido", name)
+	}
+}
+
+func TestEncryptionAtRest(t *testing.T) {
+	for name, configure := range encryptedVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			// Todos los directorios del nodo: raíz, blobs, sesiones, preparación y claves
+			nodeDir := filepath.Dir(rootDirectory)
+			ctx := context.Background()
+
+			data := plaintextData(3*defaultSegmentSize + 100)
+			uploadBase64(t, s, "base64.txt", data)
+			// En dedup, el mismo contenido con otro nombre reutiliza los blobs
+			uploadBase64(t, s, "copia.txt", data)
+			assertNoPlaintext(t, nodeDir)
+
+			session, err := s.InitiateUpload(ctx, &pb.InitiateUploadRequest{Filename: "partes.txt", TotalSize: int64(len(data)), ChecksumSha256: contentHash(data)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			half := len(data) / 2
+			if _, err := s.UploadPart(ctx, &pb.UploadPartRequest{SessionId: session.SessionId, Content: data[:half]}); err != nil {
+				t.Fatal(err)
+			}
+			// Los datos parciales de la sesión también se guardan cifrados
+			assertNoPlaintext(t, nodeDir)
+			if _, err := s.UploadPart(ctx, &pb.UploadPartRequest{SessionId: session.SessionId, Offset: int64(half), Content: data[half:]}); err != nil {
+				t.Fatal(err)
+			}
+			// El temporal de preparación se escribe ya codificado y se renombra al publicarlo,
+			// así que basta con revisar lo que queda después
+			if _, err := s.CompleteUpload(ctx, &pb.CompleteUploadRequest{SessionId: session.SessionId}); err != nil {
+				t.Fatal(err)
+			}
+			assertNoPlaintext(t, nodeDir)
+
+			for _, name := range []string{"base64.txt", "copia.txt", "partes.txt"} {
+				assertStored(t, s, name, data)
+			}
+		})
+	}
+}
+
+func TestRotateMasterKey(t *testing.T) {
+	for name, configure := range encryptedVariants {
+		t.Run(name, func(t *testing.T) {
+			cfg := testConfig(t)
+			configure(&cfg)
+			if err := os.MkdirAll(cfg.Storage.Root, 0755); err != nil {
+				t.Fatal(err)
+			}
+			s := NewServer(cfg)
+			before := plaintextData(2*defaultSegmentSize + 10)
+			uploadBase64(t, s, "antes.txt", before)
+
+			resp, err := s.RotateMasterKey(context.Background(), &pb.RotateMasterKeyRequest{NewKey: []byte(rotatedMasterKey)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.RewrappedKeys == 0 {
+				t.Fatal("no se volvió a cifrar ninguna clave de datos")
+			}
+			newKey, err := parseMasterKey([]byte(rotatedMasterKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.MasterKeyId != masterKeyID(newKey) {
+				t.Errorf("master_key_id = %s, se esperaba el de la nueva clave", resp.MasterKeyId)
+			}
+			// El nodo sigue leyendo y escribiendo sin reiniciar
+			assertStored(t, s, "antes.txt", before)
+			after := plaintextData(defaultSegmentSize + 1)
+			uploadBase64(t, s, "despues.txt", after)
+
+			// Tras reiniciar con la nueva clave se leen los archivos de antes y de después
+			cfg.Encryption.MasterKey = rotatedMasterKey
+			restarted := NewServer(cfg)
+			assertStored(t, restarted, "antes.txt", before)
+			assertStored(t, restarted, "despues.txt", after)
+			assertNoPlaintext(t, filepath.Dir(rootDirectory))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+)
+
+// Los archivos que no se guardan tal cual (por ejemplo, referencias a blobs) llevan
+// una cabecera: magic + longitud de la cabecera (uint32 big endian) + JSON + contenido.
+// Los archivos sin magic se consideran contenido plano.
+const (
+	envelopeMagic         = "FDEPOT\x00\x01"
+	maxEnvelopeHeaderSize = 64 * 1024
+)
+
+// Cabecera de un archivo almacenado
+type envelope struct {
+	// Tamaño lógico del contenido original
+	Size int64 `json:"size"`
+	// SHA-256 del blob referenciado en modo deduplicado
+	Blob string `json:"blob,omitempty"`
+	// Algoritmo con el que está comprimido el contenido
+	Compression string `json:"compression,omitempty"`
+	// Cifrado del contenido y clave de datos con la que se cifró
+	Encryption string `json:"encryption,omitempty"`
+	KeyID      string `json:"key_id,omitempty"`
+	Nonce      []byte `json:"nonce,omitempty"`
+	// Tamaño de los segmentos del contenido original (ver segments.go). Cero si el contenido no
+	// está comprimido ni cifrado, o si está en un blob.
+	SegmentSize int64 `json:"segment_size,omitempty"`
+}
+
+var errInvalidEnvelope = errors.New("cabecera de archivo almacenado inválida")
+
+func encodeEnvelope(header envelope, payload []byte) ([]byte, error) {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(envelopeMagic) + 4 + len(headerJSON) + len(payload))
+	buf.WriteString(envelopeMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(headerJSON)))
+	buf.Write(headerJSON)
+	buf.Write(payload)
+	return buf.Bytes(), nil
+}
+
+// Lee solo la cabecera de un archivo en disco, sin cargar su contenido
+func readEnvelopeHeader(path string) (*envelope, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header, _, err := readEnvelopeHeaderFrom(f)
+	return header, err
+}
+
+// Lee la cabecera desde el principio de r y devuelve también dónde empieza el contenido.
+// Devuelve nil si no hay cabecera.
+func readEnvelopeHeaderFrom(r io.Reader) (*envelope, int64, error) {
+	prefix := make([]byte, len(envelopeMagic)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	if !bytes.HasPrefix(prefix, []byte(envelopeMagic)) {
+		return nil, 0, nil
+	}
+	headerLen := binary.BigEndian.Uint32(prefix[len(envelopeMagic):])
+	if headerLen > maxEnvelopeHeaderSize {
+		return nil, 0, errInvalidEnvelope
+	}
+	headerJSON := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, headerJSON); err != nil {
+		return nil, 0, errInvalidEnvelope
+	}
+	var header envelope
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, 0, errInvalidEnvelope
+	}
+	return &header, int64(len(prefix)) + int64(headerLen), nil
+}
@@ -0,0 +1,533 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Tamaño de cada parte al pasar el cuerpo de un PUT a una sesión de subida
+const gatewayPartSize = 1024 * 1024
+
+var gatewayJSON = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// Gateway HTTP/REST sobre FileSystemService. Cada petición se traduce a la RPC equivalente,
+// que pasa por los mismos interceptores que las llamadas gRPC (autenticación, auditoría, límites).
+//
+//	GET    /v1/files/{ruta}   descarga (Range, ETag, If-None-Match)
+//	PUT    /v1/files/{ruta}   sube el cuerpo, por partes
+//	POST   /v1/files/{dir}    sube los archivos de un formulario multipart
+//	DELETE /v1/files/{ruta}   elimina un archivo o directorio
+//	GET    /v1/dirs/{ruta}    lista un directorio
+//	POST   /v1/dirs/{ruta}    crea un directorio
+//	POST   /v1/move           {"source_path", "destination_path"}
+//	POST   /v1/rename         {"old_name", "new_name"}
+//
+// Las descargas y los PUT también se aceptan sin token con una URL firmada (ver CreateSignedURL).
+type Gateway struct {
+	server       *Server
+	interceptors []grpc.UnaryServerInterceptor
+	// Tamaño máximo de los archivos de un formulario multipart, que se suben en una sola llamada
+	maxFormFileSize int64
+	mux             *http.ServeMux
+}
+
+// Crea el gateway. Los interceptores deben ser los mismos que los del servidor gRPC.
+func (s *Server) NewGateway(interceptors ...grpc.UnaryServerInterceptor) *Gateway {
+	s.reloadMu.Lock()
+	maxFormFileSize := int64(s.config.Node.MaxMessageSize)
+	s.reloadMu.Unlock()
+
+	g := &Gateway{server: s, interceptors: interceptors, maxFormFileSize: maxFormFileSize, mux: http.NewServeMux()}
+	g.mux.HandleFunc("GET /v1/files/{path...}", g.download)
+	g.mux.HandleFunc("PUT /v1/files/{path...}", g.put)
+	g.mux.HandleFunc("POST /v1/files/{path...}", g.uploadForm)
+	g.mux.HandleFunc("DELETE /v1/files/{path...}", g.delete)
+	g.mux.HandleFunc("GET /v1/dirs/{path...}", g.list)
+	g.mux.HandleFunc("POST /v1/dirs/{path...}", g.mkdir)
+	g.mux.HandleFunc("POST /v1/move", g.move)
+	g.mux.HandleFunc("POST /v1/rename", g.rename)
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// Dirección del cliente HTTP, para los interceptores que la leen del peer gRPC
+type httpAddr string
+
+func (a httpAddr) Network() string { return "tcp" }
+func (a httpAddr) String() string  { return string(a) }
+
+// Recibe los metadatos que los interceptores envían al cliente (identificador de petición,
+// tiempo de espera de los límites) y los pasa a las cabeceras de la respuesta HTTP
+type httpTransportStream struct {
+	method string
+	header http.Header
+}
+
+func (s *httpTransportStream) Method() string { return s.method }
+
+func (s *httpTransportStream) SetHeader(md metadata.MD) error {
+	for key, values := range md {
+		for _, value := range values {
+			s.header.Add(key, value)
+		}
+	}
+	return nil
+}
+
+func (s *httpTransportStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+func (s *httpTransportStream) SetTrailer(md metadata.MD) error { return s.SetHeader(md) }
+
+// Contexto de una petición HTTP como si fuera una llamada gRPC: las cabeceras llegan como
+// metadatos (authorization, x-request-id, traceparent...) y lo que los interceptores envían
+// al cliente vuelve en las cabeceras de la respuesta
+func httpCallContext(w http.ResponseWriter, r *http.Request) context.Context {
+	md := metadata.MD{}
+	for key, values := range r.Header {
+		md.Append(key, values...)
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: httpAddr(r.RemoteAddr)})
+	return grpc.NewContextWithServerTransportStream(ctx, &httpTransportStream{header: w.Header()})
+}
+
+// Ejecuta una RPC del servidor pasando por los interceptores, en un contexto creado con httpCallContext
+func invokeUnary[Req, Resp any](ctx context.Context, interceptors []grpc.UnaryServerInterceptor, server *Server, method string, req Req, fn func(context.Context, Req) (Resp, error)) (Resp, error) {
+	if stream, ok := grpc.ServerTransportStreamFromContext(ctx).(*httpTransportStream); ok {
+		ctx = grpc.NewContextWithServerTransportStream(ctx, &httpTransportStream{method: method, header: stream.header})
+	}
+	info := &grpc.UnaryServerInfo{Server: server, FullMethod: method}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return fn(ctx, req.(Req))
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		next, interceptor := handler, interceptors[i]
+		handler = func(ctx context.Context, req any) (any, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	resp, err := handler(ctx, req)
+	out, _ := resp.(Resp)
+	return out, err
+}
+
+// Ejecuta la RPC que corresponde a una petición del gateway
+func gatewayCall[Req, Resp any](g *Gateway, w http.ResponseWriter, r *http.Request, method string, req Req, fn func(context.Context, Req) (Resp, error)) (Resp, error) {
+	return invokeUnary(httpCallContext(w, r), g.interceptors, g.server, method, req, fn)
+}
+
+// Código HTTP equivalente a cada código gRPC
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeGatewayError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	json.NewEncoder(w).Encode(map[string]string{"code": st.Code().String(), "error": st.Message()})
+}
+
+func writeGatewayResponse(w http.ResponseWriter, code int, resp proto.Message) {
+	body, err := gatewayJSON.Marshal(resp)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// Algunas operaciones informan los errores de validación solo en el mensaje de la respuesta
+func writeResultOrError(w http.ResponseWriter, successStatus int, resp *pb.Response, err error) {
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	writeGatewayResponse(w, successStatus, resp)
+}
+
+// Ruta relativa de la URL, validada igual que las rutas de las réplicas
+func gatewayPath(r *http.Request, allowRoot bool) (string, error) {
+	relPath := r.PathValue("path")
+	if relPath == "" {
+		if allowRoot {
+			return "", nil
+		}
+		return "", status.Errorf(codes.InvalidArgument, "Falta la ruta")
+	}
+	if _, err := resolveStoragePath(relPath); err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	return path.Clean(relPath), nil
+}
+
+func splitGatewayPath(relPath string) (dir, name string) {
+	dir, name = path.Split(relPath)
+	return strings.TrimSuffix(dir, "/"), name
+}
+
+func (g *Gateway) download(w http.ResponseWriter, r *http.Request) {
+	relPath, err := gatewayPath(r, false)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	if r, err = g.checkSignedURL(r, relPath); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	content, resp, err := invokeDownload(httpCallContext(w, r), g.interceptors, g.server, relPath)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	defer content.Close()
+	record, err := g.server.contentChecksum(indexKey(relPath), content)
+	if err != nil {
+		writeGatewayError(w, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err))
+		return
+	}
+
+	w.Header().Set("ETag", `"`+record.Checksum+`"`)
+	w.Header().Set("Content-Type", resp.FileType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": resp.Filename}))
+	// ServeContent responde los rangos, If-None-Match y Content-Length
+	http.ServeContent(w, r, resp.Filename, time.Time{}, io.NewSectionReader(content, 0, content.size))
+}
+
+// Abre un archivo para enviarlo por partes. Pasa por los interceptores como DownloadFile
+// (autenticación, auditoría, límites), pero sin leer el archivo entero; quien lo llama debe
+// cerrar el contenido.
+func invokeDownload(ctx context.Context, interceptors []grpc.UnaryServerInterceptor, server *Server, relPath string) (*storedContent, *pb.DownloadResponse, error) {
+	var content *storedContent
+	resp, err := invokeUnary(ctx, interceptors, server, pb.FileSystemService_DownloadFile_FullMethodName, &pb.DownloadRequest{Path: relPath},
+		func(ctx context.Context, req *pb.DownloadRequest) (*pb.DownloadResponse, error) {
+			opened, resp, err := server.openDownload(ctx, req)
+			content = opened
+			return resp, err
+		})
+	if err != nil {
+		// Un interceptor puede fallar después de abrir el archivo
+		if content != nil {
+			content.Close()
+		}
+		return nil, nil, err
+	}
+	return content, resp, nil
+}
+
+// Sube el cuerpo de la petición mediante una sesión de subida, sin tenerlo entero en memoria
+func (g *Gateway) put(w http.ResponseWriter, r *http.Request) {
+	relPath, err := gatewayPath(r, false)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	if r, err = g.checkSignedURL(r, relPath); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	if r.ContentLength < 0 {
+		writeGatewayError(w, status.Errorf(codes.InvalidArgument, "Se requiere Content-Length"))
+		return
+	}
+	dir, name := splitGatewayPath(relPath)
+	resp, _, err := streamUpload(httpCallContext(w, r), g.interceptors, g.server, dir, name, r.Body, r.ContentLength, "")
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	writeGatewayResponse(w, http.StatusCreated, resp)
+}
+
+// Sube size bytes de body a dir/name mediante una sesión de subida, sin tenerlos enteros en
+// memoria, y devuelve también el SHA-256 del contenido. Si expected no está vacío, la subida se
+// descarta cuando el contenido no tiene ese SHA-256.
+func streamUpload(ctx context.Context, interceptors []grpc.UnaryServerInterceptor, server *Server, dir, name string, body io.Reader, size int64, expected string) (*pb.Response, string, error) {
+	session, err := invokeUnary(ctx, interceptors, server, pb.FileSystemService_InitiateUpload_FullMethodName,
+		&pb.InitiateUploadRequest{Filename: name, Directory: dir, TotalSize: size}, server.InitiateUpload)
+	if err != nil {
+		return nil, "", err
+	}
+	// Con la sesión abierta, las llamadas que siguen esperan al limitador en lugar de fallar
+	ctx = withThrottle(ctx)
+	sum, err := uploadSessionParts(ctx, interceptors, server, session.SessionId, body, size)
+	if err == nil && expected != "" && sum != expected {
+		err = status.Errorf(codes.DataLoss, "El contenido no coincide con el SHA-256 indicado")
+	}
+	var resp *pb.Response
+	if err == nil {
+		resp, err = invokeUnary(ctx, interceptors, server, pb.FileSystemService_CompleteUpload_FullMethodName,
+			&pb.CompleteUploadRequest{SessionId: session.SessionId, ChecksumSha256: sum}, server.CompleteUpload)
+	}
+	if err != nil {
+		invokeUnary(ctx, interceptors, server, pb.FileSystemService_AbortUpload_FullMethodName,
+			&pb.UploadSessionRequest{SessionId: session.SessionId}, server.AbortUpload)
+		return nil, "", err
+	}
+	return resp, sum, nil
+}
+
+// Pasa size bytes de body a una sesión de subida, parte por parte, y devuelve su SHA-256. Las
+// partes esperan al limitador del cliente en lugar de fallar. Los errores de lectura con estado
+// gRPC (una firma inválida, por ejemplo) se devuelven tal cual.
+func uploadSessionParts(ctx context.Context, interceptors []grpc.UnaryServerInterceptor, server *Server, sessionID string, body io.Reader, size int64) (string, error) {
+	ctx = withThrottle(ctx)
+	hasher := sha256.New()
+	buf := make([]byte, gatewayPartSize)
+	var offset int64
+	for offset < size {
+		n, err := io.ReadFull(body, buf[:min(int64(len(buf)), size-offset)])
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return "", err
+			}
+			return "", status.Errorf(codes.InvalidArgument, "Error leyendo el cuerpo: %v", err)
+		}
+		hasher.Write(buf[:n])
+		_, err = invokeUnary(ctx, interceptors, server, pb.FileSystemService_UploadPart_FullMethodName,
+			&pb.UploadPartRequest{SessionId: sessionID, Offset: offset, Content: buf[:n]}, server.UploadPart)
+		if err != nil {
+			return "", err
+		}
+		offset += int64(n)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Sube los archivos de un formulario multipart/form-data al directorio de la URL
+func (g *Gateway) uploadForm(w http.ResponseWriter, r *http.Request) {
+	dir, err := gatewayPath(r, true)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeGatewayError(w, status.Errorf(codes.InvalidArgument, "Se esperaba un formulario multipart: %v", err))
+		return
+	}
+
+	var uploaded []json.RawMessage
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeGatewayError(w, status.Errorf(codes.InvalidArgument, "Formulario inválido: %v", err))
+			return
+		}
+		name := part.FileName()
+		if name == "" {
+			continue
+		}
+		if name != path.Base(name) || name == ".." {
+			writeGatewayError(w, status.Errorf(codes.InvalidArgument, "Nombre de archivo inválido: %s", name))
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(part, g.maxFormFileSize+1))
+		if err != nil {
+			writeGatewayError(w, status.Errorf(codes.InvalidArgument, "Error leyendo %s: %v", name, err))
+			return
+		}
+		if int64(len(data)) > g.maxFormFileSize {
+			writeGatewayError(w, status.Errorf(codes.InvalidArgument, "%s supera los %d bytes; usar PUT para archivos grandes", name, g.maxFormFileSize))
+			return
+		}
+
+		resp, err := gatewayCall(g, w, r, pb.FileSystemService_UploadFile_FullMethodName,
+			&pb.UploadRequest{Filename: name, Directory: dir, ContentBase64: base64.StdEncoding.EncodeToString(data)}, g.server.UploadFile)
+		if err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+		body, err := gatewayJSON.Marshal(resp)
+		if err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+		uploaded = append(uploaded, body)
+	}
+	if len(uploaded) == 0 {
+		writeGatewayError(w, status.Errorf(codes.InvalidArgument, "El formulario no contiene archivos"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string][]json.RawMessage{"files": uploaded})
+}
+
+func (g *Gateway) delete(w http.ResponseWriter, r *http.Request) {
+	relPath, err := gatewayPath(r, false)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	resp, err := gatewayCall(g, w, r, pb.FileSystemService_DeleteFile_FullMethodName, &pb.DeleteRequest{Path: relPath}, g.server.DeleteFile)
+	writeResultOrError(w, http.StatusOK, resp, err)
+}
+
+func (g *Gateway) list(w http.ResponseWriter, r *http.Request) {
+	relPath, err := gatewayPath(r, true)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	resp, err := gatewayCall(g, w, r, pb.FileSystemService_ListAll_FullMethodName, &pb.DirectoryRequest{Path: relPath}, g.server.ListAll)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	writeGatewayResponse(w, http.StatusOK, resp)
+}
+
+func (g *Gateway) mkdir(w http.ResponseWriter, r *http.Request) {
+	relPath, err := gatewayPath(r, false)
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	resp, err := gatewayCall(g, w, r, pb.FileSystemService_CreateDirectory_FullMethodName, &pb.DirectoryRequest{Path: relPath}, g.server.CreateDirectory)
+	writeResultOrError(w, http.StatusCreated, resp, err)
+}
+
+// Lee el cuerpo JSON de una petición, con los nombres de campo de los mensajes protobuf
+func readGatewayJSON(r *http.Request, req proto.Message) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Error leyendo el cuerpo: %v", err)
+	}
+	if err := protojson.Unmarshal(body, req); err != nil {
+		return status.Errorf(codes.InvalidArgument, "JSON inválido: %v", err)
+	}
+	return nil
+}
+
+// Valida las rutas de un cuerpo JSON, que pueden estar vacías o salir del directorio raíz
+func validGatewayPaths(paths ...string) error {
+	for _, p := range paths {
+		if p == "" {
+			return status.Errorf(codes.InvalidArgument, "Las rutas no pueden estar vacías")
+		}
+		if _, err := resolveStoragePath(p); err != nil {
+			return status.Errorf(codes.InvalidArgument, "Ruta inválida %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) move(w http.ResponseWriter, r *http.Request) {
+	req := &pb.MoveRequest{}
+	if err := readGatewayJSON(r, req); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	if err := validGatewayPaths(req.SourcePath, req.DestinationPath); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	resp, err := gatewayCall(g, w, r, pb.FileSystemService_MoveFile_FullMethodName, req, g.server.MoveFile)
+	writeResultOrError(w, http.StatusOK, resp, err)
+}
+
+func (g *Gateway) rename(w http.ResponseWriter, r *http.Request) {
+	req := &pb.RenameRequest{}
+	if err := readGatewayJSON(r, req); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	if err := validGatewayPaths(req.OldName, req.NewName); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	resp, err := gatewayCall(g, w, r, pb.FileSystemService_RenameFile_FullMethodName, req, g.server.RenameFile)
+	writeResultOrError(w, http.StatusOK, resp, err)
+}
+
+// Atiende el gateway en la dirección indicada, con TLS si el nodo lo usa. Devuelve el
+// servidor para poder detenerlo al apagar el nodo.
+func (s *Server) ServeGateway(address string, interceptors ...grpc.UnaryServerInterceptor) *http.Server {
+	return s.serveHTTP("Gateway HTTP", address, "/v1/", s.NewGateway(interceptors...))
+}
+
+// Atiende un servidor HTTP del nodo en segundo plano, con TLS si el nodo lo usa
+func (s *Server) serveHTTP(name, address, urlPath string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		TLSConfig:         s.TLSConfig(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		scheme := "http"
+		var err error
+		if srv.TLSConfig != nil {
+			scheme = "https"
+		}
+		slog.Info(name+" disponible", "url", fmt.Sprintf("%s://%s%s", scheme, address, urlPath))
+		if srv.TLSConfig != nil {
+			// El certificado sale de TLSConfig, que lo toma del estado de seguridad
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error en el servidor HTTP", "server", name, "error", err)
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+)
+
+// Petición al gateway con las cabeceras indicadas, en pares nombre-valor
+func gatewayRequest(h http.Handler, method, target string, body []byte, headers ...string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body != nil {
+		r = httptest.NewRequest(method, target, bytes.NewReader(body))
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGatewayDownload(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				if configure != nil {
+					configure(c)
+				}
+				c.Node.MaxMessageSize = 1 << 20
+				c.Security.AuthTokens = []string{testToken}
+			})
+			g := s.NewGateway(s.AuthUnaryInterceptor())
+			auth := []string{authorizationKey, bearerPrefix + testToken}
+
+			// Mayor que el tamaño máximo de mensaje: la descarga no pasa por DownloadFile entero
+			data := textBytes(3<<20 + 17)
+			if w := gatewayRequest(g, http.MethodPut, "/v1/files/docs/a.txt", data, auth...); w.Code != http.StatusCreated {
+				t.Fatalf("PUT devolvió %d: %s", w.Code, w.Body)
+			}
+
+			w := gatewayRequest(g, http.MethodGet, "/v1/files/docs/a.txt", nil, auth...)
+			if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+				t.Fatalf("GET devolvió %d con %d bytes", w.Code, w.Body.Len())
+			}
+			sum := sha256.Sum256(data)
+			etag := `"` + hex.EncodeToString(sum[:]) + `"`
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Fatalf("ETag %s, se esperaba %s", got, etag)
+			}
+			if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+				t.Fatalf("Content-Type %q", got)
+			}
+
+			// Rangos, incluido uno que cruza el límite de un segmento
+			for header, want := range map[string][]byte{
+				"bytes=0-9":             data[:10],
+				"bytes=1048570-1048590": data[1048570:1048591],
+				"bytes=-5":              data[len(data)-5:],
+			} {
+				w := gatewayRequest(g, http.MethodGet, "/v1/files/docs/a.txt", nil, append(auth, "Range", header)...)
+				if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), want) {
+					t.Fatalf("Range %s devolvió %d con %q", header, w.Code, w.Body.Bytes())
+				}
+			}
+			if w := gatewayRequest(g, http.MethodGet, "/v1/files/docs/a.txt", nil, append(auth, "Range", "bytes=99999999-")...); w.Code != http.StatusRequestedRangeNotSatisfiable {
+				t.Fatalf("un rango fuera del archivo devolvió %d", w.Code)
+			}
+			if w := gatewayRequest(g, http.MethodGet, "/v1/files/docs/a.txt", nil, append(auth, "If-None-Match", etag)...); w.Code != http.StatusNotModified {
+				t.Fatalf("If-None-Match devolvió %d", w.Code)
+			}
+
+			if w := gatewayRequest(g, http.MethodGet, "/v1/files/docs/otro.txt", nil, auth...); w.Code != http.StatusNotFound {
+				t.Fatalf("un archivo inexistente devolvió %d", w.Code)
+			}
+			if w := gatewayRequest(g, http.MethodGet, "/v1/files/docs", nil, auth...); w.Code != http.StatusBadRequest {
+				t.Fatalf("un directorio devolvió %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestGatewayAuth(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.Security.AuthTokens = []string{testToken} })
+	g := s.NewGateway(s.AuthUnaryInterceptor())
+	auth := []string{authorizationKey, bearerPrefix + testToken}
+	if w := gatewayRequest(g, http.MethodPut, "/v1/files/a.txt", []byte("hola"), auth...); w.Code != http.StatusCreated {
+		t.Fatalf("PUT con token devolvió %d: %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   []byte
+	}{
+		{"descarga", http.MethodGet, "/v1/files/a.txt", nil},
+		{"subida", http.MethodPut, "/v1/files/b.txt", []byte("hola")},
+		{"borrado", http.MethodDelete, "/v1/files/a.txt", nil},
+		{"listado", http.MethodGet, "/v1/dirs/", nil},
+		{"directorio", http.MethodPost, "/v1/dirs/d", nil},
+		{"mover", http.MethodPost, "/v1/move", []byte(`{"source_path": "a.txt", "destination_path": "c.txt"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, headers := range [][]string{
+				nil,
+				{authorizationKey, bearerPrefix + "tok-inválido-0123456"},
+				{authorizationKey, testToken},
+			} {
+				w := gatewayRequest(g, tt.method, tt.target, tt.body, headers...)
+				if w.Code != http.StatusUnauthorized {
+					t.Fatalf("con cabeceras %q devolvió %d, se esperaba 401", headers, w.Code)
+				}
+			}
+		})
+	}
+
+	// Nada de lo anterior cambió el árbol
+	w := gatewayRequest(g, http.MethodGet, "/v1/files/a.txt", nil, auth...)
+	if body, _ := io.ReadAll(w.Body); w.Code != http.StatusOK || string(body) != "hola" {
+		t.Fatalf("GET con token devolvió %d con %q", w.Code, body)
+	}
+	if w := gatewayRequest(g, http.MethodGet, "/v1/files/b.txt", nil, auth...); w.Code != http.StatusNotFound {
+		t.Fatalf("la subida sin token creó el archivo: %d", w.Code)
+	}
+}
+
+func TestGatewaySignedURL(t *testing.T) {
+	const signingKey = "clave-de-firma-de-urls-de-prueba-0123456789"
+	s := newTestServer(t, func(c *Config) {
+		c.Security.AuthTokens = []string{testToken}
+		c.Security.URLSigningKey = signingKey
+		c.Node.HTTPAddress = "localhost:8080"
+	})
+	g := s.NewGateway(s.AuthUnaryInterceptor())
+	if w := gatewayRequest(g, http.MethodPut, "/v1/files/a.txt", []byte("hola"), authorizationKey, bearerPrefix+testToken); w.Code != http.StatusCreated {
+		t.Fatalf("PUT con token devolvió %d: %s", w.Code, w.Body)
+	}
+	// Ruta y consulta de una URL firmada, que es lo que recibe el gateway
+	signed := func(method, path string, maxSize int64) *url.URL {
+		t.Helper()
+		resp, err := s.CreateSignedURL(context.Background(), &pb.CreateSignedURLRequest{Method: method, Path: path, MaxSize: maxSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(resp.Url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Host != "localhost:8080" {
+			t.Fatalf("URL firmada con el host %q", u.Host)
+		}
+		return &url.URL{Path: u.Path, RawQuery: u.RawQuery}
+	}
+	withQuery := func(u *url.URL, key, value string) string {
+		query := u.Query()
+		query.Set(key, value)
+		return (&url.URL{Path: u.Path, RawQuery: query.Encode()}).String()
+	}
+
+	get := signed(http.MethodGet, "a.txt", 0)
+	if w := gatewayRequest(g, http.MethodGet, get.String(), nil); w.Code != http.StatusOK || w.Body.String() != "hola" {
+		t.Fatalf("GET firmado devolvió %d con %q", w.Code, w.Body)
+	}
+	if w := gatewayRequest(g, http.MethodHead, get.String(), nil); w.Code != http.StatusOK {
+		t.Fatalf("HEAD con la URL de GET devolvió %d", w.Code)
+	}
+	put := signed(http.MethodPut, "dir/b.txt", 10)
+	os.MkdirAll(filepath.Join(rootDirectory, "dir"), 0755)
+	if w := gatewayRequest(g, http.MethodPut, put.String(), []byte("chau")); w.Code != http.StatusCreated {
+		t.Fatalf("PUT firmado devolvió %d: %s", w.Code, w.Body)
+	}
+	assertStored(t, s, "dir/b.txt", []byte("chau"))
+
+	expires := time.Now().Add(-time.Minute).Unix()
+	expired := url.Values{}
+	expired.Set(signedURLExpiresParam, strconv.FormatInt(expires, 10))
+	expired.Set(signedURLSignatureParam, signURL([]byte(signingKey), http.MethodGet, "a.txt", expires, 0))
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   []byte
+	}{
+		{"vencida", http.MethodGet, "/v1/files/a.txt?" + expired.Encode(), nil},
+		{"otra ruta", http.MethodGet, (&url.URL{Path: "/v1/files/dir/b.txt", RawQuery: get.RawQuery}).String(), nil},
+		{"vencimiento alterado", http.MethodGet, withQuery(get, signedURLExpiresParam, strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)), nil},
+		{"firma alterada", http.MethodGet, withQuery(get, signedURLSignatureParam, get.Query().Get(signedURLSignatureParam)+"x"), nil},
+		{"GET con la URL de PUT", http.MethodGet, put.String(), nil},
+		{"PUT con la URL de GET", http.MethodPut, get.String(), []byte("otro")},
+		{"tamaño máximo alterado", http.MethodPut, withQuery(put, signedURLMaxSizeParam, "1000"), []byte("más de diez bytes")},
+		{"mayor que el tamaño máximo", http.MethodPut, put.String(), []byte("más de diez bytes")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := gatewayRequest(g, tt.method, tt.target, tt.body); w.Code != http.StatusForbidden {
+				t.Fatalf("devolvió %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+	// Las URL firmadas solo sirven para descargar y subir: el resto sigue necesitando un token
+	if w := gatewayRequest(g, http.MethodDelete, get.String(), nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("DELETE con la URL de GET devolvió %d", w.Code)
+	}
+	// Nada de lo rechazado cambió los archivos
+	assertStored(t, s, "a.txt", []byte("hola"))
+	assertStored(t, s, "dir/b.txt", []byte("chau"))
+}
+
+func TestGatewayDelete(t *testing.T) {
+	s := newTestServer(t, nil)
+	g := s.NewGateway()
+	if w := gatewayRequest(g, http.MethodPut, "/v1/files/a.txt", []byte("hola")); w.Code != http.StatusCreated {
+		t.Fatalf("PUT devolvió %d: %s", w.Code, w.Body)
+	}
+	if w := gatewayRequest(g, http.MethodDelete, "/v1/files/a.txt", nil); w.Code != http.StatusOK {
+		t.Fatalf("DELETE devolvió %d: %s", w.Code, w.Body)
+	}
+	// DeleteFile responde NotFound si la ruta no existe
+	if w := gatewayRequest(g, http.MethodDelete, "/v1/files/a.txt", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("DELETE de un archivo borrado devolvió %d", w.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+)
+
+const defaultHeartbeatInterval = 10 * time.Second
+
+// Estado que el nodo reporta al servidor central en cada latido
+func (s *Server) nodeStatus(address string) *pb.NodeStatus {
+	s.scrub.mu.Lock()
+	scanned := s.scrub.totalFiles
+	s.scrub.mu.Unlock()
+	return &pb.NodeStatus{
+		Address:       address,
+		Status:        "activo",
+		NodeId:        s.nodeID,
+		ScrubbedFiles: scanned,
+		CorruptFiles:  int64(s.checksums.issueCount()),
+	}
+}
+
+// Empieza a enviar latidos al servidor central configurado, si hay uno.
+// address es la dirección en la que escucha este nodo.
+func (s *Server) StartHeartbeat(address string) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.listenAddress = address
+	s.restartHeartbeat(s.config.Node)
+}
+
+// Detiene los latidos en curso y los vuelve a iniciar con la configuración indicada.
+// Debe llamarse con s.reloadMu tomado.
+func (s *Server) restartHeartbeat(node NodeConfig) {
+	if s.stopHeartbeat != nil {
+		s.stopHeartbeat()
+		s.stopHeartbeat = nil
+	}
+	if node.CentralAddress == "" || s.listenAddress == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopHeartbeat = cancel
+	go s.sendHeartbeats(ctx, node.CentralAddress, s.listenAddress, node.HeartbeatInterval)
+}
+
+// Envía el estado del nodo al servidor central cada cierto intervalo (10s si no se indica)
+func (s *Server) sendHeartbeats(ctx context.Context, centralAddress, address string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	conn, err := s.dialPeer(centralAddress)
+	if err != nil {
+		slog.Error("No se pudo conectar al servidor central", "address", centralAddress, "error", err)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewNodeServiceClient(conn)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, interval)
+		_, err := client.ReportStatus(reqCtx, s.nodeStatus(address))
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Error reportando estado al servidor central", "address", centralAddress, "error", err)
+		}
+	}
+}
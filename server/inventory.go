@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"path/filepath"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Checksum del contenido de un archivo. Se usa el del catálogo si el archivo no cambió
+// desde que se registró; si no, se lee el archivo completo.
+func (s *Server) fileChecksum(filePath, key string) (checksumRecord, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return checksumRecord{}, err
+	}
+	if record, recorded := s.checksums.get(key); recorded && record.ModTime == info.ModTime().UnixNano() {
+		return record, nil
+	}
+	content, err := s.openStoredFile(filePath)
+	if err != nil {
+		return checksumRecord{}, err
+	}
+	defer content.Close()
+	return s.contentChecksum(key, content)
+}
+
+// Como fileChecksum, para un archivo ya abierto
+func (s *Server) contentChecksum(key string, content *storedContent) (checksumRecord, error) {
+	record, recorded := s.checksums.get(key)
+	if recorded && record.ModTime == content.modTime {
+		return record, nil
+	}
+	sum, err := content.hash()
+	if err != nil {
+		return checksumRecord{}, err
+	}
+	current := checksumRecord{Checksum: sum, Size: content.size, ModTime: content.modTime}
+	// Un archivo modificado por fuera del servidor no se vuelve a registrar: lo decide la verificación de integridad
+	if !recorded {
+		s.checksums.record(key, current)
+	}
+	return current, nil
+}
+
+// Digest Merkle de un directorio a partir de sus hijos, ordenados por nombre
+func merkleDigest(children []*pb.InventoryEntry) string {
+	h := sha256.New()
+	for _, child := range children {
+		kind := "f"
+		if child.IsDir {
+			kind = "d"
+		}
+		h.Write([]byte(kind + "\x00" + path.Base(child.Path) + "\x00" + child.ChecksumSha256 + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Calcula las entradas de los hijos de un directorio. Los subdirectorios se recorren
+// completos y emit recibe cada archivo y, si includeDirs, cada directorio después de su contenido.
+func (s *Server) inventoryChildren(ctx context.Context, dirPath, key string, emit func(*pb.InventoryEntry) error, includeDirs bool) ([]*pb.InventoryEntry, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var children []*pb.InventoryEntry
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		childPath := filepath.Join(dirPath, e.Name())
+		childKey := path.Join(key, e.Name())
+
+		if e.IsDir() {
+			entry, err := s.inventoryDirectory(ctx, childPath, childKey, emit, includeDirs)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, entry)
+			continue
+		}
+		// Los temporales de escrituras en curso no son de nadie y cambiarían el digest
+		if !e.Type().IsRegular() || isStagingName(e.Name()) {
+			continue
+		}
+
+		entry, err := s.inventoryFile(childPath, childKey)
+		if os.IsNotExist(err) {
+			// Se borró mientras se recorría el directorio
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if emit != nil {
+			if err := emit(entry); err != nil {
+				return nil, err
+			}
+		}
+		children = append(children, entry)
+	}
+	return children, nil
+}
+
+func (s *Server) inventoryDirectory(ctx context.Context, dirPath, key string, emit func(*pb.InventoryEntry) error, includeDirs bool) (*pb.InventoryEntry, error) {
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	children, err := s.inventoryChildren(ctx, dirPath, key, emit, includeDirs)
+	if err != nil {
+		return nil, err
+	}
+	entry := &pb.InventoryEntry{
+		Path:           key,
+		IsDir:          true,
+		ModTime:        info.ModTime().UnixNano(),
+		ChecksumSha256: merkleDigest(children),
+	}
+	for _, child := range children {
+		entry.Size += child.Size
+	}
+	if includeDirs && emit != nil {
+		if err := emit(entry); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+func (s *Server) inventoryFile(filePath, key string) (*pb.InventoryEntry, error) {
+	record, err := s.fileChecksum(filePath, key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "Error leyendo %s: %v", key, err)
+	}
+	return &pb.InventoryEntry{
+		Path:           key,
+		Size:           record.Size,
+		ModTime:        record.ModTime,
+		ChecksumSha256: record.Checksum,
+	}, nil
+}
+
+// Emite todos los archivos guardados con su tamaño, fecha de modificación y checksum
+func (s *Server) Inventory(req *pb.InventoryRequest, stream pb.FileSystemService_InventoryServer) error {
+	fullPath, err := resolveStoragePath(req.Path)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return status.Errorf(codes.NotFound, "El archivo/directorio no existe")
+		}
+		return status.Errorf(codes.Internal, "Error al obtener información de la ruta: %v", err)
+	}
+
+	key := indexKey(req.Path)
+	if !info.IsDir() {
+		if isStagingName(info.Name()) {
+			return status.Errorf(codes.NotFound, "El archivo/directorio no existe")
+		}
+		entry, err := s.inventoryFile(fullPath, key)
+		if err != nil {
+			return err
+		}
+		return stream.Send(entry)
+	}
+	_, err = s.inventoryDirectory(stream.Context(), fullPath, key, stream.Send, req.IncludeDirectories)
+	return inventoryError(stream.Context(), err)
+}
+
+// Digest Merkle de un directorio junto con el de cada hijo, para que el servidor
+// central baje solo por los subárboles que no coinciden con su catálogo
+func (s *Server) DirectoryDigest(ctx context.Context, req *pb.DirectoryDigestRequest) (*pb.DirectoryDigestResponse, error) {
+	fullPath, err := resolveStoragePath(req.Path)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "El directorio no existe")
+		}
+		return nil, status.Errorf(codes.Internal, "Error al obtener información del directorio: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, status.Errorf(codes.InvalidArgument, "La ruta proporcionada no es un directorio")
+	}
+
+	key := indexKey(req.Path)
+	children, err := s.inventoryChildren(ctx, fullPath, key, nil, false)
+	if err != nil {
+		return nil, inventoryError(ctx, err)
+	}
+	return &pb.DirectoryDigestResponse{
+		Path:     key,
+		Digest:   merkleDigest(children),
+		Children: children,
+	}, nil
+}
+
+func inventoryError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.Internal, "Error recorriendo el almacenamiento: %v", err)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+)
+
+// Digest de cada directorio del árbol de prueba
+func directoryDigests(t *testing.T, s *Server) map[string]string {
+	t.Helper()
+	digests := make(map[string]string)
+	for _, dir := range []string{"", "a", "a/b", "x"} {
+		resp, err := s.DirectoryDigest(context.Background(), &pb.DirectoryDigestRequest{Path: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Digest != merkleDigest(resp.Children) {
+			t.Fatalf("el digest de %q no es el de sus hijos", dir)
+		}
+		digests[dir] = resp.Digest
+	}
+	return digests
+}
+
+// Compara dos estados del árbol: los directorios de changed tienen otro digest y el resto, el mismo
+func assertDigestChanges(t *testing.T, before, after map[string]string, changed ...string) {
+	t.Helper()
+	want := make(map[string]bool)
+	for _, dir := range changed {
+		want[dir] = true
+	}
+	for dir, digest := range before {
+		if (after[dir] != digest) != want[dir] {
+			t.Fatalf("digest de %q: %s antes, %s después; se esperaba cambio: %v", dir, digest, after[dir], want[dir])
+		}
+	}
+}
+
+func TestDirectoryDigest(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, dir := range []string{"a/b", "x"} {
+		os.MkdirAll(filepath.Join(rootDirectory, filepath.FromSlash(dir)), 0755)
+	}
+	uploadBase64(t, s, "a/b/c.txt", []byte("contenido 1"))
+	uploadBase64(t, s, "a/d.txt", []byte("otro archivo"))
+	uploadBase64(t, s, "x/e.txt", []byte("otra rama"))
+	initial := directoryDigests(t, s)
+
+	// Cambiar un archivo cambia el digest de sus directorios hasta la raíz, y solo esos
+	uploadBase64(t, s, "a/b/c.txt", []byte("contenido 2"))
+	changed := directoryDigests(t, s)
+	assertDigestChanges(t, initial, changed, "", "a", "a/b")
+
+	// El digest depende solo del contenido: volver al original lo restituye
+	uploadBase64(t, s, "a/b/c.txt", []byte("contenido 1"))
+	assertDigestChanges(t, initial, directoryDigests(t, s))
+
+	// Los temporales de escrituras en curso no cuentan
+	if err := os.WriteFile(filepath.Join(rootDirectory, "x", ".e.txt-123456"), []byte("a medias"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertDigestChanges(t, initial, directoryDigests(t, s))
+
+	// Un archivo modificado por fuera del servidor también cambia el digest
+	filePath := filepath.Join(rootDirectory, "x", "e.txt")
+	if err := os.WriteFile(filePath, []byte("otra rama!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filePath, later, later)
+	assertDigestChanges(t, initial, directoryDigests(t, s), "", "x")
+
+	// Un directorio vacío nuevo también
+	current := directoryDigests(t, s)
+	os.MkdirAll(filepath.Join(rootDirectory, "a", "vacío"), 0755)
+	assertDigestChanges(t, current, directoryDigests(t, s), "", "a")
+}
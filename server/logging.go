@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadato con el identificador de la petición, se recibe del cliente o se genera
+const requestIDKey = "x-request-id"
+
+type requestIDContextKey struct{}
+
+// Configura el logger global con el nivel (debug, info, warn, error) y el formato (text, json) indicados
+func SetupLogging(cfg LoggingConfig) error {
+	logger, err := newLogger(os.Stderr, cfg.Level, cfg.Format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("LOG_LEVEL inválido: %s (valores posibles: debug, info, warn, error)", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("LOG_FORMAT inválido: %s (valores posibles: text, json)", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// Agrega a cada línea el identificador de la petición y la traza que vienen en el contexto
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Identificador de la petición en curso, vacío fuera de una RPC
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Toma el identificador de los metadatos entrantes o genera uno nuevo
+func withRequestID(ctx context.Context) (context.Context, string) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 && len(values[0]) <= 128 {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, id), id
+}
+
+func logRPC(ctx context.Context, method string, start time.Time, err error) {
+	slog.DebugContext(ctx, "RPC terminada",
+		"rpc", method,
+		"code", status.Code(err).String(),
+		"duration", time.Since(start))
+}
+
+// Interceptor que asigna un identificador a cada llamada unaria. Debe ir antes que los demás.
+func RequestIDUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx, id := withRequestID(ctx)
+		// El cliente recibe el identificador para poder reportarlo
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+		resp, err := handler(ctx, req)
+		logRPC(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIDStream) Context() context.Context {
+	return s.ctx
+}
+
+// Interceptor que asigna un identificador a cada llamada con streaming
+func RequestIDStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, id := withRequestID(ss.Context())
+		ss.SetHeader(metadata.Pairs(requestIDKey, id))
+		err := handler(srv, &requestIDStream{ServerStream: ss, ctx: ctx})
+		logRPC(ctx, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// Interceptor que convierte el pánico de un handler en un error Internal en lugar de tumbar el
+// nodo. Debe ir el último de la cadena: las llamadas unarias se ejecutan en el pool de workers
+// y el pánico solo se puede recuperar en la goroutine del handler.
+func RecoveryUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer recoverRPC(ctx, info.FullMethod, &err)
+		return handler(ctx, req)
+	}
+}
+
+// Como RecoveryUnaryInterceptor, para las llamadas con streaming
+func RecoveryStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverRPC(ss.Context(), info.FullMethod, &err)
+		return handler(srv, ss)
+	}
+}
+
+func recoverRPC(ctx context.Context, method string, err *error) {
+	if r := recover(); r != nil {
+		slog.ErrorContext(ctx, "Pánico en una llamada", "rpc", method, "panic", r, "stack", string(debug.Stack()))
+		*err = status.Errorf(codes.Internal, "Error interno del servidor")
+	}
+}
+
+// Registra un error de configuración o de arranque y termina el proceso
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
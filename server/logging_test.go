@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type contextStream struct {
+	grpc.ServerStream
+}
+
+func (contextStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestRecoveryInterceptors(t *testing.T) {
+	unary := RecoveryUnaryInterceptor()
+	resp, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"},
+		func(ctx context.Context, req any) (any, error) {
+			var m map[string]int
+			m["x"] = 1
+			return "ok", nil
+		})
+	if resp != nil || status.Code(err) != codes.Internal {
+		t.Fatalf("unaria: se obtuvo %v, %v; se esperaba Internal", resp, err)
+	}
+
+	stream := RecoveryStreamInterceptor()
+	err = stream(nil, contextStream{}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"},
+		func(srv any, ss grpc.ServerStream) error {
+			panic("fallo")
+		})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("streaming: se obtuvo %v; se esperaba Internal", err)
+	}
+
+	// Sin pánico el resultado pasa sin cambios
+	resp, err = unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"},
+		func(ctx context.Context, req any) (any, error) {
+			return "ok", status.Error(codes.NotFound, "no")
+		})
+	if resp != "ok" || status.Code(err) != codes.NotFound {
+		t.Fatalf("sin pánico: se obtuvo %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultReplicationTimeout = 30 * time.Second
+	// Reintentos asíncronos de las réplicas que fallaron
+	maxReplicaRetries       = 10
+	initialReplicaRetryWait = 2 * time.Second
+	maxReplicaRetryWait     = 5 * time.Minute
+)
+
+// Replicación síncrona de las subidas: el nodo reenvía el archivo a sus pares y
+// no responde hasta que writeQuorum de ellos lo confirman.
+type replicationConfig struct {
+	peers       []string
+	writeQuorum int
+	// Directorios críticos; si está vacío se replica todo
+	directories []string
+	timeout     time.Duration
+}
+
+func newReplicationConfig(cfg ReplicationConfig) replicationConfig {
+	config := replicationConfig{
+		peers:       cfg.Peers,
+		writeQuorum: len(cfg.Peers),
+		timeout:     cfg.Timeout,
+	}
+	for _, dir := range cfg.Directories {
+		config.directories = append(config.directories, indexKey(dir))
+	}
+	if cfg.WriteQuorum != nil {
+		config.writeQuorum = *cfg.WriteQuorum
+	}
+	return config
+}
+
+// Separa una lista de valores por comas, ignorando los vacíos
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Nodos a los que se replica una subida y quórum necesario. Los pares indicados en la
+// petición (por ejemplo, por el servidor central) tienen prioridad sobre la configuración,
+// pero solo pueden elegir entre los de replication.peers: el nodo no abre conexiones a
+// direcciones arbitrarias que le indique un cliente.
+func (s *Server) replicationTargets(relPath string, requestPeers []string, requestQuorum int32) ([]string, int, error) {
+	config := s.replication
+	if len(requestPeers) > 0 {
+		var peers []string
+		for _, peer := range requestPeers {
+			if err := s.checkPeer(peer); err != nil {
+				return nil, 0, err
+			}
+			if !slices.Contains(peers, peer) {
+				peers = append(peers, peer)
+			}
+		}
+		quorum := int(requestQuorum)
+		if quorum <= 0 || quorum > len(peers) {
+			quorum = len(peers)
+		}
+		return peers, quorum, nil
+	}
+
+	if len(config.peers) == 0 {
+		return nil, 0, nil
+	}
+	if len(config.directories) > 0 {
+		key := indexKey(relPath)
+		critical := false
+		for _, dir := range config.directories {
+			if isUnderPath(key, dir) {
+				critical = true
+				break
+			}
+		}
+		if !critical {
+			return nil, 0, nil
+		}
+	}
+	return config.peers, config.writeQuorum, nil
+}
+
+// Error de una escritura que quedó guardada en el nodo pero sin el quórum de réplicas. Es
+// FailedPrecondition y no Unavailable porque repetirla no sirve hasta que se recuperen los
+// pares, y los clientes reintentan Unavailable. resp va en los detalles del estado para que el
+// cliente sepa qué réplicas sí confirmaron.
+func quorumError(resp *pb.Response, quorum int) error {
+	st := status.Newf(codes.FailedPrecondition, "Archivo guardado localmente, pero solo %d de %d réplicas confirmaron la escritura", len(resp.ReplicaNodeIds), quorum)
+	if detailed, err := st.WithDetails(resp); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+type replicaResult struct {
+	peer   string
+	nodeID string
+	err    error
+}
+
+// Envía la escritura a los pares y espera hasta tener el quórum o hasta que todos respondan.
+// content es el contenido escrito y checksum su SHA-256; cada réplica lo retiene hasta terminar,
+// así que quien lo abrió puede cerrarlo al volver. Las réplicas que fallan se reintentan en
+// segundo plano. Devuelve los IDs de los nodos que confirmaron.
+func (s *Server) replicateWrite(ctx context.Context, filePath string, content *storedContent, checksum, mimeType string, peers []string, quorum int) ([]string, bool) {
+	if len(peers) == 0 {
+		return nil, true
+	}
+	ctx, span := startSpan(ctx, "replication.write",
+		attribute.String("path", filePath), attribute.Int("peers", len(peers)), attribute.Int("quorum", quorum))
+	defer span.End()
+	relPath, err := filepath.Rel(rootDirectory, filePath)
+	if err != nil {
+		slog.Error("No se pudo replicar", "path", filePath, "error", err)
+		return nil, quorum == 0
+	}
+	relPath = indexKey(relPath)
+	meta := &pb.ReplicaMetadata{
+		Path:           relPath,
+		Size:           content.size,
+		ChecksumSha256: checksum,
+		FileType:       mimeType,
+	}
+	if info, err := os.Stat(filePath); err == nil {
+		meta.ModTime = info.ModTime().UnixNano()
+	}
+
+	results := make(chan replicaResult, len(peers))
+	for _, peer := range peers {
+		// Las réplicas que terminan después de responder siguen leyendo el contenido
+		content.retain()
+		go func(peer string) {
+			defer content.Close()
+			// No se hereda la cancelación de la petición: las réplicas que sigan en curso
+			// al alcanzar el quórum deben terminar aunque ya se haya respondido
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.replication.timeout)
+			defer cancel()
+			ctx, span := startSpan(ctx, "replication.push", attribute.String("peer", peer))
+			resp, err := s.pushReplica(ctx, peer, meta, content)
+			endSpan(span, err)
+			if err != nil {
+				slog.Warn("Réplica fallida, se reintentará", "path", relPath, "peer", peer, "error", err)
+				s.scheduleReplicaRetry(relPath, peer, 1)
+				results <- replicaResult{peer: peer, err: err}
+				return
+			}
+			results <- replicaResult{peer: peer, nodeID: resp.NodeId}
+		}(peer)
+	}
+
+	var nodeIDs []string
+	for range peers {
+		if len(nodeIDs) >= quorum {
+			break
+		}
+		result := <-results
+		if result.err == nil {
+			nodeIDs = append(nodeIDs, result.nodeID)
+		}
+	}
+	span.SetAttributes(attribute.Int("confirmed", len(nodeIDs)))
+	if len(nodeIDs) < quorum {
+		span.SetStatus(otelcodes.Error, "quórum de escritura no alcanzado")
+	}
+	return nodeIDs, len(nodeIDs) >= quorum
+}
+
+// Reintenta una réplica con espera exponencial usando el contenido actual del archivo
+func (s *Server) scheduleReplicaRetry(relPath, peer string, attempt int) {
+	if attempt > maxReplicaRetries {
+		slog.Error("Réplica abandonada", "path", relPath, "peer", peer, "attempts", maxReplicaRetries)
+		return
+	}
+	wait := initialReplicaRetryWait << (attempt - 1)
+	if wait > maxReplicaRetryWait || wait <= 0 {
+		wait = maxReplicaRetryWait
+	}
+	time.AfterFunc(wait, func() {
+		meta, content, err := s.replicaSource(relPath)
+		if err != nil {
+			// El archivo se borró o movió después de subirlo: ya no hay nada que replicar
+			slog.Info("Réplica cancelada", "path", relPath, "peer", peer, "reason", err)
+			return
+		}
+		defer content.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), s.replication.timeout)
+		defer cancel()
+		if _, err := s.pushReplica(ctx, peer, meta, content); err != nil {
+			slog.Warn("Reintento de réplica fallido", "path", relPath, "peer", peer, "attempt", attempt, "error", err)
+			s.scheduleReplicaRetry(relPath, peer, attempt+1)
+			return
+		}
+		slog.Info("Réplica completada", "path", relPath, "peer", peer, "attempt", attempt)
+	})
+}
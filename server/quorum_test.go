@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Sirve s por gRPC en un puerto libre de 127.0.0.1 y devuelve su dirección
+func serveTestNode(t *testing.T, s pb.FileSystemServiceServer, opts ...grpc.ServerOption) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer(opts...)
+	pb.RegisterFileSystemServiceServer(gs, s)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	return lis.Addr().String()
+}
+
+// Dirección de 127.0.0.1 en la que no escucha nadie
+func deadAddress(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := lis.Addr().String()
+	lis.Close()
+	return address
+}
+
+func TestUploadFileQuorum(t *testing.T) {
+	// Los pares se crean antes que el nodo principal: rootDirectory es global y el último
+	// NewServer lo fija, así que las réplicas comparten el árbol del principal y confirman
+	// sin reescribir el archivo. Lo que se prueba es el protocolo entre nodos.
+	peerA := serveTestNode(t, newTestServer(t, func(c *Config) { c.Node.ID = "peer-a" }))
+	peerB := serveTestNode(t, newTestServer(t, func(c *Config) { c.Node.ID = "peer-b" }))
+	dead := deadAddress(t)
+	primary := newTestServer(t, func(c *Config) {
+		c.Node.ID = "primary"
+		c.Replication.Peers = []string{peerA, peerB, dead}
+		c.Replication.Timeout = 5 * time.Second
+	})
+	conn, err := grpc.NewClient(serveTestNode(t, primary), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	svc := pb.NewFileSystemServiceClient(conn)
+	ctx := context.Background()
+	upload := func(name string, peers []string, quorum int32) (*pb.Response, error) {
+		return svc.UploadFile(ctx, &pb.UploadRequest{
+			Filename:      name,
+			ContentBase64: base64.StdEncoding.EncodeToString(textBytes(10_000)),
+			ReplicaPeers:  peers,
+			WriteQuorum:   quorum,
+		})
+	}
+
+	t.Run("quorum", func(t *testing.T) {
+		resp, err := upload("ok.txt", []string{peerA, peerB, peerA}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := slices.Sorted(slices.Values(resp.ReplicaNodeIds))
+		if !slices.Equal(ids, []string{"peer-a", "peer-b"}) {
+			t.Errorf("réplicas = %v, se esperaban peer-a y peer-b", resp.ReplicaNodeIds)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		resp, err := upload("partial.txt", []string{peerA, dead}, 2)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("error = %v, se esperaba FailedPrecondition", err)
+		}
+		if resp != nil {
+			t.Errorf("respuesta junto con el error: %v", resp)
+		}
+		var detail *pb.Response
+		for _, d := range status.Convert(err).Details() {
+			if r, ok := d.(*pb.Response); ok {
+				detail = r
+			}
+		}
+		if detail == nil {
+			t.Fatal("el error no lleva la respuesta en los detalles")
+		}
+		if !slices.Equal(detail.ReplicaNodeIds, []string{"peer-a"}) || detail.NodeId != "primary" {
+			t.Errorf("detalles = %v, se esperaba la réplica de peer-a", detail)
+		}
+		if _, err := os.Stat(filepath.Join(rootDirectory, "partial.txt")); err != nil {
+			t.Errorf("el archivo no quedó guardado localmente: %v", err)
+		}
+	})
+
+	t.Run("unknown peer", func(t *testing.T) {
+		other := deadAddress(t)
+		_, err := upload("ssrf.txt", []string{peerA, other}, 1)
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("error = %v, se esperaba PermissionDenied", err)
+		}
+		if _, err := os.Stat(filepath.Join(rootDirectory, "ssrf.txt")); !os.IsNotExist(err) {
+			t.Errorf("se escribió el archivo pese a rechazar la petición: %v", err)
+		}
+	})
+}
+
+// Par que recibe réplicas después de una espera y avisa el checksum de lo que recibió completo
+type slowPeer struct {
+	pb.UnimplementedFileSystemServiceServer
+	delay    time.Duration
+	received chan string
+}
+
+func (p *slowPeer) ReplicateFile(stream pb.FileSystemService_ReplicateFileServer) error {
+	time.Sleep(p.delay)
+	h := sha256.New()
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		h.Write(chunk.Data)
+	}
+	p.received <- hex.EncodeToString(h.Sum(nil))
+	return stream.SendAndClose(&pb.ReplicateResponse{NodeId: "slow"})
+}
+
+// Configura un par rápido y otro lento con quórum 1: la respuesta llega antes de que el lento
+// termine, que debe seguir leyendo el contenido aunque el handler ya haya vuelto.
+func newLateReplicaServer(t *testing.T, configure func(*Config)) (*Server, *slowPeer) {
+	t.Helper()
+	fast := serveTestNode(t, newTestServer(t, nil))
+	slow := &slowPeer{delay: 300 * time.Millisecond, received: make(chan string, 2)}
+	slowAddress := serveTestNode(t, slow)
+	quorum := 1
+	s := newTestServer(t, func(c *Config) {
+		c.Replication.Peers = []string{fast, slowAddress}
+		c.Replication.WriteQuorum = &quorum
+		if configure != nil {
+			configure(c)
+		}
+	})
+	return s, slow
+}
+
+// Espera la réplica del par lento. El primer reintento llega a los 2 s, así que el plazo
+// menor comprueba que bastó el primer intento.
+func waitLateReplica(t *testing.T, slow *slowPeer, want string) {
+	t.Helper()
+	select {
+	case got := <-slow.received:
+		if got != want {
+			t.Fatalf("la réplica tardía recibió otro contenido: %s", got)
+		}
+	case <-time.After(1500 * time.Millisecond):
+		t.Fatal("la réplica que terminó después de responder no recibió el archivo")
+	}
+}
+
+func TestCompleteUploadLateReplica(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s, slow := newLateReplicaServer(t, configure)
+			ctx := context.Background()
+			// Varios mensajes de réplica, más de lo que cabe en la ventana de gRPC
+			data := textBytes(3*replicaChunkSize + 10)
+			session, err := s.InitiateUpload(ctx, &pb.InitiateUploadRequest{Filename: "tarde.txt", TotalSize: int64(len(data)), ChecksumSha256: contentHash(data)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.UploadPart(ctx, &pb.UploadPartRequest{SessionId: session.SessionId, Content: data}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CompleteUpload(ctx, &pb.CompleteUploadRequest{SessionId: session.SessionId}); err != nil {
+				t.Fatal(err)
+			}
+			waitLateReplica(t, slow, contentHash(data))
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Los clientes sin actividad durante este tiempo se olvidan
+const rateLimitIdleTimeout = 10 * time.Minute
+
+// Balde de tokens que se llena a rate por segundo hasta un segundo de capacidad.
+// Un consumo mayor que la capacidad se permite con el balde lleno y lo deja en negativo,
+// así un archivo grande pasa pero el cliente espera lo que corresponde antes del siguiente.
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	updated  time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	capacity := math.Max(rate, 1)
+	return &tokenBucket{rate: rate, capacity: capacity, tokens: capacity, updated: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+}
+
+// Consume n tokens, o devuelve cuánto hay que esperar para poder hacerlo
+func (b *tokenBucket) take(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	need := math.Min(n, b.capacity)
+	if b.tokens < need {
+		return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens -= n
+	return 0
+}
+
+// Descuenta n tokens sin verificar, para consumos que se conocen después de atender la llamada
+func (b *tokenBucket) charge(n float64, now time.Time) {
+	if b == nil {
+		return
+	}
+	b.refill(now)
+	b.tokens -= n
+}
+
+type callerLimiter struct {
+	requests *tokenBucket
+	upload   *tokenBucket
+	download *tokenBucket
+	lastUsed time.Time
+}
+
+// Limitadores de cada cliente, por identidad o por dirección IP
+type rateLimiter struct {
+	mu      sync.Mutex
+	config  RateLimitConfig
+	callers map[string]*callerLimiter
+	swept   time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	return &rateLimiter{config: cfg, callers: make(map[string]*callerLimiter), swept: time.Now()}
+}
+
+// Cambia los límites; los clientes empiezan de nuevo con los baldes llenos
+func (l *rateLimiter) setConfig(cfg RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = cfg
+	l.callers = make(map[string]*callerLimiter)
+}
+
+// Ejecuta fn con el limitador del cliente tomado
+func (l *rateLimiter) with(key string, fn func(*callerLimiter, time.Time) time.Duration) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) > time.Minute {
+		for k, c := range l.callers {
+			if now.Sub(c.lastUsed) > rateLimitIdleTimeout {
+				delete(l.callers, k)
+			}
+		}
+		l.swept = now
+	}
+	c, ok := l.callers[key]
+	if !ok {
+		limits := l.config.forCaller(key)
+		c = &callerLimiter{
+			requests: newTokenBucket(limits.RequestsPerSecond, now),
+			upload:   newTokenBucket(float64(limits.UploadBytesPerSecond), now),
+			download: newTokenBucket(float64(limits.DownloadBytesPerSecond), now),
+		}
+		l.callers[key] = c
+	}
+	c.lastUsed = now
+	return fn(c, now)
+}
+
+// Clave del cliente: el principal con que se autenticó o, si no hay, su dirección IP.
+// Las identidades que el cliente declara en los metadatos no cuentan: cualquiera podría
+// cambiarlas en cada llamada para no agotar nunca su límite.
+func (s *Server) rateLimitKey(ctx context.Context) string {
+	if principal := s.callerPrincipal(ctx); principal != "" {
+		return principal
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// Bytes que sube una petición
+func uploadBytes(req any) int64 {
+	switch r := req.(type) {
+	case *pb.UploadRequest:
+		return int64(len(r.Content)) + int64(len(r.ContentBase64))*3/4
+	case *pb.UploadPartRequest:
+		return int64(len(r.Content))
+	case *pb.DeltaChunk:
+		// Solo cuentan los datos literales; las copias no se transfieren
+		var n int64
+		for _, op := range r.Ops {
+			n += int64(len(op.GetData()))
+		}
+		return n
+	}
+	return 0
+}
+
+// Bytes que descarga una respuesta o un mensaje de un stream
+func downloadBytes(resp any) int64 {
+	switch r := resp.(type) {
+	case *pb.DownloadResponse:
+		return r.GetFilesize()
+	case *pb.ReplicaChunk:
+		return int64(len(r.Data))
+	case *pb.ArchiveChunk:
+		return int64(len(r.Data))
+	}
+	return 0
+}
+
+func isDownload(fullMethod string) bool {
+	switch fullMethod {
+	case pb.FileSystemService_DownloadFile_FullMethodName,
+		pb.FileSystemService_PullFile_FullMethodName,
+		pb.FileSystemService_DownloadArchive_FullMethodName:
+		return true
+	}
+	return false
+}
+
+// Error con el tiempo a esperar, en los trailers (retry-after en segundos, como en HTTP,
+// y retry-after-ms) y como RetryInfo en los detalles del estado
+func rateLimitError(ctx context.Context, what string, wait time.Duration) error {
+	grpc.SetTrailer(ctx, metadata.Pairs(
+		"retry-after", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10),
+		"retry-after-ms", strconv.FormatInt(int64(math.Ceil(float64(wait)/float64(time.Millisecond))), 10),
+	))
+	st := status.Newf(codes.ResourceExhausted, "Límite de %s excedido, reintentar en %s", what, wait.Round(time.Millisecond))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+type throttleKey struct{}
+
+// Marca las llamadas internas que esperan al limitador en lugar de fallar. Las usan las subidas
+// del gateway, WebDAV y S3 una vez abierta la sesión: rechazar una parte abortaría el archivo
+// entero, que el cliente HTTP envió en una sola petición.
+func withThrottle(ctx context.Context) context.Context {
+	return context.WithValue(ctx, throttleKey{}, true)
+}
+
+func isThrottled(ctx context.Context) bool {
+	throttled, _ := ctx.Value(throttleKey{}).(bool)
+	return throttled
+}
+
+// Espera el tiempo indicado, o hasta que termine la llamada
+func waitContext(ctx context.Context, wait time.Duration) error {
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Interceptor que limita las llamadas y los bytes subidos y descargados de cada cliente
+func (s *Server) RateLimitUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		key := s.rateLimitKey(ctx)
+		for {
+			var what string
+			wait := s.limiter.with(key, func(c *callerLimiter, now time.Time) time.Duration {
+				what = "llamadas"
+				if wait := c.requests.take(1, now); wait > 0 {
+					return wait
+				}
+				if n := uploadBytes(req); n > 0 {
+					what = "subida"
+					if wait := c.upload.take(float64(n), now); wait > 0 {
+						// La llamada se reintenta entera, así que se devuelve su token
+						c.requests.charge(-1, now)
+						return wait
+					}
+					return 0
+				}
+				if isDownload(info.FullMethod) {
+					// El tamaño se conoce al leer el archivo: solo se exige no estar en deuda
+					what = "descarga"
+					return c.download.take(0, now)
+				}
+				return 0
+			})
+			if wait <= 0 {
+				break
+			}
+			if !isThrottled(ctx) {
+				return nil, rateLimitError(ctx, what, wait)
+			}
+			if err := waitContext(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := handler(ctx, req)
+		if n := downloadBytes(resp); n > 0 {
+			s.limiter.with(key, func(c *callerLimiter, now time.Time) time.Duration {
+				c.download.charge(float64(n), now)
+				return 0
+			})
+		}
+		return resp, err
+	}
+}
+
+// Interceptor que limita las llamadas con streaming de cada cliente. Los bytes de un stream no
+// se rechazan a mitad de camino: se descuentan al recibirlos o enviarlos y, si el cliente queda
+// en deuda, se espera antes del siguiente mensaje.
+func (s *Server) RateLimitStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		key := s.rateLimitKey(ss.Context())
+		what := "llamadas"
+		wait := s.limiter.with(key, func(c *callerLimiter, now time.Time) time.Duration {
+			if wait := c.requests.take(1, now); wait > 0 {
+				return wait
+			}
+			if isDownload(info.FullMethod) {
+				what = "descarga"
+				return c.download.take(0, now)
+			}
+			return 0
+		})
+		if wait > 0 {
+			return rateLimitError(ss.Context(), what, wait)
+		}
+		return handler(srv, &rateLimitedStream{ServerStream: ss, limiter: s.limiter, key: key})
+	}
+}
+
+type rateLimitedStream struct {
+	grpc.ServerStream
+	limiter *rateLimiter
+	key     string
+}
+
+func (rs *rateLimitedStream) RecvMsg(m any) error {
+	if err := rs.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	n := uploadBytes(m)
+	if n == 0 {
+		return nil
+	}
+	return rs.pause(rs.limiter.with(rs.key, func(c *callerLimiter, now time.Time) time.Duration {
+		c.upload.charge(float64(n), now)
+		return c.upload.take(0, now)
+	}))
+}
+
+func (rs *rateLimitedStream) SendMsg(m any) error {
+	if err := rs.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	n := downloadBytes(m)
+	if n == 0 {
+		return nil
+	}
+	return rs.pause(rs.limiter.with(rs.key, func(c *callerLimiter, now time.Time) time.Duration {
+		c.download.charge(float64(n), now)
+		return c.download.take(0, now)
+	}))
+}
+
+// Espera lo que el cliente quedó en deuda, o hasta que termine la llamada
+func (rs *rateLimitedStream) pause(wait time.Duration) error {
+	return waitContext(rs.Context(), wait)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const testToken = "tok0123456789abcdef"
+
+// Contexto de una llamada desde 192.0.2.1 con los metadatos indicados
+func callContext(pairs ...string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5000}})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(pairs...))
+}
+
+func TestRateLimitKey(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.Security.AuthTokens = []string{testToken} })
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"token", callContext(authorizationKey, bearerPrefix+testToken), tokenPrincipal(testToken)},
+		{"identidad declarada", callContext(authorizationKey, bearerPrefix+testToken, "x-caller-id", "otro"), tokenPrincipal(testToken)},
+		{"solo identidad declarada", callContext("x-caller-id", "otro", "x-user-id", "otro"), "192.0.2.1"},
+		{"token inválido", callContext(authorizationKey, bearerPrefix+"tok-inválido-0123456"), "192.0.2.1"},
+		{"preautorizada", withPreauthorized(callContext(authorizationKey, bearerPrefix+"cualquiera-0123456")), "192.0.2.1"},
+		{"s3", withPrincipal(withPreauthorized(callContext("x-caller-id", "otro")), "s3:AKID"), "s3:AKID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.rateLimitKey(tt.ctx); got != tt.want {
+				t.Fatalf("clave %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+
+	// Sin tokens configurados cualquier token vale, así que tampoco identifica al cliente
+	open := newTestServer(t, nil)
+	if got := open.rateLimitKey(callContext(authorizationKey, bearerPrefix+testToken)); got != "192.0.2.1" {
+		t.Fatalf("clave %q sin tokens configurados, se esperaba la IP", got)
+	}
+}
+
+// Stream de servidor que descarta lo que se envía
+type discardStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (d *discardStream) Context() context.Context { return d.ctx }
+func (d *discardStream) SendMsg(m any) error      { return nil }
+
+func TestRateLimitStreamDownload(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.RateLimit.DownloadBytesPerSecond = 100_000 })
+	interceptor := s.RateLimitStreamInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: pb.FileSystemService_PullFile_FullMethodName}
+
+	// 300 KB con 100 KB/s de límite: el envío deja al cliente en deuda y espera antes de volver
+	ctx, cancel := context.WithTimeout(callContext(), 50*time.Millisecond)
+	defer cancel()
+	err := interceptor(nil, &discardStream{ctx: ctx}, info, func(srv any, ss grpc.ServerStream) error {
+		return ss.SendMsg(&pb.ReplicaChunk{Data: make([]byte, 300_000)})
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("el envío no esperó lo que correspondía: %v", err)
+	}
+
+	// Mientras siga en deuda no puede empezar otra descarga, aunque declare otra identidad
+	called := false
+	err = interceptor(nil, &discardStream{ctx: callContext("x-caller-id", "otro")}, info, func(srv any, ss grpc.ServerStream) error {
+		called = true
+		return nil
+	})
+	if status.Code(err) != codes.ResourceExhausted || called {
+		t.Fatalf("se esperaba ResourceExhausted sin llamar al handler, se obtuvo %v", err)
+	}
+}
+
+func TestRateLimitGatewayUpload(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.RateLimit.RequestsPerSecond = 5
+		c.RateLimit.UploadBytesPerSecond = 4 << 20
+	})
+	g := s.NewGateway(s.RateLimitUnaryInterceptor())
+
+	// 6 MiB son más partes y más bytes de los que permite el límite de golpe: las partes esperan
+	// su turno en lugar de abortar la subida
+	data := randomBytes(t, 6<<20+17)
+	r := httptest.NewRequest(http.MethodPut, "/v1/files/grande.bin", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT devolvió %d: %s", w.Code, w.Body)
+	}
+	assertStored(t, s, "grande.bin", data)
+
+	// Las llamadas gRPC del mismo cliente se siguen rechazando cuando agotan el límite
+	interceptor := s.RateLimitUnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: pb.FileSystemService_UploadPart_FullMethodName}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: httpAddr(r.RemoteAddr)})
+	req := &pb.UploadPartRequest{Content: make([]byte, 4<<20)}
+	handler := func(ctx context.Context, req any) (any, error) { return &pb.UploadStatus{}, nil }
+	interceptor(ctx, req, info, handler)
+	if _, err := interceptor(ctx, req, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("se esperaba ResourceExhausted, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errInvalidConfig = errors.New("configuración inválida")
+
+// Cambios que no se pueden aplicar sin reiniciar el nodo
+type unsafeChangeError struct {
+	fields []string
+}
+
+func (e *unsafeChangeError) Error() string {
+	return "requieren reiniciar el nodo: " + strings.Join(e.fields, ", ")
+}
+
+// Dos opciones son iguales si tienen el mismo valor; una lista vacía equivale a ninguna
+func sameConfigValue(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// Vuelve a cargar la configuración con las mismas fuentes del arranque y aplica los cambios
+// que se pueden hacer en caliente. Si algo es inválido o requiere reiniciar no se aplica nada.
+// Devuelve las opciones que cambiaron.
+func (s *Server) Reload() (changed []string, err error) {
+	next, _, err := LoadConfig(s.configArgs)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", errInvalidConfig, err)
+	} else {
+		changed, err = s.applyConfig(next)
+	}
+	if err != nil {
+		slog.Error("Recarga de configuración rechazada", "error", err)
+		return nil, err
+	}
+	slog.Info("Configuración recargada", "changed", changed)
+	return changed, nil
+}
+
+func (s *Server) applyConfig(next Config) ([]string, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	prev := s.config
+	var changed, unsafe []string
+	prevFields, nextFields := prev.fields(), next.fields()
+	for i, field := range prevFields {
+		if sameConfigValue(field.value, nextFields[i].value) {
+			continue
+		}
+		if field.reload {
+			changed = append(changed, field.name)
+		} else {
+			unsafe = append(unsafe, field.name)
+		}
+	}
+	// El listener se creó con o sin TLS; solo se puede cambiar el certificado
+	if (prev.Security.TLSCertFile == "") != (next.Security.TLSCertFile == "") {
+		unsafe = append(unsafe, "habilitar o deshabilitar TLS")
+	}
+	if len(unsafe) > 0 {
+		return nil, &unsafeChangeError{unsafe}
+	}
+
+	// Primero se prepara todo lo que puede fallar, para no dejar la recarga a medias
+	logger, err := newLogger(os.Stderr, next.Logging.Level, next.Logging.Format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidConfig, err)
+	}
+	// El certificado se vuelve a leer aunque la ruta no cambie, porque se suele renovar en el mismo archivo
+	var cert *tls.Certificate
+	if next.Security.TLSCertFile != "" {
+		if cert, err = loadCertificate(next.Security); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidConfig, err)
+		}
+	}
+
+	slog.SetDefault(logger)
+	s.workers.resize(next.Node.Workers, next.Node.QueueSize)
+	s.security.setTokens(next.Security.AuthTokens)
+	s.security.setURLSigningKey(next.Security.URLSigningKey)
+	s.security.setS3Keys(next.S3.AccessKeys)
+	if cert != nil {
+		s.security.cert.Store(cert)
+	}
+	if !reflect.DeepEqual(prev.RateLimit, next.RateLimit) {
+		s.limiter.setConfig(next.RateLimit)
+	}
+	if prev.Node.CentralAddress != next.Node.CentralAddress || prev.Node.HeartbeatInterval != next.Node.HeartbeatInterval {
+		s.restartHeartbeat(next.Node)
+	}
+	s.config = next
+	return changed, nil
+}
+
+// Recarga la configuración del nodo, igual que al recibir SIGHUP
+func (s *Server) ReloadConfig(ctx context.Context, req *pb.ReloadConfigRequest) (*pb.ReloadConfigResponse, error) {
+	changed, err := s.Reload()
+	var unsafe *unsafeChangeError
+	switch {
+	case errors.As(err, &unsafe):
+		return nil, status.Errorf(codes.FailedPrecondition, "No se aplicó ningún cambio: hay opciones que %v", err)
+	case err != nil:
+		return nil, status.Errorf(codes.InvalidArgument, "No se aplicó ningún cambio: %v", err)
+	}
+	return &pb.ReloadConfigResponse{Changed: changed}, nil
+}
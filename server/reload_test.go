@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	reloadTokenA = "token-de-recarga-a-0123"
+	reloadTokenB = "token-de-recarga-b-0123"
+)
+
+// Nodo cargado con LoadConfig desde un archivo que el test puede reescribir. Los directorios de
+// testConfig se pasan como opciones, así que el archivo no los puede cambiar.
+func newReloadServer(t *testing.T, text string) (*Server, string) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	file := writeConfigFile(t, text)
+	cfg, defaults := testConfig(t), DefaultConfig()
+	args := []string{"-config", file}
+	defaultFields := defaults.fields()
+	for i, field := range cfg.fields() {
+		if field.env != "" && !sameConfigValue(field.value, defaultFields[i].value) {
+			args = append(args, fmt.Sprintf("-%s=%v", field.name, field.value.Interface()))
+		}
+	}
+	loaded, _, err := LoadConfig(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(loaded.Storage.Root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(loaded), file
+}
+
+func rewriteConfig(t *testing.T, file, text string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const reloadBaseConfig = `
+node:
+  workers: 2
+security:
+  auth_tokens: [` + reloadTokenA + `]
+`
+
+// La configuración sigue siendo la del arranque
+func assertNotReloaded(t *testing.T, s *Server) {
+	t.Helper()
+	if s.config.Node.Workers != 2 || !s.security.authorize(reloadTokenA) || s.security.authorize(reloadTokenB) {
+		t.Fatal("se aplicó parte de una recarga rechazada")
+	}
+}
+
+func TestReloadSafeFields(t *testing.T) {
+	s, file := newReloadServer(t, reloadBaseConfig)
+	rewriteConfig(t, file, `
+node:
+  workers: 6
+security:
+  auth_tokens: [`+reloadTokenB+`]
+rate_limit:
+  requests_per_second: 5
+`)
+	resp, err := s.ReloadConfig(context.Background(), &pb.ReloadConfigRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"node.workers", "security.auth_tokens", "rate_limit.requests_per_second"}
+	if !slices.Equal(resp.Changed, want) {
+		t.Fatalf("cambiaron %q, se esperaba %q", resp.Changed, want)
+	}
+	if s.config.Node.Workers != 6 || s.config.RateLimit.RequestsPerSecond != 5 {
+		t.Fatal("la configuración no se actualizó")
+	}
+	if s.security.authorize(reloadTokenA) || !s.security.authorize(reloadTokenB) {
+		t.Fatal("los tokens no se actualizaron")
+	}
+
+	// Sin cambios no cambia nada
+	if changed, err := s.Reload(); err != nil || len(changed) != 0 {
+		t.Fatalf("recarga sin cambios: %q, %v", changed, err)
+	}
+}
+
+func TestReloadRejectsUnsafeFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		fields []string
+	}{
+		{"puerto", "node:\n  workers: 6\n  port: 6000\nsecurity:\n  auth_tokens: [" + reloadTokenB + "]\n", []string{"node.port"}},
+		{"almacenamiento", "storage:\n  mode: dedup\n  search_index: true\n", []string{"storage.mode", "storage.search_index"}},
+		{"habilitar TLS", "security:\n  tls_cert_file: cert.pem\n  tls_key_file: key.pem\n", []string{"habilitar o deshabilitar TLS"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, file := newReloadServer(t, reloadBaseConfig)
+			rewriteConfig(t, file, tt.config)
+
+			_, err := s.Reload()
+			var unsafe *unsafeChangeError
+			if !errors.As(err, &unsafe) {
+				t.Fatalf("se esperaba un cambio que requiere reiniciar, se obtuvo %v", err)
+			}
+			for _, field := range tt.fields {
+				if !slices.Contains(unsafe.fields, field) {
+					t.Fatalf("no se informó %s: %q", field, unsafe.fields)
+				}
+			}
+			// Tampoco se aplican los cambios que sí se podían hacer en caliente
+			assertNotReloaded(t, s)
+			if _, err := s.ReloadConfig(context.Background(), &pb.ReloadConfigRequest{}); status.Code(err) != codes.FailedPrecondition {
+				t.Fatalf("ReloadConfig devolvió %v, se esperaba FailedPrecondition", err)
+			}
+			assertNotReloaded(t, s)
+		})
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	s, file := newReloadServer(t, reloadBaseConfig)
+	for _, config := range []string{
+		"node:\n  workers: 0\nsecurity:\n  auth_tokens: [" + reloadTokenB + "]\n",
+		"security:\n  auth_tokens: [corto]\n",
+		"node:\n  trabajadores: 6\n",
+	} {
+		rewriteConfig(t, file, config)
+		if _, err := s.ReloadConfig(context.Background(), &pb.ReloadConfigRequest{}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("%q: ReloadConfig devolvió %v, se esperaba InvalidArgument", config, err)
+		}
+		assertNotReloaded(t, s)
+	}
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tamaño de cada mensaje al transferir réplicas entre nodos
+const replicaChunkSize = 1024 * 1024
+
+var errPathOutsideRoot = errors.New("la ruta sale del directorio raíz")
+
+// Convierte una ruta relativa en la ruta en disco, sin permitir salir del directorio raíz
+func resolveStoragePath(relPath string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(relPath))
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", errPathOutsideRoot
+	}
+	return filepath.Join(rootDirectory, cleaned), nil
+}
+
+// Checksum del contenido local de un archivo, o false si no existe
+func (s *Server) localChecksum(filePath string) (string, bool) {
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	relPath, err := filepath.Rel(rootDirectory, filePath)
+	if err != nil {
+		return "", false
+	}
+	record, err := s.fileChecksum(filePath, indexKey(relPath))
+	if err != nil {
+		return "", false
+	}
+	return record.Checksum, true
+}
+
+// Abre un archivo local junto con los metadatos que viajan con la réplica. El contenido se lee
+// por partes y hay que cerrarlo.
+func (s *Server) replicaSource(relPath string) (*pb.ReplicaMetadata, *storedContent, error) {
+	filePath, err := resolveStoragePath(relPath)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, status.Errorf(codes.NotFound, "El archivo no existe")
+		}
+		return nil, nil, status.Errorf(codes.Internal, "Error al obtener información del archivo: %v", err)
+	}
+	if info.IsDir() {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "La ruta proporcionada es un directorio, no un archivo")
+	}
+	content, err := s.openStoredFile(filePath)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+	}
+	key := indexKey(relPath)
+	record, err := s.contentChecksum(key, content)
+	if err != nil {
+		content.Close()
+		return nil, nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+	}
+	head := make([]byte, min(content.size, mimeSniffLength))
+	if err := readFullAt(content, head, 0); err != nil {
+		content.Close()
+		return nil, nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+	}
+	return &pb.ReplicaMetadata{
+		Path:           key,
+		Size:           content.size,
+		ModTime:        content.modTime,
+		ChecksumSha256: record.Checksum,
+		FileType:       detectMimeType(filePath, head),
+	}, content, nil
+}
+
+// Envía los metadatos en el primer mensaje y después el contenido [start, end) por partes
+func sendReplicaChunks(send func(*pb.ReplicaChunk) error, meta *pb.ReplicaMetadata, content io.ReaderAt, start, end int64) error {
+	chunk := &pb.ReplicaChunk{Metadata: meta}
+	if meta.Identical {
+		return send(chunk)
+	}
+	for offset := start; ; {
+		// Cada mensaje lleva su propio buffer: gRPC puede seguir usándolo después de Send
+		data := make([]byte, min(replicaChunkSize, end-offset))
+		if err := readFullAt(content, data, offset); err != nil {
+			return status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+		}
+		chunk.Data = data
+		if err := send(chunk); err != nil {
+			return err
+		}
+		if offset += int64(len(data)); offset >= end {
+			return nil
+		}
+		chunk = &pb.ReplicaChunk{}
+	}
+}
+
+// Recibe el contenido de una réplica en un temporal, sin aceptar más bytes de los anunciados.
+// El tamaño anunciado no se usa para reservar memoria: solo se compara con el límite de subida.
+func (s *Server) receiveReplica(first *pb.ReplicaChunk, recv func() (*pb.ReplicaChunk, error)) (*stagedFile, error) {
+	meta := first.Metadata
+	if meta.Size > s.uploads.maxSize {
+		return nil, status.Errorf(codes.OutOfRange, "La réplica supera el tamaño máximo de subida (%d bytes)", s.uploads.maxSize)
+	}
+	staged, err := s.newStagedFile(".replica-*")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error preparando la réplica: %v", err)
+	}
+	for chunk := first; ; {
+		if staged.written+int64(len(chunk.Data)) > meta.Size {
+			staged.remove()
+			return nil, status.Errorf(codes.InvalidArgument, "La réplica tiene más datos que los %d bytes anunciados", meta.Size)
+		}
+		if _, err := staged.Write(chunk.Data); err != nil {
+			staged.remove()
+			return nil, status.Errorf(codes.Internal, "Error escribiendo la réplica: %v", err)
+		}
+		if chunk, err = recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			staged.remove()
+			return nil, err
+		}
+	}
+	return staged, nil
+}
+
+func validateReplicaMetadata(meta *pb.ReplicaMetadata) (string, error) {
+	if meta == nil {
+		return "", status.Errorf(codes.InvalidArgument, "El primer mensaje de la réplica debe traer los metadatos")
+	}
+	if meta.Path == "" || !isValidBlobHash(meta.ChecksumSha256) || meta.Size < 0 {
+		return "", status.Errorf(codes.InvalidArgument, "Metadatos de réplica inválidos")
+	}
+	filePath, err := resolveStoragePath(meta.Path)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	return filePath, nil
+}
+
+// Verifica y guarda una réplica recibida conservando su fecha de modificación
+func (s *Server) storeReplica(filePath string, meta *pb.ReplicaMetadata, staged *stagedFile) error {
+	sum, err := staged.flush()
+	if err != nil {
+		return status.Errorf(codes.Internal, "Error escribiendo la réplica: %v", err)
+	}
+	if staged.written != meta.Size || sum != meta.ChecksumSha256 {
+		return status.Errorf(codes.DataLoss, "El checksum de la réplica no coincide")
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return status.Errorf(codes.Internal, "Error creando directorio: %v", err)
+	}
+	existed := pathExists(filePath)
+	if err := s.writeStoredContent(filePath, staged.content, meta.Size, sum); err != nil {
+		return status.Errorf(codes.Internal, "Error escribiendo archivo: %v", err)
+	}
+	s.preserveModTime(filePath, meta)
+	s.publishWrite(meta.Path, existed, meta.Size)
+	if s.index != nil {
+		s.index.updateFrom(meta.Path, staged.content, meta.FileType)
+	}
+	return nil
+}
+
+func (s *Server) preserveModTime(filePath string, meta *pb.ReplicaMetadata) {
+	if meta.ModTime == 0 {
+		return
+	}
+	modTime := time.Unix(0, meta.ModTime)
+	if err := os.Chtimes(filePath, time.Now(), modTime); err != nil {
+		slog.Warn("No se pudo conservar la fecha de modificación", "path", filePath, "error", err)
+		return
+	}
+	// El checksum se registra con la nueva fecha
+	s.recordChecksum(filePath, meta.ChecksumSha256, meta.Size)
+}
+
+func (s *Server) replicaResponse(meta *pb.ReplicaMetadata, skipped bool, transferred int64) *pb.ReplicateResponse {
+	message := "Réplica guardada correctamente"
+	if skipped {
+		message = "El destino ya tenía el mismo contenido"
+	}
+	return &pb.ReplicateResponse{
+		Message:          message,
+		Path:             meta.Path,
+		Size:             meta.Size,
+		ChecksumSha256:   meta.ChecksumSha256,
+		Skipped:          skipped,
+		BytesTransferred: transferred,
+		NodeId:           s.nodeID,
+	}
+}
+
+// Recibe un archivo que otro nodo envía. Si ya se tiene el mismo contenido se responde
+// sin esperar los datos, y el nodo que envía deja de transmitir.
+func (s *Server) ReplicateFile(stream pb.FileSystemService_ReplicateFileServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	meta := first.Metadata
+	filePath, err := validateReplicaMetadata(meta)
+	if err != nil {
+		return err
+	}
+
+	if sum, ok := s.localChecksum(filePath); ok && sum == meta.ChecksumSha256 {
+		s.preserveModTime(filePath, meta)
+		return stream.SendAndClose(s.replicaResponse(meta, true, 0))
+	}
+
+	staged, err := s.receiveReplica(first, stream.Recv)
+	if err != nil {
+		return err
+	}
+	defer staged.remove()
+	if err := s.storeReplica(filePath, meta, staged); err != nil {
+		return err
+	}
+	slog.InfoContext(stream.Context(), "Réplica recibida", "path", meta.Path, "size", meta.Size)
+	return stream.SendAndClose(s.replicaResponse(meta, false, meta.Size))
+}
+
+// Envía un archivo local a otro nodo que lo pide. Si el nodo ya tiene el mismo
+// contenido solo se envían los metadatos.
+func (s *Server) PullFile(req *pb.PullFileRequest, stream pb.FileSystemService_PullFileServer) error {
+	meta, content, err := s.replicaSource(req.Path)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	meta.Identical = req.ChecksumSha256 != "" && strings.EqualFold(req.ChecksumSha256, meta.ChecksumSha256)
+	// Los metadatos describen el archivo completo aunque se pida solo un rango
+	if req.Offset < 0 || req.Length < 0 || req.Offset > meta.Size {
+		return status.Errorf(codes.OutOfRange, "El rango [%d, +%d) no está dentro del archivo de %d bytes", req.Offset, req.Length, meta.Size)
+	}
+	// Un rango que pasa del final se recorta. Se compara con lo que queda del archivo en lugar
+	// de sumar offset y longitud, que puede desbordar.
+	end := meta.Size
+	if req.Length > 0 && req.Length < meta.Size-req.Offset {
+		end = req.Offset + req.Length
+	}
+	return sendReplicaChunks(stream.Send, meta, content, req.Offset, end)
+}
+
+// Envía una réplica a otro nodo y devuelve su respuesta
+func (s *Server) pushReplica(ctx context.Context, peerAddress string, meta *pb.ReplicaMetadata, content io.ReaderAt) (*pb.ReplicateResponse, error) {
+	conn, err := s.dialPeer(peerAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewFileSystemServiceClient(conn).ReplicateFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// io.EOF significa que el destino ya respondió (por ejemplo, porque tenía el contenido)
+	if err := sendReplicaChunks(stream.Send, meta, content, 0, meta.Size); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+// Comprueba que address sea uno de los pares de replicación configurados. Las conexiones
+// a otros nodos llevan el token del nodo, así que nunca se abren hacia direcciones arbitrarias
+// que indique un cliente.
+func (s *Server) checkPeer(address string) error {
+	if !slices.Contains(s.replication.peers, address) {
+		return status.Errorf(codes.PermissionDenied, "El nodo %s no está entre los pares de replicación configurados", address)
+	}
+	return nil
+}
+
+// Replica un archivo local en otro nodo
+func (s *Server) ReplicateToPeer(ctx context.Context, req *pb.PeerReplicaRequest) (*pb.ReplicateResponse, error) {
+	if req.PeerAddress == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Falta la dirección del nodo destino")
+	}
+	if err := s.checkPeer(req.PeerAddress); err != nil {
+		return nil, err
+	}
+	meta, content, err := s.replicaSource(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	resp, err := s.pushReplica(ctx, req.PeerAddress, meta, content)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "Error replicando en %s: %v", req.PeerAddress, err)
+	}
+	slog.InfoContext(ctx, "Archivo replicado", "path", meta.Path, "peer", req.PeerAddress, "skipped", resp.Skipped)
+	return resp, nil
+}
+
+// Trae un archivo desde otro nodo y lo guarda con la misma ruta
+func (s *Server) PullFromPeer(ctx context.Context, req *pb.PeerReplicaRequest) (*pb.ReplicateResponse, error) {
+	if req.PeerAddress == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Falta la dirección del nodo origen")
+	}
+	if err := s.checkPeer(req.PeerAddress); err != nil {
+		return nil, err
+	}
+	filePath, err := resolveStoragePath(req.Path)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	localSum, _ := s.localChecksum(filePath)
+
+	conn, err := s.dialPeer(req.PeerAddress)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "Error conectando con %s: %v", req.PeerAddress, err)
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewFileSystemServiceClient(conn).PullFile(ctx, &pb.PullFileRequest{Path: req.Path, ChecksumSha256: localSum})
+	if err != nil {
+		return nil, err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	meta := first.Metadata
+	if _, err := validateReplicaMetadata(meta); err != nil {
+		return nil, err
+	}
+	// Se guarda con la ruta pedida, no con la que informa el otro nodo
+	meta.Path = indexKey(req.Path)
+
+	if meta.Identical {
+		s.preserveModTime(filePath, meta)
+		return s.replicaResponse(meta, true, 0), nil
+	}
+	staged, err := s.receiveReplica(first, stream.Recv)
+	if err != nil {
+		return nil, err
+	}
+	defer staged.remove()
+	if err := s.storeReplica(filePath, meta, staged); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Archivo traído desde otro nodo", "path", meta.Path, "peer", req.PeerAddress, "size", meta.Size)
+	return s.replicaResponse(meta, false, meta.Size), nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Recoge los mensajes que un handler envía por un stream
+type chunkRecorder struct {
+	grpc.ServerStream
+	chunks []*pb.ReplicaChunk
+}
+
+func (r *chunkRecorder) Context() context.Context {
+	return context.Background()
+}
+
+func (r *chunkRecorder) Send(chunk *pb.ReplicaChunk) error {
+	r.chunks = append(r.chunks, chunk)
+	return nil
+}
+
+func (r *chunkRecorder) data() []byte {
+	var buf bytes.Buffer
+	for _, chunk := range r.chunks {
+		buf.Write(chunk.Data)
+	}
+	return buf.Bytes()
+}
+
+func TestPullFileRanges(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			data := textBytes(2*replicaChunkSize + 100)
+			if err := s.writeStoredFile(filepath.Join(rootDirectory, "a.txt"), data); err != nil {
+				t.Fatal(err)
+			}
+			size := int64(len(data))
+			tests := []struct {
+				offset, length int64
+				want           []byte
+			}{
+				{0, 0, data},
+				{10, 5, data[10:15]},
+				{replicaChunkSize - 1, replicaChunkSize + 2, data[replicaChunkSize-1 : 2*replicaChunkSize+1]},
+				{size - 3, 100, data[size-3:]},
+				// offset + length desborda int64
+				{1, math.MaxInt64, data[1:]},
+				{size, math.MaxInt64, nil},
+			}
+			for _, tt := range tests {
+				stream := &chunkRecorder{}
+				if err := s.PullFile(&pb.PullFileRequest{Path: "a.txt", Offset: tt.offset, Length: tt.length}, stream); err != nil {
+					t.Fatalf("[%d, +%d): %v", tt.offset, tt.length, err)
+				}
+				if !bytes.Equal(stream.data(), tt.want) {
+					t.Fatalf("[%d, +%d): se recibieron %d bytes, se esperaban %d", tt.offset, tt.length, len(stream.data()), len(tt.want))
+				}
+				meta := stream.chunks[0].Metadata
+				if meta.Size != size || meta.ChecksumSha256 != contentHash(data) {
+					t.Fatalf("[%d, +%d): los metadatos no describen el archivo completo", tt.offset, tt.length)
+				}
+			}
+			for _, req := range []*pb.PullFileRequest{{Offset: size + 1}, {Offset: -1}, {Length: -1}, {Offset: math.MaxInt64, Length: math.MaxInt64}} {
+				req.Path = "a.txt"
+				if err := s.PullFile(req, &chunkRecorder{}); status.Code(err) != codes.OutOfRange {
+					t.Fatalf("[%d, +%d): se esperaba OutOfRange, se obtuvo %v", req.Offset, req.Length, err)
+				}
+			}
+		})
+	}
+}
+
+// Stream de ReplicateFile que entrega los mensajes indicados
+type replicaStream struct {
+	grpc.ServerStream
+	chunks []*pb.ReplicaChunk
+	resp   *pb.ReplicateResponse
+}
+
+func (r *replicaStream) Context() context.Context {
+	return context.Background()
+}
+
+func (r *replicaStream) Recv() (*pb.ReplicaChunk, error) {
+	if len(r.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	return chunk, nil
+}
+
+func (r *replicaStream) SendAndClose(resp *pb.ReplicateResponse) error {
+	r.resp = resp
+	return nil
+}
+
+// Mensajes de una réplica de data, con los metadatos que se indiquen
+func replicaChunks(meta *pb.ReplicaMetadata, data []byte) []*pb.ReplicaChunk {
+	chunks := []*pb.ReplicaChunk{{Metadata: meta}}
+	for len(data) > 0 {
+		n := min(len(data), 1000)
+		chunks = append(chunks, &pb.ReplicaChunk{Data: data[:n]})
+		data = data[n:]
+	}
+	return chunks
+}
+
+func TestReplicateFile(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.Storage.MaxUploadSize = 1 << 20
+				if configure != nil {
+					configure(c)
+				}
+			})
+			data := plaintextData(50_000)
+			meta := &pb.ReplicaMetadata{Path: "dir/r.txt", Size: int64(len(data)), ChecksumSha256: contentHash(data)}
+			stream := &replicaStream{chunks: replicaChunks(meta, data)}
+			if err := s.ReplicateFile(stream); err != nil {
+				t.Fatal(err)
+			}
+			if stream.resp.Skipped || stream.resp.BytesTransferred != int64(len(data)) {
+				t.Errorf("respuesta = %v", stream.resp)
+			}
+			assertStored(t, s, "dir/r.txt", data)
+			if entries, _ := os.ReadDir(s.stagingDir); len(entries) > 0 {
+				t.Errorf("quedaron %d temporales en el directorio de preparación", len(entries))
+			}
+
+			tests := []struct {
+				name string
+				meta *pb.ReplicaMetadata
+				data []byte
+				code codes.Code
+			}{
+				// El tamaño anunciado nunca se reserva: solo se compara con el límite
+				{"huge", &pb.ReplicaMetadata{Path: "h.txt", Size: math.MaxInt64, ChecksumSha256: contentHash(data)}, data, codes.OutOfRange},
+				{"over limit", &pb.ReplicaMetadata{Path: "h.txt", Size: 1<<20 + 1, ChecksumSha256: contentHash(data)}, data, codes.OutOfRange},
+				{"more data", &pb.ReplicaMetadata{Path: "m.txt", Size: 100, ChecksumSha256: contentHash(data)}, data, codes.InvalidArgument},
+				{"checksum", &pb.ReplicaMetadata{Path: "c.txt", Size: int64(len(data)), ChecksumSha256: contentHash(nil)}, data, codes.DataLoss},
+			}
+			for _, tt := range tests {
+				err := s.ReplicateFile(&replicaStream{chunks: replicaChunks(tt.meta, tt.data)})
+				if status.Code(err) != tt.code {
+					t.Errorf("%s: error = %v, se esperaba %v", tt.name, err, tt.code)
+				}
+				if _, err := os.Stat(filepath.Join(rootDirectory, tt.meta.Path)); !os.IsNotExist(err) {
+					t.Errorf("%s: se publicó la réplica rechazada", tt.name)
+				}
+			}
+			if entries, _ := os.ReadDir(s.stagingDir); len(entries) > 0 {
+				t.Errorf("quedaron %d temporales tras rechazar réplicas", len(entries))
+			}
+		})
+	}
+}
+
+func TestPeerRequestsRequireConfiguredPeer(t *testing.T) {
+	peer := serveTestNode(t, newTestServer(t, nil))
+	s := newTestServer(t, func(c *Config) { c.Replication.Peers = []string{peer} })
+	if err := s.writeStoredFile(filepath.Join(rootDirectory, "a.txt"), []byte("hola")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	other := deadAddress(t)
+	if _, err := s.ReplicateToPeer(ctx, &pb.PeerReplicaRequest{Path: "a.txt", PeerAddress: other}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ReplicateToPeer: error = %v, se esperaba PermissionDenied", err)
+	}
+	if _, err := s.PullFromPeer(ctx, &pb.PeerReplicaRequest{Path: "a.txt", PeerAddress: other}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("PullFromPeer: error = %v, se esperaba PermissionDenied", err)
+	}
+	// Los pares configurados se siguen aceptando
+	if _, err := s.ReplicateToPeer(ctx, &pb.PeerReplicaRequest{Path: "a.txt", PeerAddress: peer}); err != nil {
+		t.Errorf("ReplicateToPeer a un par configurado: %v", err)
+	}
+	if _, err := s.PullFromPeer(ctx, &pb.PeerReplicaRequest{Path: "a.txt", PeerAddress: peer}); err != nil {
+		t.Errorf("PullFromPeer desde un par configurado: %v", err)
+	}
+}
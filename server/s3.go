@@ -0,0 +1,720 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	s3XMLNamespace  = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3MaxKeys       = 1000
+	s3TimeLayout    = "2006-01-02T15:04:05.000Z"
+	s3MaxXMLBody    = 1024 * 1024
+	s3StorageClass  = "STANDARD"
+	s3EncodingURL   = "url"
+	s3ListVersion2  = "2"
+	s3DirectoryETag = `"` + s3EmptySHA256 + `"`
+)
+
+// API compatible con un subconjunto de S3, con direcciones de estilo ruta (http://host/bucket/clave).
+// Los buckets son los directorios del primer nivel y las claves, las rutas dentro de ellos.
+// Los cambios y las descargas se hacen con las mismas RPC que usan los clientes gRPC, pasando
+// por sus interceptores; los listados se leen directamente del disco, como en WebDAV.
+//
+//	GET    /                                       ListBuckets
+//	PUT    /{bucket}                               CreateBucket
+//	HEAD   /{bucket}                               HeadBucket
+//	DELETE /{bucket}                               DeleteBucket (debe estar vacío)
+//	GET    /{bucket}                               ListObjects, ListObjectsV2 (list-type=2)
+//	PUT    /{bucket}/{clave}                       PutObject; una clave terminada en / crea un directorio
+//	GET    /{bucket}/{clave}                       GetObject (Range, If-None-Match)
+//	HEAD   /{bucket}/{clave}                       HeadObject
+//	DELETE /{bucket}/{clave}                       DeleteObject
+//	POST   /{bucket}/{clave}?uploads               CreateMultipartUpload
+//	PUT    /{bucket}/{clave}?partNumber&uploadId   UploadPart
+//	POST   /{bucket}/{clave}?uploadId              CompleteMultipartUpload
+//	DELETE /{bucket}/{clave}?uploadId              AbortMultipartUpload
+//
+// Las peticiones se firman con SigV4 y las access keys de s3.access_keys; las que no están
+// firmadas se autentican con el token Bearer, como en el gateway HTTP. Los ETag son el SHA-256
+// del contenido, no su MD5. Los archivos ocultos (que empiezan con punto) no se listan.
+type s3Handler struct {
+	server       *Server
+	interceptors []grpc.UnaryServerInterceptor
+	multipart    *s3MultipartStore
+	// Hora con la que se comprueba la vigencia de las firmas
+	now func() time.Time
+}
+
+// Crea la API S3. Los interceptores deben ser los mismos que los del servidor gRPC.
+func (s *Server) NewS3Handler(interceptors ...grpc.UnaryServerInterceptor) http.Handler {
+	s.reloadMu.Lock()
+	multipartDir := s.config.S3.MultipartDirectory
+	s.reloadMu.Unlock()
+
+	multipart, err := newS3MultipartStore(multipartDir, s.uploads.ttl)
+	if err != nil {
+		fatal("Error abriendo las subidas multipart S3", "error", err)
+	}
+	// Los buckets se listan desde la raíz, que se crea con la primera subida
+	if err := os.MkdirAll(rootDirectory, os.ModePerm); err != nil {
+		fatal("Error creando directorio raíz", "error", err)
+	}
+	return &s3Handler{server: s, interceptors: interceptors, multipart: multipart, now: time.Now}
+}
+
+// Atiende la API S3 en la dirección indicada, con TLS si el nodo lo usa
+func (s *Server) ServeS3(address string, interceptors ...grpc.UnaryServerInterceptor) *http.Server {
+	return s.serveHTTP("API S3", address, "/", s.NewS3Handler(interceptors...))
+}
+
+// Error con el código y el estado HTTP de S3
+type s3Error struct {
+	httpStatus int
+	code       string
+	message    string
+}
+
+func s3ErrorOf(httpStatus int, code, message string) *s3Error {
+	return &s3Error{httpStatus: httpStatus, code: code, message: message}
+}
+
+func (e *s3Error) Error() string {
+	return e.message
+}
+
+// Permite que los errores al leer el cuerpo atraviesen las RPC sin perder el código S3
+func (e *s3Error) GRPCStatus() *status.Status {
+	if e.httpStatus == http.StatusForbidden {
+		return status.New(codes.PermissionDenied, e.message)
+	}
+	return status.New(codes.InvalidArgument, e.message)
+}
+
+// Error S3 equivalente al de una RPC
+func s3ErrorFrom(err error) *s3Error {
+	var s3err *s3Error
+	if errors.As(err, &s3err) {
+		return s3err
+	}
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.NotFound:
+		return s3ErrorOf(http.StatusNotFound, "NoSuchKey", st.Message())
+	case codes.InvalidArgument, codes.OutOfRange:
+		return s3ErrorOf(http.StatusBadRequest, "InvalidArgument", st.Message())
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return s3ErrorOf(http.StatusForbidden, "AccessDenied", st.Message())
+	case codes.AlreadyExists, codes.Aborted:
+		return s3ErrorOf(http.StatusConflict, "OperationAborted", st.Message())
+	case codes.FailedPrecondition:
+		return s3ErrorOf(http.StatusPreconditionFailed, "PreconditionFailed", st.Message())
+	case codes.DataLoss:
+		return s3ErrorOf(http.StatusBadRequest, "XAmzContentSHA256Mismatch", st.Message())
+	case codes.ResourceExhausted:
+		return s3ErrorOf(http.StatusServiceUnavailable, "SlowDown", st.Message())
+	case codes.Unavailable:
+		return s3ErrorOf(http.StatusServiceUnavailable, "ServiceUnavailable", st.Message())
+	case codes.Unimplemented:
+		return s3ErrorOf(http.StatusNotImplemented, "NotImplemented", st.Message())
+	}
+	return s3ErrorOf(http.StatusInternalServerError, "InternalError", st.Message())
+}
+
+type s3ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string
+	RequestId string
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, err error) {
+	e := s3ErrorFrom(err)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.httpStatus)
+	// Las respuestas a HEAD no tienen cuerpo
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(s3ErrorResponse{
+		Code:      e.code,
+		Message:   e.message,
+		Resource:  r.URL.Path,
+		RequestId: w.Header().Get(requestIDKey),
+	})
+}
+
+func writeS3XML(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(code)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(body)
+}
+
+// Petición S3 ya autenticada
+type s3Call struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	ctx    context.Context
+	sig    *s3Signature
+	bucket string
+	key    string
+}
+
+func (h *s3Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sig, err := h.verifySignature(r)
+	if err != nil {
+		writeS3Error(w, r, err)
+		return
+	}
+	if sig != nil {
+		// La access key identifica al cliente en la auditoría y en los límites
+		r = r.WithContext(withPrincipal(withPreauthorized(r.Context()), "s3:"+sig.accessKey))
+	}
+	ctx := httpCallContext(w, r)
+	if err := h.server.authenticate(ctx); err != nil {
+		writeS3Error(w, r, s3ErrorOf(http.StatusForbidden, "AccessDenied", status.Convert(err).Message()))
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	c := &s3Call{w: w, r: r, ctx: ctx, sig: sig, bucket: bucket, key: key}
+	query := r.URL.Query()
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		h.listBuckets(c)
+	case bucket == "":
+		writeS3Error(w, r, s3ErrorOf(http.StatusMethodNotAllowed, "MethodNotAllowed", "Método no soportado"))
+	case key == "":
+		h.serveBucket(c, query)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		h.createMultipartUpload(c)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		h.completeMultipartUpload(c, query.Get("uploadId"))
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		h.uploadPart(c, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		h.abortMultipartUpload(c, query.Get("uploadId"))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		h.getObject(c)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		writeS3Error(w, r, s3ErrorOf(http.StatusNotImplemented, "NotImplemented", "CopyObject no está soportado"))
+	case r.Method == http.MethodPut:
+		h.putObject(c)
+	case r.Method == http.MethodDelete:
+		h.deleteObject(c)
+	default:
+		writeS3Error(w, r, s3ErrorOf(http.StatusMethodNotAllowed, "MethodNotAllowed", "Método no soportado"))
+	}
+}
+
+func (h *s3Handler) serveBucket(c *s3Call, query url.Values) {
+	switch c.r.Method {
+	case http.MethodPut:
+		h.createBucket(c)
+	case http.MethodHead:
+		h.headBucket(c)
+	case http.MethodDelete:
+		h.deleteBucket(c)
+	case http.MethodGet:
+		if query.Has("location") {
+			h.bucketLocation(c)
+			return
+		}
+		h.listObjects(c)
+	default:
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusMethodNotAllowed, "MethodNotAllowed", "Método no soportado"))
+	}
+}
+
+// Ruta en disco de un bucket, que debe ser un nombre válido de directorio del primer nivel
+func s3BucketPath(bucket string) (string, error) {
+	if bucket == "" || strings.HasPrefix(bucket, ".") || strings.ContainsAny(bucket, `/\`) {
+		return "", s3ErrorOf(http.StatusBadRequest, "InvalidBucketName", "Nombre de bucket inválido")
+	}
+	return filepath.Join(rootDirectory, bucket), nil
+}
+
+// Ruta en disco de un bucket existente
+func existingBucketPath(bucket string) (string, error) {
+	bucketPath, err := s3BucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(bucketPath); err != nil || !info.IsDir() {
+		return "", s3ErrorOf(http.StatusNotFound, "NoSuchBucket", "El bucket no existe")
+	}
+	return bucketPath, nil
+}
+
+// Ruta relativa y en disco de una clave. Las claves terminadas en / son directorios.
+func s3ObjectPath(bucket, key string) (relPath, fullPath string, isDir bool, err error) {
+	if _, err := existingBucketPath(bucket); err != nil {
+		return "", "", false, err
+	}
+	trimmed := strings.TrimSuffix(key, "/")
+	isDir = trimmed != key
+	if trimmed == "" || trimmed == "." || trimmed == ".." || path.Clean(trimmed) != trimmed ||
+		strings.HasPrefix(trimmed, "../") || strings.Contains(trimmed, `\`) {
+		return "", "", false, s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "Clave inválida")
+	}
+	relPath = bucket + "/" + trimmed
+	if fullPath, err = resolveStoragePath(relPath); err != nil {
+		return "", "", false, s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "Clave inválida")
+	}
+	return relPath, fullPath, isDir, nil
+}
+
+func s3ETag(checksum string) string {
+	return `"` + checksum + `"`
+}
+
+type s3Bucket struct {
+	Name         string
+	CreationDate string
+}
+
+type s3ListBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	OwnerID string     `xml:"Owner>ID"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+func (h *s3Handler) listBuckets(c *s3Call) {
+	entries, err := os.ReadDir(rootDirectory)
+	if err != nil {
+		writeS3Error(c.w, c.r, status.Errorf(codes.Internal, "Error listando los buckets: %v", err))
+		return
+	}
+	result := s3ListBucketsResult{Xmlns: s3XMLNamespace, OwnerID: h.server.nodeID}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		result.Buckets = append(result.Buckets, s3Bucket{Name: entry.Name(), CreationDate: info.ModTime().UTC().Format(s3TimeLayout)})
+	}
+	writeS3XML(c.w, http.StatusOK, result)
+}
+
+func (h *s3Handler) createBucket(c *s3Call) {
+	bucketPath, err := s3BucketPath(c.bucket)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	if _, err := os.Stat(bucketPath); err == nil {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusConflict, "BucketAlreadyOwnedByYou", "El bucket ya existe"))
+		return
+	}
+	_, err = invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_CreateDirectory_FullMethodName,
+		&pb.DirectoryRequest{Path: c.bucket}, h.server.CreateDirectory)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	c.w.Header().Set("Location", "/"+c.bucket)
+	c.w.WriteHeader(http.StatusOK)
+}
+
+func (h *s3Handler) headBucket(c *s3Call) {
+	if _, err := existingBucketPath(c.bucket); err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	c.w.WriteHeader(http.StatusOK)
+}
+
+func (h *s3Handler) deleteBucket(c *s3Call) {
+	bucketPath, err := existingBucketPath(c.bucket)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	entries, err := os.ReadDir(bucketPath)
+	if err != nil {
+		writeS3Error(c.w, c.r, status.Errorf(codes.Internal, "Error leyendo el bucket: %v", err))
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			writeS3Error(c.w, c.r, s3ErrorOf(http.StatusConflict, "BucketNotEmpty", "El bucket no está vacío"))
+			return
+		}
+	}
+	_, err = invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_DeleteFile_FullMethodName,
+		&pb.DeleteRequest{Path: c.bucket}, h.server.DeleteFile)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	c.w.WriteHeader(http.StatusNoContent)
+}
+
+type s3LocationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+}
+
+// Región del bucket; vacía equivale a us-east-1, que aceptan todos los clientes
+func (h *s3Handler) bucketLocation(c *s3Call) {
+	if _, err := existingBucketPath(c.bucket); err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	writeS3XML(c.w, http.StatusOK, s3LocationConstraint{Xmlns: s3XMLNamespace})
+}
+
+func (h *s3Handler) putObject(c *s3Call) {
+	relPath, fullPath, isDir, err := s3ObjectPath(c.bucket, c.key)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	body, size, expected, err := c.sig.body(c.r)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	if size < 0 {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusLengthRequired, "MissingContentLength", "Se requiere Content-Length"))
+		return
+	}
+
+	// Los clientes crean las "carpetas" con un objeto vacío terminado en /
+	if isDir {
+		if size > 0 {
+			writeS3Error(c.w, c.r, s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "Una clave terminada en / no puede tener contenido"))
+			return
+		}
+		_, err := invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_CreateDirectory_FullMethodName,
+			&pb.DirectoryRequest{Path: relPath}, h.server.CreateDirectory)
+		if err != nil {
+			writeS3Error(c.w, c.r, err)
+			return
+		}
+		c.w.Header().Set("ETag", s3DirectoryETag)
+		c.w.WriteHeader(http.StatusOK)
+		return
+	}
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusConflict, "InvalidRequest", "Ya existe un directorio con esa clave"))
+		return
+	}
+
+	dir, name := splitGatewayPath(relPath)
+	_, sum, err := streamUpload(c.ctx, h.interceptors, h.server, dir, name, body, size, expected)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	c.w.Header().Set("ETag", s3ETag(sum))
+	c.w.WriteHeader(http.StatusOK)
+}
+
+func (h *s3Handler) getObject(c *s3Call) {
+	relPath, fullPath, isDir, err := s3ObjectPath(c.bucket, c.key)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() != isDir {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusNotFound, "NoSuchKey", "La clave no existe"))
+		return
+	}
+	c.w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	if isDir {
+		c.w.Header().Set("ETag", s3DirectoryETag)
+		c.w.Header().Set("Content-Length", "0")
+		c.w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if c.r.Method == http.MethodHead {
+		resp, err := invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_StatFile_FullMethodName,
+			&pb.StatRequest{Path: relPath}, h.server.StatFile)
+		if err != nil {
+			writeS3Error(c.w, c.r, err)
+			return
+		}
+		if record, err := h.server.fileChecksum(fullPath, indexKey(relPath)); err == nil {
+			c.w.Header().Set("ETag", s3ETag(record.Checksum))
+		}
+		c.w.Header().Set("Content-Type", resp.FileType)
+		c.w.Header().Set("Content-Length", strconv.FormatInt(resp.Size, 10))
+		c.w.Header().Set("Accept-Ranges", "bytes")
+		c.w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	content, resp, err := invokeDownload(c.ctx, h.interceptors, h.server, relPath)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	defer content.Close()
+	record, err := h.server.contentChecksum(indexKey(relPath), content)
+	if err != nil {
+		writeS3Error(c.w, c.r, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err))
+		return
+	}
+	c.w.Header().Set("ETag", s3ETag(record.Checksum))
+	c.w.Header().Set("Content-Type", resp.FileType)
+	// ServeContent responde los rangos y las peticiones condicionales
+	http.ServeContent(c.w, c.r, resp.Filename, info.ModTime(), io.NewSectionReader(content, 0, content.size))
+}
+
+// Borrar una clave que no existe no es un error en S3
+func (h *s3Handler) deleteObject(c *s3Call) {
+	relPath, fullPath, isDir, err := s3ObjectPath(c.bucket, c.key)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() != isDir {
+		c.w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// Un directorio es una "carpeta" mientras esté vacío; con contenido, la clave no existe por sí sola
+	if isDir {
+		entries, err := os.ReadDir(fullPath)
+		if err != nil || len(entries) > 0 {
+			c.w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	_, err = invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_DeleteFile_FullMethodName,
+		&pb.DeleteRequest{Path: relPath}, h.server.DeleteFile)
+	// Otra petición pudo borrarla mientras tanto
+	if err != nil && status.Code(err) != codes.NotFound {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	c.w.WriteHeader(http.StatusNoContent)
+}
+
+// Archivo o directorio vacío de un listado
+type s3Object struct {
+	key     string
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// Recorre el bucket y agrega los objetos con el prefijo. Con el delimitador / los directorios que
+// quedan agrupados en un prefijo común no se recorren: basta con agregarlos como "carpeta".
+func (h *s3Handler) collectObjects(bucket, dir, keyPrefix, prefix string, grouped bool, objects *[]s3Object) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	visible := 0
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		visible++
+		key := keyPrefix + entry.Name()
+		fullPath := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if entry.IsDir() {
+			dirKey := key + "/"
+			switch {
+			case grouped && strings.HasPrefix(dirKey, prefix) && len(dirKey) > len(prefix):
+				*objects = append(*objects, s3Object{key: dirKey, modTime: info.ModTime()})
+			case strings.HasPrefix(dirKey, prefix) || strings.HasPrefix(prefix, dirKey):
+				if err := h.collectObjects(bucket, fullPath, dirKey, prefix, grouped, objects); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			continue
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		object := s3Object{key: key, size: info.Size(), modTime: info.ModTime()}
+		if stored, err := h.server.statStoredFile(fullPath); err == nil {
+			object.size = stored.size
+		}
+		// El ETag solo se incluye si ya está en el catálogo, para no leer cada archivo
+		if record, ok := h.server.checksums.get(indexKey(bucket + "/" + key)); ok && record.ModTime == info.ModTime().UnixNano() {
+			object.etag = s3ETag(record.Checksum)
+		}
+		*objects = append(*objects, object)
+	}
+	// Un directorio vacío es una "carpeta" creada con una clave terminada en /
+	if visible == 0 && keyPrefix != "" && strings.HasPrefix(keyPrefix, prefix) {
+		if info, err := os.Stat(dir); err == nil {
+			*objects = append(*objects, s3Object{key: keyPrefix, modTime: info.ModTime()})
+		}
+	}
+	return nil
+}
+
+type s3ListObject struct {
+	Key          string
+	LastModified string
+	ETag         string `xml:",omitempty"`
+	Size         int64
+	StorageClass string
+}
+
+type s3CommonPrefix struct {
+	Prefix string
+}
+
+// Respuesta de ListObjects y ListObjectsV2; los campos de una sola versión son punteros
+type s3ListBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string  `xml:",omitempty"`
+	Marker                *string `xml:",omitempty"`
+	NextMarker            string  `xml:",omitempty"`
+	StartAfter            string  `xml:",omitempty"`
+	ContinuationToken     string  `xml:",omitempty"`
+	NextContinuationToken string  `xml:",omitempty"`
+	KeyCount              *int    `xml:",omitempty"`
+	MaxKeys               int
+	IsTruncated           bool
+	EncodingType          string `xml:",omitempty"`
+	Contents              []s3ListObject
+	CommonPrefixes        []s3CommonPrefix
+}
+
+func (h *s3Handler) listObjects(c *s3Call) {
+	if _, err := existingBucketPath(c.bucket); err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	query := c.r.URL.Query()
+	v2 := query.Get("list-type") == s3ListVersion2
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	maxKeys := s3MaxKeys
+	if text := query.Get("max-keys"); text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			writeS3Error(c.w, c.r, s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "max-keys inválido"))
+			return
+		}
+		maxKeys = min(n, s3MaxKeys)
+	}
+	encode := func(text string) string { return text }
+	if query.Get("encoding-type") == s3EncodingURL {
+		encode = func(text string) string { return s3Encode(text, true) }
+	}
+
+	result := s3ListBucketResult{Xmlns: s3XMLNamespace, Name: c.bucket, Prefix: encode(prefix), Delimiter: encode(delimiter), MaxKeys: maxKeys}
+	if query.Get("encoding-type") == s3EncodingURL {
+		result.EncodingType = s3EncodingURL
+	}
+	// Se continúa después de la última clave o prefijo común devuelto
+	var after string
+	if v2 {
+		result.StartAfter = encode(query.Get("start-after"))
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				writeS3Error(c.w, c.r, s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "continuation-token inválido"))
+				return
+			}
+			result.ContinuationToken = token
+			after = string(decoded)
+		}
+	} else {
+		marker := query.Get("marker")
+		result.Marker = &marker
+		after = marker
+	}
+
+	// Solo se recorre el directorio al que apunta el prefijo
+	startKey := prefix[:strings.LastIndex(prefix, "/")+1]
+	startDir, err := resolveStoragePath(c.bucket + "/" + startKey)
+	if err != nil {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "Prefijo inválido"))
+		return
+	}
+	var objects []s3Object
+	if err := h.collectObjects(c.bucket, startDir, startKey, prefix, delimiter == "/", &objects); err != nil && !os.IsNotExist(err) {
+		writeS3Error(c.w, c.r, status.Errorf(codes.Internal, "Error listando el bucket: %v", err))
+		return
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].key < objects[j].key })
+
+	count := 0
+	var last string
+	for _, object := range objects {
+		if object.key <= after || (delimiter != "" && strings.HasSuffix(after, delimiter) && strings.HasPrefix(object.key, after)) {
+			continue
+		}
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(object.key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = object.key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if commonPrefix != "" && commonPrefix == last {
+			continue
+		}
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		count++
+		if commonPrefix != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: encode(commonPrefix)})
+			last = commonPrefix
+			continue
+		}
+		result.Contents = append(result.Contents, s3ListObject{
+			Key:          encode(object.key),
+			LastModified: object.modTime.UTC().Format(s3TimeLayout),
+			ETag:         object.etag,
+			Size:         object.size,
+			StorageClass: s3StorageClass,
+		})
+		last = object.key
+	}
+	if result.IsTruncated {
+		if v2 {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		} else {
+			result.NextMarker = encode(last)
+		}
+	}
+	if v2 {
+		result.KeyCount = &count
+	}
+	writeS3XML(c.w, http.StatusOK, result)
+}
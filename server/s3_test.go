@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestS3GetObject(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				if configure != nil {
+					configure(c)
+				}
+				c.Node.MaxMessageSize = 1 << 20
+			})
+			h := s.NewS3Handler()
+			if w := gatewayRequest(h, http.MethodPut, "/fotos", nil); w.Code != http.StatusOK {
+				t.Fatalf("CreateBucket devolvió %d: %s", w.Code, w.Body)
+			}
+			// Mayor que el tamaño máximo de mensaje: se envía sin pasar por DownloadFile entero
+			data := randomBytes(t, 3<<20+5)
+			if w := gatewayRequest(h, http.MethodPut, "/fotos/a/b.bin", data); w.Code != http.StatusOK {
+				t.Fatalf("PutObject devolvió %d: %s", w.Code, w.Body)
+			}
+
+			w := gatewayRequest(h, http.MethodGet, "/fotos/a/b.bin", nil)
+			if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+				t.Fatalf("GetObject devolvió %d con %d bytes", w.Code, w.Body.Len())
+			}
+			etag := s3ETag(sha256Hex(data))
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Fatalf("ETag %s, se esperaba %s", got, etag)
+			}
+			if head := gatewayRequest(h, http.MethodHead, "/fotos/a/b.bin", nil); head.Header().Get("ETag") != etag {
+				t.Fatalf("HEAD devolvió el ETag %s, GET %s", head.Header().Get("ETag"), etag)
+			}
+
+			w = gatewayRequest(h, http.MethodGet, "/fotos/a/b.bin", nil, "Range", "bytes=65530-65545")
+			if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), data[65530:65546]) {
+				t.Fatalf("Range devolvió %d con %d bytes", w.Code, w.Body.Len())
+			}
+			if w := gatewayRequest(h, http.MethodGet, "/fotos/a/b.bin", nil, "If-None-Match", etag); w.Code != http.StatusNotModified {
+				t.Fatalf("If-None-Match devolvió %d", w.Code)
+			}
+			if w := gatewayRequest(h, http.MethodGet, "/fotos/a/otro.bin", nil); w.Code != http.StatusNotFound {
+				t.Fatalf("una clave inexistente devolvió %d", w.Code)
+			}
+		})
+	}
+}
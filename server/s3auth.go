@@ -0,0 +1,350 @@
+package server
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Firma Signature Version 4 de las peticiones S3
+const (
+	s3Algorithm           = "AWS4-HMAC-SHA256"
+	s3ChunkAlgorithm      = "AWS4-HMAC-SHA256-PAYLOAD"
+	s3TimeFormat          = "20060102T150405Z"
+	s3MaxClockSkew        = 15 * time.Minute
+	s3MaxPresignedExpires = 7 * 24 * time.Hour
+	// SHA-256 de un contenido vacío
+	s3EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Valores de x-amz-content-sha256 que no son el SHA-256 del cuerpo
+const (
+	s3UnsignedPayload          = "UNSIGNED-PAYLOAD"
+	s3StreamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	s3StreamingPayloadTrailer  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	s3StreamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+// Tamaño máximo de un bloque aws-chunked, que se verifica entero en memoria
+const s3MaxChunkSize = 16 * 1024 * 1024
+
+// Firma ya verificada de una petición, necesaria para verificar los bloques del cuerpo
+type s3Signature struct {
+	accessKey  string
+	signingKey []byte
+	amzDate    string
+	scope      string
+	signature  string
+	// Valor de x-amz-content-sha256 (UNSIGNED-PAYLOAD en las URL prefirmadas)
+	payloadHash string
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Codifica como S3: todo salvo A-Z, a-z, 0-9, '-', '.', '_' y '~', y la barra si keepSlash
+func s3Encode(text string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+// Cabecera Authorization o parámetros de una URL prefirmada
+type s3Credentials struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+}
+
+// Lee "AK/20250101/us-east-1/s3/aws4_request"
+func parseS3Credential(credential string, c *s3Credentials) bool {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || parts[3] != "s3" {
+		return false
+	}
+	c.accessKey, c.date, c.region, c.service = parts[0], parts[1], parts[2], parts[3]
+	return c.accessKey != ""
+}
+
+// Lee "AWS4-HMAC-SHA256 Credential=..., SignedHeaders=..., Signature=..."
+func parseS3Authorization(header string) (*s3Credentials, bool) {
+	fields, ok := strings.CutPrefix(header, s3Algorithm+" ")
+	if !ok {
+		return nil, false
+	}
+	c := &s3Credentials{}
+	for _, field := range strings.Split(fields, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "Credential":
+			if !parseS3Credential(value, c) {
+				return nil, false
+			}
+		case "SignedHeaders":
+			c.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			c.signature = value
+		}
+	}
+	return c, c.accessKey != "" && len(c.signedHeaders) > 0 && c.signature != ""
+}
+
+// Verifica la firma SigV4 de una petición, en la cabecera Authorization o en la URL (prefirmada).
+// Devuelve nil sin error si la petición no está firmada.
+func (h *s3Handler) verifySignature(r *http.Request) (*s3Signature, error) {
+	query := r.URL.Query()
+	authorization := r.Header.Get("Authorization")
+	presigned := query.Get("X-Amz-Algorithm") != ""
+	if !presigned && !strings.HasPrefix(authorization, "AWS") {
+		return nil, nil
+	}
+
+	var creds *s3Credentials
+	var amzDate, payloadHash string
+	var expires time.Duration
+	if presigned {
+		if query.Get("X-Amz-Algorithm") != s3Algorithm {
+			return nil, s3ErrorOf(http.StatusBadRequest, "AuthorizationQueryParametersError", "Algoritmo de firma no soportado")
+		}
+		creds = &s3Credentials{signature: query.Get("X-Amz-Signature")}
+		seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if !parseS3Credential(query.Get("X-Amz-Credential"), creds) || err != nil || seconds < 0 || creds.signature == "" {
+			return nil, s3ErrorOf(http.StatusBadRequest, "AuthorizationQueryParametersError", "Parámetros de la URL prefirmada inválidos")
+		}
+		expires = time.Duration(seconds) * time.Second
+		if expires > s3MaxPresignedExpires {
+			return nil, s3ErrorOf(http.StatusBadRequest, "AuthorizationQueryParametersError", "El vencimiento no puede superar los 7 días")
+		}
+		creds.signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+		amzDate = query.Get("X-Amz-Date")
+		payloadHash = s3UnsignedPayload
+	} else {
+		var ok bool
+		if creds, ok = parseS3Authorization(authorization); !ok {
+			return nil, s3ErrorOf(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Cabecera Authorization inválida")
+		}
+		amzDate = r.Header.Get("X-Amz-Date")
+		payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if payloadHash == "" {
+			return nil, s3ErrorOf(http.StatusBadRequest, "InvalidRequest", "Falta la cabecera x-amz-content-sha256")
+		}
+	}
+
+	signedAt, err := time.Parse(s3TimeFormat, amzDate)
+	if err != nil || creds.date != amzDate[:8] {
+		return nil, s3ErrorOf(http.StatusForbidden, "AccessDenied", "Fecha de la firma inválida")
+	}
+	now := h.now()
+	if signedAt.Sub(now) > s3MaxClockSkew || (!presigned && now.Sub(signedAt) > s3MaxClockSkew) {
+		return nil, s3ErrorOf(http.StatusForbidden, "RequestTimeTooSkewed", "La hora de la petición difiere demasiado de la del servidor")
+	}
+	if presigned && now.After(signedAt.Add(expires)) {
+		return nil, s3ErrorOf(http.StatusForbidden, "AccessDenied", "La URL prefirmada venció")
+	}
+
+	secret, ok := (*h.server.security.s3Keys.Load())[creds.accessKey]
+	if !ok {
+		return nil, s3ErrorOf(http.StatusForbidden, "InvalidAccessKeyId", "La access key no existe")
+	}
+	scope := strings.Join([]string{creds.date, creds.region, creds.service, "aws4_request"}, "/")
+	signingKey := hmacSHA256([]byte("AWS4"+secret), creds.date)
+	signingKey = hmacSHA256(signingKey, creds.region)
+	signingKey = hmacSHA256(signingKey, creds.service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		s3Encode(r.URL.Path, true),
+		s3CanonicalQuery(query, presigned),
+		s3CanonicalHeaders(r, creds.signedHeaders),
+		strings.Join(creds.signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(creds.signature)) {
+		return nil, s3ErrorOf(http.StatusForbidden, "SignatureDoesNotMatch", "La firma de la petición no coincide")
+	}
+	return &s3Signature{
+		accessKey:   creds.accessKey,
+		signingKey:  signingKey,
+		amzDate:     amzDate,
+		scope:       scope,
+		signature:   expected,
+		payloadHash: payloadHash,
+	}, nil
+}
+
+// Parámetros ordenados y codificados; en las URL prefirmadas sin la firma
+func s3CanonicalQuery(query url.Values, presigned bool) string {
+	var pairs []string
+	for key, values := range query {
+		if presigned && key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, s3Encode(key, false)+"="+s3Encode(value, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// Cabeceras firmadas, una por línea y terminadas en salto de línea
+func s3CanonicalHeaders(r *http.Request, signedHeaders []string) string {
+	var b strings.Builder
+	for _, name := range signedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		// net/http quita estas cabeceras de r.Header
+		case "content-length":
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		case "transfer-encoding":
+			values = r.TransferEncoding
+		default:
+			values = r.Header.Values(name)
+		}
+		for i, value := range values {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		b.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return b.String()
+}
+
+// Cuerpo de la petición según x-amz-content-sha256, con su tamaño y el SHA-256 que debe tener
+// (vacío si no se indicó). Los cuerpos aws-chunked se decodifican verificando cada bloque.
+func (sig *s3Signature) body(r *http.Request) (io.Reader, int64, string, error) {
+	payloadHash := s3UnsignedPayload
+	if sig != nil {
+		payloadHash = sig.payloadHash
+	}
+	switch payloadHash {
+	case s3UnsignedPayload:
+		return r.Body, r.ContentLength, "", nil
+	case s3StreamingPayload, s3StreamingPayloadTrailer, s3StreamingUnsignedTrailer:
+		size, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil || size < 0 {
+			return nil, 0, "", s3ErrorOf(http.StatusLengthRequired, "MissingContentLength", "Falta x-amz-decoded-content-length")
+		}
+		chunks := &s3ChunkReader{r: bufio.NewReader(r.Body)}
+		if payloadHash != s3StreamingUnsignedTrailer {
+			chunks.sig, chunks.previous = sig, sig.signature
+		}
+		return chunks, size, "", nil
+	}
+	if len(payloadHash) != sha256.Size*2 || !isValidBlobHash(strings.ToLower(payloadHash)) {
+		return nil, 0, "", s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "x-amz-content-sha256 inválido")
+	}
+	return r.Body, r.ContentLength, strings.ToLower(payloadHash), nil
+}
+
+// Decodifica un cuerpo aws-chunked ("tamaño;chunk-signature=firma\r\ndatos\r\n"...), verificando la
+// firma de cada bloque si sig no es nil. Los trailers del final (checksums) se descartan.
+type s3ChunkReader struct {
+	r        *bufio.Reader
+	sig      *s3Signature
+	previous string
+	chunk    []byte
+	done     bool
+}
+
+func (c *s3ChunkReader) Read(p []byte) (int, error) {
+	for len(c.chunk) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
+	return n, nil
+}
+
+func (c *s3ChunkReader) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", s3ErrorOf(http.StatusBadRequest, "IncompleteBody", "El cuerpo aws-chunked está incompleto")
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func (c *s3ChunkReader) next() error {
+	invalid := s3ErrorOf(http.StatusBadRequest, "InvalidRequest", "Cuerpo aws-chunked inválido")
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeHex, extension, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > s3MaxChunkSize {
+		return invalid
+	}
+	chunk := make([]byte, size)
+	if size > 0 {
+		if _, err := io.ReadFull(c.r, chunk); err != nil {
+			return s3ErrorOf(http.StatusBadRequest, "IncompleteBody", "El cuerpo aws-chunked está incompleto")
+		}
+		if end, err := c.readLine(); err != nil || end != "" {
+			return invalid
+		}
+	}
+
+	if c.sig != nil {
+		signature, _ := strings.CutPrefix(extension, "chunk-signature=")
+		stringToSign := strings.Join([]string{s3ChunkAlgorithm, c.sig.amzDate, c.sig.scope, c.previous, s3EmptySHA256, sha256Hex(chunk)}, "\n")
+		expected := hex.EncodeToString(hmacSHA256(c.sig.signingKey, stringToSign))
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			return s3ErrorOf(http.StatusForbidden, "SignatureDoesNotMatch", "La firma de un bloque del cuerpo no coincide")
+		}
+		c.previous = expected
+	}
+
+	if size == 0 {
+		// Trailers hasta la línea vacía
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "" {
+				break
+			}
+		}
+		c.done = true
+	}
+	c.chunk = chunk
+	return nil
+}
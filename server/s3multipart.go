@@ -0,0 +1,410 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultS3MultipartDirectory = "s3-multipart"
+	s3MaxPartNumber             = 10000
+)
+
+// Parte recibida de una subida multipart. Cada parte es una sesión de subida propia, así que
+// se cifra y expira igual que las subidas por partes de la API gRPC.
+type s3Part struct {
+	SessionID string `json:"session_id"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"etag"`
+}
+
+// Subida multipart de S3, guardada en disco para sobrevivir a un reinicio
+type s3MultipartUpload struct {
+	ID      string          `json:"id"`
+	Bucket  string          `json:"bucket"`
+	Key     string          `json:"key"`
+	Created time.Time       `json:"created"`
+	Updated time.Time       `json:"updated"`
+	Parts   map[int]*s3Part `json:"parts"`
+
+	mu sync.Mutex
+	// Se marca al completarla o cancelarla, para rechazar las partes que lleguen tarde
+	closed bool
+}
+
+type s3MultipartStore struct {
+	dir     string
+	ttl     time.Duration
+	mu      sync.Mutex
+	uploads map[string]*s3MultipartUpload
+}
+
+// Abre el directorio de las subidas multipart y recupera las que quedaron en curso
+func newS3MultipartStore(dir string, ttl time.Duration) (*s3MultipartStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	m := &s3MultipartStore{dir: dir, ttl: ttl, uploads: make(map[string]*s3MultipartUpload)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		var upload s3MultipartUpload
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err == nil {
+			err = json.Unmarshal(data, &upload)
+		}
+		if err != nil || upload.ID != id {
+			slog.Warn("Subida multipart S3 inválida, se elimina", "upload_id", id)
+			os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		if upload.Parts == nil {
+			upload.Parts = make(map[int]*s3Part)
+		}
+		m.uploads[id] = &upload
+	}
+	m.expire()
+	return m, nil
+}
+
+// Guarda la subida. Debe llamarse con el candado de la subida tomado.
+func (m *s3MultipartStore) save(upload *s3MultipartUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.dir, upload.ID+".json"), data, 0600)
+}
+
+func (m *s3MultipartStore) add(upload *s3MultipartUpload) error {
+	if err := m.save(upload); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.uploads[upload.ID] = upload
+	m.mu.Unlock()
+	return nil
+}
+
+// Subida de bucket/key, o un error NoSuchUpload
+func (m *s3MultipartStore) get(id, bucket, key string) (*s3MultipartUpload, error) {
+	m.mu.Lock()
+	upload, ok := m.uploads[id]
+	m.mu.Unlock()
+	if !ok || upload.Bucket != bucket || upload.Key != key {
+		return nil, s3ErrorOf(http.StatusNotFound, "NoSuchUpload", "La subida multipart no existe o expiró")
+	}
+	return upload, nil
+}
+
+// Elimina la subida. Debe llamarse con el candado de la subida tomado.
+func (m *s3MultipartStore) remove(upload *s3MultipartUpload) {
+	upload.closed = true
+	m.mu.Lock()
+	delete(m.uploads, upload.ID)
+	m.mu.Unlock()
+	if err := os.Remove(filepath.Join(m.dir, upload.ID+".json")); err != nil && !os.IsNotExist(err) {
+		slog.Warn("No se pudo eliminar la subida multipart S3", "upload_id", upload.ID, "error", err)
+	}
+}
+
+// Olvida las subidas sin partes nuevas durante el tiempo de vida de las sesiones; sus partes
+// ya expiraron con ellas
+func (m *s3MultipartStore) expire() {
+	m.mu.Lock()
+	var uploads []*s3MultipartUpload
+	for _, upload := range m.uploads {
+		uploads = append(uploads, upload)
+	}
+	m.mu.Unlock()
+
+	now := time.Now()
+	for _, upload := range uploads {
+		if !upload.mu.TryLock() {
+			continue
+		}
+		if !upload.closed && now.After(upload.Updated.Add(m.ttl)) {
+			slog.Info("Subida multipart S3 expirada", "upload_id", upload.ID, "bucket", upload.Bucket, "key", upload.Key)
+			m.remove(upload)
+		}
+		upload.mu.Unlock()
+	}
+}
+
+type s3InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+func (h *s3Handler) createMultipartUpload(c *s3Call) {
+	if _, _, isDir, err := s3ObjectPath(c.bucket, c.key); err != nil || isDir {
+		if err == nil {
+			err = s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "Una clave terminada en / no puede tener contenido")
+		}
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	h.multipart.expire()
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		writeS3Error(c.w, c.r, status.Errorf(codes.Internal, "Error generando la subida: %v", err))
+		return
+	}
+	now := time.Now()
+	upload := &s3MultipartUpload{
+		ID:      hex.EncodeToString(idBytes),
+		Bucket:  c.bucket,
+		Key:     c.key,
+		Created: now,
+		Updated: now,
+		Parts:   make(map[int]*s3Part),
+	}
+	if err := h.multipart.add(upload); err != nil {
+		writeS3Error(c.w, c.r, status.Errorf(codes.Internal, "Error guardando la subida: %v", err))
+		return
+	}
+	slog.InfoContext(c.ctx, "Subida multipart S3 iniciada", "upload_id", upload.ID, "bucket", c.bucket, "key", c.key)
+	writeS3XML(c.w, http.StatusOK, s3InitiateMultipartUploadResult{Xmlns: s3XMLNamespace, Bucket: c.bucket, Key: c.key, UploadId: upload.ID})
+}
+
+// Cancela una sesión de subida, pasando por los interceptores para que quede auditada
+func (h *s3Handler) abortSession(c *s3Call, sessionID string) {
+	invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_AbortUpload_FullMethodName,
+		&pb.UploadSessionRequest{SessionId: sessionID}, h.server.AbortUpload)
+}
+
+func (h *s3Handler) uploadPart(c *s3Call, uploadID, partNumber string) {
+	number, err := strconv.Atoi(partNumber)
+	if err != nil || number < 1 || number > s3MaxPartNumber {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusBadRequest, "InvalidArgument", "partNumber debe estar entre 1 y 10000"))
+		return
+	}
+	relPath, _, _, err := s3ObjectPath(c.bucket, c.key)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	upload, err := h.multipart.get(uploadID, c.bucket, c.key)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	body, size, expected, err := c.sig.body(c.r)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	if size < 0 {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusLengthRequired, "MissingContentLength", "Se requiere Content-Length"))
+		return
+	}
+
+	// La sesión lleva el destino final para que la auditoría muestre la ruta
+	dir, name := splitGatewayPath(relPath)
+	session, err := invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_InitiateUpload_FullMethodName,
+		&pb.InitiateUploadRequest{Filename: name, Directory: dir, TotalSize: size}, h.server.InitiateUpload)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	sum, err := uploadSessionParts(c.ctx, h.interceptors, h.server, session.SessionId, body, size)
+	if err == nil && expected != "" && sum != expected {
+		err = status.Errorf(codes.DataLoss, "El contenido no coincide con el SHA-256 indicado")
+	}
+	if err != nil {
+		h.abortSession(c, session.SessionId)
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+
+	upload.mu.Lock()
+	if upload.closed {
+		upload.mu.Unlock()
+		h.abortSession(c, session.SessionId)
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusNotFound, "NoSuchUpload", "La subida multipart no existe o expiró"))
+		return
+	}
+	// Volver a subir una parte la reemplaza
+	previous := upload.Parts[number]
+	upload.Parts[number] = &s3Part{SessionID: session.SessionId, Size: size, ETag: sum}
+	upload.Updated = time.Now()
+	err = h.multipart.save(upload)
+	upload.mu.Unlock()
+	if err != nil {
+		writeS3Error(c.w, c.r, status.Errorf(codes.Internal, "Error guardando la subida: %v", err))
+		return
+	}
+	if previous != nil {
+		h.abortSession(c, previous.SessionID)
+	}
+	c.w.Header().Set("ETag", s3ETag(sum))
+	c.w.WriteHeader(http.StatusOK)
+}
+
+type s3CompleteMultipartUpload struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type s3CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+// Une las partes indicadas en una sesión de subida nueva y la completa. Las partes se copian
+// en orden, así que el archivo final se verifica y publica igual que cualquier otra subida.
+func (h *s3Handler) completeMultipartUpload(c *s3Call, uploadID string) {
+	relPath, _, _, err := s3ObjectPath(c.bucket, c.key)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	upload, err := h.multipart.get(uploadID, c.bucket, c.key)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	body, _, expected, err := c.sig.body(c.r)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(body, s3MaxXMLBody))
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	if expected != "" && sha256Hex(data) != expected {
+		writeS3Error(c.w, c.r, status.Errorf(codes.DataLoss, "El contenido no coincide con el SHA-256 indicado"))
+		return
+	}
+	var request s3CompleteMultipartUpload
+	if err := xml.Unmarshal(data, &request); err != nil || len(request.Parts) == 0 {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusBadRequest, "MalformedXML", "La lista de partes es inválida"))
+		return
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if upload.closed {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusNotFound, "NoSuchUpload", "La subida multipart no existe o expiró"))
+		return
+	}
+	parts := make([]*s3Part, len(request.Parts))
+	var total int64
+	for i, requested := range request.Parts {
+		if i > 0 && requested.PartNumber <= request.Parts[i-1].PartNumber {
+			writeS3Error(c.w, c.r, s3ErrorOf(http.StatusBadRequest, "InvalidPartOrder", "Las partes deben estar en orden ascendente"))
+			return
+		}
+		part, ok := upload.Parts[requested.PartNumber]
+		if !ok || strings.Trim(requested.ETag, `"`) != part.ETag {
+			writeS3Error(c.w, c.r, s3ErrorOf(http.StatusBadRequest, "InvalidPart", "La parte "+strconv.Itoa(requested.PartNumber)+" no existe o su ETag no coincide"))
+			return
+		}
+		parts[i] = part
+		total += part.Size
+	}
+
+	dir, name := splitGatewayPath(relPath)
+	session, err := invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_InitiateUpload_FullMethodName,
+		&pb.InitiateUploadRequest{Filename: name, Directory: dir, TotalSize: total}, h.server.InitiateUpload)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	// Los bytes ya pasaron por los límites al subir cada parte: la copia llama directamente a UploadPart
+	hasher := sha256.New()
+	buf := make([]byte, gatewayPartSize)
+	var offset int64
+	for _, part := range parts {
+		err = h.server.readUploadData(part.SessionID, buf, func(chunk []byte) error {
+			hasher.Write(chunk)
+			_, err := h.server.UploadPart(c.ctx, &pb.UploadPartRequest{SessionId: session.SessionId, Offset: offset, Content: chunk})
+			offset += int64(len(chunk))
+			return err
+		})
+		if status.Code(err) == codes.NotFound {
+			err = s3ErrorOf(http.StatusBadRequest, "InvalidPart", "Una de las partes expiró")
+		}
+		if err != nil {
+			break
+		}
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if err == nil {
+		_, err = invokeUnary(c.ctx, h.interceptors, h.server, pb.FileSystemService_CompleteUpload_FullMethodName,
+			&pb.CompleteUploadRequest{SessionId: session.SessionId, ChecksumSha256: sum}, h.server.CompleteUpload)
+	}
+	if err != nil {
+		h.abortSession(c, session.SessionId)
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+
+	for _, part := range upload.Parts {
+		h.abortSession(c, part.SessionID)
+	}
+	h.multipart.remove(upload)
+	slog.InfoContext(c.ctx, "Subida multipart S3 completada", "upload_id", upload.ID, "path", relPath, "parts", len(parts), "size", total)
+	writeS3XML(c.w, http.StatusOK, s3CompleteMultipartUploadResult{
+		Xmlns:    s3XMLNamespace,
+		Location: "/" + c.bucket + "/" + c.key,
+		Bucket:   c.bucket,
+		Key:      c.key,
+		ETag:     s3ETag(sum),
+	})
+}
+
+func (h *s3Handler) abortMultipartUpload(c *s3Call, uploadID string) {
+	upload, err := h.multipart.get(uploadID, c.bucket, c.key)
+	if err != nil {
+		writeS3Error(c.w, c.r, err)
+		return
+	}
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if upload.closed {
+		writeS3Error(c.w, c.r, s3ErrorOf(http.StatusNotFound, "NoSuchUpload", "La subida multipart no existe o expiró"))
+		return
+	}
+	for _, part := range upload.Parts {
+		h.abortSession(c, part.SessionID)
+	}
+	h.multipart.remove(upload)
+	slog.InfoContext(c.ctx, "Subida multipart S3 cancelada", "upload_id", upload.ID)
+	c.w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Qué hacer con un archivo corrupto
+const (
+	// Se marca y se informa, pero se deja en su sitio
+	scrubActionFlag = "flag"
+	// Se mueve fuera del almacenamiento para que no se sirva
+	scrubActionQuarantine = "quarantine"
+)
+
+const (
+	defaultScrubInterval       = 24 * time.Hour
+	defaultScrubBytesPerSecond = 4 * 1024 * 1024
+	defaultQuarantineDirectory = "quarantine"
+	// Espera antes de confirmar una discrepancia, por si coincidió con una escritura
+	scrubConfirmDelay = time.Second
+)
+
+// Contadores publicados en /debug/vars
+var scrubMetrics = expvar.NewMap("scrub")
+
+// Verificación periódica de la integridad de los archivos guardados
+type scrubber struct {
+	enabled        bool
+	interval       time.Duration
+	bytesPerSecond int64
+	action         string
+	quarantineDir  string
+
+	mu            sync.Mutex
+	running       bool
+	passStarted   time.Time
+	passCompleted time.Time
+	passes        int64
+	// Progreso de la pasada actual o de la última
+	passFiles int64
+	passBytes int64
+	// Totales desde que arrancó el nodo
+	totalFiles int64
+	totalBytes int64
+}
+
+func newScrubber(cfg ScrubConfig) *scrubber {
+	return &scrubber{
+		enabled:        cfg.Enabled,
+		interval:       cfg.Interval,
+		bytesPerSecond: cfg.BytesPerSecond,
+		action:         cfg.Action,
+		quarantineDir:  cfg.QuarantineDirectory,
+	}
+}
+
+func (sc *scrubber) addProgress(files, bytes int64) {
+	sc.mu.Lock()
+	sc.passFiles += files
+	sc.passBytes += bytes
+	sc.totalFiles += files
+	sc.totalBytes += bytes
+	sc.mu.Unlock()
+	scrubMetrics.Add("files_scanned", files)
+	scrubMetrics.Add("bytes_scanned", bytes)
+}
+
+// Espera lo necesario para no superar el presupuesto de lectura
+func (sc *scrubber) throttle(bytes int64) {
+	if bytes > 0 {
+		time.Sleep(time.Duration(float64(bytes) / float64(sc.bytesPerSecond) * float64(time.Second)))
+	}
+}
+
+// Contenido que se lee respetando el presupuesto bloque a bloque, así un archivo grande no
+// se lee de golpe. Cada byte del contenido cuenta por lo que ocupa en disco (ratio).
+type throttledReaderAt struct {
+	io.ReaderAt
+	sc    *scrubber
+	ratio float64
+}
+
+func (r *throttledReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ReaderAt.ReadAt(p, off)
+	r.sc.throttle(int64(float64(n) * r.ratio))
+	return n, err
+}
+
+// Repite las pasadas de verificación sobre todo el almacenamiento
+func (s *Server) runScrubber() {
+	for {
+		s.scrubPass()
+		time.Sleep(s.scrub.interval)
+	}
+}
+
+func (s *Server) scrubPass() {
+	sc := s.scrub
+	sc.mu.Lock()
+	sc.running = true
+	sc.passStarted = time.Now()
+	sc.passFiles, sc.passBytes = 0, 0
+	sc.mu.Unlock()
+	slog.Info("Iniciando verificación de integridad del almacenamiento")
+
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(rootDirectory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || isStagingName(d.Name()) {
+			return nil
+		}
+		relPath, err := filepath.Rel(rootDirectory, path)
+		if err != nil {
+			return nil
+		}
+		key := indexKey(relPath)
+		seen[key] = true
+		s.scrubFile(path, key, true)
+		return nil
+	})
+	if err != nil {
+		slog.Error("Error recorriendo el almacenamiento durante la verificación", "error", err)
+	}
+	s.scrubMissing("", seen)
+
+	sc.mu.Lock()
+	sc.running = false
+	sc.passCompleted = time.Now()
+	sc.passes++
+	files, bytes := sc.passFiles, sc.passBytes
+	sc.mu.Unlock()
+	scrubMetrics.Add("passes", 1)
+	slog.Info("Verificación de integridad terminada", "files", files, "bytes", bytes, "corrupt", s.checksums.issueCount())
+}
+
+// Verifica un archivo contra su checksum registrado, con el presupuesto de lectura si throttled.
+// Devuelve los bytes leídos de disco y el problema encontrado, si lo hay.
+func (s *Server) scrubFile(filePath, key string, throttled bool) (int64, *scrubIssue) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		// Pudo borrarse mientras se recorría el árbol
+		return 0, nil
+	}
+	// Con una cabecera dañada se cuenta solo el archivo; la lectura de abajo fallará
+	physical := info.Size()
+	if stored, err := s.statStoredFile(filePath); err == nil {
+		physical = stored.physicalSize
+	}
+	before, recorded := s.checksums.get(key)
+	content, err := s.openStoredFile(filePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	var sum string
+	var size int64
+	if err == nil {
+		size = content.size
+		if throttled {
+			content.ReaderAt = &throttledReaderAt{ReaderAt: content.ReaderAt, sc: s.scrub, ratio: float64(physical) / float64(max(size, 1))}
+		}
+		sum, err = content.hash()
+		content.Close()
+	}
+	s.scrub.addProgress(1, physical)
+	if err != nil {
+		return physical, s.handleCorruptFile(filePath, scrubIssue{
+			Path:     key,
+			Reason:   fmt.Sprintf("No se pudo leer el contenido: %v", err),
+			Expected: before.Checksum,
+		})
+	}
+
+	if !recorded {
+		// Archivos que no están en el catálogo, como los escritos por fuera del servidor: se adopta su checksum
+		s.recordChecksum(filePath, sum, size)
+		slog.Info("Checksum registrado por primera vez", "path", key)
+		return physical, nil
+	}
+	if sum == before.Checksum {
+		s.checksums.clear(key)
+		return physical, nil
+	}
+
+	// Una escritura puede haber reemplazado el archivo justo antes de registrar su checksum
+	time.Sleep(scrubConfirmDelay)
+	if after, ok := s.checksums.get(key); !ok || after != before {
+		return physical, nil
+	}
+	return physical, s.handleCorruptFile(filePath, scrubIssue{
+		Path:     key,
+		Reason:   "El contenido no coincide con el checksum registrado",
+		Expected: before.Checksum,
+		Actual:   sum,
+	})
+}
+
+// Marca como faltantes los archivos registrados bajo dir que ya no están en disco
+func (s *Server) scrubMissing(dir string, seen map[string]bool) []scrubIssue {
+	var issues []scrubIssue
+	for _, key := range s.checksums.keysUnder(dir) {
+		if seen[key] {
+			continue
+		}
+		filePath := filepath.Join(rootDirectory, filepath.FromSlash(key))
+		if _, err := os.Lstat(filePath); !os.IsNotExist(err) {
+			// Se creó después de recorrer su directorio
+			continue
+		}
+		record, _ := s.checksums.get(key)
+		s.checksums.remove(key)
+		issue := scrubIssue{Path: key, Reason: "El archivo ya no existe en disco", Expected: record.Checksum, Detected: time.Now()}
+		s.checksums.flag(issue)
+		scrubMetrics.Add("corrupt_files", 1)
+		slog.Warn("Archivo registrado no encontrado en disco", "path", key)
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// Marca un archivo corrupto y, si así se configuró, lo mueve a cuarentena
+func (s *Server) handleCorruptFile(filePath string, issue scrubIssue) *scrubIssue {
+	issue.Detected = time.Now()
+	slog.Error("Archivo corrupto", "path", issue.Path, "reason", issue.Reason)
+	scrubMetrics.Add("corrupt_files", 1)
+
+	if s.scrub.action == scrubActionQuarantine {
+		target := filepath.Join(s.scrub.quarantineDir, filepath.FromSlash(issue.Path)+"."+strconv.FormatInt(issue.Detected.UnixNano(), 10))
+		blobRefs := s.blobRefsUnder(filePath)
+		err := os.MkdirAll(filepath.Dir(target), os.ModePerm)
+		if err == nil {
+			err = os.Rename(filePath, target)
+		}
+		if err != nil {
+			slog.Error("No se pudo mover a cuarentena", "path", issue.Path, "error", err)
+		} else {
+			issue.Quarantine = target
+			s.releaseMissingBlobRefs(blobRefs)
+			s.checksums.remove(issue.Path)
+			s.publishEvent(eventDeleted, issue.Path, "", false, 0)
+			if s.index != nil {
+				s.index.remove(issue.Path)
+			}
+			slog.Warn("Archivo movido a cuarentena", "path", issue.Path, "quarantine", target)
+		}
+	}
+	s.checksums.flag(issue)
+	return &issue
+}
+
+func scrubIssueToProto(issue scrubIssue) *pb.ScrubIssue {
+	return &pb.ScrubIssue{
+		Path:           issue.Path,
+		Reason:         issue.Reason,
+		ExpectedSha256: issue.Expected,
+		ActualSha256:   issue.Actual,
+		DetectedAt:     issue.Detected.Unix(),
+		QuarantinePath: issue.Quarantine,
+	}
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Estado de la verificación de integridad en segundo plano y archivos marcados como corruptos
+func (s *Server) ScrubStatus(ctx context.Context, req *pb.ScrubStatusRequest) (*pb.ScrubStatusResponse, error) {
+	sc := s.scrub
+	sc.mu.Lock()
+	resp := &pb.ScrubStatusResponse{
+		Enabled:           sc.enabled,
+		Running:           sc.running,
+		Action:            sc.action,
+		BytesPerSecond:    sc.bytesPerSecond,
+		IntervalSeconds:   int64(sc.interval / time.Second),
+		LastPassStarted:   unixOrZero(sc.passStarted),
+		LastPassCompleted: unixOrZero(sc.passCompleted),
+		PassesCompleted:   sc.passes,
+		PassFiles:         sc.passFiles,
+		PassBytes:         sc.passBytes,
+		FilesScanned:      sc.totalFiles,
+		BytesScanned:      sc.totalBytes,
+	}
+	sc.mu.Unlock()
+
+	for _, issue := range s.checksums.issueList() {
+		resp.Issues = append(resp.Issues, scrubIssueToProto(issue))
+	}
+	resp.CorruptFiles = int64(len(resp.Issues))
+	return resp, nil
+}
+
+// Verifica en el momento un archivo o un directorio completo, sin límite de lectura
+func (s *Server) ScrubPath(ctx context.Context, req *pb.ScrubPathRequest) (*pb.ScrubPathResponse, error) {
+	fullPath, err := resolveStoragePath(req.Path)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	dir := indexKey(req.Path)
+	if _, err := os.Stat(fullPath); err != nil && !os.IsNotExist(err) {
+		return nil, status.Errorf(codes.Internal, "Error al obtener información de la ruta: %v", err)
+	}
+
+	resp := &pb.ScrubPathResponse{}
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(fullPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !d.Type().IsRegular() || isStagingName(d.Name()) {
+			return nil
+		}
+		relPath, err := filepath.Rel(rootDirectory, path)
+		if err != nil {
+			return nil
+		}
+		key := indexKey(relPath)
+		seen[key] = true
+		read, issue := s.scrubFile(path, key, false)
+		resp.FilesScanned++
+		resp.BytesScanned += read
+		if issue != nil {
+			resp.Issues = append(resp.Issues, scrubIssueToProto(*issue))
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, status.Errorf(codes.Internal, "Error recorriendo la ruta: %v", err)
+	}
+	for _, issue := range s.scrubMissing(dir, seen) {
+		resp.Issues = append(resp.Issues, scrubIssueToProto(issue))
+	}
+	return resp, nil
+}
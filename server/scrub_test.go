@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+)
+
+// Invierte el último byte de un archivo en disco
+func corruptFile(t *testing.T, filePath string) {
+	t.Helper()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func scrubPath(t *testing.T, s *Server, path string) *pb.ScrubPathResponse {
+	t.Helper()
+	resp, err := s.ScrubPath(context.Background(), &pb.ScrubPathRequest{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// Sin cifrar, la corrupción se detecta al comparar el checksum; cifrado, al leer
+var scrubVariants = map[string]func(*Config){
+	"plain":     nil,
+	"encrypted": storageVariants["encrypted"],
+}
+
+func TestScrubFlag(t *testing.T) {
+	for name, configure := range scrubVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			data := textBytes(3 * defaultSegmentSize)
+			uploadBase64(t, s, "a.txt", data)
+			uploadBase64(t, s, "b.txt", []byte("sano"))
+
+			if resp := scrubPath(t, s, ""); resp.FilesScanned != 2 || len(resp.Issues) != 0 {
+				t.Fatalf("verificación sin corrupción: %d archivos, %d problemas", resp.FilesScanned, len(resp.Issues))
+			}
+			filePath := filepath.Join(rootDirectory, "a.txt")
+			corruptFile(t, filePath)
+
+			resp := scrubPath(t, s, "")
+			if len(resp.Issues) != 1 || resp.Issues[0].Path != "a.txt" || resp.Issues[0].ExpectedSha256 != contentHash(data) {
+				t.Fatalf("problemas inesperados: %v", resp.Issues)
+			}
+			if resp.Issues[0].QuarantinePath != "" {
+				t.Fatal("con flag el archivo se movió a cuarentena")
+			}
+			if _, err := os.Stat(filePath); err != nil {
+				t.Fatalf("con flag el archivo debe quedar en su sitio: %v", err)
+			}
+			status, err := s.ScrubStatus(context.Background(), &pb.ScrubStatusRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.CorruptFiles != 1 || status.Issues[0].Path != "a.txt" {
+				t.Fatalf("el estado no informa el archivo corrupto: %v", status.Issues)
+			}
+		})
+	}
+}
+
+func TestScrubQuarantine(t *testing.T) {
+	for name, configure := range scrubVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				if configure != nil {
+					configure(c)
+				}
+				c.Scrub.Action = scrubActionQuarantine
+			})
+			os.MkdirAll(filepath.Join(rootDirectory, "dir"), 0755)
+			uploadBase64(t, s, "dir/a.txt", textBytes(1000))
+			filePath := filepath.Join(rootDirectory, "dir", "a.txt")
+			corruptFile(t, filePath)
+
+			resp := scrubPath(t, s, "dir")
+			if len(resp.Issues) != 1 {
+				t.Fatalf("se esperaba un problema, se obtuvo %v", resp.Issues)
+			}
+			quarantine := resp.Issues[0].QuarantinePath
+			if !strings.HasPrefix(quarantine, s.scrub.quarantineDir) {
+				t.Fatalf("el archivo no se movió a cuarentena: %q", quarantine)
+			}
+			if _, err := os.Stat(quarantine); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+				t.Fatalf("el archivo corrupto sigue en el almacenamiento: %v", err)
+			}
+			// Ya no está registrado, así que no se informa además como faltante
+			if _, recorded := s.checksums.get("dir/a.txt"); recorded {
+				t.Fatal("el checksum del archivo en cuarentena sigue registrado")
+			}
+			if resp := scrubPath(t, s, ""); len(resp.Issues) != 0 {
+				t.Fatalf("problemas inesperados tras la cuarentena: %v", resp.Issues)
+			}
+		})
+	}
+}
+
+func TestScrubMissing(t *testing.T) {
+	s := newTestServer(t, nil)
+	data := []byte("hola")
+	for _, dir := range []string{"dir", "otro"} {
+		os.MkdirAll(filepath.Join(rootDirectory, dir), 0755)
+	}
+	uploadBase64(t, s, "dir/a.txt", data)
+	uploadBase64(t, s, "otro/b.txt", data)
+	if err := os.Remove(filepath.Join(rootDirectory, "dir", "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fuera del directorio verificado no se informa
+	if resp := scrubPath(t, s, "otro"); len(resp.Issues) != 0 {
+		t.Fatalf("problemas inesperados: %v", resp.Issues)
+	}
+	resp := scrubPath(t, s, "dir")
+	if len(resp.Issues) != 1 || resp.Issues[0].Path != "dir/a.txt" || resp.Issues[0].ExpectedSha256 != contentHash(data) {
+		t.Fatalf("no se informó el archivo faltante: %v", resp.Issues)
+	}
+	// Se informa una sola vez
+	if resp := scrubPath(t, s, "dir"); len(resp.Issues) != 0 {
+		t.Fatalf("el archivo faltante se informó de nuevo: %v", resp.Issues)
+	}
+}
+
+func TestScrubUnrecorded(t *testing.T) {
+	s := newTestServer(t, nil)
+	data := []byte("escrito por fuera del servidor")
+	if err := os.WriteFile(filepath.Join(rootDirectory, "a.txt"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if resp := scrubPath(t, s, ""); len(resp.Issues) != 0 {
+		t.Fatalf("problemas inesperados: %v", resp.Issues)
+	}
+	if record, recorded := s.checksums.get("a.txt"); !recorded || record.Checksum != contentHash(data) {
+		t.Fatal("no se adoptó el checksum del archivo")
+	}
+}
+
+func TestScrubThrottle(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.Scrub.BytesPerSecond = 1 << 20 })
+	data := randomBytes(t, 256*1024)
+	uploadBase64(t, s, "a.bin", data)
+
+	// La pasada lee el archivo a 1 MiB/s; ScrubPath no tiene límite
+	filePath := filepath.Join(rootDirectory, "a.bin")
+	start := time.Now()
+	if read, issue := s.scrubFile(filePath, "a.bin", true); read != int64(len(data)) || issue != nil {
+		t.Fatalf("verificación: %d bytes, %v", read, issue)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("la verificación tardó %s, menos de lo que permite el presupuesto", elapsed)
+	}
+	start = time.Now()
+	scrubPath(t, s, "a.bin")
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("ScrubPath tardó %s", elapsed)
+	}
+}
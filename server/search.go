@@ -0,0 +1,450 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Archivos más grandes que esto no se indexan
+	maxIndexedFileSize = 10 * 1024 * 1024
+	defaultSearchLimit = 20
+	maxSearchLimit     = 200
+	// Caracteres de contexto alrededor de cada coincidencia en los snippets
+	snippetRadius        = 60
+	maxSnippetsPerResult = 3
+	minTokenLength       = 2
+	maxTokenLength       = 64
+	// Parámetros de BM25
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Tipos MIME que se consideran texto indexable además de text/x-*
+var indexableMimeTypes = map[string]bool{
+	"text/plain":                true,
+	"text/markdown":             true,
+	"text/x-markdown":           true,
+	"text/csv":                  true,
+	"application/json":          true,
+	"application/javascript":    true,
+	"text/javascript":           true,
+	"application/typescript":    true,
+	"application/x-sh":          true,
+	"application/x-python":      true,
+	"application/x-httpd-php":   true,
+	"application/x-ruby":        true,
+	"application/sql":           true,
+	"application/xml":           true,
+	"text/xml":                  true,
+	"application/x-yaml":        true,
+	"application/yaml":          true,
+	"application/toml":          true,
+	"application/x-perl":        true,
+	"application/x-java-source": true,
+}
+
+func isIndexableMimeType(mimeType string) bool {
+	base := strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	return indexableMimeTypes[base] || strings.HasPrefix(base, "text/x-")
+}
+
+// Documento indexado: solo sus términos. Los snippets se generan leyendo el archivo al buscar.
+type indexedDocument struct {
+	terms  map[string]int // término -> frecuencia
+	length int
+}
+
+// Índice invertido en memoria con los términos de los archivos de texto
+type searchIndex struct {
+	// Directorio raíz y lectura del contenido original de sus archivos
+	root     string
+	readFile func(string) ([]byte, error)
+
+	mu       sync.RWMutex
+	docs     map[string]*indexedDocument
+	postings map[string]map[string]int // término -> ruta -> frecuencia
+	totalLen int
+	// Rutas que cambiaron durante una reconstrucción, que no debe pisarlas con lo que leyó antes
+	rebuilding bool
+	touched    []string
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+func newSearchIndex(root string, readFile func(string) ([]byte, error)) *searchIndex {
+	return &searchIndex{
+		root:     root,
+		readFile: readFile,
+		docs:     make(map[string]*indexedDocument),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// Normaliza una ruta relativa al directorio raíz para usarla como clave
+func indexKey(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+path)), "/")
+}
+
+// Separa el texto en términos en minúsculas junto con su posición en bytes
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = appendToken(tokens, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = appendToken(tokens, text, start, len(text))
+	}
+	return tokens
+}
+
+func appendToken(tokens []token, text string, start, end int) []token {
+	n := utf8.RuneCountInString(text[start:end])
+	if n < minTokenLength || n > maxTokenLength {
+		return tokens
+	}
+	return append(tokens, token{term: strings.ToLower(text[start:end]), start: start, end: end})
+}
+
+// Como update, leyendo el contenido solo si es lo bastante pequeño para indexarlo
+func (idx *searchIndex) updateFrom(path string, content *storedContent, mimeType string) {
+	if !isIndexableMimeType(mimeType) || content.size > maxIndexedFileSize {
+		idx.remove(path)
+		return
+	}
+	data := make([]byte, content.size)
+	if err := readFullAt(content, data, 0); err != nil {
+		idx.remove(path)
+		return
+	}
+	idx.update(path, data, mimeType)
+}
+
+// Términos de un archivo, o nil si no es texto indexable
+func analyze(data []byte, mimeType string) *indexedDocument {
+	if !isIndexableMimeType(mimeType) || len(data) > maxIndexedFileSize || !utf8.Valid(data) {
+		return nil
+	}
+	tokens := tokenize(string(data))
+	doc := &indexedDocument{terms: make(map[string]int), length: len(tokens)}
+	for _, t := range tokens {
+		doc.terms[t.term]++
+	}
+	return doc
+}
+
+// Indexa (o reindexa) un archivo. Si no es texto indexable se quita del índice.
+func (idx *searchIndex) update(path string, data []byte, mimeType string) {
+	key := indexKey(path)
+	doc := analyze(data, mimeType)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.touchLocked(key)
+	idx.removeLocked(key)
+	if doc != nil {
+		idx.insertLocked(key, doc)
+	}
+}
+
+// Quita un archivo, o todo lo que esté debajo si la ruta es un directorio
+func (idx *searchIndex) remove(path string) {
+	key := indexKey(path)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.touchLocked(key)
+	for docKey := range idx.docs {
+		if isUnderPath(docKey, key) {
+			idx.removeLocked(docKey)
+		}
+	}
+}
+
+func (idx *searchIndex) touchLocked(key string) {
+	if idx.rebuilding {
+		idx.touched = append(idx.touched, key)
+	}
+}
+
+func (idx *searchIndex) insertLocked(key string, doc *indexedDocument) {
+	idx.docs[key] = doc
+	idx.totalLen += doc.length
+	for term, freq := range doc.terms {
+		docs := idx.postings[term]
+		if docs == nil {
+			docs = make(map[string]int)
+			idx.postings[term] = docs
+		}
+		docs[key] = freq
+	}
+}
+
+func (idx *searchIndex) removeLocked(key string) {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		if docs := idx.postings[term]; docs != nil {
+			delete(docs, key)
+			if len(docs) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+	}
+	idx.totalLen -= doc.length
+	delete(idx.docs, key)
+}
+
+// Actualiza las rutas tras mover o renombrar un archivo o directorio
+func (idx *searchIndex) rename(oldPath, newPath string) {
+	oldKey, newKey := indexKey(oldPath), indexKey(newPath)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.touchLocked(oldKey)
+	idx.touchLocked(newKey)
+
+	moved := make(map[string]string)
+	for docKey := range idx.docs {
+		if isUnderPath(docKey, oldKey) {
+			moved[docKey] = newKey + strings.TrimPrefix(docKey, oldKey)
+		}
+	}
+	for from, to := range moved {
+		// Si el destino ya estaba indexado se sobrescribe, igual que en disco
+		idx.removeLocked(to)
+		doc := idx.docs[from]
+		idx.removeLocked(from)
+		idx.insertLocked(to, doc)
+	}
+}
+
+// Indica si key es la ruta dir o está contenida en ella
+func isUnderPath(key, dir string) bool {
+	if dir == "" || dir == "." {
+		return true
+	}
+	return key == dir || strings.HasPrefix(key, dir+"/")
+}
+
+// Recorre el directorio raíz e indexa todos los archivos de texto existentes. Corre a la par de
+// las escrituras: los archivos modificados después de empezar, y las rutas que cambian mientras
+// se leen, quedan como las dejaron esas escrituras.
+func (idx *searchIndex) rebuild() {
+	snapshot := time.Now()
+	idx.mu.Lock()
+	idx.rebuilding, idx.touched = true, nil
+	idx.mu.Unlock()
+	defer func() {
+		idx.mu.Lock()
+		idx.rebuilding, idx.touched = false, nil
+		idx.mu.Unlock()
+	}()
+
+	count := 0
+	err := filepath.WalkDir(idx.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || isStagingName(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(snapshot) {
+			return nil
+		}
+		data, err := idx.readFile(path)
+		if err != nil || len(data) > maxIndexedFileSize {
+			return nil
+		}
+		rel, err := filepath.Rel(idx.root, path)
+		if err != nil {
+			return nil
+		}
+		if doc := analyze(data, detectMimeType(path, data)); doc != nil && idx.rebuildInsert(indexKey(rel), doc) {
+			count++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		slog.Error("Error reconstruyendo el índice de búsqueda", "error", err)
+		return
+	}
+	slog.Info("Índice de búsqueda reconstruido", "indexed_files", count)
+}
+
+// Agrega un documento leído por la reconstrucción, salvo que su ruta haya cambiado desde entonces
+func (idx *searchIndex) rebuildInsert(key string, doc *indexedDocument) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, touched := range idx.touched {
+		if isUnderPath(key, touched) {
+			return false
+		}
+	}
+	idx.removeLocked(key)
+	idx.insertLocked(key, doc)
+	return true
+}
+
+type searchHit struct {
+	path  string
+	score float64
+}
+
+// Busca los términos de la consulta y devuelve los resultados ordenados por BM25, con snippets
+// del contenido actual de cada archivo
+func (idx *searchIndex) search(query, prefix string, limit int) []*pb.SearchResult {
+	terms := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		terms[t.term] = true
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	hits := idx.rank(terms, indexKey(prefix), limit)
+	results := make([]*pb.SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		result := &pb.SearchResult{Path: hit.path, Score: hit.score}
+		// El archivo pudo cambiar o borrarse después de indexarlo: sin texto no hay snippets
+		data, err := idx.readFile(filepath.Join(idx.root, filepath.FromSlash(hit.path)))
+		if err == nil && len(data) <= maxIndexedFileSize && utf8.Valid(data) {
+			result.Snippets = buildSnippets(string(data), terms)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Rutas con mayor puntuación BM25 para los términos, hasta limit
+func (idx *searchIndex) rank(terms map[string]bool, prefixKey string, limit int) []searchHit {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.docs))
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(idx.totalLen) / n
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	scores := make(map[string]float64)
+	for term := range terms {
+		docs := idx.postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for key, freq := range docs {
+			if !isUnderPath(key, prefixKey) {
+				continue
+			}
+			tf := float64(freq)
+			docLen := float64(idx.docs[key].length)
+			scores[key] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+		}
+	}
+
+	hits := make([]searchHit, 0, len(scores))
+	for key, score := range scores {
+		hits = append(hits, searchHit{path: key, score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].path < hits[j].path
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// Genera fragmentos del texto alrededor de las coincidencias, marcando cada término encontrado
+func buildSnippets(content string, terms map[string]bool) []*pb.SearchSnippet {
+	var matches []token
+	for _, t := range tokenize(content) {
+		if terms[t.term] {
+			matches = append(matches, t)
+		}
+	}
+
+	var snippets []*pb.SearchSnippet
+	for i := 0; i < len(matches) && len(snippets) < maxSnippetsPerResult; {
+		start := runeStart(content, matches[i].start-snippetRadius)
+		end := runeStart(content, matches[i].end+snippetRadius)
+
+		snippet := &pb.SearchSnippet{Text: content[start:end]}
+		for ; i < len(matches) && matches[i].end <= end; i++ {
+			snippet.Highlights = append(snippet.Highlights, &pb.SearchHighlight{
+				Start: int32(matches[i].start - start),
+				End:   int32(matches[i].end - start),
+			})
+		}
+		snippets = append(snippets, snippet)
+	}
+	return snippets
+}
+
+// Ajusta un offset a los límites del texto y al inicio de un carácter UTF-8
+func runeStart(content string, offset int) int {
+	if offset <= 0 {
+		return 0
+	}
+	if offset >= len(content) {
+		return len(content)
+	}
+	for offset > 0 && !utf8.RuneStart(content[offset]) {
+		offset--
+	}
+	return offset
+}
+
+// Busca archivos de texto por su contenido
+func (s *Server) SearchContent(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResponse, error) {
+	if s.index == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "La búsqueda por contenido no está habilitada en este nodo")
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "La consulta no puede estar vacía")
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	return &pb.SearchResponse{Results: s.index.search(req.Query, req.Path, limit)}, nil
+}
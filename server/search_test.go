@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+)
+
+// Índice sobre un directorio temporal con los archivos indicados
+func newTestIndex(t *testing.T, files map[string]string) (*searchIndex, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, text := range files {
+		writeIndexedFile(t, root, name, text)
+	}
+	return newSearchIndex(root, os.ReadFile), root
+}
+
+func writeIndexedFile(t *testing.T, root, name, text string) {
+	t.Helper()
+	filePath := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func resultPaths(results []*pb.SearchResult) []string {
+	paths := make([]string, len(results))
+	for i, r := range results {
+		paths[i] = r.Path
+	}
+	return paths
+}
+
+func assertResults(t *testing.T, idx *searchIndex, query, prefix string, want ...string) []*pb.SearchResult {
+	t.Helper()
+	results := idx.search(query, prefix, defaultSearchLimit)
+	got := resultPaths(results)
+	if len(got) != len(want) {
+		t.Fatalf("%q en %q: %v, se esperaba %v", query, prefix, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%q en %q: %v, se esperaba %v", query, prefix, got, want)
+		}
+	}
+	return results
+}
+
+func TestSearchIndex(t *testing.T) {
+	files := map[string]string{
+		"notas/a.txt":  "El zorro marrón salta sobre el perro. Zorro, zorro.",
+		"notas/b.txt":  "Un perro duerme. El zorro mira.",
+		"docs/c.md":    "Nada que ver con animales.",
+		"imagen.png":   "zorro",
+		"binario.txt":  "zorro \xff\xfe",
+		"otros/d.json": `{"animal": "zorro", "descripcion": "de cola larga, vive en el bosque y en la ciudad"}`,
+	}
+	idx, root := newTestIndex(t, files)
+	for name, text := range files {
+		idx.update(name, []byte(text), detectMimeType(name, []byte(text)))
+	}
+
+	// Ordenado por BM25: más apariciones en un documento de largo similar puntúa más
+	results := assertResults(t, idx, "ZORRO", "", "notas/a.txt", "notas/b.txt", "otros/d.json")
+	assertResults(t, idx, "zorro", "notas", "notas/a.txt", "notas/b.txt")
+	assertResults(t, idx, "perro duerme", "", "notas/b.txt", "notas/a.txt")
+	assertResults(t, idx, "gato", "")
+
+	// Los snippets marcan cada aparición del término en el texto
+	snippet := results[0].Snippets[0]
+	for _, h := range snippet.Highlights {
+		if word := snippet.Text[h.Start:h.End]; word != "zorro" && word != "Zorro" {
+			t.Fatalf("se marcó %q", word)
+		}
+	}
+	if len(snippet.Highlights) != 3 {
+		t.Fatalf("%d apariciones marcadas, se esperaban 3", len(snippet.Highlights))
+	}
+
+	// Los snippets salen del contenido actual; si ya no es texto no hay snippets
+	writeIndexedFile(t, root, "notas/b.txt", "\xff")
+	if results := assertResults(t, idx, "duerme", "", "notas/b.txt"); len(results[0].Snippets) != 0 {
+		t.Fatal("se generaron snippets de un archivo que ya no es texto")
+	}
+
+	idx.rename("notas", "archivo")
+	assertResults(t, idx, "zorro", "notas")
+	assertResults(t, idx, "zorro", "archivo", "archivo/a.txt", "archivo/b.txt")
+	idx.update("archivo/a.txt", []byte("ahora habla de gatos"), "text/plain")
+	assertResults(t, idx, "zorro", "", "archivo/b.txt", "otros/d.json")
+	assertResults(t, idx, "gatos", "", "archivo/a.txt")
+	idx.remove("archivo")
+	assertResults(t, idx, "zorro", "", "otros/d.json")
+
+	// No quedan términos de los documentos que se quitaron
+	idx.remove("otros/d.json")
+	idx.remove("docs")
+	if len(idx.docs) != 0 || len(idx.postings) != 0 || idx.totalLen != 0 {
+		t.Fatalf("quedaron %d documentos, %d términos y largo %d", len(idx.docs), len(idx.postings), idx.totalLen)
+	}
+}
+
+func TestSearchIndexRebuild(t *testing.T) {
+	idx, root := newTestIndex(t, map[string]string{
+		"a.txt":          "versión vieja",
+		"b.txt":          "borrado durante la reconstrucción",
+		"dir/c.txt":      "movido durante la reconstrucción",
+		"d.txt":          "sin cambios",
+		"futuro.txt":     "modificado después de empezar",
+		".e.txt-1234567": "temporal de una escritura",
+	})
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "futuro.txt"), future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	// Las escrituras llegan mientras la reconstrucción lee cada archivo
+	idx.readFile = func(filePath string) ([]byte, error) {
+		data, err := os.ReadFile(filePath)
+		switch filepath.Base(filePath) {
+		case "a.txt":
+			idx.update("a.txt", []byte("versión nueva"), "text/plain")
+		case "b.txt":
+			idx.remove("b.txt")
+		case "c.txt":
+			idx.rename("dir", "otro")
+		case "futuro.txt":
+			t.Error("se leyó un archivo modificado después de empezar la reconstrucción")
+		}
+		return data, err
+	}
+	idx.rebuild()
+
+	assertResults(t, idx, "nueva", "", "a.txt")
+	assertResults(t, idx, "vieja", "")
+	assertResults(t, idx, "borrado", "")
+	assertResults(t, idx, "movido", "")
+	assertResults(t, idx, "cambios", "", "d.txt")
+	assertResults(t, idx, "temporal", "")
+	if idx.rebuilding || idx.touched != nil {
+		t.Fatal("la reconstrucción no terminó")
+	}
+	// Terminada la reconstrucción, las escrituras ya no se registran
+	idx.update("d.txt", []byte("otra cosa"), "text/plain")
+	if idx.touched != nil {
+		t.Fatal("se registró una escritura fuera de la reconstrucción")
+	}
+}
+
+func TestSearchContent(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.Storage.SearchIndex = true
+		c.Encryption.MasterKey = testMasterKey
+	})
+	uploadBase64(t, s, "a.txt", []byte("El índice guarda términos, no contenido"))
+	resp, err := s.SearchContent(context.Background(), &pb.SearchRequest{Query: "TÉRMINOS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Path != "a.txt" || len(resp.Results[0].Snippets) != 1 {
+		t.Fatalf("resultados inesperados: %v", resp.Results)
+	}
+	if text := resp.Results[0].Snippets[0].Text; text != "El índice guarda términos, no contenido" {
+		t.Fatalf("snippet %q", text)
+	}
+}
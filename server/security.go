@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationKey   = "authorization"
+	bearerPrefix       = "Bearer "
+	minAuthTokenLength = 16
+)
+
+// Tokens y certificado en uso. Se reemplazan completos al recargar la configuración.
+type securityState struct {
+	tokens atomic.Pointer[[]string]
+	cert   atomic.Pointer[tls.Certificate]
+	// Clave de las URLs firmadas, vacía si no se configuró
+	urlKey atomic.Pointer[[]byte]
+	// Claves secretas de la API S3, por access key
+	s3Keys atomic.Pointer[map[string]string]
+	// CA con la que se verifican los demás nodos, nil para usar las del sistema
+	peerCAs *x509.CertPool
+	tls     bool
+}
+
+func newSecurityState(cfg SecurityConfig) (*securityState, error) {
+	sec := &securityState{tls: cfg.TLSCertFile != ""}
+	sec.setTokens(cfg.AuthTokens)
+	sec.setURLSigningKey(cfg.URLSigningKey)
+	if sec.tls {
+		cert, err := loadCertificate(cfg)
+		if err != nil {
+			return nil, err
+		}
+		sec.cert.Store(cert)
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("no se pudo leer la CA: %w", err)
+		}
+		sec.peerCAs = x509.NewCertPool()
+		if !sec.peerCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s no contiene certificados válidos", cfg.TLSCAFile)
+		}
+	}
+	return sec, nil
+}
+
+func loadCertificate(cfg SecurityConfig) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo cargar el certificado TLS: %w", err)
+	}
+	return &cert, nil
+}
+
+func (sec *securityState) setTokens(tokens []string) {
+	copied := append([]string(nil), tokens...)
+	sec.tokens.Store(&copied)
+}
+
+// Recibe los pares access_key:secret_key ya validados
+func (sec *securityState) setS3Keys(pairs []string) {
+	keys := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		accessKey, secret, _ := strings.Cut(pair, ":")
+		keys[accessKey] = secret
+	}
+	sec.s3Keys.Store(&keys)
+}
+
+func (sec *securityState) setURLSigningKey(key string) {
+	b := []byte(key)
+	sec.urlKey.Store(&b)
+}
+
+// Indica si el token es uno de los configurados. Sin tokens configurados se acepta cualquier llamada.
+func (sec *securityState) authorize(token string) bool {
+	tokens := *sec.tokens.Load()
+	if len(tokens) == 0 {
+		return true
+	}
+	valid := false
+	for _, t := range tokens {
+		// Se comparan todos para no revelar cuál coincidió por el tiempo de respuesta
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// Token con el que este nodo se presenta ante los demás: el primero de los configurados
+func (sec *securityState) peerToken() string {
+	if tokens := *sec.tokens.Load(); len(tokens) > 0 {
+		return tokens[0]
+	}
+	return ""
+}
+
+// Configuración TLS de los servidores del nodo, o nil si no se usa TLS. El certificado se toma
+// en cada conexión, así que uno nuevo se aplica sin reiniciar.
+func (s *Server) TLSConfig() *tls.Config {
+	if !s.security.tls {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.security.cert.Load(), nil
+		},
+	}
+}
+
+// Credenciales del servidor gRPC, o nil si no se usa TLS
+func (s *Server) TransportCredentials() credentials.TransportCredentials {
+	if !s.security.tls {
+		return nil
+	}
+	return credentials.NewTLS(s.TLSConfig())
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(authorizationKey)
+	if len(values) == 0 || !strings.HasPrefix(values[0], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(values[0], bearerPrefix)
+}
+
+type preauthorizedContextKey struct{}
+
+// Marca una petición HTTP que ya se autorizó por otro medio (URL firmada, firma S3).
+// Solo los servidores HTTP del nodo crean este contexto, así que las llamadas gRPC no pueden usarlo.
+func withPreauthorized(ctx context.Context) context.Context {
+	return context.WithValue(ctx, preauthorizedContextKey{}, true)
+}
+
+func isPreauthorized(ctx context.Context) bool {
+	ok, _ := ctx.Value(preauthorizedContextKey{}).(bool)
+	return ok
+}
+
+type principalContextKey struct{}
+
+// Guarda el principal que ya autenticó un servidor HTTP del nodo (la access key de S3)
+func withPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// Principal autenticado de una llamada: "s3:" y la access key que firmó la petición, o "token:"
+// y el principio del SHA-256 del token Bearer, que no se expone. Vacío si la llamada no trae una
+// credencial propia: sin tokens configurados o con una URL firmada. Los metadatos que declara el
+// cliente, como x-caller-id, nunca cuentan.
+func (s *Server) callerPrincipal(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalContextKey{}).(string); ok {
+		return principal
+	}
+	// El token de una petición preautorizada no se verificó
+	if isPreauthorized(ctx) {
+		return ""
+	}
+	token := bearerToken(ctx)
+	if token == "" || len(*s.security.tokens.Load()) == 0 || !s.security.authorize(token) {
+		return ""
+	}
+	return tokenPrincipal(token)
+}
+
+func tokenPrincipal(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:6])
+}
+
+func (s *Server) authenticate(ctx context.Context) error {
+	if isPreauthorized(ctx) {
+		return nil
+	}
+	if !s.security.authorize(bearerToken(ctx)) {
+		return status.Errorf(codes.Unauthenticated, "Token de autenticación ausente o inválido")
+	}
+	return nil
+}
+
+// Interceptor que exige un token válido en las llamadas unarias, si hay tokens configurados
+func (s *Server) AuthUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := s.authenticate(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Interceptor que exige un token válido en las llamadas con streaming
+func (s *Server) AuthStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := s.authenticate(ss.Context()); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// Agrega el token del nodo a las llamadas salientes
+type peerTokenCredentials struct {
+	security *securityState
+}
+
+func (c peerTokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token := c.security.peerToken()
+	if token == "" {
+		return nil, nil
+	}
+	return map[string]string{authorizationKey: bearerPrefix + token}, nil
+}
+
+func (c peerTokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// Abre una conexión con otro nodo que ejecuta FileSystemService, con TLS si este nodo lo usa
+func (s *Server) dialPeer(address string) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if s.security.tls {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: s.security.peerCAs})
+	}
+	return grpc.NewClient(address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithPerRPCCredentials(peerTokenCredentials{s.security}),
+		grpc.WithUnaryInterceptor(tracingUnaryClientInterceptor),
+		grpc.WithStreamInterceptor(tracingStreamClientInterceptor))
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Formato segmentado del contenido almacenado. El contenido original se divide en segmentos de
+// SegmentSize bytes que se comprimen y cifran por separado. Tras la cabecera va un índice con la
+// longitud en disco de cada segmento (uint32 big endian, con segmentCompressed si se guardó
+// comprimido) y después los segmentos. Así un archivo se escribe y se lee por partes, y un rango
+// se sirve decodificando solo los segmentos que lo contienen.
+const (
+	defaultSegmentSize = 64 * 1024
+	maxSegmentSize     = 16 * 1024 * 1024
+	segmentCompressed  = 1 << 31
+	// Lo que el cifrado añade a cada segmento (la etiqueta de GCM)
+	segmentOverhead = 16
+)
+
+func numSegments(size, segmentSize int64) int64 {
+	return (size + segmentSize - 1) / segmentSize
+}
+
+// Lee exactamente len(p) bytes de r desde off
+func readFullAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Escribe en f los bytes que se guardan en disco para los size bytes de src: tal cual si no hay
+// que comprimir ni cifrar, o en el formato segmentado
+func (s *Server) encodeContent(f *os.File, relPath string, src io.ReaderAt, size int64) error {
+	head := make([]byte, min(size, mimeSniffLength))
+	if err := readFullAt(src, head, 0); err != nil {
+		return err
+	}
+	compress := s.shouldCompress(relPath, detectMimeType(relPath, head))
+	if !compress && s.keys == nil {
+		return writeRawContent(f, src, size, head)
+	}
+
+	header := envelope{Size: size, SegmentSize: defaultSegmentSize}
+	var compressor *segmentCompressor
+	var sealer *segmentCipher
+	var err error
+	if compress {
+		header.Compression = s.compression
+		if compressor, err = newSegmentCompressor(s.compression); err != nil {
+			return err
+		}
+	}
+	if s.keys != nil {
+		if sealer, err = s.newSegmentSealer(&header); err != nil {
+			return err
+		}
+	}
+	prefix, err := encodeEnvelope(header, nil)
+	if err != nil {
+		return err
+	}
+
+	// El índice se completa al final, cuando se conocen las longitudes
+	count := numSegments(size, header.SegmentSize)
+	index := make([]byte, 4*count)
+	w := bufio.NewWriterSize(f, 256*1024)
+	w.Write(prefix)
+	w.Write(index)
+	plain := make([]byte, min(size, header.SegmentSize))
+	var sealed []byte
+	compressedAny := false
+	for i := int64(0); i < count; i++ {
+		offset := i * header.SegmentSize
+		segment := plain[:min(header.SegmentSize, size-offset)]
+		if err := readFullAt(src, segment, offset); err != nil {
+			return err
+		}
+		var flags uint32
+		if compressor != nil {
+			compressed, err := compressor.compress(segment)
+			if err != nil {
+				return err
+			}
+			// Solo se guarda comprimido si realmente ocupa menos
+			if len(compressed) < len(segment) {
+				segment, flags, compressedAny = compressed, segmentCompressed, true
+			}
+		}
+		if sealer != nil {
+			sealed = sealer.seal(sealed[:0], segment, i, i == count-1)
+			segment = sealed
+		}
+		binary.BigEndian.PutUint32(index[4*i:], uint32(len(segment))|flags)
+		if _, err := w.Write(segment); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if compress && !compressedAny {
+		if sealer == nil {
+			// Comprimir no redujo nada: se guarda tal cual
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			return writeRawContent(f, src, size, head)
+		}
+		// La cabecera no debe decir que está comprimido. Sin la compresión el JSON es más corto,
+		// y se completa con espacios para no mover el índice.
+		header.Compression = ""
+		headerJSON, err := json.Marshal(header)
+		if err != nil {
+			return err
+		}
+		headerStart := len(envelopeMagic) + 4
+		headerJSON = append(headerJSON, bytes.Repeat([]byte(" "), len(prefix)-headerStart-len(headerJSON))...)
+		if _, err := f.WriteAt(headerJSON, int64(headerStart)); err != nil {
+			return err
+		}
+	}
+	_, err = f.WriteAt(index, int64(len(prefix)))
+	return err
+}
+
+// Escribe el contenido sin transformar, con una cabecera solo si se confundiría con una
+func writeRawContent(w io.Writer, src io.ReaderAt, size int64, head []byte) error {
+	if bytes.HasPrefix(head, []byte(envelopeMagic)) {
+		prefix, err := encodeEnvelope(envelope{Size: size}, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(prefix); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(w, io.NewSectionReader(src, 0, size))
+	return err
+}
+
+// Lee por partes el contenido original de un archivo en formato segmentado
+type segmentReader struct {
+	r      io.ReaderAt
+	header *envelope
+	count  int64
+	// Posición en disco de cada segmento; offsets[count] es el final del último
+	offsets    []int64
+	compressed []bool
+	cipher     *segmentCipher
+
+	mu sync.Mutex
+	// Último segmento decodificado, para las lecturas secuenciales más pequeñas que un segmento
+	current      int64
+	plain        []byte
+	raw          []byte
+	decompressor segmentDecompressor
+}
+
+func (s *Server) newSegmentReader(r io.ReaderAt, header *envelope, dataOffset, fileSize int64) (*segmentReader, error) {
+	if header.SegmentSize <= 0 || header.SegmentSize > maxSegmentSize || header.Size < 0 {
+		return nil, errInvalidEnvelope
+	}
+	count := numSegments(header.Size, header.SegmentSize)
+	if 4*count > fileSize-dataOffset {
+		return nil, errInvalidEnvelope
+	}
+	index := make([]byte, 4*count)
+	if err := readFullAt(r, index, dataOffset); err != nil {
+		return nil, err
+	}
+	sr := &segmentReader{
+		r:          r,
+		header:     header,
+		count:      count,
+		offsets:    make([]int64, count+1),
+		compressed: make([]bool, count),
+		current:    -1,
+	}
+	sr.offsets[0] = dataOffset + 4*count
+	maxStored := uint32(header.SegmentSize + segmentOverhead)
+	for i := range count {
+		length := binary.BigEndian.Uint32(index[4*i:])
+		sr.compressed[i] = length&segmentCompressed != 0
+		length &^= segmentCompressed
+		if length > maxStored {
+			return nil, errInvalidEnvelope
+		}
+		sr.offsets[i+1] = sr.offsets[i] + int64(length)
+	}
+	if sr.offsets[count] != fileSize {
+		return nil, errInvalidEnvelope
+	}
+	if header.Encryption != "" {
+		cipher, err := s.segmentOpener(header)
+		if err != nil {
+			return nil, err
+		}
+		sr.cipher = cipher
+	}
+	return sr, nil
+}
+
+func (r *segmentReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("offset negativo")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(p) && off < r.header.Size {
+		i := off / r.header.SegmentSize
+		plain, err := r.segment(i)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], plain[off-i*r.header.SegmentSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Decodifica el segmento i. Debe llamarse con r.mu tomado.
+func (r *segmentReader) segment(i int64) ([]byte, error) {
+	if i == r.current {
+		return r.plain, nil
+	}
+	r.current = -1
+	stored := r.offsets[i+1] - r.offsets[i]
+	if int64(cap(r.raw)) < stored {
+		r.raw = make([]byte, stored)
+	}
+	data := r.raw[:stored]
+	if err := readFullAt(r.r, data, r.offsets[i]); err != nil {
+		return nil, err
+	}
+	if r.cipher != nil {
+		var err error
+		if data, err = r.cipher.open(data[:0], data, i, i == r.count-1); err != nil {
+			return nil, fmt.Errorf("segmento %d: %w", i, err)
+		}
+	}
+
+	length := min(r.header.SegmentSize, r.header.Size-i*r.header.SegmentSize)
+	if int64(cap(r.plain)) < length {
+		r.plain = make([]byte, r.header.SegmentSize)
+	}
+	r.plain = r.plain[:length]
+	if r.compressed[i] {
+		if err := r.decompressor.decompress(r.header.Compression, r.plain, data); err != nil {
+			return nil, fmt.Errorf("segmento %d: %w", i, err)
+		}
+	} else {
+		if int64(len(data)) != length {
+			return nil, fmt.Errorf("segmento %d: %w", i, errInvalidEnvelope)
+		}
+		copy(r.plain, data)
+	}
+	r.current = i
+	return r.plain, nil
+}
@@ -4,24 +4,74 @@ import (
 	"context"
 	"encoding/base64"
 	"strings"
+	"sync"
 
 	pb "filesystem/proto/filesystem"
-	"log"
+	"io"
+	"log/slog"
 	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 // Acá se marca la ruta dentro de la vm donde se ejecuta de donde se guardará cada archivo.
-const rootDirectory = "storage"
+const defaultRootDirectory = "storage"
+
+// Directorio raíz en uso; lo fija NewServer a partir de la configuración
+var rootDirectory = defaultRootDirectory
 
 type Server struct {
 	pb.UnimplementedFileSystemServiceServer
+	pb.UnimplementedAdminServiceServer
+	nodeID string
+	// Configuración en uso; solo se lee o se reemplaza con reloadMu tomado
+	reloadMu   sync.Mutex
+	config     Config
+	configArgs []string
+	// Latidos al servidor central
+	listenAddress string
+	stopHeartbeat context.CancelFunc
+	// Pool de workers de las llamadas unarias
+	workers *workerPool
+	// Tokens de autenticación y certificado TLS
+	security *securityState
+	// Límites de llamadas y de ancho de banda por cliente
+	limiter *rateLimiter
+	// Índice de búsqueda por contenido, nil si está deshabilitado
+	index *searchIndex
+	// plain o dedup
+	storageMode string
+	// Almacén de blobs, nil si nunca se usó el modo deduplicado
+	blobs          *blobStore
+	blobGCInterval time.Duration
+	// Compresión en reposo: none o gzip. Si hay directorios configurados solo se comprime dentro de ellos.
+	compression     string
+	compressionDirs []string
+	// Claves para el cifrado en reposo, nil si no hay clave maestra configurada
+	keys *keyStore
+	// Sesiones de subida por partes
+	uploads *uploadManager
+	// Temporales de las escrituras, fuera del directorio raíz para que nadie vea archivos a medias
+	stagingDir string
+	// Serializa la publicación de las escrituras de cada ruta
+	paths pathLocks
+	// Máximo de bytes de contenido de DownloadArchive
+	maxArchiveSize int64
+	// Pares y quórum de la replicación síncrona de las subidas
+	replication replicationConfig
+	// Checksums registrados de cada archivo y verificación de integridad
+	checksums *checksumCatalog
+	scrub     *scrubber
+	// Eventos de cambios para los suscriptores de WatchPath
+	events *eventHub
+	// Registro de auditoría de todas las llamadas
+	audit *auditLog
 }
 
 // // // Registrar el nodo con el servidor central
@@ -64,36 +114,25 @@ type Server struct {
 // 	}
 // }
 
-// // // Enviar estado cada 10 segundos
-// func (s *Server) SendHeartbeat() {
-// 	for {
-// 		time.Sleep(10 * time.Second)
-// 		s.ReportStatus("activo")
-// 	}
-// }
-
 // Subir archivo en Base64
 func (s *Server) UploadFile(ctx context.Context, req *pb.UploadRequest) (*pb.Response, error) {
 	filename := req.Filename
 	base64Data := req.ContentBase64
-
-	// Cargar variables de entorno desde el archivo .env
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("No se pudo cargar el archivo .env")
-	}
-
-	nodeIDStr := os.Getenv("NODE_ID")
-	// En caso de estar vacío se pondrá un valor por defecto
-	if nodeIDStr == "" {
-		nodeIDStr = "1"
-	}
+	nodeIDStr := s.nodeID
 
 	if filename == "" {
 		return &pb.Response{Message: "El nombre del archivo no puede estar vacío"}, nil
 	}
 
+	// Los pares se validan antes de escribir para no dejar el archivo si la petición no es válida
+	peers, quorum, err := s.replicationTargets(filepath.Join(req.Directory, filename), req.ReplicaPeers, req.WriteQuorum)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span := startSpan(ctx, "base64.decode", attribute.Int("encoded_size", len(base64Data)))
 	data, err := base64.StdEncoding.DecodeString(base64Data)
+	endSpan(span, err)
 	if err != nil {
 		return &pb.Response{Message: "Error decodificando Base64"}, err
 	}
@@ -112,46 +151,59 @@ func (s *Server) UploadFile(ctx context.Context, req *pb.UploadRequest) (*pb.Res
 		filePath = filepath.Join(fullDir, filename)
 	}
 
-	err = os.WriteFile(filePath, data, 0644)
+	existed := pathExists(filePath)
+	_, span = startSpan(ctx, "storage.write", attribute.String("path", filePath), attribute.Int("size", len(data)))
+	err = s.writeStoredFile(filePath, data)
+	endSpan(span, err)
 	if err != nil {
 		return &pb.Response{Message: "Error escribiendo archivo"}, err
 	}
+	s.publishWrite(filepath.Join(req.Directory, filename), existed, int64(len(data)))
 
 	// Obtener tipo de archivo (MIME type)
-	mimeType := http.DetectContentType(data)
+	mimeType := detectMimeType(filename, data)
 
-	// Alternativamente, usar extensión si deseas más precisión:
-	ext := filepath.Ext(filename)
-	if ext != "" {
-		mimeFromExt := mime.TypeByExtension(ext)
-		if mimeFromExt != "" {
-			mimeType = mimeFromExt
-		}
+	if s.index != nil {
+		s.index.update(filepath.Join(req.Directory, filename), data, mimeType)
 	}
 
-	return &pb.Response{
+	resp := &pb.Response{
 		Message:  "Archivo subido correctamente",
 		FilePath: filePath,
 		FileName: filename,
 		FileSize: int64(len(data)),
 		FileType: mimeType,
 		NodeId:   nodeIDStr,
-	}, nil
+	}
+
+	// Con replicación síncrona no se responde hasta que el quórum de pares confirma la escritura
+	replicaIDs, ok := s.replicateWrite(ctx, filePath, memoryContent(data), contentHash(data), mimeType, peers, quorum)
+	resp.ReplicaNodeIds = replicaIDs
+	if !ok {
+		resp.Message = "Archivo guardado localmente pero sin alcanzar el quórum de escritura"
+		return nil, quorumError(resp, quorum)
+	}
+	return resp, nil
 }
 
 // Mover un archivo
 func (s *Server) MoveFile(ctx context.Context, req *pb.MoveRequest) (*pb.Response, error) {
-	log.Printf("Datos recibidos:\nSourcePath: %s\nDestinationPath: %s", req.SourcePath, req.DestinationPath)
+	slog.InfoContext(ctx, "Moviendo archivo", "source", req.SourcePath, "destination", req.DestinationPath)
 	sourcePath := filepath.Join(rootDirectory, req.SourcePath)
 	destPath := filepath.Join(rootDirectory, req.DestinationPath)
 
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
+	info, err := os.Stat(sourcePath)
+	if os.IsNotExist(err) {
 		return nil, status.Errorf(codes.NotFound, "El archivo fuente no existe")
 	}
 
-	if err := os.Rename(sourcePath, destPath); err != nil {
+	if err := s.renameStoredPath(sourcePath, destPath); err != nil {
 		return nil, status.Errorf(codes.Internal, "Error al mover archivo: %v", err)
 	}
+	if s.index != nil {
+		s.index.rename(req.SourcePath, req.DestinationPath)
+	}
+	s.publishEvent(eventMoved, req.DestinationPath, req.SourcePath, info != nil && info.IsDir(), 0)
 	return &pb.Response{Message: "Archivo movido con éxito"}, nil
 }
 
@@ -162,10 +214,14 @@ func (s *Server) CreateDirectory(ctx context.Context, req *pb.DirectoryRequest)
 	}
 
 	fullPath := filepath.Join(rootDirectory, req.Path)
+	existed := pathExists(fullPath)
 	err := os.MkdirAll(fullPath, os.ModePerm)
 	if err != nil {
 		return &pb.Response{Message: "Error creando directorio"}, err
 	}
+	if !existed {
+		s.publishEvent(eventCreated, req.Path, "", true, 0)
+	}
 	return &pb.Response{Message: "Directorio creado correctamente"}, nil
 }
 
@@ -176,10 +232,14 @@ func (s *Server) CreateSubdirectory(ctx context.Context, req *pb.SubdirectoryReq
 	}
 
 	fullPath := filepath.Join(rootDirectory, req.ParentDirectory, req.SubdirectoryName)
+	existed := pathExists(fullPath)
 	err := os.MkdirAll(fullPath, os.ModePerm)
 	if err != nil {
 		return &pb.Response{Message: "Error creando subdirectorio"}, err
 	}
+	if !existed {
+		s.publishEvent(eventCreated, filepath.Join(req.ParentDirectory, req.SubdirectoryName), "", true, 0)
+	}
 	return &pb.Response{Message: "Subdirectorio creado correctamente"}, nil
 }
 
@@ -188,13 +248,18 @@ func (s *Server) RenameFile(ctx context.Context, req *pb.RenameRequest) (*pb.Res
 	oldPath := filepath.Join(rootDirectory, req.OldName)
 	newPath := filepath.Join(rootDirectory, req.NewName)
 
-	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+	info, err := os.Stat(oldPath)
+	if os.IsNotExist(err) {
 		return nil, status.Errorf(codes.NotFound, "El archivo a renombrar no existe")
 	}
 
-	if err := os.Rename(oldPath, newPath); err != nil {
+	if err := s.renameStoredPath(oldPath, newPath); err != nil {
 		return nil, status.Errorf(codes.Internal, "Error al renombrar archivo: %v", err)
 	}
+	if s.index != nil {
+		s.index.rename(req.OldName, req.NewName)
+	}
+	s.publishEvent(eventRenamed, req.NewName, req.OldName, info != nil && info.IsDir(), 0)
 	return &pb.Response{Message: "Archivo renombrado con éxito"}, nil
 }
 
@@ -204,12 +269,21 @@ func (s *Server) DeleteFile(ctx context.Context, req *pb.DeleteRequest) (*pb.Res
 
 	info, err := os.Stat(targetPath)
 	if os.IsNotExist(err) {
-		return &pb.Response{Message: "El archivo/directorio no existe"}, nil
+		return nil, status.Errorf(codes.NotFound, "El archivo/directorio no existe")
 	}
+	blobRefs := s.blobRefsUnder(targetPath)
 
 	if info.IsDir() {
 		// Eliminar el directorio y su contenido
 		err = os.RemoveAll(targetPath)
+		s.releaseMissingBlobRefs(blobRefs)
+		// Lo que no se pudo borrar vuelve a registrarse en la siguiente verificación
+		s.checksums.remove(indexKey(req.Path))
+		s.publishEvent(eventDeleted, req.Path, "", true, 0)
+		if s.index != nil {
+			// Aunque falle, parte del contenido pudo haberse eliminado
+			s.index.remove(req.Path)
+		}
 		if err != nil {
 			return &pb.Response{Message: "Error eliminando directorio"}, err
 		}
@@ -221,6 +295,12 @@ func (s *Server) DeleteFile(ctx context.Context, req *pb.DeleteRequest) (*pb.Res
 	if err != nil {
 		return &pb.Response{Message: "Error eliminando archivo"}, err
 	}
+	s.releaseMissingBlobRefs(blobRefs)
+	s.checksums.remove(indexKey(req.Path))
+	s.publishEvent(eventDeleted, req.Path, "", false, 0)
+	if s.index != nil {
+		s.index.remove(req.Path)
+	}
 	return &pb.Response{Message: "Archivo eliminado correctamente"}, nil
 }
 
@@ -301,84 +381,191 @@ type fileInfo struct {
 }
 
 func (s *Server) DownloadFile(ctx context.Context, req *pb.DownloadRequest) (*pb.DownloadResponse, error) {
+	content, resp, err := s.openDownload(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content.reader())
+	if err != nil {
+		slog.ErrorContext(ctx, "Error al leer el archivo", "path", req.Path, "error", err)
+		return nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+	}
+	resp.ContentBase64 = base64.StdEncoding.EncodeToString(data)
+	return resp, nil
+}
+
+// Abre el archivo de una descarga y prepara la respuesta sin el contenido, que se lee de
+// content por partes. Quien lo llama debe cerrar content.
+func (s *Server) openDownload(ctx context.Context, req *pb.DownloadRequest) (*storedContent, *pb.DownloadResponse, error) {
 	// Asegúrate de que req.Path sea solo una ruta válida
 	if req.Path == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "Ruta proporcionada es vacía")
+		return nil, nil, status.Errorf(codes.InvalidArgument, "Ruta proporcionada es vacía")
 	}
 
 	// Asegurarse de que no esté recibiendo un JSON o algo inesperado
 	if strings.Contains(req.Path, "{") || strings.Contains(req.Path, "}") {
-		return nil, status.Errorf(codes.InvalidArgument, "La ruta proporcionada contiene un formato JSON inválido: %s", req.Path)
+		return nil, nil, status.Errorf(codes.InvalidArgument, "La ruta proporcionada contiene un formato JSON inválido: %s", req.Path)
 	}
 
 	// Ahora se crea la ruta completa
 	fullPath := filepath.Join(rootDirectory, req.Path)
 
-	// Log para saber si se llegó al archivo
-	log.Printf("Intentando acceder al archivo: %s", fullPath)
+	slog.DebugContext(ctx, "Intentando acceder al archivo", "path", fullPath)
 
 	// Verificar si el archivo existe
 	info, err := os.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.Printf("El archivo no existe: %s", fullPath)
-			return nil, status.Errorf(codes.NotFound, "El archivo no existe")
+			slog.InfoContext(ctx, "El archivo no existe", "path", fullPath)
+			return nil, nil, status.Errorf(codes.NotFound, "El archivo no existe")
 		}
-		log.Printf("Error al obtener información del archivo: %v", err)
-		return nil, status.Errorf(codes.Internal, "Error al obtener información del archivo: %v", err)
+		slog.ErrorContext(ctx, "Error al obtener información del archivo", "path", fullPath, "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "Error al obtener información del archivo: %v", err)
 	}
 
 	// Si es un directorio, no un archivo
 	if info.IsDir() {
-		log.Printf("La ruta proporcionada es un directorio, no un archivo: %s", fullPath)
-		return nil, status.Errorf(codes.InvalidArgument, "La ruta proporcionada es un directorio, no un archivo")
+		slog.InfoContext(ctx, "La ruta proporcionada es un directorio, no un archivo", "path", fullPath)
+		return nil, nil, status.Errorf(codes.InvalidArgument, "La ruta proporcionada es un directorio, no un archivo")
 	}
 
-	// Log para saber si se encontró el archivo
-	log.Printf("Archivo encontrado: %s", fullPath)
-
-	// Leer el archivo
-	data, err := os.ReadFile(fullPath)
+	// Abrir el archivo
+	_, span := startSpan(ctx, "storage.read", attribute.String("path", fullPath))
+	content, err := s.openStoredFile(fullPath)
+	endSpan(span, err)
 	if err != nil {
-		log.Printf("Error al leer el archivo %s: %v", fullPath, err)
-		return nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+		slog.ErrorContext(ctx, "Error al leer el archivo", "path", fullPath, "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
 	}
-	log.Printf("Tamaño de datos leídos: %d bytes", len(data))
-
-	// Log para saber si el archivo se leyó correctamente
-	log.Printf("Archivo leído exitosamente: %s", fullPath)
 
-	// Codificar en Base64
-	base64Content := base64.StdEncoding.EncodeToString(data)
+	// Obtener tipo MIME. El contenido del archivo nunca se escribe en el log.
+	head := make([]byte, min(content.size, mimeSniffLength))
+	if err := readFullAt(content, head, 0); err != nil {
+		content.Close()
+		slog.ErrorContext(ctx, "Error al leer el archivo", "path", fullPath, "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+	}
+	mimeType := detectMimeType(req.Path, head)
+	slog.InfoContext(ctx, "Archivo descargado",
+		"path", req.Path,
+		"size", content.size,
+		"file_type", mimeType,
+	)
 
-	// Log para saber si la conversión a Base64 fue exitosa
-	log.Printf("Archivo convertido a Base64 exitosamente: %s", fullPath)
+	return content, &pb.DownloadResponse{
+		Filename: filepath.Base(fullPath),
+		Filesize: content.size,
+		FileType: mimeType,
+	}, nil
+}
 
-	// Obtener tipo MIME
+// Detecta el tipo MIME por contenido, dando prioridad a la extensión si se conoce
+func detectMimeType(filename string, data []byte) string {
 	mimeType := http.DetectContentType(data)
-	ext := filepath.Ext(req.Path)
+	ext := filepath.Ext(filename)
 	if ext != "" {
 		mimeFromExt := mime.TypeByExtension(ext)
 		if mimeFromExt != "" {
 			mimeType = mimeFromExt
 		}
 	}
-	log.Printf("Respuesta enviada al cliente:\nFilename: %s\nFilesize: %d\nFileType: %s\nBase64 (primeros 100): %.100s",
-		filepath.Base(fullPath),
-		info.Size(),
-		mimeType,
-		base64Content,
-	)
-
-	return &pb.DownloadResponse{
-		Filename:      filepath.Base(fullPath),
-		ContentBase64: base64Content,
-		Filesize:      info.Size(),
-		FileType:      mimeType,
-	}, nil
+	return mimeType
 }
 
-// Instancia de server
-func NewServer() *Server {
-	return &Server{}
+// Instancia de server con la configuración ya validada
+func NewServer(cfg Config) *Server {
+	rootDirectory = cfg.Storage.Root
+	s := &Server{
+		nodeID:         cfg.Node.ID,
+		config:         cfg,
+		configArgs:     cfg.args,
+		storageMode:    cfg.Storage.Mode,
+		blobGCInterval: cfg.Storage.BlobGCInterval,
+		compression:    cfg.Storage.Compression,
+	}
+	s.events = newEventHub(cfg.Storage.WatchHistory)
+	s.workers = newWorkerPool(cfg.Node.Workers, cfg.Node.QueueSize)
+
+	security, err := newSecurityState(cfg.Security)
+	if err != nil {
+		fatal("Error en la configuración de seguridad", "error", err)
+	}
+	s.security = security
+	s.security.setS3Keys(cfg.S3.AccessKeys)
+	s.limiter = newRateLimiter(cfg.RateLimit)
+
+	audit, err := newAuditLog(cfg.Audit.File, cfg.Audit.MaxSize, cfg.Audit.MaxFiles)
+	if err != nil {
+		fatal("Error abriendo el registro de auditoría", "error", err)
+	}
+	s.audit = audit
+
+	// Compresión transparente en reposo, opcionalmente limitada a algunos directorios
+	for _, dir := range cfg.Storage.CompressionDirectories {
+		s.compressionDirs = append(s.compressionDirs, indexKey(dir))
+	}
+
+	if err := s.initKeyStore(cfg.Encryption); err != nil {
+		fatal("Error cargando la clave maestra", "error", err)
+	}
+
+	stagingDir, err := newStagingDirectory(cfg.Storage.StagingDirectory)
+	if err != nil {
+		fatal("Error preparando el directorio de temporales", "error", err)
+	}
+	s.stagingDir = stagingDir
+	s.maxArchiveSize = cfg.Storage.MaxArchiveSize
+
+	// Sesiones de subida reanudables, se conservan entre reinicios hasta que expiran
+	uploads, err := newUploadManager(cfg.Storage.UploadDirectory, cfg.Storage.UploadSessionTTL, cfg.Storage.MaxUploadSize)
+	if err != nil {
+		fatal("Error iniciando las sesiones de subida", "error", err)
+	}
+	s.uploads = uploads
+	go uploads.runExpiry()
+
+	s.replication = newReplicationConfig(cfg.Replication)
+
+	checksums, err := newChecksumCatalog(cfg.Storage.ChecksumFile)
+	if err != nil {
+		fatal("Error cargando el catálogo de checksums", "error", err)
+	}
+	s.checksums = checksums
+	s.scrub = newScrubber(cfg.Scrub)
+
+	// El almacén también se abre en modo plain si existe, para poder leer los archivos deduplicados
+	blobDir := cfg.Storage.BlobDirectory
+	if _, err := os.Stat(blobDir); s.storageMode == storageModeDedup || err == nil {
+		if err := s.initBlobStore(blobDir); err != nil {
+			fatal("Error iniciando el almacén de blobs", "error", err)
+		}
+	}
+
+	// Las claves en uso se buscan en la raíz, los blobs y las sesiones, así que la limpieza
+	// empieza cuando todos están abiertos
+	if s.keys != nil {
+		go s.removeUnusedDataKeys()
+	}
+
+	// El índice de búsqueda es opcional
+	if cfg.Storage.SearchIndex {
+		s.index = newSearchIndex(rootDirectory, s.readStoredFile)
+		go s.index.rebuild()
+	}
+	// Los cambios hechos por fuera del servidor se detectan con inotify si está habilitado
+	if cfg.Storage.WatchInotify {
+		if err := os.MkdirAll(rootDirectory, os.ModePerm); err != nil {
+			fatal("Error creando directorio raíz", "error", err)
+		}
+		if err := s.startInotify(); err != nil {
+			fatal("Error iniciando inotify", "error", err)
+		}
+	}
+	// La verificación en segundo plano es opcional
+	if s.scrub.enabled {
+		go s.runScrubber()
+	}
+	return s
 }
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	minURLSigningKeyLength = 32
+	defaultSignedURLExpiry = 15 * time.Minute
+	maxSignedURLExpiry     = 7 * 24 * time.Hour
+)
+
+// Parámetros de consulta de una URL firmada
+const (
+	signedURLExpiresParam   = "expires"
+	signedURLMaxSizeParam   = "max_size"
+	signedURLSignatureParam = "signature"
+)
+
+// Firma HMAC-SHA256 del método, la ruta, el vencimiento y el tamaño máximo
+func signURL(key []byte, method, relPath string, expires, maxSize int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%d", method, relPath, expires, maxSize)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Escapa cada segmento de la ruta, conservando las barras
+func escapeURLPath(relPath string) string {
+	segments := strings.Split(relPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// Crea una URL del gateway HTTP para descargar (GET) o subir (PUT) un archivo hasta que venza
+func (s *Server) CreateSignedURL(ctx context.Context, req *pb.CreateSignedURLRequest) (*pb.CreateSignedURLResponse, error) {
+	key := *s.security.urlKey.Load()
+	if len(key) == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "El nodo no tiene configurada una clave para firmar URLs")
+	}
+
+	method := strings.ToUpper(req.Method)
+	if method != http.MethodGet && method != http.MethodPut {
+		return nil, status.Errorf(codes.InvalidArgument, "Método inválido: %s (valores posibles: GET, PUT)", req.Method)
+	}
+	if req.Path == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "La ruta no puede estar vacía")
+	}
+	if _, err := resolveStoragePath(req.Path); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	if req.MaxSize < 0 || (req.MaxSize > 0 && method != http.MethodPut) {
+		return nil, status.Errorf(codes.InvalidArgument, "max_size debe ser positivo y solo se aplica a PUT")
+	}
+	expiresIn := time.Duration(req.ExpiresInSeconds) * time.Second
+	if expiresIn == 0 {
+		expiresIn = defaultSignedURLExpiry
+	}
+	if expiresIn < 0 || expiresIn > maxSignedURLExpiry {
+		return nil, status.Errorf(codes.InvalidArgument, "El vencimiento debe estar entre 1 segundo y %s", maxSignedURLExpiry)
+	}
+
+	s.reloadMu.Lock()
+	base, address := s.config.Node.HTTPPublicURL, s.config.Node.HTTPAddress
+	s.reloadMu.Unlock()
+	if base == "" {
+		if address == "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "El gateway HTTP no está habilitado")
+		}
+		base = "http://" + address
+		if s.security.tls {
+			base = "https://" + address
+		}
+	}
+
+	// La ruta se firma igual que la recibe el gateway
+	relPath := path.Clean(filepath.ToSlash(req.Path))
+	expires := time.Now().Add(expiresIn).Unix()
+	query := url.Values{}
+	query.Set(signedURLExpiresParam, strconv.FormatInt(expires, 10))
+	if req.MaxSize > 0 {
+		query.Set(signedURLMaxSizeParam, strconv.FormatInt(req.MaxSize, 10))
+	}
+	query.Set(signedURLSignatureParam, signURL(key, method, relPath, expires, req.MaxSize))
+
+	slog.InfoContext(ctx, "URL firmada creada", "path", relPath, "method", method, "expires_at", expires)
+	return &pb.CreateSignedURLResponse{
+		Url:       strings.TrimSuffix(base, "/") + "/v1/files/" + escapeURLPath(relPath) + "?" + query.Encode(),
+		ExpiresAt: expires,
+	}, nil
+}
+
+// Verifica la firma de una petición del gateway. Sin firma devuelve la petición sin cambios,
+// y las llamadas siguen necesitando un token.
+func (g *Gateway) checkSignedURL(r *http.Request, relPath string) (*http.Request, error) {
+	query := r.URL.Query()
+	signature := query.Get(signedURLSignatureParam)
+	if signature == "" {
+		return r, nil
+	}
+	key := *g.server.security.urlKey.Load()
+	expires, err := strconv.ParseInt(query.Get(signedURLExpiresParam), 10, 64)
+	if err != nil || len(key) == 0 {
+		return nil, status.Errorf(codes.PermissionDenied, "URL firmada inválida")
+	}
+	var maxSize int64
+	if text := query.Get(signedURLMaxSizeParam); text != "" {
+		if maxSize, err = strconv.ParseInt(text, 10, 64); err != nil {
+			return nil, status.Errorf(codes.PermissionDenied, "URL firmada inválida")
+		}
+	}
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	expected := signURL(key, method, relPath, expires, maxSize)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, status.Errorf(codes.PermissionDenied, "URL firmada inválida")
+	}
+	if time.Now().Unix() > expires {
+		return nil, status.Errorf(codes.PermissionDenied, "La URL firmada venció")
+	}
+	if maxSize > 0 && r.ContentLength > maxSize {
+		return nil, status.Errorf(codes.PermissionDenied, "El archivo supera el tamaño máximo de la URL firmada (%d bytes)", maxSize)
+	}
+	return r.WithContext(withPreauthorized(r.Context())), nil
+}
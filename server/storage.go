@@ -0,0 +1,648 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Modos de almacenamiento del contenido de los archivos
+const (
+	// Cada archivo se escribe completo en su ruta
+	storageModePlain = "plain"
+	// El contenido se guarda una sola vez en el almacén de blobs y la ruta lo referencia
+	storageModeDedup = "dedup"
+)
+
+const (
+	defaultBlobDirectory    = "blobs"
+	defaultStagingDirectory = "staging"
+)
+
+// Escribe el contenido de un archivo según el modo de almacenamiento configurado
+func (s *Server) writeStoredFile(filePath string, data []byte) error {
+	return s.writeStoredContent(filePath, bytes.NewReader(data), int64(len(data)), contentHash(data))
+}
+
+// Como writeStoredFile, leyendo por partes los size bytes de src, cuyo SHA-256 es hash.
+// Nunca se carga el contenido entero en memoria.
+func (s *Server) writeStoredContent(filePath string, src io.ReaderAt, size int64, hash string) error {
+	return s.writeStoredContentIf(filePath, src, size, hash, nil)
+}
+
+// Como writeStoredContent, pero el archivo solo se reemplaza si check no devuelve un error.
+// check se ejecuta con la ruta bloqueada, así que ninguna otra escritura puede colarse entre
+// la comprobación y el reemplazo.
+func (s *Server) writeStoredContentIf(filePath string, src io.ReaderAt, size int64, hash string, check func() error) error {
+	relPath, err := filepath.Rel(rootDirectory, filePath)
+	if err != nil {
+		return err
+	}
+	write := func(f *os.File) error {
+		return s.encodeContent(f, relPath, src, size)
+	}
+
+	// La codificación, que es lo costoso, se hace antes de bloquear la ruta
+	referenced := false
+	if s.storageMode == storageModeDedup {
+		// Solo se codifica el contenido si el blob todavía no existe
+		if !s.blobs.ref(hash) {
+			if err := s.blobs.put(hash, write); err != nil {
+				return err
+			}
+		}
+		referenced = true
+		content, err := encodeEnvelope(envelope{Size: size, Blob: hash}, nil)
+		if err != nil {
+			s.blobs.release(hash)
+			return err
+		}
+		write = func(f *os.File) error {
+			_, err := f.Write(content)
+			return err
+		}
+	}
+	tmpPath, err := stageFile(s.stagingDir, filePath, 0644, write)
+	if err == nil {
+		defer os.Remove(tmpPath)
+		err = s.publishFileIf(tmpPath, filePath, hash, size, check)
+	}
+	if err != nil && referenced {
+		s.blobs.release(hash)
+	}
+	return err
+}
+
+// Indica si un contenido se guarda en disco tal cual, sin cabecera ni transformaciones.
+// head son los primeros bytes del contenido, suficientes para detectar el tipo MIME.
+func (s *Server) storesAsIs(relPath string, head []byte) bool {
+	return s.storageMode == storageModePlain && s.keys == nil &&
+		!s.shouldCompress(relPath, detectMimeType(relPath, head)) &&
+		!bytes.HasPrefix(head, []byte(envelopeMagic))
+}
+
+// Publica con rename un archivo ya escrito en disco y registra el checksum de su contenido
+func (s *Server) publishFile(tmpPath, filePath, hash string, size int64) error {
+	return s.publishFileIf(tmpPath, filePath, hash, size, nil)
+}
+
+func (s *Server) publishFileIf(tmpPath, filePath, hash string, size int64, check func() error) error {
+	unlock := s.paths.lock(filePath)
+	defer unlock()
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	previous := s.blobRefsUnder(filePath)
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	// El archivo sobrescrito deja de referenciar su blob
+	for _, oldHash := range previous {
+		s.blobs.release(oldHash)
+	}
+	s.recordChecksum(filePath, hash, size)
+	return nil
+}
+
+// Candados por ruta que serializan la publicación de las escrituras de un mismo archivo
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+// Bloquea la ruta y devuelve la función que la libera
+func (p *pathLocks) lock(path string) func() {
+	p.mu.Lock()
+	if p.locks == nil {
+		p.locks = make(map[string]*pathLock)
+	}
+	l, ok := p.locks[path]
+	if !ok {
+		l = &pathLock{}
+		p.locks[path] = l
+	}
+	l.users++
+	p.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		p.mu.Lock()
+		if l.users--; l.users == 0 {
+			delete(p.locks, path)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Escribe un archivo en un temporal y lo publica con rename para no dejarlo a medias
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeFileAtomicIn(filepath.Dir(path), path, data, perm)
+}
+
+// Como writeFileAtomic, con el temporal en dir, que debe estar en el mismo sistema de archivos
+func writeFileAtomicIn(dir, path string, data []byte, perm os.FileMode) error {
+	return writeFileAtomicFrom(dir, path, perm, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
+
+// Como writeFileAtomicIn, con el contenido que write escribe en el temporal
+func writeFileAtomicFrom(dir, path string, perm os.FileMode, write func(*os.File) error) error {
+	tmpPath, err := stageFile(dir, path, perm, write)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	return os.Rename(tmpPath, path)
+}
+
+// Escribe en un temporal de dir el contenido que produce write y lo deja sincronizado en disco,
+// listo para publicarlo en path con rename
+func stageFile(dir, path string, perm os.FileMode, write func(*os.File) error) (string, error) {
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return "", err
+	}
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// Temporal fuera del directorio raíz donde se junta un contenido que llega por partes, mientras
+// se calcula su checksum. Con cifrado se guarda con AES-CTR y una clave que solo existe en
+// memoria, para que el contenido no toque el disco en claro.
+type stagedFile struct {
+	f       *os.File
+	w       *bufio.Writer
+	hasher  hash.Hash
+	written int64
+	// Lo escrito hasta el último flush, leído por partes y ya descifrado
+	content *storedContent
+}
+
+// Crea un temporal en el directorio de preparación con el patrón indicado
+func (s *Server) newStagedFile(pattern string) (*stagedFile, error) {
+	f, err := os.CreateTemp(s.stagingDir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	staged := &stagedFile{f: f, hasher: sha256.New(), content: &storedContent{ReaderAt: f, files: []*os.File{f}}}
+	var w io.Writer = f
+	if s.keys != nil {
+		key := make([]byte, dataKeySize)
+		iv := make([]byte, aes.BlockSize)
+		_, err := rand.Read(key)
+		if err == nil {
+			_, err = rand.Read(iv)
+		}
+		var stream cipher.Stream
+		if err == nil {
+			stream, err = stagingStream(key, iv, 0)
+		}
+		if err != nil {
+			staged.remove()
+			return nil, err
+		}
+		w = cipher.StreamWriter{S: stream, W: f}
+		staged.content.ReaderAt = &stagingReader{f: f, key: key, iv: iv}
+	}
+	// Los datos llegan en trozos pequeños
+	staged.w = bufio.NewWriterSize(w, 256*1024)
+	return staged, nil
+}
+
+func (st *stagedFile) Write(p []byte) (int, error) {
+	n, err := st.w.Write(p)
+	st.hasher.Write(p[:n])
+	st.written += int64(n)
+	return n, err
+}
+
+// Vuelca lo pendiente al disco y devuelve el SHA-256 de todo lo escrito
+func (st *stagedFile) flush() (string, error) {
+	if err := st.w.Flush(); err != nil {
+		return "", err
+	}
+	st.content.size = st.written
+	return hex.EncodeToString(st.hasher.Sum(nil)), nil
+}
+
+// Borra el temporal. El archivo sigue abierto para quien haya retenido el contenido, como
+// las réplicas que terminan en segundo plano, y se cierra con su último Close.
+func (st *stagedFile) remove() {
+	os.Remove(st.f.Name())
+	st.content.Close()
+}
+
+// Crea el directorio de temporales y borra los que dejaron escrituras interrumpidas
+func newStagingDirectory(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && isStagingName(entry.Name()) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+	return dir, nil
+}
+
+// Indica si dir es root o está dentro de él
+func isInsideDirectory(dir, root string) bool {
+	absDir, errDir := filepath.Abs(dir)
+	absRoot, errRoot := filepath.Abs(root)
+	if errDir != nil || errRoot != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Temporales de las escrituras atómicas (".<nombre>-<número>", ver stageFile). Los recorridos del
+// almacenamiento los ignoran: no son archivos de nadie y pueden estar a medias.
+var stagingNamePattern = regexp.MustCompile(`^\..+-[0-9]+$`)
+
+func isStagingName(name string) bool {
+	return stagingNamePattern.MatchString(name)
+}
+
+// Contenido original de un archivo almacenado, que se lee por partes sin cargarlo entero
+type storedContent struct {
+	io.ReaderAt
+	size int64
+	// Fecha de modificación en disco del archivo abierto, en nanosegundos
+	modTime int64
+	files   []*os.File
+	// Lectores que lo siguen usando además de quien lo abrió (ver retain)
+	readers atomic.Int32
+}
+
+// Contenido que ya está en memoria
+func memoryContent(data []byte) *storedContent {
+	return &storedContent{ReaderAt: bytes.NewReader(data), size: int64(len(data))}
+}
+
+// Mantiene el contenido abierto para un lector más, que debe llamar a Close al terminar. Los
+// archivos se cierran con el último Close, aunque quien lo abrió ya haya terminado.
+func (c *storedContent) retain() {
+	c.readers.Add(1)
+}
+
+func (c *storedContent) Close() error {
+	if c.readers.Add(-1) >= 0 {
+		return nil
+	}
+	var err error
+	for _, f := range c.files {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Lector secuencial desde el principio
+func (c *storedContent) reader() io.Reader {
+	return io.NewSectionReader(c, 0, c.size)
+}
+
+// SHA-256 del contenido, leyéndolo por partes
+func (c *storedContent) hash() (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, c.reader()); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Abre un archivo almacenado para leer su contenido original. Reemplazar el archivo
+// mientras tanto no afecta al contenido abierto.
+func (s *Server) openStoredFile(filePath string) (*storedContent, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	content := &storedContent{modTime: info.ModTime().UnixNano(), files: []*os.File{f}}
+	if err := s.decodeStoredContent(content, f, info.Size(), true); err != nil {
+		content.Close()
+		return nil, err
+	}
+	return content, nil
+}
+
+// Prepara la lectura del contenido de f según su cabecera
+func (s *Server) decodeStoredContent(content *storedContent, f *os.File, fileSize int64, allowBlob bool) error {
+	header, dataOffset, err := readEnvelopeHeaderFrom(io.NewSectionReader(f, 0, fileSize))
+	switch {
+	case err != nil:
+		return err
+	case header == nil:
+		content.ReaderAt, content.size = f, fileSize
+	case header.Blob != "":
+		// Los blobs nunca referencian otros blobs
+		if !allowBlob {
+			return errInvalidEnvelope
+		}
+		if s.blobs == nil {
+			return fmt.Errorf("el archivo referencia el blob %s pero no hay almacén de blobs", header.Blob)
+		}
+		if !isValidBlobHash(header.Blob) {
+			return fmt.Errorf("hash de blob inválido: %q", header.Blob)
+		}
+		blob, err := os.Open(s.blobs.path(header.Blob))
+		if err != nil {
+			return err
+		}
+		content.files = append(content.files, blob)
+		info, err := blob.Stat()
+		if err != nil {
+			return err
+		}
+		return s.decodeStoredContent(content, blob, info.Size(), false)
+	case header.SegmentSize > 0:
+		r, err := s.newSegmentReader(f, header, dataOffset, fileSize)
+		if err != nil {
+			return err
+		}
+		content.ReaderAt, content.size = r, header.Size
+	case header.Compression == "" && header.Encryption == "":
+		content.ReaderAt = io.NewSectionReader(f, dataOffset, fileSize-dataOffset)
+		content.size = fileSize - dataOffset
+	default:
+		return errInvalidEnvelope
+	}
+	return nil
+}
+
+// Lee el contenido original completo de un archivo almacenado
+func (s *Server) readStoredFile(filePath string) ([]byte, error) {
+	content, err := s.openStoredFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	data := make([]byte, content.size)
+	if err := readFullAt(content, data, 0); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Información de un archivo almacenado tal como la ve el cliente y como ocupa en disco
+type storedFileInfo struct {
+	size         int64
+	physicalSize int64
+	compression  string
+	encryption   string
+	blob         string
+}
+
+// Obtiene el tamaño lógico y físico de un archivo leyendo solo las cabeceras
+func (s *Server) statStoredFile(filePath string) (*storedFileInfo, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	stored := &storedFileInfo{size: info.Size(), physicalSize: info.Size()}
+	header, err := readEnvelopeHeader(filePath)
+	if err != nil || header == nil {
+		return stored, err
+	}
+	stored.size = header.Size
+	stored.compression = header.Compression
+	stored.encryption = header.Encryption
+	if header.Blob != "" && s.blobs != nil {
+		stored.blob = header.Blob
+		blobPath := s.blobs.path(header.Blob)
+		if blobInfo, err := os.Stat(blobPath); err == nil {
+			stored.physicalSize = blobInfo.Size()
+		}
+		if blobHeader, err := readEnvelopeHeader(blobPath); err == nil && blobHeader != nil {
+			stored.compression = blobHeader.Compression
+			stored.encryption = blobHeader.Encryption
+		}
+	}
+	return stored, nil
+}
+
+// Devuelve los blobs referenciados por los archivos bajo una ruta del disco
+func (s *Server) blobRefsUnder(fullPath string) map[string]string {
+	refs := make(map[string]string)
+	if s.blobs == nil {
+		return refs
+	}
+	filepath.WalkDir(fullPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if header, err := readEnvelopeHeader(path); err == nil && header != nil && header.Blob != "" {
+			refs[path] = header.Blob
+		}
+		return nil
+	})
+	return refs
+}
+
+// Libera las referencias de los archivos que ya no existen en disco tras borrar o mover
+func (s *Server) releaseMissingBlobRefs(refs map[string]string) {
+	for path, hash := range refs {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			s.blobs.release(hash)
+		}
+	}
+}
+
+// Renombra un archivo o directorio liberando el blob del destino si se sobrescribe
+func (s *Server) renameStoredPath(oldPath, newPath string) error {
+	overwritten := make(map[string]string)
+	if info, err := os.Stat(newPath); err == nil && info.Mode().IsRegular() {
+		overwritten = s.blobRefsUnder(newPath)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	for _, hash := range overwritten {
+		s.blobs.release(hash)
+	}
+	oldRel, errOld := filepath.Rel(rootDirectory, oldPath)
+	newRel, errNew := filepath.Rel(rootDirectory, newPath)
+	if errOld == nil && errNew == nil {
+		s.checksums.rename(indexKey(oldRel), indexKey(newRel))
+	}
+	return nil
+}
+
+// Configura el almacén de blobs y lanza su recolector de basura
+func (s *Server) initBlobStore(dir string) error {
+	blobs, err := newBlobStore(dir)
+	if err != nil {
+		return err
+	}
+	if err := blobs.rebuildRefs(rootDirectory); err != nil {
+		return err
+	}
+	s.blobs = blobs
+	go blobs.runGC(s.blobGCInterval)
+	return nil
+}
+
+// Estadísticas de uso del almacenamiento, incluyendo la tasa de deduplicación
+func (s *Server) StorageStats(ctx context.Context, req *pb.StorageStatsRequest) (*pb.StorageStatsResponse, error) {
+	resp := &pb.StorageStatsResponse{StorageMode: s.storageMode, Compression: s.compression}
+
+	// Para la tasa de deduplicación se comparan los bytes lógicos referenciados con los de los blobs únicos
+	var dedupLogical, uniqueLogical int64
+	seenBlobs := make(map[string]bool)
+	err := filepath.WalkDir(rootDirectory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		resp.FileCount++
+		resp.PhysicalBytes += info.Size()
+
+		stored, err := s.statStoredFile(path)
+		if err != nil {
+			slog.WarnContext(ctx, "No se pudo leer la cabecera", "path", path, "error", err)
+			resp.LogicalBytes += info.Size()
+			return nil
+		}
+		resp.LogicalBytes += stored.size
+		if stored.blob != "" {
+			dedupLogical += stored.size
+			if !seenBlobs[stored.blob] {
+				seenBlobs[stored.blob] = true
+				uniqueLogical += stored.size
+			}
+		}
+		if stored.compression != "" {
+			resp.CompressedFileCount++
+		}
+		if stored.encryption != "" {
+			resp.EncryptedFileCount++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, status.Errorf(codes.Internal, "Error recorriendo el almacenamiento: %v", err)
+	}
+
+	resp.DedupRatio = 1
+	if s.blobs != nil {
+		count, physical, reclaimable, err := s.blobs.usage()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Error recorriendo el almacén de blobs: %v", err)
+		}
+		resp.BlobCount = count
+		resp.PhysicalBytes += physical
+		resp.ReclaimableBytes = reclaimable
+		if uniqueLogical > 0 {
+			resp.DedupRatio = float64(dedupLogical) / float64(uniqueLogical)
+		}
+	}
+	return resp, nil
+}
+
+// Devuelve la información de un archivo o directorio con su tamaño lógico y físico
+func (s *Server) StatFile(ctx context.Context, req *pb.StatRequest) (*pb.StatResponse, error) {
+	fullPath := filepath.Join(rootDirectory, req.Path)
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "El archivo/directorio no existe")
+		}
+		return nil, status.Errorf(codes.Internal, "Error al obtener información del archivo: %v", err)
+	}
+
+	resp := &pb.StatResponse{
+		Path:    indexKey(req.Path),
+		Name:    info.Name(),
+		IsDir:   info.IsDir(),
+		ModTime: info.ModTime().Unix(),
+	}
+	if info.IsDir() {
+		return resp, nil
+	}
+
+	stored, err := s.statStoredFile(fullPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error al leer la cabecera del archivo: %v", err)
+	}
+	resp.Size = stored.size
+	resp.PhysicalSize = stored.physicalSize
+	resp.Compression = stored.compression
+	resp.Deduplicated = stored.blob != ""
+	resp.Encryption = stored.encryption
+
+	// El tipo MIME se saca de la extensión y, si no se conoce, del principio del contenido original
+	resp.FileType = mime.TypeByExtension(filepath.Ext(fullPath))
+	if resp.FileType == "" {
+		content, err := s.openStoredFile(fullPath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+		}
+		defer content.Close()
+		head := make([]byte, min(content.size, mimeSniffLength))
+		if err := readFullAt(content, head, 0); err != nil {
+			return nil, status.Errorf(codes.Internal, "Error al leer el archivo: %v", err)
+		}
+		resp.FileType = detectMimeType(fullPath, head)
+	}
+	return resp, nil
+}
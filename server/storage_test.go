@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testMasterKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// Nodo con todos sus directorios en un temporal del test. configure ajusta la configuración.
+func newTestServer(t *testing.T, configure func(*Config)) *Server {
+	t.Helper()
+	cfg := testConfig(t)
+	if configure != nil {
+		configure(&cfg)
+	}
+	if err := os.MkdirAll(cfg.Storage.Root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(cfg)
+}
+
+// Configuración con todos los directorios en un temporal del test
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Storage.Root = filepath.Join(dir, "root")
+	cfg.Storage.BlobDirectory = filepath.Join(dir, "blobs")
+	cfg.Storage.UploadDirectory = filepath.Join(dir, "uploads")
+	cfg.Storage.StagingDirectory = filepath.Join(dir, "staging")
+	cfg.Storage.ChecksumFile = filepath.Join(dir, "checksums.log")
+	cfg.Encryption.KeyDirectory = filepath.Join(dir, "keys")
+	cfg.Scrub.QuarantineDirectory = filepath.Join(dir, "quarantine")
+	cfg.Audit.File = filepath.Join(dir, "audit.log")
+	cfg.S3.MultipartDirectory = filepath.Join(dir, "s3")
+	return cfg
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Texto comprimible de n bytes
+func textBytes(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < n; i++ {
+		fmt.Fprintf(&buf, "línea %d del archivo de prueba\n", i)
+	}
+	return buf.Bytes()[:n]
+}
+
+var storageVariants = map[string]func(*Config){
+	"plain":          nil,
+	"gzip":           func(c *Config) { c.Storage.Compression = compressionGzip },
+	"encrypted":      func(c *Config) { c.Encryption.MasterKey = testMasterKey },
+	"encrypted-gzip": func(c *Config) { c.Encryption.MasterKey = testMasterKey; c.Storage.Compression = compressionGzip },
+	"dedup":          func(c *Config) { c.Storage.Mode = storageModeDedup },
+	"dedup-encrypted-gz": func(c *Config) {
+		c.Storage.Mode = storageModeDedup
+		c.Encryption.MasterKey = testMasterKey
+		c.Storage.Compression = compressionGzip
+	},
+}
+
+func TestStoredContentRoundTrip(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			files := map[string][]byte{
+				"empty.txt":  {},
+				"small.txt":  []byte("hola"),
+				"magic.dat":  append([]byte(envelopeMagic), "no es una cabecera"...),
+				"random.bin": randomBytes(t, 3*defaultSegmentSize+123),
+				"text.txt":   textBytes(5*defaultSegmentSize + 7),
+				"exact.txt":  textBytes(2 * defaultSegmentSize),
+			}
+			for fileName, data := range files {
+				filePath := filepath.Join(rootDirectory, fileName)
+				if err := s.writeStoredFile(filePath, data); err != nil {
+					t.Fatalf("%s: %v", fileName, err)
+				}
+				got, err := s.readStoredFile(filePath)
+				if err != nil {
+					t.Fatalf("%s: %v", fileName, err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("%s: el contenido leído no coincide", fileName)
+				}
+
+				content, err := s.openStoredFile(filePath)
+				if err != nil {
+					t.Fatalf("%s: %v", fileName, err)
+				}
+				if content.size != int64(len(data)) {
+					t.Fatalf("%s: tamaño %d, se esperaba %d", fileName, content.size, len(data))
+				}
+				// Rangos que empiezan y terminan dentro de segmentos distintos
+				for _, r := range [][2]int{{0, 1}, {1, 100}, {defaultSegmentSize - 10, 20}, {defaultSegmentSize, defaultSegmentSize + 5}, {len(data) - 3, 3}} {
+					off, n := r[0], r[1]
+					if off < 0 || off+n > len(data) {
+						continue
+					}
+					buf := make([]byte, n)
+					if err := readFullAt(content, buf, int64(off)); err != nil {
+						t.Fatalf("%s [%d, +%d): %v", fileName, off, n, err)
+					}
+					if !bytes.Equal(buf, data[off:off+n]) {
+						t.Fatalf("%s [%d, +%d): el rango no coincide", fileName, off, n)
+					}
+				}
+				if n, err := content.ReadAt(make([]byte, 1), content.size); n != 0 || err != io.EOF {
+					t.Fatalf("%s: leer al final devolvió %d, %v", fileName, n, err)
+				}
+				content.Close()
+			}
+		})
+	}
+}
+
+func TestSegmentsCompressOnlyWhenSmaller(t *testing.T) {
+	s := newTestServer(t, storageVariants["encrypted-gzip"])
+	filePath := filepath.Join(rootDirectory, "random.txt")
+	if err := s.writeStoredFile(filePath, randomBytes(t, 2*defaultSegmentSize)); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.statStoredFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.compression != "" || stored.encryption != encryptionAESGCM {
+		t.Fatalf("compresión %q y cifrado %q; se esperaba solo cifrado", stored.compression, stored.encryption)
+	}
+}
+
+func TestSegmentsDetectTampering(t *testing.T) {
+	s := newTestServer(t, storageVariants["encrypted"])
+	filePath := filepath.Join(rootDirectory, "data.bin")
+	data := randomBytes(t, 3*defaultSegmentSize)
+	if err := s.writeStoredFile(filePath, data); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Un byte cambiado en el último segmento
+	tampered := bytes.Clone(raw)
+	tampered[len(tampered)-1] ^= 1
+	if err := os.WriteFile(filePath, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+	content, err := s.openStoredFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	if err := readFullAt(content, make([]byte, 10), 0); err != nil {
+		t.Fatalf("el primer segmento no cambió y debería leerse: %v", err)
+	}
+	if err := readFullAt(content, make([]byte, 10), 2*defaultSegmentSize); err == nil {
+		t.Fatal("se leyó un segmento modificado sin error")
+	}
+
+	// Archivo truncado
+	if err := os.WriteFile(filePath, raw[:len(raw)-100], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.readStoredFile(filePath); err == nil {
+		t.Fatal("se leyó un archivo truncado sin error")
+	}
+}
+
+func TestStatFileType(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			png := append([]byte("\x89PNG\r\n\x1a\n"), randomBytes(t, 3*defaultSegmentSize)...)
+			files := map[string]struct {
+				data []byte
+				want string
+			}{
+				"texto":      {textBytes(2 * defaultSegmentSize), "text/plain; charset=utf-8"},
+				"imagen":     {png, "image/png"},
+				"vacío":      {nil, "text/plain; charset=utf-8"},
+				"tabla.json": {[]byte("no es json"), "application/json"},
+			}
+			for name, f := range files {
+				if err := s.writeStoredFile(filepath.Join(rootDirectory, name), f.data); err != nil {
+					t.Fatal(err)
+				}
+				resp, err := s.StatFile(context.Background(), &pb.StatRequest{Path: name})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.FileType != f.want || resp.Size != int64(len(f.data)) {
+					t.Fatalf("%s: tipo %q y tamaño %d, se esperaba %q y %d", name, resp.FileType, resp.Size, f.want, len(f.data))
+				}
+			}
+		})
+	}
+}
+
+func TestInitiateUploadMaxSize(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.Storage.MaxUploadSize = 1000 })
+	_, err := s.InitiateUpload(context.Background(), &pb.InitiateUploadRequest{Filename: "a.bin", TotalSize: 1001})
+	if status.Code(err) != codes.OutOfRange {
+		t.Fatalf("se esperaba OutOfRange, se obtuvo %v", err)
+	}
+	if _, err := s.InitiateUpload(context.Background(), &pb.InitiateUploadRequest{Filename: "a.bin", TotalSize: 1000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadPartOverwrite(t *testing.T) {
+	for name, configure := range map[string]func(*Config){"plain": nil, "encrypted": storageVariants["encrypted"]} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			ctx := context.Background()
+			data := randomBytes(t, 100)
+			session, err := s.InitiateUpload(ctx, &pb.InitiateUploadRequest{Filename: "a.bin", TotalSize: int64(len(data))})
+			if err != nil {
+				t.Fatal(err)
+			}
+			upload := func(start, end int, content []byte) error {
+				_, err := s.UploadPart(ctx, &pb.UploadPartRequest{SessionId: session.SessionId, Offset: int64(start), Content: content[start:end]})
+				return err
+			}
+			if err := upload(10, 60, data); err != nil {
+				t.Fatal(err)
+			}
+			// Repetir una parte, o solaparla con los mismos bytes, se acepta
+			if err := upload(10, 60, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := upload(0, 30, data); err != nil {
+				t.Fatal(err)
+			}
+
+			// Cambiar bytes ya recibidos no, aunque la mayor parte de la parte sea nueva
+			changed := bytes.Clone(data)
+			changed[59] ^= 0xff
+			for _, part := range [][2]int{{10, 60}, {59, 100}, {0, 100}} {
+				if err := upload(part[0], part[1], changed); status.Code(err) != codes.FailedPrecondition {
+					t.Fatalf("la parte [%d, %d) cambió bytes recibidos: %v", part[0], part[1], err)
+				}
+			}
+
+			if err := upload(30, 100, data); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CompleteUpload(ctx, &pb.CompleteUploadRequest{SessionId: session.SessionId, ChecksumSha256: contentHash(data)}); err != nil {
+				t.Fatal(err)
+			}
+			assertStored(t, s, "a.bin", data)
+		})
+	}
+}
+
+func TestCompleteUploadStreams(t *testing.T) {
+	for name, configure := range storageVariants {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, configure)
+			data := textBytes(4*defaultSegmentSize + 1)
+			ctx := context.Background()
+			session, err := s.InitiateUpload(ctx, &pb.InitiateUploadRequest{
+				Filename:       "subida.txt",
+				Directory:      "dir",
+				TotalSize:      int64(len(data)),
+				ChecksumSha256: contentHash(data),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Las partes llegan desordenadas
+			half := len(data) / 2
+			for _, part := range [][2]int{{half, len(data)}, {0, half}} {
+				if _, err := s.UploadPart(ctx, &pb.UploadPartRequest{SessionId: session.SessionId, Offset: int64(part[0]), Content: data[part[0]:part[1]]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := s.CompleteUpload(ctx, &pb.CompleteUploadRequest{SessionId: session.SessionId}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.readStoredFile(filepath.Join(rootDirectory, "dir", "subida.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("el archivo publicado no coincide con lo subido")
+			}
+			entries, err := os.ReadDir(s.stagingDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if !strings.HasPrefix(e.Name(), ".") {
+					continue
+				}
+				t.Fatalf("quedó un temporal en el directorio de preparación: %s", e.Name())
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"testing"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	memoryTracingOnce sync.Once
+	memorySpans       *tracetest.InMemoryExporter
+)
+
+// Guarda las trazas en memoria. El tracer del paquete queda enlazado con el primer proveedor
+// global que se configura, así que se instala una sola vez y cada test vacía el exportador.
+func setupInMemoryTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	memoryTracingOnce.Do(func() {
+		setupPropagation()
+		memorySpans = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(memorySpans)))
+	})
+	memorySpans.Reset()
+	return memorySpans
+}
+
+// Espera a que termine el span con ese nombre; los de otros nodos pueden cerrarse después
+// de que el cliente recibió la respuesta
+func waitSpan(t *testing.T, exp *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, span := range exp.GetSpans() {
+			if span.Name == name {
+				return span
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no se registró el span %s", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func spanAttribute(span tracetest.SpanStub, key string) attribute.Value {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingAcrossNodes(t *testing.T) {
+	exp := setupInMemoryTracing(t)
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(TracingUnaryInterceptor()),
+		grpc.ChainStreamInterceptor(TracingStreamInterceptor()),
+	}
+	peer := serveTestNode(t, newTestServer(t, func(c *Config) { c.Node.ID = "peer" }), opts...)
+	primary := newTestServer(t, func(c *Config) {
+		c.Node.ID = "primary"
+		c.Replication.Peers = []string{peer}
+	})
+	conn, err := grpc.NewClient(serveTestNode(t, primary, opts...), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = pb.NewFileSystemServiceClient(conn).UploadFile(context.Background(), &pb.UploadRequest{
+		Filename:      "traza.txt",
+		ContentBase64: base64.StdEncoding.EncodeToString(textBytes(1000)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := waitSpan(t, exp, "filesystem.FileSystemService/UploadFile")
+	if upload.SpanKind != trace.SpanKindServer {
+		t.Errorf("UploadFile: kind = %v, se esperaba server", upload.SpanKind)
+	}
+	if got := spanAttribute(upload, "rpc.method").AsString(); got != "UploadFile" {
+		t.Errorf("UploadFile: rpc.method = %q", got)
+	}
+	if got := spanAttribute(upload, "rpc.grpc.status_code").AsInt64(); got != int64(codes.OK) {
+		t.Errorf("UploadFile: rpc.grpc.status_code = %d", got)
+	}
+	traceID := upload.SpanContext.TraceID()
+
+	// Los pasos de la subida cuelgan del span de la RPC
+	write := waitSpan(t, exp, "storage.write")
+	replication := waitSpan(t, exp, "replication.write")
+	for _, span := range []tracetest.SpanStub{write, replication} {
+		if span.Parent.SpanID() != upload.SpanContext.SpanID() {
+			t.Errorf("%s no es hijo de UploadFile", span.Name)
+		}
+	}
+	if got := spanAttribute(replication, "confirmed").AsInt64(); got != 1 {
+		t.Errorf("replication.write: confirmed = %d, se esperaba 1", got)
+	}
+	push := waitSpan(t, exp, "replication.push")
+	if push.Parent.SpanID() != replication.SpanContext.SpanID() {
+		t.Error("replication.push no es hijo de replication.write")
+	}
+
+	// El par continúa la misma traza a partir de los metadatos de la llamada
+	replica := waitSpan(t, exp, "filesystem.FileSystemService/ReplicateFile")
+	if replica.SpanContext.TraceID() != traceID {
+		t.Errorf("ReplicateFile está en la traza %s, se esperaba %s", replica.SpanContext.TraceID(), traceID)
+	}
+	if !replica.Parent.IsRemote() || replica.Parent.SpanID() != push.SpanContext.SpanID() {
+		t.Error("ReplicateFile no es hijo remoto de replication.push")
+	}
+}
+
+func TestTracingInterceptorStatus(t *testing.T) {
+	exp := setupInMemoryTracing(t)
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/filesystem.FileSystemService/DownloadFile"}
+	_, err := TracingUnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Errorf(codes.NotFound, "El archivo no existe")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("el interceptor cambió el error: %v", err)
+	}
+
+	span := waitSpan(t, exp, "filesystem.FileSystemService/DownloadFile")
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("no se continuó la traza de traceparent: traza %s, padre %s", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+	if got := spanAttribute(span, "rpc.service").AsString(); got != "filesystem.FileSystemService" {
+		t.Errorf("rpc.service = %q", got)
+	}
+	if got := spanAttribute(span, "rpc.grpc.status_code").AsInt64(); got != int64(codes.NotFound) {
+		t.Errorf("rpc.grpc.status_code = %d, se esperaba %d", got, codes.NotFound)
+	}
+	if span.Status.Code != otelcodes.Error || span.Status.Description != "El archivo no existe" {
+		t.Errorf("estado = %+v, se esperaba error con el mensaje de la RPC", span.Status)
+	}
+}
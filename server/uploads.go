@@ -0,0 +1,650 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultUploadDirectory  = "uploads"
+	defaultUploadSessionTTL = 24 * time.Hour
+	defaultMaxUploadSize    = 64 << 30
+	uploadSessionFile       = "session.json"
+	uploadDataFile          = "data"
+	// Bytes iniciales que se leen para detectar el tipo MIME
+	mimeSniffLength = 512
+)
+
+// Rango de bytes recibido, [Start, End)
+type byteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Sesión de subida por partes. Se guarda en disco junto a los datos recibidos
+// para poder continuar después de reiniciar el nodo.
+type uploadSession struct {
+	ID        string      `json:"id"`
+	Filename  string      `json:"filename"`
+	Directory string      `json:"directory"`
+	TotalSize int64       `json:"total_size"`
+	Checksum  string      `json:"checksum_sha256,omitempty"`
+	Ranges    []byteRange `json:"ranges"`
+	Created   time.Time   `json:"created"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	// Con cifrado en reposo los datos parciales se guardan cifrados con AES-CTR
+	KeyID string `json:"key_id,omitempty"`
+	IV    []byte `json:"iv,omitempty"`
+
+	mu sync.Mutex
+	// Se marca cuando la sesión se completó o canceló, para rechazar partes que lleguen tarde
+	closed bool
+}
+
+type uploadManager struct {
+	dir string
+	ttl time.Duration
+	// Tamaño máximo de una sesión
+	maxSize  int64
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+var errUploadSessionNotFound = errors.New("la sesión de subida no existe o expiró")
+
+// Crea el gestor de sesiones y recupera las que quedaron en disco
+func newUploadManager(dir string, ttl time.Duration, maxSize int64) (*uploadManager, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	m := &uploadManager{dir: dir, ttl: ttl, maxSize: maxSize, sessions: make(map[string]*uploadSession)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), uploadSessionFile))
+		if err != nil {
+			slog.Warn("Sesión de subida inválida, se elimina", "session_id", entry.Name(), "error", err)
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		var session uploadSession
+		if err := json.Unmarshal(data, &session); err != nil || session.ID != entry.Name() {
+			slog.Warn("Sesión de subida inválida, se elimina", "session_id", entry.Name())
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		m.sessions[session.ID] = &session
+	}
+	if len(m.sessions) > 0 {
+		slog.Info("Sesiones de subida recuperadas", "sessions", len(m.sessions))
+	}
+	return m, nil
+}
+
+func (m *uploadManager) sessionDir(id string) string {
+	return filepath.Join(m.dir, id)
+}
+
+func (m *uploadManager) dataPath(id string) string {
+	return filepath.Join(m.dir, id, uploadDataFile)
+}
+
+func (m *uploadManager) create(session *uploadSession) error {
+	if err := os.MkdirAll(m.sessionDir(session.ID), 0700); err != nil {
+		return err
+	}
+	if err := m.save(session); err != nil {
+		os.RemoveAll(m.sessionDir(session.ID))
+		return err
+	}
+	m.mu.Lock()
+	m.sessions[session.ID] = session
+	m.mu.Unlock()
+	return nil
+}
+
+// Guarda los metadatos de la sesión. Debe llamarse con el candado de la sesión tomado.
+func (m *uploadManager) save(session *uploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.sessionDir(session.ID), uploadSessionFile), data, 0600)
+}
+
+func (m *uploadManager) get(id string) (*uploadSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, errUploadSessionNotFound
+	}
+	return session, nil
+}
+
+// Elimina la sesión y sus datos. Debe llamarse con el candado de la sesión tomado.
+func (m *uploadManager) remove(session *uploadSession) {
+	session.closed = true
+	m.mu.Lock()
+	delete(m.sessions, session.ID)
+	m.mu.Unlock()
+	if err := os.RemoveAll(m.sessionDir(session.ID)); err != nil {
+		slog.Warn("No se pudo eliminar la sesión de subida", "session_id", session.ID, "error", err)
+	}
+}
+
+// Elimina las sesiones que superaron su tiempo de vida
+func (m *uploadManager) expire() {
+	m.mu.Lock()
+	var expired []*uploadSession
+	for _, session := range m.sessions {
+		expired = append(expired, session)
+	}
+	m.mu.Unlock()
+
+	now := time.Now()
+	for _, session := range expired {
+		// Si la sesión está ocupada recibiendo datos no ha expirado
+		if !session.mu.TryLock() {
+			continue
+		}
+		if !session.closed && now.After(session.ExpiresAt) {
+			slog.Info("Sesión de subida expirada", "session_id", session.ID, "path", filepath.Join(session.Directory, session.Filename))
+			m.remove(session)
+		}
+		session.mu.Unlock()
+	}
+}
+
+// Claves de datos usadas por las sesiones abiertas
+func (m *uploadManager) keyIDs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for _, session := range m.sessions {
+		if session.KeyID != "" {
+			ids = append(ids, session.KeyID)
+		}
+	}
+	return ids
+}
+
+func (m *uploadManager) runExpiry() {
+	interval := m.ttl / 4
+	if interval > 10*time.Minute {
+		interval = 10 * time.Minute
+	}
+	for {
+		m.expire()
+		time.Sleep(interval)
+	}
+}
+
+// Agrega un rango a la lista, uniendo los que se solapan o se tocan
+func addByteRange(ranges []byteRange, r byteRange) []byteRange {
+	if r.End <= r.Start {
+		return ranges
+	}
+	ranges = append(ranges, r)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	merged := ranges[:1]
+	for _, current := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if current.Start <= last.End {
+			if current.End > last.End {
+				last.End = current.End
+			}
+			continue
+		}
+		merged = append(merged, current)
+	}
+	return merged
+}
+
+func (session *uploadSession) receivedBytes() int64 {
+	var total int64
+	for _, r := range session.Ranges {
+		total += r.End - r.Start
+	}
+	return total
+}
+
+func (session *uploadSession) isComplete() bool {
+	return session.receivedBytes() == session.TotalSize
+}
+
+func (session *uploadSession) toStatus() *pb.UploadStatus {
+	resp := &pb.UploadStatus{
+		SessionId:     session.ID,
+		Filename:      session.Filename,
+		Directory:     session.Directory,
+		TotalSize:     session.TotalSize,
+		ReceivedBytes: session.receivedBytes(),
+		ExpiresAt:     session.ExpiresAt.Unix(),
+		Complete:      session.isComplete(),
+	}
+	for _, r := range session.Ranges {
+		resp.ReceivedRanges = append(resp.ReceivedRanges, &pb.ByteRange{Start: r.Start, End: r.End})
+	}
+	return resp
+}
+
+// Flujo AES-CTR posicionado en un offset arbitrario del archivo de preparación
+func stagingStream(key, iv []byte, offset int64) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("IV inválido")
+	}
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, iv)
+	// Se suma el número de bloque al contador de 128 bits
+	low := binary.BigEndian.Uint64(counter[8:])
+	high := binary.BigEndian.Uint64(counter[:8])
+	blocks := uint64(offset / aes.BlockSize)
+	if low+blocks < low {
+		high++
+	}
+	binary.BigEndian.PutUint64(counter[8:], low+blocks)
+	binary.BigEndian.PutUint64(counter[:8], high)
+
+	stream := cipher.NewCTR(block, counter)
+	skip := make([]byte, offset%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	return stream, nil
+}
+
+// Datos de una sesión cifrada, descifrados al leerlos desde cualquier offset
+type stagingReader struct {
+	f   *os.File
+	key []byte
+	iv  []byte
+}
+
+func (r *stagingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.f.ReadAt(p, off)
+	if n > 0 {
+		stream, streamErr := stagingStream(r.key, r.iv, off)
+		if streamErr != nil {
+			return 0, streamErr
+		}
+		stream.XORKeyStream(p[:n], p[:n])
+	}
+	return n, err
+}
+
+// Indica si data, que va en offset, coincide con lo ya recibido en los rangos que se solapan. Los
+// datos cifrados de la sesión usan un único flujo AES-CTR: escribir otros bytes en el mismo
+// offset reutilizaría el flujo y revelaría la diferencia entre ambos contenidos.
+func sameAsReceived(ranges []byteRange, r io.ReaderAt, offset int64, data []byte) (bool, error) {
+	end := offset + int64(len(data))
+	for _, received := range ranges {
+		start, stop := max(received.Start, offset), min(received.End, end)
+		if start >= stop {
+			continue
+		}
+		existing := make([]byte, stop-start)
+		if err := readFullAt(r, existing, start); err != nil {
+			return false, err
+		}
+		if !bytes.Equal(existing, data[start-offset:stop-offset]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func uploadSessionError(err error) error {
+	if errors.Is(err, errUploadSessionNotFound) {
+		return status.Errorf(codes.NotFound, "La sesión de subida no existe o expiró")
+	}
+	return status.Errorf(codes.Internal, "Error en la sesión de subida: %v", err)
+}
+
+// Abre una sesión de subida por partes
+func (s *Server) InitiateUpload(ctx context.Context, req *pb.InitiateUploadRequest) (*pb.UploadStatus, error) {
+	if req.Filename == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "El nombre del archivo no puede estar vacío")
+	}
+	if req.TotalSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "El tamaño total no puede ser negativo")
+	}
+	if req.TotalSize > s.uploads.maxSize {
+		return nil, status.Errorf(codes.OutOfRange, "El archivo supera el tamaño máximo de subida (%d bytes)", s.uploads.maxSize)
+	}
+	checksum := strings.ToLower(req.ChecksumSha256)
+	if checksum != "" && !isValidBlobHash(checksum) {
+		return nil, status.Errorf(codes.InvalidArgument, "El checksum debe ser un SHA-256 en hexadecimal")
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error generando la sesión: %v", err)
+	}
+	now := time.Now()
+	session := &uploadSession{
+		ID:        hex.EncodeToString(idBytes),
+		Filename:  req.Filename,
+		Directory: req.Directory,
+		TotalSize: req.TotalSize,
+		Checksum:  checksum,
+		Created:   now,
+		ExpiresAt: now.Add(s.uploads.ttl),
+	}
+	if s.keys != nil {
+		keyID, _, err := s.keys.newDataKey()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Error generando la clave de la sesión: %v", err)
+		}
+		session.KeyID = keyID
+		session.IV = make([]byte, aes.BlockSize)
+		if _, err := rand.Read(session.IV); err != nil {
+			return nil, status.Errorf(codes.Internal, "Error generando la sesión: %v", err)
+		}
+	}
+
+	if err := s.uploads.create(session); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error creando la sesión de subida: %v", err)
+	}
+	slog.InfoContext(ctx, "Sesión de subida iniciada", "session_id", session.ID, "path", filepath.Join(req.Directory, req.Filename), "size", req.TotalSize)
+	return session.toStatus(), nil
+}
+
+// Escribe una parte en su offset. Repetir la misma parte no tiene efectos adicionales, pero una
+// parte no puede cambiar bytes ya recibidos.
+func (s *Server) UploadPart(ctx context.Context, req *pb.UploadPartRequest) (*pb.UploadStatus, error) {
+	session, err := s.uploads.get(req.SessionId)
+	if err != nil {
+		return nil, uploadSessionError(err)
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return nil, uploadSessionError(errUploadSessionNotFound)
+	}
+
+	end := req.Offset + int64(len(req.Content))
+	if req.Offset < 0 || end > session.TotalSize {
+		return nil, status.Errorf(codes.OutOfRange, "La parte [%d, %d) excede el tamaño total %d", req.Offset, end, session.TotalSize)
+	}
+
+	var key []byte
+	if session.KeyID != "" {
+		if key, err = s.keys.dataKey(session.KeyID); err != nil {
+			return nil, status.Errorf(codes.Internal, "Error obteniendo la clave de la sesión: %v", err)
+		}
+	}
+
+	f, err := os.OpenFile(s.uploads.dataPath(session.ID), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error abriendo los datos de la sesión: %v", err)
+	}
+	var received io.ReaderAt = f
+	if key != nil {
+		received = &stagingReader{f: f, key: key, iv: session.IV}
+	}
+	same, err := sameAsReceived(session.Ranges, received, req.Offset, req.Content)
+	if err != nil {
+		f.Close()
+		return nil, status.Errorf(codes.Internal, "Error leyendo los datos de la sesión: %v", err)
+	}
+	if !same {
+		f.Close()
+		return nil, status.Errorf(codes.FailedPrecondition, "La parte [%d, %d) cambia bytes ya recibidos", req.Offset, end)
+	}
+
+	content := req.Content
+	if key != nil {
+		stream, err := stagingStream(key, session.IV, req.Offset)
+		if err != nil {
+			f.Close()
+			return nil, status.Errorf(codes.Internal, "Error cifrando la parte: %v", err)
+		}
+		content = make([]byte, len(req.Content))
+		stream.XORKeyStream(content, req.Content)
+	}
+
+	if _, err := f.WriteAt(content, req.Offset); err != nil {
+		f.Close()
+		return nil, status.Errorf(codes.Internal, "Error escribiendo la parte: %v", err)
+	}
+	// Los datos deben estar en disco antes de marcarlos como recibidos
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, status.Errorf(codes.Internal, "Error escribiendo la parte: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error escribiendo la parte: %v", err)
+	}
+
+	session.Ranges = addByteRange(session.Ranges, byteRange{Start: req.Offset, End: end})
+	session.ExpiresAt = time.Now().Add(s.uploads.ttl)
+	if err := s.uploads.save(session); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error guardando la sesión: %v", err)
+	}
+	return session.toStatus(), nil
+}
+
+// Devuelve los rangos recibidos de una sesión
+func (s *Server) GetUploadStatus(ctx context.Context, req *pb.UploadSessionRequest) (*pb.UploadStatus, error) {
+	session, err := s.uploads.get(req.SessionId)
+	if err != nil {
+		return nil, uploadSessionError(err)
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return nil, uploadSessionError(errUploadSessionNotFound)
+	}
+	return session.toStatus(), nil
+}
+
+// Verifica el checksum y publica el archivo en su destino de forma atómica
+func (s *Server) CompleteUpload(ctx context.Context, req *pb.CompleteUploadRequest) (*pb.Response, error) {
+	session, err := s.uploads.get(req.SessionId)
+	if err != nil {
+		return nil, uploadSessionError(err)
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return nil, uploadSessionError(errUploadSessionNotFound)
+	}
+
+	if !session.isComplete() {
+		return nil, status.Errorf(codes.FailedPrecondition, "Faltan datos: recibidos %d de %d bytes", session.receivedBytes(), session.TotalSize)
+	}
+	checksum := strings.ToLower(req.ChecksumSha256)
+	switch {
+	case checksum == "":
+		checksum = session.Checksum
+	case session.Checksum != "" && checksum != session.Checksum:
+		return nil, status.Errorf(codes.InvalidArgument, "El checksum no coincide con el indicado al iniciar la subida")
+	}
+	if checksum == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Se requiere el checksum SHA-256 del archivo")
+	}
+
+	dataPath := s.uploads.dataPath(session.ID)
+	// Con tamaño 0 puede no haberse escrito nunca el archivo de datos
+	f, err := os.OpenFile(dataPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error abriendo los datos de la sesión: %v", err)
+	}
+	// Los datos se leen por partes desde el archivo de la sesión, descifrándolos si hace falta.
+	// El archivo se cierra cuando terminan también las réplicas que siguen en segundo plano.
+	content := &storedContent{ReaderAt: f, size: session.TotalSize, files: []*os.File{f}}
+	defer content.Close()
+	if session.KeyID != "" {
+		key, err := s.keys.dataKey(session.KeyID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Error obteniendo la clave de la sesión: %v", err)
+		}
+		content.ReaderAt = &stagingReader{f: f, key: key, iv: session.IV}
+	}
+
+	filePath := filepath.Join(rootDirectory, session.Directory, session.Filename)
+	relPath := filepath.Join(session.Directory, session.Filename)
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error creando directorio especificado: %v", err)
+	}
+
+	head := make([]byte, min(session.TotalSize, mimeSniffLength))
+	if err := readFullAt(content, head, 0); err != nil {
+		return nil, status.Errorf(codes.Internal, "Error leyendo los datos de la sesión: %v", err)
+	}
+	sum, err := content.hash()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error leyendo los datos de la sesión: %v", err)
+	}
+	if sum != checksum {
+		return nil, status.Errorf(codes.DataLoss, "El checksum de los datos recibidos no coincide")
+	}
+
+	existed := pathExists(filePath)
+	if session.KeyID == "" && s.storesAsIs(relPath, head) {
+		// Se guarda tal cual: basta con renombrar el archivo
+		if err := f.Chmod(0644); err != nil {
+			return nil, status.Errorf(codes.Internal, "Error preparando el archivo: %v", err)
+		}
+		_, span := startSpan(ctx, "storage.publish", attribute.String("path", filePath), attribute.Int64("size", session.TotalSize))
+		err := s.publishFile(dataPath, filePath, checksum, session.TotalSize)
+		endSpan(span, err)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Error publicando el archivo: %v", err)
+		}
+	} else {
+		_, span := startSpan(ctx, "storage.write", attribute.String("path", filePath), attribute.Int64("size", session.TotalSize))
+		err := s.writeStoredContent(filePath, content, session.TotalSize, checksum)
+		endSpan(span, err)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Error escribiendo archivo: %v", err)
+		}
+	}
+
+	mimeType := detectMimeType(session.Filename, head)
+	if s.index != nil {
+		s.index.updateFrom(relPath, content, mimeType)
+	}
+	s.uploads.remove(session)
+	slog.InfoContext(ctx, "Sesión de subida completada", "session_id", session.ID, "path", filePath)
+	s.publishWrite(relPath, existed, session.TotalSize)
+
+	resp := &pb.Response{
+		Message:  "Archivo subido correctamente",
+		FilePath: filePath,
+		FileName: session.Filename,
+		FileSize: session.TotalSize,
+		FileType: mimeType,
+		NodeId:   s.nodeID,
+	}
+
+	// Igual que en UploadFile, se espera el quórum de réplicas configurado en el nodo. El archivo
+	// de la sesión sigue abierto, así que las réplicas se envían desde él aunque ya se haya borrado.
+	peers, quorum, _ := s.replicationTargets(relPath, nil, 0)
+	replicaIDs, ok := s.replicateWrite(ctx, filePath, content, checksum, mimeType, peers, quorum)
+	resp.ReplicaNodeIds = replicaIDs
+	if !ok {
+		return nil, quorumError(resp, quorum)
+	}
+	return resp, nil
+}
+
+// Cancela una sesión y descarta los datos recibidos
+func (s *Server) AbortUpload(ctx context.Context, req *pb.UploadSessionRequest) (*pb.Response, error) {
+	session, err := s.uploads.get(req.SessionId)
+	if err != nil {
+		return nil, uploadSessionError(err)
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return nil, uploadSessionError(errUploadSessionNotFound)
+	}
+	s.uploads.remove(session)
+	slog.InfoContext(ctx, "Sesión de subida cancelada", "session_id", session.ID)
+	return &pb.Response{Message: "Subida cancelada"}, nil
+}
+
+// Recorre los datos de una sesión completa, ya descifrados, en bloques de hasta len(buf) bytes.
+// La sesión queda tomada mientras tanto, así que fn no puede usarla.
+func (s *Server) readUploadData(sessionID string, buf []byte, fn func([]byte) error) error {
+	session, err := s.uploads.get(sessionID)
+	if err != nil {
+		return uploadSessionError(err)
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.closed {
+		return uploadSessionError(errUploadSessionNotFound)
+	}
+	if !session.isComplete() {
+		return status.Errorf(codes.FailedPrecondition, "Faltan datos: recibidos %d de %d bytes", session.receivedBytes(), session.TotalSize)
+	}
+	if session.TotalSize == 0 {
+		return nil
+	}
+
+	var stream cipher.Stream
+	if session.KeyID != "" {
+		key, err := s.keys.dataKey(session.KeyID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Error obteniendo la clave de la sesión: %v", err)
+		}
+		if stream, err = stagingStream(key, session.IV, 0); err != nil {
+			return status.Errorf(codes.Internal, "Error descifrando la sesión: %v", err)
+		}
+	}
+	f, err := os.Open(s.uploads.dataPath(session.ID))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Error abriendo los datos de la sesión: %v", err)
+	}
+	defer f.Close()
+	data := io.LimitReader(f, session.TotalSize)
+	for {
+		n, err := io.ReadFull(data, buf)
+		if n > 0 {
+			if stream != nil {
+				stream.XORKeyStream(buf[:n], buf[:n])
+			}
+			if err := fn(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "Error leyendo los datos de la sesión: %v", err)
+		}
+	}
+}
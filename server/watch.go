@@ -0,0 +1,281 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Tipos de evento de cambios en el almacenamiento
+const (
+	eventCreated  = "created"
+	eventModified = "modified"
+	eventDeleted  = "deleted"
+	eventMoved    = "moved"
+	eventRenamed  = "renamed"
+)
+
+// Origen de los eventos
+const (
+	eventSourceRPC     = "rpc"
+	eventSourceInotify = "inotify"
+)
+
+const (
+	defaultWatchHistory = 10000
+	// Eventos pendientes por suscriptor antes de desconectarlo por lento
+	watchSubscriberBuffer = 256
+	// Tiempo durante el que inotify ignora las rutas que acaba de cambiar una RPC
+	rpcEventWindow = 2 * time.Second
+)
+
+var (
+	errWatchGap  = errors.New("los eventos pedidos ya no están disponibles")
+	errWatchSlow = errors.New("el suscriptor no leyó los eventos a tiempo")
+)
+
+type watchEvent struct {
+	Seq     uint64
+	Type    string
+	Path    string
+	OldPath string
+	IsDir   bool
+	Size    int64
+	Time    time.Time
+	Source  string
+}
+
+func (ev watchEvent) matches(prefix string) bool {
+	return isUnderPath(ev.Path, prefix) || (ev.OldPath != "" && isUnderPath(ev.OldPath, prefix))
+}
+
+func (ev watchEvent) toProto() *pb.WatchEvent {
+	return &pb.WatchEvent{
+		Sequence:  ev.Seq,
+		Type:      ev.Type,
+		Path:      ev.Path,
+		OldPath:   ev.OldPath,
+		IsDir:     ev.IsDir,
+		Size:      ev.Size,
+		Timestamp: ev.Time.UnixNano(),
+		Source:    ev.Source,
+	}
+}
+
+type watchSubscriber struct {
+	prefix string
+	ch     chan watchEvent
+	// Por qué se desconectó: errWatchSlow o errWatchGap
+	err error
+}
+
+// Reparte los eventos de cambios a los suscriptores y guarda los últimos para poder reanudar
+type eventHub struct {
+	mu      sync.Mutex
+	seq     uint64
+	history []watchEvent
+	size    int
+	subs    map[*watchSubscriber]struct{}
+	// Última secuencia publicada antes de perder eventos; no se puede reanudar desde ella ni antes
+	lostAt uint64
+	// Rutas cambiadas por RPC hace poco, para no repetir sus eventos desde inotify
+	recent map[string]recentChange
+}
+
+type recentChange struct {
+	at time.Time
+	// Borrar o mover un directorio también cambia todo lo que contiene
+	subtree bool
+}
+
+func newEventHub(size int) *eventHub {
+	return &eventHub{
+		// Se parte de la hora de arranque para que la secuencia siga creciendo entre reinicios;
+		// quien reanude con un número anterior al reinicio recibe errWatchGap
+		seq:    uint64(time.Now().UnixMicro()),
+		size:   size,
+		subs:   make(map[*watchSubscriber]struct{}),
+		recent: make(map[string]recentChange),
+	}
+}
+
+func (h *eventHub) publish(ev watchEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	ev.Seq = h.seq
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	h.history = append(h.history, ev)
+	if len(h.history) > 2*h.size {
+		h.history = append([]watchEvent(nil), h.history[len(h.history)-h.size:]...)
+	}
+
+	if ev.Source == eventSourceRPC {
+		change := recentChange{at: ev.Time, subtree: ev.IsDir && ev.Type != eventCreated}
+		h.recent[ev.Path] = change
+		if ev.OldPath != "" {
+			h.recent[ev.OldPath] = change
+		}
+	}
+
+	for sub := range h.subs {
+		if !ev.matches(sub.prefix) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			h.disconnect(sub, errWatchSlow)
+		}
+	}
+}
+
+// Registra que se perdieron eventos (por ejemplo, porque se llenó la cola de inotify) y
+// desconecta a todos los suscriptores, que tienen que volver a sincronizar
+func (h *eventHub) lost() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lostAt = h.seq
+	for sub := range h.subs {
+		h.disconnect(sub, errWatchGap)
+	}
+}
+
+func (h *eventHub) disconnect(sub *watchSubscriber, err error) {
+	sub.err = err
+	close(sub.ch)
+	delete(h.subs, sub)
+}
+
+// Indica si una ruta (o un directorio que la contiene) acaba de cambiar por una RPC
+func (h *eventHub) changedByRPC(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	found := false
+	for path, change := range h.recent {
+		if now.Sub(change.at) > rpcEventWindow {
+			delete(h.recent, path)
+			continue
+		}
+		if key == path || (change.subtree && isUnderPath(key, path)) {
+			found = true
+		}
+	}
+	return found
+}
+
+// Registra un suscriptor y devuelve los eventos posteriores a from que ya pasaron.
+// Con from en 0 solo se reciben los eventos nuevos.
+// También devuelve la última secuencia publicada al suscribirse.
+func (h *eventHub) subscribe(prefix string, from uint64) (*watchSubscriber, []watchEvent, uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var backlog []watchEvent
+	if from > 0 {
+		window := h.history[max(0, len(h.history)-h.size):]
+		oldest := h.seq + 1
+		if len(window) > 0 {
+			oldest = window[0].Seq
+		}
+		if from > h.seq || from+1 < oldest || from <= h.lostAt {
+			return nil, nil, h.seq, errWatchGap
+		}
+		for _, ev := range window {
+			if ev.Seq > from && ev.matches(prefix) {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	sub := &watchSubscriber{prefix: prefix, ch: make(chan watchEvent, watchSubscriberBuffer)}
+	h.subs[sub] = struct{}{}
+	return sub, backlog, h.seq, nil
+}
+
+func (h *eventHub) unsubscribe(sub *watchSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Publica un evento producido por una RPC
+func (s *Server) publishEvent(eventType, path, oldPath string, isDir bool, size int64) {
+	ev := watchEvent{Type: eventType, Path: indexKey(path), IsDir: isDir, Size: size, Source: eventSourceRPC}
+	if oldPath != "" {
+		ev.OldPath = indexKey(oldPath)
+	}
+	s.events.publish(ev)
+}
+
+// Publica la escritura de un archivo como creado o modificado según si ya existía
+func (s *Server) publishWrite(path string, existed bool, size int64) {
+	eventType := eventCreated
+	if existed {
+		eventType = eventModified
+	}
+	s.publishEvent(eventType, path, "", false, size)
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Emite los cambios bajo una ruta. Con from_sequence se reanuda después del último evento recibido.
+func (s *Server) WatchPath(req *pb.WatchRequest, stream pb.FileSystemService_WatchPathServer) error {
+	if _, err := resolveStoragePath(req.Path); err != nil {
+		return status.Errorf(codes.InvalidArgument, "Ruta inválida: %v", err)
+	}
+	sub, backlog, last, err := s.events.subscribe(indexKey(req.Path), req.FromSequence)
+	if err != nil {
+		return status.Errorf(codes.OutOfRange, "Los eventos posteriores a %d ya no están disponibles (último: %d); hay que volver a sincronizar",
+			req.FromSequence, last)
+	}
+	defer s.events.unsubscribe(sub)
+
+	// Confirma la suscripción con la última secuencia, para poder reanudar aunque todavía no llegue ningún evento
+	if err := stream.SendHeader(metadata.Pairs("x-watch-sequence", strconv.FormatUint(last, 10))); err != nil {
+		return err
+	}
+
+	for _, ev := range backlog {
+		if err := stream.Send(ev.toProto()); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-sub.ch:
+			if !ok {
+				switch sub.err {
+				case errWatchSlow:
+					return status.Errorf(codes.ResourceExhausted, "El suscriptor no leyó los eventos a tiempo; reanudar desde la última secuencia recibida")
+				case errWatchGap:
+					return status.Errorf(codes.OutOfRange, "Se perdieron eventos del almacenamiento; hay que volver a sincronizar")
+				}
+				return nil
+			}
+			if err := stream.Send(ev.toProto()); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+//go:build linux
+
+package server
+
+import (
+	"io/fs"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	inotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE |
+		unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF
+	// Espera antes de publicar un evento de inotify, para que la RPC que lo causó registre el suyo primero
+	inotifyDelay = 500 * time.Millisecond
+	// Marca en la cola de eventos que el kernel descartó eventos porque se llenó la suya
+	inotifyOverflow = "overflow"
+)
+
+// Observa el directorio raíz con inotify para detectar cambios hechos por fuera del servidor
+type inotifyWatcher struct {
+	fd      int
+	root    string
+	dirs    map[int]string // descriptor de watch -> ruta relativa del directorio
+	pending chan watchEvent
+	events  *eventHub
+}
+
+func (s *Server) startInotify() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	w := &inotifyWatcher{
+		fd:      fd,
+		root:    rootDirectory,
+		dirs:    make(map[int]string),
+		pending: make(chan watchEvent, 1024),
+		events:  s.events,
+	}
+	if err := w.addTree(""); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	go w.read()
+	go w.deliver()
+	return nil
+}
+
+// Agrega watches a un directorio y a todos sus subdirectorios
+func (w *inotifyWatcher) addTree(key string) error {
+	return filepath.WalkDir(filepath.Join(w.root, filepath.FromSlash(key)), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(w.root, p)
+		if err != nil {
+			return nil
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, p, inotifyMask)
+		if err != nil {
+			return err
+		}
+		w.dirs[wd] = indexKey(rel)
+		return nil
+	})
+}
+
+// Actualiza las rutas de los watches de un directorio movido
+func (w *inotifyWatcher) renameTree(oldKey, newKey string) {
+	for wd, key := range w.dirs {
+		if isUnderPath(key, oldKey) {
+			w.dirs[wd] = newKey + strings.TrimPrefix(key, oldKey)
+		}
+	}
+}
+
+func (w *inotifyWatcher) read() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			slog.Error("Error leyendo eventos de inotify", "error", err)
+			return
+		}
+
+		// Los MOVED_FROM sin su MOVED_TO en la misma lectura salieron del almacenamiento
+		movedFrom := make(map[uint32]watchEvent)
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(raw.Len)]
+			offset += unix.SizeofInotifyEvent + int(raw.Len)
+
+			if raw.Mask&unix.IN_Q_OVERFLOW != 0 {
+				// Los directorios creados mientras tanto tampoco tienen watch
+				w.addTree("")
+				w.pending <- watchEvent{Type: inotifyOverflow, Time: time.Now()}
+				continue
+			}
+			dir, ok := w.dirs[int(raw.Wd)]
+			if !ok {
+				continue
+			}
+			if raw.Mask&(unix.IN_DELETE_SELF|unix.IN_IGNORED) != 0 {
+				delete(w.dirs, int(raw.Wd))
+				continue
+			}
+			name := strings.TrimRight(string(nameBytes), "\x00")
+			if name == "" || isStagingName(name) {
+				continue
+			}
+			key := path.Join(dir, name)
+			isDir := raw.Mask&unix.IN_ISDIR != 0
+			ev := watchEvent{Path: key, IsDir: isDir, Time: time.Now(), Source: eventSourceInotify}
+
+			switch {
+			case raw.Mask&unix.IN_CREATE != 0:
+				if isDir {
+					w.addTree(key)
+				}
+				ev.Type = eventCreated
+			case raw.Mask&unix.IN_CLOSE_WRITE != 0:
+				ev.Type = eventModified
+			case raw.Mask&unix.IN_DELETE != 0:
+				ev.Type = eventDeleted
+			case raw.Mask&unix.IN_MOVED_FROM != 0:
+				movedFrom[raw.Cookie] = ev
+				continue
+			case raw.Mask&unix.IN_MOVED_TO != 0:
+				from, paired := movedFrom[raw.Cookie]
+				if !paired {
+					// Entró desde fuera del almacenamiento
+					if isDir {
+						w.addTree(key)
+					}
+					ev.Type = eventCreated
+					break
+				}
+				delete(movedFrom, raw.Cookie)
+				if isDir {
+					w.renameTree(from.Path, key)
+				}
+				ev.OldPath = from.Path
+				ev.Type = eventMoved
+				if path.Dir(from.Path) == path.Dir(key) {
+					ev.Type = eventRenamed
+				}
+			default:
+				continue
+			}
+			w.pending <- ev
+		}
+		for _, ev := range movedFrom {
+			ev.Type = eventDeleted
+			w.pending <- ev
+		}
+	}
+}
+
+// Publica los eventos en orden, descartando los que ya publicó la RPC que hizo el cambio
+func (w *inotifyWatcher) deliver() {
+	for ev := range w.pending {
+		if wait := time.Until(ev.Time.Add(inotifyDelay)); wait > 0 {
+			time.Sleep(wait)
+		}
+		if ev.Type == inotifyOverflow {
+			slog.Warn("Se llenó la cola de inotify; se perdieron eventos")
+			w.events.lost()
+			continue
+		}
+		if w.events.changedByRPC(ev.Path) || (ev.OldPath != "" && w.events.changedByRPC(ev.OldPath)) {
+			continue
+		}
+		w.events.publish(ev)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotifyIgnoresStaging(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.Storage.WatchInotify = true })
+	svc := newWatchClient(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, _ := watchPath(t, ctx, svc, "", 0)
+
+	// Solo los temporales de las escrituras atómicas se ignoran, no cualquier archivo oculto
+	for _, name := range []string{".a.txt-123456", ".oculto", "fin.txt"} {
+		if err := os.WriteFile(filepath.Join(rootDirectory, name), []byte("hola"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := make(map[string]bool)
+	for !seen["fin.txt"] {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Source != eventSourceInotify {
+			t.Fatalf("evento %v no viene de inotify", ev)
+		}
+		seen[ev.Path] = true
+	}
+	if seen[".a.txt-123456"] || !seen[".oculto"] {
+		t.Fatalf("eventos recibidos: %v", seen)
+	}
+}
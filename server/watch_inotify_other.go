@@ -0,0 +1,9 @@
+//go:build !linux
+
+package server
+
+import "errors"
+
+func (s *Server) startInotify() error {
+	return errors.New("inotify solo está disponible en Linux")
+}
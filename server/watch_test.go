@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	pb "filesystem/proto/filesystem"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func newWatchClient(t *testing.T, s *Server) pb.FileSystemServiceClient {
+	t.Helper()
+	conn, err := grpc.NewClient(serveTestNode(t, s), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewFileSystemServiceClient(conn)
+}
+
+// Se suscribe a path y devuelve el stream con la secuencia que confirmó el servidor
+func watchPath(t *testing.T, ctx context.Context, svc pb.FileSystemServiceClient, path string, from uint64) (pb.FileSystemService_WatchPathClient, uint64) {
+	t.Helper()
+	stream, err := svc.WatchPath(ctx, &pb.WatchRequest{Path: path, FromSequence: from})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := header.Get("x-watch-sequence")
+	if len(values) != 1 {
+		t.Fatalf("la suscripción no confirmó la secuencia: %v", header)
+	}
+	last, err := strconv.ParseUint(values[0], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream, last
+}
+
+// Recibe un evento y comprueba su tipo y su ruta
+func expectEvent(t *testing.T, stream pb.FileSystemService_WatchPathClient, eventType, path string) *pb.WatchEvent {
+	t.Helper()
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != eventType || ev.Path != path {
+		t.Fatalf("evento %s %s, se esperaba %s %s", ev.Type, ev.Path, eventType, path)
+	}
+	return ev
+}
+
+func expectWatchError(t *testing.T, stream pb.FileSystemService_WatchPathClient, code codes.Code) {
+	t.Helper()
+	ev, err := stream.Recv()
+	if status.Code(err) != code {
+		t.Fatalf("se esperaba %s, se obtuvo %v (evento %v)", code, err, ev)
+	}
+}
+
+func TestWatchPathResume(t *testing.T) {
+	s := newTestServer(t, nil)
+	svc := newWatchClient(t, s)
+	for _, dir := range []string{"dir", "otro"} {
+		os.MkdirAll(filepath.Join(rootDirectory, dir), 0755)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, _ := watchPath(t, ctx, svc, "dir", 0)
+	uploadBase64(t, s, "dir/a.txt", []byte("hola"))
+	uploadBase64(t, s, "otro/b.txt", []byte("fuera del prefijo"))
+	uploadBase64(t, s, "dir/c.txt", []byte("hola"))
+	received := expectEvent(t, stream, eventCreated, "dir/a.txt")
+	expectEvent(t, stream, eventCreated, "dir/c.txt")
+	cancel()
+
+	// Los cambios mientras no hay suscripción se reciben al reanudar, en orden
+	uploadBase64(t, s, "dir/a.txt", []byte("chau"))
+	uploadBase64(t, s, "otro/b.txt", []byte("sigue fuera"))
+	if _, err := s.DeleteFile(context.Background(), &pb.DeleteRequest{Path: "dir/c.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	stream, last := watchPath(t, ctx, svc, "dir", received.Sequence)
+	expectEvent(t, stream, eventCreated, "dir/c.txt")
+	expectEvent(t, stream, eventModified, "dir/a.txt")
+	deleted := expectEvent(t, stream, eventDeleted, "dir/c.txt")
+	if deleted.Sequence != last {
+		t.Fatalf("el último evento tiene la secuencia %d, la suscripción confirmó %d", deleted.Sequence, last)
+	}
+	// Y después siguen los nuevos
+	uploadBase64(t, s, "dir/d.txt", []byte("hola"))
+	if ev := expectEvent(t, stream, eventCreated, "dir/d.txt"); ev.Sequence <= last {
+		t.Fatalf("secuencia %d no posterior a %d", ev.Sequence, last)
+	}
+}
+
+func TestWatchPathGap(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.Storage.WatchHistory = 3 })
+	svc := newWatchClient(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, first := watchPath(t, ctx, svc, "", 0)
+	for i := range 5 {
+		uploadBase64(t, s, "a"+strconv.Itoa(i)+".txt", []byte("hola"))
+	}
+	_, last := watchPath(t, ctx, svc, "", 0)
+
+	// Reanudar desde un evento que ya salió del historial, o desde uno que no existe, es un hueco
+	for _, from := range []uint64{first, last - 4, last + 1} {
+		stream, err := svc.WatchPath(ctx, &pb.WatchRequest{FromSequence: from})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectWatchError(t, stream, codes.OutOfRange)
+	}
+	stream, _ := watchPath(t, ctx, svc, "", last-2)
+	expectEvent(t, stream, eventCreated, "a3.txt")
+	expectEvent(t, stream, eventCreated, "a4.txt")
+
+	// Si se pierden eventos, los suscriptores se desconectan y no se puede reanudar desde antes
+	s.events.lost()
+	expectWatchError(t, stream, codes.OutOfRange)
+	resumed, err := svc.WatchPath(ctx, &pb.WatchRequest{FromSequence: last})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectWatchError(t, resumed, codes.OutOfRange)
+
+	// Una suscripción nueva sí, y desde ella se puede reanudar
+	stream, _ = watchPath(t, ctx, svc, "", 0)
+	uploadBase64(t, s, "b.txt", []byte("hola"))
+	ev := expectEvent(t, stream, eventCreated, "b.txt")
+	uploadBase64(t, s, "c.txt", []byte("hola"))
+	stream, _ = watchPath(t, ctx, svc, "", ev.Sequence)
+	expectEvent(t, stream, eventCreated, "c.txt")
+}
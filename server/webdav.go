@@ -0,0 +1,467 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "filesystem/proto/filesystem"
+
+	"golang.org/x/net/webdav"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Servidor WebDAV sobre el almacenamiento del nodo, para montarlo como unidad de red.
+// Las descargas y los cambios se hacen con las mismas RPC que usan los clientes gRPC,
+// pasando por sus interceptores, así que ambos ven lo mismo; los listados y los
+// metadatos se leen directamente del disco.
+type davHandler struct {
+	server *Server
+	dav    *webdav.Handler
+}
+
+// Clave del contexto con el Content-Length de un PUT
+type davPutSizeKey struct{}
+
+// Crea el servidor WebDAV. Los interceptores deben ser los mismos que los del servidor gRPC.
+func (s *Server) NewWebDAVHandler(interceptors ...grpc.UnaryServerInterceptor) http.Handler {
+	// La raíz se crea con la primera subida, pero WebDAV la necesita desde el principio
+	if err := os.MkdirAll(rootDirectory, os.ModePerm); err != nil {
+		slog.Error("Error creando directorio raíz", "error", err)
+	}
+	s.reloadMu.Lock()
+	maxBufferedSize := int64(s.config.Node.MaxMessageSize)
+	s.reloadMu.Unlock()
+	return &davHandler{
+		server: s,
+		dav: &webdav.Handler{
+			FileSystem: &davFileSystem{server: s, interceptors: interceptors, maxBufferedSize: maxBufferedSize},
+			LockSystem: webdav.NewMemLS(),
+		},
+	}
+}
+
+// Atiende WebDAV en la dirección indicada, con TLS si el nodo lo usa
+func (s *Server) ServeWebDAV(address string, interceptors ...grpc.UnaryServerInterceptor) *http.Server {
+	return s.serveHTTP("Servidor WebDAV", address, "/", s.NewWebDAVHandler(interceptors...))
+}
+
+func (h *davHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Los clientes WebDAV no envían tokens Bearer: el token va como contraseña de Basic
+	if _, password, ok := r.BasicAuth(); ok {
+		r = r.Clone(r.Context())
+		r.Header.Set(authorizationKey, bearerPrefix+password)
+	}
+	ctx := httpCallContext(w, r)
+	if err := h.server.authenticate(ctx); err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="FileDepot"`)
+		http.Error(w, status.Convert(err).Message(), http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodPut && r.ContentLength >= 0 {
+		// Con el tamaño conocido el cuerpo se sube por partes a medida que llega
+		ctx = context.WithValue(ctx, davPutSizeKey{}, r.ContentLength)
+	}
+	h.dav.ServeHTTP(w, r.WithContext(ctx))
+}
+
+type davFileSystem struct {
+	server       *Server
+	interceptors []grpc.UnaryServerInterceptor
+	// Máximo que se junta en memoria de una escritura de tamaño desconocido
+	maxBufferedSize int64
+}
+
+// Ruta relativa y ruta en disco de un nombre WebDAV ("/a/b")
+func davPath(name string) (string, string, error) {
+	relPath := strings.TrimPrefix(path.Clean("/"+name), "/")
+	fullPath, err := resolveStoragePath(relPath)
+	if err != nil {
+		return "", "", os.ErrPermission
+	}
+	return relPath, fullPath, nil
+}
+
+// Traduce los errores de las RPC a los del sistema de archivos, que el paquete webdav
+// convierte en los códigos HTTP correspondientes
+func davError(err error) error {
+	switch status.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.NotFound:
+		return os.ErrNotExist
+	case codes.AlreadyExists:
+		return os.ErrExist
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return os.ErrPermission
+	}
+	return err
+}
+
+// El directorio padre tiene que existir, como en un sistema de archivos
+func davParentExists(fullPath string) error {
+	info, err := os.Stat(filepath.Dir(fullPath))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func (fsys *davFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	relPath, fullPath, err := davPath(name)
+	if err != nil {
+		return err
+	}
+	if relPath == "" || pathExists(fullPath) {
+		return os.ErrExist
+	}
+	if err := davParentExists(fullPath); err != nil {
+		return err
+	}
+	_, err = invokeUnary(ctx, fsys.interceptors, fsys.server, pb.FileSystemService_CreateDirectory_FullMethodName,
+		&pb.DirectoryRequest{Path: relPath}, fsys.server.CreateDirectory)
+	return davError(err)
+}
+
+func (fsys *davFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	relPath, fullPath, err := davPath(name)
+	if err != nil {
+		return nil, err
+	}
+	info, statErr := fsys.stat(fullPath)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) == 0 {
+		if statErr != nil {
+			return nil, statErr
+		}
+		return &davFile{fsys: fsys, ctx: ctx, relPath: relPath, fullPath: fullPath, info: info}, nil
+	}
+
+	// Escritura: con el tamaño conocido (un PUT con Content-Length) el contenido va a una sesión
+	// de subida a medida que llega; si no, se junta en memoria y se sube al cerrar
+	switch {
+	case relPath == "" || (statErr == nil && info.IsDir()):
+		return nil, os.ErrPermission
+	case statErr == nil && flag&os.O_EXCL != 0:
+		return nil, os.ErrExist
+	case statErr != nil && !errors.Is(statErr, fs.ErrNotExist):
+		return nil, statErr
+	case statErr != nil && flag&os.O_CREATE == 0:
+		return nil, statErr
+	}
+	if err := davParentExists(fullPath); err != nil {
+		return nil, err
+	}
+	f := &davFile{fsys: fsys, ctx: ctx, relPath: relPath, fullPath: fullPath, writing: true}
+	if size, ok := ctx.Value(davPutSizeKey{}).(int64); ok && flag&os.O_TRUNC != 0 {
+		f.upload = fsys.startUpload(ctx, relPath, size)
+		return f, nil
+	}
+	if statErr == nil && flag&os.O_TRUNC == 0 {
+		if info.Size() > fsys.maxBufferedSize {
+			return nil, status.Errorf(codes.InvalidArgument, "%s supera los %d bytes que se pueden modificar sin reemplazarlo", relPath, fsys.maxBufferedSize)
+		}
+		data, err := fsys.server.readStoredFile(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		f.buf.Write(data)
+	}
+	return f, nil
+}
+
+// Subida en curso de un archivo que se escribe por WebDAV
+type davUpload struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// Empieza a subir size bytes a relPath con una sesión de subida, como el PUT del gateway. Lo que
+// se escribe en pw se envía por partes; si la subida falla, las escrituras devuelven su error.
+func (fsys *davFileSystem) startUpload(ctx context.Context, relPath string, size int64) *davUpload {
+	pr, pw := io.Pipe()
+	upload := &davUpload{pw: pw, done: make(chan error, 1)}
+	dir, name := path.Split(relPath)
+	go func() {
+		_, _, err := streamUpload(ctx, fsys.interceptors, fsys.server, strings.TrimSuffix(dir, "/"), name, pr, size, "")
+		if err != nil {
+			pr.CloseWithError(err)
+		} else {
+			pr.Close()
+		}
+		upload.done <- err
+	}()
+	return upload
+}
+
+func (fsys *davFileSystem) RemoveAll(ctx context.Context, name string) error {
+	relPath, fullPath, err := davPath(name)
+	if err != nil {
+		return err
+	}
+	if relPath == "" {
+		return os.ErrPermission
+	}
+	if !pathExists(fullPath) {
+		return os.ErrNotExist
+	}
+	_, err = invokeUnary(ctx, fsys.interceptors, fsys.server, pb.FileSystemService_DeleteFile_FullMethodName,
+		&pb.DeleteRequest{Path: relPath}, fsys.server.DeleteFile)
+	return davError(err)
+}
+
+func (fsys *davFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldRel, _, err := davPath(oldName)
+	if err != nil {
+		return err
+	}
+	newRel, newFull, err := davPath(newName)
+	if err != nil {
+		return err
+	}
+	if oldRel == "" || newRel == "" {
+		return os.ErrPermission
+	}
+	if err := davParentExists(newFull); err != nil {
+		return err
+	}
+	_, err = invokeUnary(ctx, fsys.interceptors, fsys.server, pb.FileSystemService_MoveFile_FullMethodName,
+		&pb.MoveRequest{SourcePath: oldRel, DestinationPath: newRel}, fsys.server.MoveFile)
+	return davError(err)
+}
+
+func (fsys *davFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	_, fullPath, err := davPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.stat(fullPath)
+}
+
+// Datos de un archivo con su tamaño original, no el que ocupa en disco
+func (fsys *davFileSystem) stat(fullPath string) (os.FileInfo, error) {
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+	stored, err := fsys.server.statStoredFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return davFileInfo{FileInfo: info, size: stored.size}, nil
+}
+
+type davFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi davFileInfo) Size() int64 {
+	return fi.size
+}
+
+// El tipo se toma de la extensión, para no leer cada archivo al listar un directorio
+func (fi davFileInfo) ContentType(ctx context.Context) (string, error) {
+	if mimeType := mime.TypeByExtension(filepath.Ext(fi.Name())); mimeType != "" {
+		return mimeType, nil
+	}
+	return "application/octet-stream", nil
+}
+
+// Archivo o directorio abierto. El contenido de un archivo se abre recién al leerlo, así un
+// PROPFIND no lo abre, y se lee por partes.
+type davFile struct {
+	fsys     *davFileSystem
+	ctx      context.Context
+	relPath  string
+	fullPath string
+	info     os.FileInfo
+	content  *storedContent
+	reader   *io.SectionReader
+	// Entradas que faltan devolver en Readdir
+	entries []os.FileInfo
+	listed  bool
+	writing bool
+	upload  *davUpload
+	buf     bytes.Buffer
+	// Bytes escritos en upload
+	written int64
+	// Primer error de escritura; si lo hay, al cerrar no se sube nada
+	writeErr error
+}
+
+func (f *davFile) load() error {
+	if f.reader != nil {
+		return nil
+	}
+	if f.info.IsDir() {
+		return os.ErrInvalid
+	}
+	content, _, err := invokeDownload(f.ctx, f.fsys.interceptors, f.fsys.server, f.relPath)
+	if err != nil {
+		return davError(err)
+	}
+	f.content = content
+	f.reader = io.NewSectionReader(content, 0, content.size)
+	return nil
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if f.writing {
+		return 0, os.ErrInvalid
+	}
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Read(p)
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if f.writing {
+		// Solo se admite consultar la posición, que siempre es el final
+		if offset == 0 && (whence == io.SeekCurrent || whence == io.SeekEnd) {
+			return f.writtenSize(), nil
+		}
+		return 0, os.ErrInvalid
+	}
+	// Ir al final para conocer el tamaño, o volver al principio, no requiere abrir el archivo
+	if f.reader == nil && !f.info.IsDir() && offset == 0 {
+		switch whence {
+		case io.SeekEnd:
+			return f.info.Size(), nil
+		case io.SeekStart:
+			return 0, nil
+		}
+	}
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	if !f.writing {
+		return 0, os.ErrPermission
+	}
+	if f.upload != nil {
+		n, err := f.upload.pw.Write(p)
+		f.written += int64(n)
+		return n, err
+	}
+	if int64(f.buf.Len()+len(p)) > f.fsys.maxBufferedSize {
+		f.writeErr = status.Errorf(codes.InvalidArgument, "Sin Content-Length solo se aceptan archivos de hasta %d bytes", f.fsys.maxBufferedSize)
+	}
+	if f.writeErr != nil {
+		return 0, f.writeErr
+	}
+	return f.buf.Write(p)
+}
+
+// COPY escribe el destino con io.Copy desde el origen, sin Content-Length: como el tamaño del
+// origen se conoce, el destino se sube por partes en lugar de juntarse en memoria
+func (f *davFile) ReadFrom(r io.Reader) (int64, error) {
+	if src, ok := r.(*davFile); ok && f.writing && f.upload == nil && f.buf.Len() == 0 && !src.writing && !src.info.IsDir() {
+		f.upload = f.fsys.startUpload(f.ctx, f.relPath, src.info.Size())
+	}
+	return io.Copy(struct{ io.Writer }{f}, r)
+}
+
+func (f *davFile) writtenSize() int64 {
+	if f.upload != nil {
+		return f.written
+	}
+	return int64(f.buf.Len())
+}
+
+func (f *davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if f.writing || !f.info.IsDir() {
+		return nil, os.ErrInvalid
+	}
+	if !f.listed {
+		entries, err := os.ReadDir(f.fullPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			// Los temporales de las escrituras a medias no son archivos de nadie
+			if isStagingName(entry.Name()) {
+				continue
+			}
+			info, err := f.fsys.stat(filepath.Join(f.fullPath, entry.Name()))
+			if err != nil {
+				continue
+			}
+			f.entries = append(f.entries, info)
+		}
+		f.listed = true
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *davFile) Stat() (fs.FileInfo, error) {
+	if f.writing {
+		return davWriteInfo{name: path.Base(f.relPath), size: f.writtenSize()}, nil
+	}
+	return f.info, nil
+}
+
+// Al cerrar un archivo escrito se completa su subida. Si llegaron menos bytes de los
+// anunciados, la sesión se descarta y el archivo no cambia.
+func (f *davFile) Close() error {
+	if !f.writing {
+		if content := f.content; content != nil {
+			f.content, f.reader = nil, nil
+			return content.Close()
+		}
+		return nil
+	}
+	f.writing = false
+	if f.upload != nil {
+		f.upload.pw.Close()
+		return davError(<-f.upload.done)
+	}
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+	dir, name := path.Split(f.relPath)
+	_, _, err := streamUpload(f.ctx, f.fsys.interceptors, f.fsys.server, strings.TrimSuffix(dir, "/"), name, bytes.NewReader(f.buf.Bytes()), int64(f.buf.Len()), "")
+	return davError(err)
+}
+
+// Datos de un archivo que se está escribiendo y todavía no se subió
+type davWriteInfo struct {
+	name string
+	size int64
+}
+
+func (fi davWriteInfo) Name() string       { return fi.name }
+func (fi davWriteInfo) Size() int64        { return fi.size }
+func (fi davWriteInfo) Mode() fs.FileMode  { return 0644 }
+func (fi davWriteInfo) ModTime() time.Time { return time.Now() }
+func (fi davWriteInfo) IsDir() bool        { return false }
+func (fi davWriteInfo) Sys() any           { return nil }
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// PUT por WebDAV; con chunked el cuerpo va sin Content-Length
+func davPut(h http.Handler, name string, body io.Reader, contentLength int64) int {
+	r := httptest.NewRequest(http.MethodPut, name, body)
+	r.ContentLength = contentLength
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestWebDAVPut(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.Node.MaxMessageSize = 1 << 20
+		c.Encryption.MasterKey = testMasterKey
+	})
+	h := s.NewWebDAVHandler()
+	filePath := filepath.Join(rootDirectory, "a.bin")
+	large := randomBytes(t, 3*gatewayPartSize+17)
+
+	// Con Content-Length se sube por partes, aunque supere lo que se junta en memoria
+	if code := davPut(h, "/a.bin", bytes.NewReader(large), int64(len(large))); code != http.StatusCreated {
+		t.Fatalf("PUT devolvió %d", code)
+	}
+	got, err := s.readStoredFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, large) {
+		t.Fatal("el archivo subido no coincide")
+	}
+
+	// Un cuerpo más corto que lo anunciado no reemplaza el archivo
+	if code := davPut(h, "/a.bin", bytes.NewReader(large[:1000]), int64(len(large))); code == http.StatusCreated {
+		t.Fatal("se aceptó un cuerpo incompleto")
+	}
+	// Sin Content-Length solo se aceptan archivos pequeños
+	if code := davPut(h, "/a.bin", bytes.NewReader(large), -1); code == http.StatusCreated {
+		t.Fatal("se aceptó sin Content-Length un archivo mayor que el límite")
+	}
+	if got, err := s.readStoredFile(filePath); err != nil || !bytes.Equal(got, large) {
+		t.Fatalf("una subida rechazada modificó el archivo (%v)", err)
+	}
+
+	small := []byte("contenido pequeño")
+	if code := davPut(h, "/b.txt", bytes.NewReader(small), -1); code != http.StatusCreated {
+		t.Fatalf("PUT sin Content-Length devolvió %d", code)
+	}
+	if got, err := s.readStoredFile(filepath.Join(rootDirectory, "b.txt")); err != nil || !bytes.Equal(got, small) {
+		t.Fatalf("el archivo subido sin Content-Length no coincide (%v)", err)
+	}
+	if code := davPut(h, "/vacío.txt", bytes.NewReader(nil), 0); code != http.StatusCreated {
+		t.Fatalf("PUT vacío devolvió %d", code)
+	}
+
+	// No quedan sesiones de las subidas descartadas
+	entries, err := os.ReadDir(s.uploads.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("quedaron %d sesiones de subida", len(entries))
+	}
+}
+
+func TestWebDAVGetCopy(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.Node.MaxMessageSize = 1 << 20
+		c.Encryption.MasterKey = testMasterKey
+	})
+	h := s.NewWebDAVHandler()
+	large := randomBytes(t, 3*gatewayPartSize+17)
+	if code := davPut(h, "/a.bin", bytes.NewReader(large), int64(len(large))); code != http.StatusCreated {
+		t.Fatalf("PUT devolvió %d", code)
+	}
+
+	// GET y COPY leen el archivo por partes, aunque supere el tamaño máximo de mensaje
+	if w := gatewayRequest(h, http.MethodGet, "/a.bin", nil); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), large) {
+		t.Fatalf("GET devolvió %d con %d bytes", w.Code, w.Body.Len())
+	}
+	w := gatewayRequest(h, http.MethodGet, "/a.bin", nil, "Range", "bytes=2000000-2000009")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), large[2000000:2000010]) {
+		t.Fatalf("Range devolvió %d con %d bytes", w.Code, w.Body.Len())
+	}
+	if w := gatewayRequest(h, "COPY", "/a.bin", nil, "Destination", "/copia.bin"); w.Code != http.StatusCreated {
+		t.Fatalf("COPY devolvió %d: %s", w.Code, w.Body)
+	}
+	assertStored(t, s, "copia.bin", large)
+}
+
+func TestWebDAVReaddir(t *testing.T) {
+	s := newTestServer(t, nil)
+	h := s.NewWebDAVHandler()
+	for _, name := range []string{"/visible.txt", "/.oculto"} {
+		if code := davPut(h, name, bytes.NewReader([]byte("hola")), 4); code != http.StatusCreated {
+			t.Fatalf("PUT %s devolvió %d", name, code)
+		}
+	}
+	// Un temporal de una escritura a medias
+	if err := os.WriteFile(filepath.Join(rootDirectory, ".visible.txt-123"), []byte("ho"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := gatewayRequest(h, "PROPFIND", "/", nil, "Depth", "1")
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND devolvió %d", w.Code)
+	}
+	listing := w.Body.String()
+	for name, want := range map[string]bool{"/visible.txt<": true, "/.oculto<": true, "/.visible.txt-123<": false} {
+		if got := strings.Contains(listing, name); got != want {
+			t.Errorf("%s en el listado: %v, se esperaba %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Pool de workers que atiende las llamadas unarias. La cantidad de workers y el
+// tamaño de la cola se pueden cambiar en caliente.
+type workerPool struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	queue    []func()
+	// Valores configurados
+	workers   int
+	queueSize int
+	// Workers vivos; si hay más que los configurados, los que sobran terminan al quedar libres
+	running int
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	p := &workerPool{}
+	p.notEmpty = sync.NewCond(&p.mu)
+	p.notFull = sync.NewCond(&p.mu)
+	p.resize(workers, queueSize)
+	return p
+}
+
+// Cambia la cantidad de workers y el tamaño de la cola. Las tareas ya encoladas no se pierden.
+func (p *workerPool) resize(workers, queueSize int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.workers = workers
+	p.queueSize = queueSize
+	for p.running < p.workers {
+		p.running++
+		p.wg.Add(1)
+		go p.work(p.running)
+	}
+	// Despierta a los que sobran para que terminen, y a quienes esperan lugar en la cola
+	p.notEmpty.Broadcast()
+	p.notFull.Broadcast()
+}
+
+func (p *workerPool) work(id int) {
+	defer p.wg.Done()
+	slog.Debug("Worker iniciado", "worker", id)
+	defer slog.Debug("Worker detenido", "worker", id)
+	p.mu.Lock()
+	for {
+		for len(p.queue) == 0 && !p.closed && p.running <= p.workers {
+			p.notEmpty.Wait()
+		}
+		if p.running > p.workers || (p.closed && len(p.queue) == 0) {
+			p.running--
+			p.mu.Unlock()
+			return
+		}
+		task := p.queue[0]
+		p.queue = p.queue[1:]
+		p.notFull.Signal()
+		p.mu.Unlock()
+		task()
+		p.mu.Lock()
+	}
+}
+
+// Encola una tarea; bloquea mientras la cola esté llena. Devuelve false si el pool está cerrado.
+func (p *workerPool) submit(task func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.queue) >= p.queueSize && !p.closed {
+		p.notFull.Wait()
+	}
+	if p.closed {
+		return false
+	}
+	p.queue = append(p.queue, task)
+	p.notEmpty.Signal()
+	return true
+}
+
+// Termina las tareas encoladas y detiene los workers
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	p.closed = true
+	p.notEmpty.Broadcast()
+	p.notFull.Broadcast()
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// Interceptor que ejecuta cada llamada unaria en el pool de workers
+func (s *Server) WorkerPoolInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var resp any
+		var err error
+		done := make(chan struct{})
+
+		// Tiempo en cola hasta que un worker toma la petición
+		_, wait := startSpan(ctx, "workers.wait")
+		queued := s.workers.submit(func() {
+			wait.End()
+			resp, err = handler(ctx, req)
+			close(done)
+		})
+		if !queued {
+			wait.End()
+			return nil, status.Errorf(codes.Unavailable, "El servidor se está deteniendo")
+		}
+		<-done
+		return resp, err
+	}
+}
+
+// Espera a que terminen las llamadas encoladas y detiene los workers
+func (s *Server) StopWorkers() {
+	s.workers.stop()
+}